@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertOver, alertWebhook and alertSlack are the -alert-over, -alert-webhook
+// and -alert-slack flags
+var (
+	alertOver    string
+	alertWebhook string
+	alertSlack   string
+)
+
+// noLimit marks an AlertThreshold limit that -alert-over didn't set
+const noLimit = -1
+
+// AlertThreshold is how many open ports a scan may find before it alerts:
+// on any one host, in total, or both
+type AlertThreshold struct {
+	Host  int
+	Total int
+}
+
+// ParseAlertOver parses -alert-over: a number of open ports any host may
+// have, or comma-separated limits such as "host=5,total=50"
+func ParseAlertOver(spec string) (*AlertThreshold, error) {
+	t := &AlertThreshold{Host: noLimit, Total: noLimit}
+	if n, err := strconv.Atoi(spec); err == nil && n >= 0 {
+		t.Host = n
+		return t, nil
+	}
+	for _, limit := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(limit), "=")
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("-alert-over: %q is not N, host=N or total=N", limit)
+		}
+		switch name {
+		case "host":
+			t.Host = n
+		case "total":
+			t.Total = n
+		default:
+			return nil, fmt.Errorf("-alert-over: unknown limit %q (supported: host, total)", name)
+		}
+	}
+	return t, nil
+}
+
+// String formats a threshold the way ParseAlertOver reads it
+func (t *AlertThreshold) String() string {
+	var limits []string
+	if t.Host != noLimit {
+		limits = append(limits, "host="+strconv.Itoa(t.Host))
+	}
+	if t.Total != noLimit {
+		limits = append(limits, "total="+strconv.Itoa(t.Total))
+	}
+	return strings.Join(limits, ",")
+}
+
+// HostExposure is a host with more open ports than an AlertThreshold allows
+type HostExposure struct {
+	Host string `json:"host"`
+	IP   string `json:"ip"`
+	Open int    `json:"open"`
+}
+
+// ExposureAlert reports a scan that found more open ports than its
+// threshold allows
+type ExposureAlert struct {
+	Time      time.Time      `json:"time"`
+	Threshold string         `json:"threshold"`
+	Open      int            `json:"open"`            // open ports found in all
+	OverTotal bool           `json:"over_total"`      // Open exceeds the total limit
+	Hosts     []HostExposure `json:"hosts,omitempty"` // hosts over the per-host limit
+}
+
+// Check counts the open ports of results, each address and port once, and
+// returns an alert when a limit is exceeded, or nil
+func (t *AlertThreshold) Check(results []Result) *ExposureAlert {
+	seen := make(map[string]bool)
+	counts := make(map[string]*HostExposure)
+	var order []*HostExposure
+	open := 0
+	for _, r := range results {
+		if r.State != StateOpen || seen[r.Key()] {
+			continue
+		}
+		seen[r.Key()] = true
+		open++
+		h := counts[r.IP]
+		if h == nil {
+			h = &HostExposure{Host: r.Host, IP: r.IP}
+			counts[r.IP] = h
+			order = append(order, h)
+		}
+		h.Open++
+	}
+
+	alert := &ExposureAlert{Time: time.Now(), Threshold: t.String(), Open: open}
+	alert.OverTotal = t.Total != noLimit && open > t.Total
+	for _, h := range order {
+		if t.Host != noLimit && h.Open > t.Host {
+			alert.Hosts = append(alert.Hosts, *h)
+		}
+	}
+	if !alert.OverTotal && len(alert.Hosts) == 0 {
+		return nil
+	}
+	return alert
+}
+
+// Summary renders the alert as plain text
+func (a ExposureAlert) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pscanner: open ports over -alert-over %s", a.Threshold)
+	if a.OverTotal {
+		fmt.Fprintf(&b, "\n%d open port(s) in total", a.Open)
+	}
+	for _, h := range a.Hosts {
+		host := h.IP
+		if h.Host != h.IP {
+			host = fmt.Sprintf("%s (%s)", h.Host, h.IP)
+		}
+		fmt.Fprintf(&b, "\n%s: %d open port(s)", host, h.Open)
+	}
+	return b.String()
+}
+
+// WriteExposure prints an alert after the scan summary
+func WriteExposure(w io.Writer, a *ExposureAlert) {
+	if a == nil {
+		return
+	}
+	fmt.Fprintf(w, "\n=== Alert ===\n%s\n", strings.TrimPrefix(a.Summary(), "pscanner: "))
+}
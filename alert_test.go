@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAlertOver(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *AlertThreshold
+		wantErr bool
+	}{
+		{spec: "5", want: &AlertThreshold{Host: 5, Total: noLimit}},
+		{spec: "0", want: &AlertThreshold{Host: 0, Total: noLimit}},
+		{spec: "total=50", want: &AlertThreshold{Host: noLimit, Total: 50}},
+		{spec: "host=3, total=40", want: &AlertThreshold{Host: 3, Total: 40}},
+		{spec: "-1", wantErr: true},
+		{spec: "host=", wantErr: true},
+		{spec: "ports=5", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseAlertOver(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAlertOver(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAlertOver(%q) = %+v, expected %+v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertThresholdCheck(t *testing.T) {
+	results := []Result{
+		{Host: "web", IP: "10.0.0.1", Port: 80},
+		{Host: "web", IP: "10.0.0.1", Port: 443},
+		{Host: "web", IP: "10.0.0.1", Port: 443},
+		{Host: "web", IP: "10.0.0.1", Port: 23, State: StateClosed},
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 53},
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 53, Transport: "udp"},
+		{Host: "10.0.0.3", IP: "10.0.0.3", Port: 22},
+	}
+	tests := []struct {
+		name      string
+		threshold AlertThreshold
+		overTotal bool
+		hosts     []HostExposure
+	}{
+		{name: "Within limits", threshold: AlertThreshold{Host: 2, Total: 5}},
+		{name: "Host over", threshold: AlertThreshold{Host: 1, Total: noLimit},
+			hosts: []HostExposure{{Host: "web", IP: "10.0.0.1", Open: 2}, {Host: "10.0.0.2", IP: "10.0.0.2", Open: 2}}},
+		{name: "Total over", threshold: AlertThreshold{Host: noLimit, Total: 4}, overTotal: true},
+		{name: "No limits", threshold: AlertThreshold{Host: noLimit, Total: noLimit}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := tt.threshold.Check(results)
+			if !tt.overTotal && tt.hosts == nil {
+				if alert != nil {
+					t.Errorf("Check() = %+v, expected no alert", alert)
+				}
+				return
+			}
+			if alert == nil {
+				t.Fatal("Check() = nil, expected an alert")
+			}
+			if alert.Open != 5 || alert.OverTotal != tt.overTotal || !reflect.DeepEqual(alert.Hosts, tt.hosts) {
+				t.Errorf("Check() = %+v, expected 5 open, over total %v, hosts %+v", alert, tt.overTotal, tt.hosts)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"time"
+)
+
+// The -audit-log and -audit-chain flags
+var (
+	auditFile  string
+	auditChain bool
+)
+
+// AuditEntry records one scan in the audit log: who ran it, when, against
+// what and with which result. With -audit-chain each entry carries the hash
+// of the one before it, so removing or editing an entry breaks the chain.
+type AuditEntry struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	User    string    `json:"user"`
+	Machine string    `json:"machine"`
+	Version string    `json:"version"`
+	Args    []string  `json:"args"`
+	Targets string    `json:"targets,omitempty"` // fingerprint of the expanded targets
+	Hosts   int       `json:"hosts"`
+	Ports   int       `json:"ports"`
+	Scanned int       `json:"scanned"`
+	Open    int       `json:"open"`
+	Exit    int       `json:"exit"`
+
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// newAuditEntry starts the entry for a scan run with args
+func newAuditEntry(args []string) *AuditEntry {
+	e := &AuditEntry{Start: time.Now().UTC(), Version: currentBuild().Version, Args: args}
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	} else {
+		e.User = os.Getenv("USER")
+	}
+	e.Machine, _ = os.Hostname()
+	return e
+}
+
+// chainHash is the hash an entry is sealed with: SHA-256 over the previous
+// entry's hash and the entry's JSON without its own hash
+func (e AuditEntry) chainHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	io.WriteString(h, e.Prev+"\n")
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lastAuditHash returns the hash of the last entry in an audit log
+func lastAuditHash(f *os.File) (string, error) {
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil || last == nil {
+		return "", err
+	}
+	var e AuditEntry
+	if err := json.Unmarshal(last, &e); err != nil {
+		return "", fmt.Errorf("last entry: %v", err)
+	}
+	return e.Hash, nil
+}
+
+// AppendAudit adds an entry to the audit log as a JSON line, chained to the
+// previous entry when chain is set. The log is only ever appended to.
+func AppendAudit(filename string, e *AuditEntry, chain bool) error {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeAudit(f, e, chain)
+}
+
+// writeAudit is AppendAudit to an audit log already open for reading and
+// appending
+func writeAudit(f *os.File, e *AuditEntry, chain bool) error {
+	if chain {
+		var err error
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if e.Prev, err = lastAuditHash(f); err != nil {
+			return err
+		}
+		if e.Hash, err = e.chainHash(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// VerifyAudit checks the hash chain of an audit log, returning the number of
+// entries. Entries written without -audit-chain cannot be checked and reset
+// the chain.
+func VerifyAudit(r io.Reader) (entries, chained int, err error) {
+	prev := ""
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var e AuditEntry
+		if err := json.Unmarshal(data, &e); err != nil {
+			return entries, chained, fmt.Errorf("line %d: %v", line, err)
+		}
+		entries++
+		if e.Hash == "" {
+			prev = ""
+			continue
+		}
+		if e.Prev != prev {
+			return entries, chained, fmt.Errorf("line %d: chain broken, an entry before it was removed or changed", line)
+		}
+		if sum, err := e.chainHash(); err != nil || sum != e.Hash {
+			return entries, chained, fmt.Errorf("line %d: entry was modified", line)
+		}
+		chained++
+		prev = e.Hash
+	}
+	return entries, chained, scanner.Err()
+}
+
+// runAudit implements the "audit" subcommand, which verifies an audit log
+func runAudit(args []string) int {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner audit log-file\n\n"+
+			"Verifies the hash chain of an audit log written with -audit-log and -audit-chain\n")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitError
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	defer f.Close()
+	entries, chained, err := VerifyAudit(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	fmt.Printf("%s: %d entries, %d of them hash-chained and intact\n", flags.Arg(0), entries, chained)
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAppendAudit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	for i, chain := range []bool{true, true, true, false} {
+		e := newAuditEntry([]string{"-h", "10.0.0.1"})
+		e.Open = i
+		if err := AppendAudit(filename, e, chain); err != nil {
+			t.Fatalf("AppendAudit() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filename); info.Mode().Perm() != 0o600 {
+		t.Errorf("audit log mode = %v, expected 0600", info.Mode().Perm())
+	}
+	entries, chained, err := VerifyAudit(strings.NewReader(string(data)))
+	if err != nil || entries != 4 || chained != 3 {
+		t.Fatalf("VerifyAudit() = %d, %d, %v, expected 4, 3, nil", entries, chained, err)
+	}
+
+	lines := strings.SplitAfter(string(data), "\n")
+	tests := []struct {
+		name string
+		log  string
+		want string
+	}{
+		{name: "Edited", log: strings.Replace(string(data), `"open":1`, `"open":5`, 1), want: "line 2: entry was modified"},
+		{name: "Removed", log: lines[0] + lines[2], want: "line 2: chain broken"},
+		{name: "Reordered", log: lines[1] + lines[0], want: "line 1: chain broken"},
+		{name: "Replayed", log: lines[0] + lines[1] + lines[0], want: "line 3: chain broken"},
+		{name: "Garbage", log: "not json\n", want: "line 1:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := VerifyAudit(strings.NewReader(tt.log))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("VerifyAudit() error = %v, expected %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunScanAudit(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	defer func() { auditFile, auditChain = "", false }()
+
+	code := runScan([]string{"-h", "127.0.0.1", "-p", "1", "-r", "1", "-s", "0", "-q", "-yes", "-audit-log", filename, "-audit-chain"}, nil)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("no audit log written: %v", err)
+	}
+	for _, want := range []string{`"args":["-h","127.0.0.1"`, `"hosts":1`, `"ports":1`, `"exit":` + strconv.Itoa(code), `"hash":"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("audit entry %s is missing %s", data, want)
+		}
+	}
+}
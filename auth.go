@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// errOutOfScope is returned when a target isn't covered by an API key's scope
+var errOutOfScope = errors.New("target outside allowed ranges")
+
+// APIKey is a credential accepted by server mode along with its restrictions
+type APIKey struct {
+	Name    string   `json:"name"`
+	Key     string   `json:"key"`
+	Allow   []string `json:"allow"`    // CIDRs the key may scan; empty allows any target
+	MaxRate int      `json:"max_rate"` // maximum ports per second, 0 for unlimited
+
+	nets []*net.IPNet
+}
+
+// LoadAPIKeys reads a JSON array of API keys from a file
+func LoadAPIKeys(filename string) ([]*APIKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("invalid API keys file: %v", err)
+	}
+	// Scans belong to the name of the key that submitted them, so two keys
+	// sharing one would see each other's
+	names := make(map[string]bool)
+	for _, k := range keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("API key with an empty name")
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("API key name %q is used more than once", k.Name)
+		}
+		names[k.Name] = true
+		if k.Key == "" {
+			return nil, fmt.Errorf("API key %q has an empty key", k.Name)
+		}
+		for _, cidr := range k.Allow {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("API key %q: invalid CIDR %s", k.Name, cidr)
+			}
+			k.nets = append(k.nets, ipnet)
+		}
+	}
+	return keys, nil
+}
+
+// Permits reports whether the key may scan an address
+func (k *APIKey) Permits(ip net.IP) bool {
+	if len(k.nets) == 0 {
+		return true
+	}
+	for _, ipnet := range k.nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve checks that the key may scan every host and returns the address to
+// probe for each, along with the names those addresses stand for. A name is
+// looked up once, here, and every one of its addresses on network must be in
+// scope; the scan then probes the first, so neither a name with several
+// addresses nor one that changes before it is probed can reach outside the
+// scope. Keys without a scope leave the hosts as they are.
+func (k *APIKey) Resolve(ctx context.Context, hosts []string, network string) ([]string, map[string]string, error) {
+	if len(k.nets) == 0 {
+		return hosts, nil, nil
+	}
+	addrs := make([]string, 0, len(hosts))
+	names := make(map[string]string)
+	for _, host := range hosts {
+		if ip := parseHostIP(host); ip != nil {
+			if !k.Permits(ip) {
+				return nil, nil, fmt.Errorf("%w: %s (API key %q)", errOutOfScope, host, k.Name)
+			}
+			addrs = append(addrs, host)
+			continue
+		}
+		found, err := lookupHost(ctx, host)
+		if found = filterFamily(found, network); err == nil && len(found) == 0 {
+			err = errors.New("no addresses to probe")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to resolve host %s: %v", host, err)
+		}
+		for _, addr := range found {
+			if !k.Permits(net.ParseIP(addr)) {
+				return nil, nil, fmt.Errorf("%w: %s resolves to %s (API key %q)", errOutOfScope, host, addr, k.Name)
+			}
+		}
+		addrs = append(addrs, found[0])
+		names[found[0]] = host
+	}
+	return addrs, names, nil
+}
+
+type apiKeyContextKey struct{}
+
+// keyFromContext returns the API key that authenticated a request, if any
+func keyFromContext(ctx context.Context) *APIKey {
+	k, _ := ctx.Value(apiKeyContextKey{}).(*APIKey)
+	return k
+}
+
+// lookupKey finds the API key matching a presented secret
+func (s *Server) lookupKey(secret string) *APIKey {
+	var found *APIKey
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(k.Key), []byte(secret)) == 1 {
+			found = k
+		}
+	}
+	return found
+}
+
+// requestKey returns the API key a request presents, or nil without a valid
+// one
+func (s *Server) requestKey(r *http.Request) *APIKey {
+	secret := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		secret = bearer
+	}
+	if secret == "" {
+		secret = r.URL.Query().Get("key")
+	}
+	return s.lookupKey(secret)
+}
+
+// Authenticate rejects requests without a valid API key when keys are
+// configured. The key is taken from "Authorization: Bearer", "X-API-Key",
+// or the "key" query parameter (for EventSource clients).
+func (s *Server) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.keys) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key := s.requestKey(r)
+		if key == nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// LoadServerTLS builds the server's TLS configuration. When clientCA is set,
+// clients must present a certificate signed by it (mutual TLS).
+func LoadServerTLS(certFile, keyFile, clientCA string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCA != "" {
+		pem, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func writeKeysFile(t *testing.T, keys string) string {
+	filename := t.TempDir() + "/keys.json"
+	if err := os.WriteFile(filename, []byte(keys), 0600); err != nil {
+		t.Fatalf("Failed to create keys file: %v", err)
+	}
+	return filename
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name:    "Valid keys",
+			content: `[{"name": "ci", "key": "secret", "allow": ["10.0.0.0/8"], "max_rate": 100}]`,
+			wantErr: false,
+		},
+		{
+			name:    "Empty key",
+			content: `[{"name": "ci", "key": ""}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid CIDR",
+			content: `[{"name": "ci", "key": "secret", "allow": ["10.0.0.0"]}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Empty name",
+			content: `[{"key": "secret"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Duplicate name",
+			content: `[{"name": "ci", "key": "one"}, {"name": "ci", "key": "two"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "Invalid JSON",
+			content: `{"name": "ci"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadAPIKeys(writeKeysFile(t, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadAPIKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyResolve(t *testing.T) {
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		switch name {
+		case "inside.example.com":
+			return []string{"192.168.1.7", "127.0.0.1"}, nil
+		case "straddling.example.com":
+			return []string{"192.168.1.8", "10.1.2.3"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	keys, err := LoadAPIKeys(writeKeysFile(t, `[{"name": "lab", "key": "k", "allow": ["127.0.0.0/8", "192.168.1.0/24"]}]`))
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		host       string
+		addr       string
+		outOfScope bool
+	}{
+		{name: "Address in range", host: "192.168.1.20", addr: "192.168.1.20"},
+		{name: "Name with every address in range", host: "inside.example.com", addr: "192.168.1.7"},
+		{name: "Address out of range", host: "10.1.2.3", outOfScope: true},
+		{name: "Name with an address out of range", host: "straddling.example.com", outOfScope: true},
+		{name: "Name that does not resolve", host: "missing.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, names, err := keys[0].Resolve(context.Background(), []string{tt.host}, "tcp")
+			if tt.addr == "" {
+				if err == nil {
+					t.Fatalf("Resolve(%s) = %v, expected an error", tt.host, addrs)
+				}
+				if errors.Is(err, errOutOfScope) != tt.outOfScope {
+					t.Errorf("Resolve(%s) error = %v, out of scope %v", tt.host, err, tt.outOfScope)
+				}
+				return
+			}
+			if err != nil || len(addrs) != 1 || addrs[0] != tt.addr {
+				t.Fatalf("Resolve(%s) = %v, %v, expected %s", tt.host, addrs, err, tt.addr)
+			}
+			if tt.addr != tt.host && names[tt.addr] != tt.host {
+				t.Errorf("Resolve(%s) names = %v, expected %s for %s", tt.host, names, tt.host, tt.addr)
+			}
+		})
+	}
+
+	unscoped := &APIKey{Name: "any"}
+	if addrs, _, err := unscoped.Resolve(context.Background(), []string{"anything.example.com"}, "tcp"); err != nil || addrs[0] != "anything.example.com" {
+		t.Errorf("Resolve() without a scope = %v, %v, expected the host unchanged", addrs, err)
+	}
+}
+
+func TestServerAuthentication(t *testing.T) {
+	keys, err := LoadAPIKeys(writeKeysFile(t, `[
+		{"name": "alice", "key": "alice-key", "allow": ["192.0.2.0/24"], "max_rate": 50},
+		{"name": "bob", "key": "bob-key"}
+	]`))
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	server := NewServer(quickProbe)
+	server.keys = keys
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	do := func(method, path, key string, body any) *http.Response {
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, _ := http.NewRequest(method, ts.URL+path, &buf)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s error = %v", method, path, err)
+		}
+		return resp
+	}
+
+	if resp := do("GET", "/api/scans", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request without key = %d, expected 401", resp.StatusCode)
+	}
+	if resp := do("GET", "/api/scans", "wrong", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("request with wrong key = %d, expected 401", resp.StatusCode)
+	}
+	if resp := do("GET", "/", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("web UI without key = %d, expected 200", resp.StatusCode)
+	}
+
+	req := ScanRequest{Hosts: []string{"198.51.100.1"}, Ports: "80"}
+	if resp := do("POST", "/api/scans", "alice-key", req); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("out-of-scope scan = %d, expected 403", resp.StatusCode)
+	}
+
+	req = ScanRequest{Hosts: []string{"192.0.2.1"}, Ports: "80", Rate: 1000}
+	resp := do("POST", "/api/scans", "alice-key", req)
+	var status JobStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("in-scope scan = %d, expected 201", resp.StatusCode)
+	}
+	job := server.Job(status.ID, nil)
+	defer job.cancel()
+	if job.Owner != "alice" || job.Request.Rate != 50 {
+		t.Errorf("job owner = %q rate = %d, expected alice capped at 50", job.Owner, job.Request.Rate)
+	}
+
+	if resp := do("GET", "/api/scans/"+status.ID, "bob-key", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("other key's scan = %d, expected 404", resp.StatusCode)
+	}
+	if resp := do("GET", "/api/scans/"+status.ID+"?key=alice-key", "", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("own scan with query key = %d, expected 200", resp.StatusCode)
+	}
+}
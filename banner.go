@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxBanner caps how much of a banner is kept
+const maxBanner = 512
+
+// wellKnownServices names the service usually found on a port, for open
+// ports whose banner does not say
+var wellKnownServices = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 53: "dns", 80: "http", 110: "pop3",
+	111: "rpcbind", 135: "msrpc", 139: "netbios-ssn", 143: "imap", 389: "ldap", 443: "https",
+	445: "smb", 465: "smtps", 587: "submission", 636: "ldaps", 993: "imaps", 995: "pop3s",
+	1433: "mssql", 1521: "oracle", 2049: "nfs", 3306: "mysql", 3389: "rdp", 5432: "postgresql",
+	5900: "vnc", 6379: "redis", 8080: "http", 8443: "https", 9200: "elasticsearch",
+	11211: "memcached", 27017: "mongodb",
+}
+
+// BannerGrabber is an enricher that reads what an open port says first and
+// names its service. Ports that wait for the client, such as HTTP, are sent
+// a HEAD request.
+type BannerGrabber struct {
+	Timeout time.Duration
+}
+
+// Enrich fills in the banner and service of a result
+func (g BannerGrabber) Enrich(r *Result, probe ProbeConfig) {
+	r.Banner = grabBanner(r.Host, r.Port, probe, g.Timeout)
+	r.Service = serviceFromBanner(r.Banner)
+	if r.Service == "" {
+		r.Service = wellKnownServices[r.Port]
+	}
+	if info, ok := parseSSHBanner(r.Banner); ok {
+		r.Service, r.SSH = "ssh", &info
+		r.Product, r.Version = splitProduct(info.Software)
+	} else if r.Service == "ftp" {
+		r.Product, r.Version = ftpProduct(r.Banner)
+	} else if r.Service == "smtp" {
+		r.Product, r.Version = smtpProduct(r.Banner)
+	}
+}
+
+// grabBanner connects to a port and returns the start of what it sends,
+// with invalid UTF-8 replaced, or "" when it says nothing
+func grabBanner(host string, port int, probe ProbeConfig, wait time.Duration) string {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+
+	buf := make([]byte, maxBanner)
+	conn.SetDeadline(time.Now().Add(wait))
+	n, _ := conn.Read(buf)
+	if n == 0 {
+		conn.SetDeadline(time.Now().Add(wait))
+		if _, err := conn.Write([]byte("HEAD / HTTP/1.0\r\nHost: " + host + "\r\n\r\n")); err != nil {
+			return ""
+		}
+		n, _ = conn.Read(buf)
+	}
+	return strings.ToValidUTF8(strings.TrimSpace(string(buf[:n])), "�")
+}
+
+// serviceFromBanner recognizes the common protocols that announce themselves
+func serviceFromBanner(banner string) string {
+	upper := strings.ToUpper(banner)
+	switch {
+	case strings.HasPrefix(banner, "SSH-"):
+		return "ssh"
+	case strings.HasPrefix(banner, "HTTP/"):
+		return "http"
+	case strings.HasPrefix(banner, "RFB "):
+		return "vnc"
+	case strings.HasPrefix(banner, "+OK"):
+		return "pop3"
+	case strings.HasPrefix(banner, "* OK"):
+		return "imap"
+	case strings.HasPrefix(banner, "220") && strings.Contains(upper, "FTP"):
+		return "ftp"
+	case strings.HasPrefix(banner, "220") && (strings.Contains(upper, "SMTP") || strings.Contains(upper, "MAIL")):
+		return "smtp"
+	}
+	return ""
+}
+
+// serviceFindings are the notes on a service worth an operator's attention,
+// such as an FTP server taking anonymous logins
+func serviceFindings(r Result) []string {
+	var notes []string
+	if r.SSH != nil && strings.HasPrefix(r.SSH.Protocol, "1.") {
+		notes = append(notes, "accepts SSH 1")
+	}
+	if r.FTP != nil && r.FTP.Anonymous {
+		notes = append(notes, "anonymous login allowed")
+	}
+	if r.SMTP != nil && !r.SMTP.StartTLS {
+		notes = append(notes, "no STARTTLS")
+	}
+	if r.SMTP != nil && r.SMTP.Relay != nil && *r.SMTP.Relay {
+		notes = append(notes, "accepted a relay recipient (possible open relay)")
+	}
+	if r.Database != nil && r.Database.Auth == "trust" {
+		notes = append(notes, "no password required")
+	}
+	if r.Cache != nil && r.Cache.Unauthenticated {
+		notes = append(notes, "answers without authentication")
+	}
+	if r.SMB != nil && !r.SMB.SigningRequired {
+		notes = append(notes, "SMB signing not required")
+	}
+	if r.RDP != nil && !r.RDP.NLARequired {
+		notes = append(notes, "allows connections without NLA")
+	}
+	if r.TLS != nil && r.TLS.Audit != nil {
+		if deprecated := r.TLS.Audit.Deprecated; len(deprecated) > 0 {
+			notes = append(notes, "deprecated "+strings.Join(deprecated, ", "))
+		}
+		if weak := len(r.TLS.Audit.Weak); weak > 0 {
+			notes = append(notes, fmt.Sprintf("%d weak cipher suite(s)", weak))
+		}
+	}
+	if r.DNS != nil && r.DNS.Recursion {
+		notes = append(notes, "resolves queries for anyone (open resolver)")
+	}
+	if r.NTP != nil && r.NTP.Monlist {
+		notes = append(notes, "answers monlist (usable for amplification)")
+	}
+	if r.HTTP != nil && len(r.HTTP.WebSockets) > 0 {
+		notes = append(notes, "WebSocket on "+strings.Join(r.HTTP.WebSockets, ", "))
+	}
+	for _, h := range r.Hints {
+		notes = append(notes, fmt.Sprintf("may be affected by %s (unverified)", cmp.Or(strings.Join(h.References, ", "), h.ID)))
+	}
+	if r.SNMP != nil {
+		notes = append(notes, fmt.Sprintf("SNMP community %q accepted", r.SNMP.Community))
+	}
+	return notes
+}
+
+// WriteServices lists the open ports whose software was identified or that
+// have findings, one line each
+func WriteServices(w io.Writer, results []Result) {
+	results = append([]Result(nil), results...)
+	sortResults(results)
+	var tw *tabwriter.Writer
+	for _, r := range results {
+		notes := serviceFindings(r)
+		if r.State != StateOpen || r.Product == "" && len(notes) == 0 {
+			continue
+		}
+		address := net.JoinHostPort(r.IP, strconv.Itoa(r.Port))
+		if r.Transport != "" {
+			address += "/" + r.Transport
+		}
+		if tw == nil {
+			fmt.Fprintf(w, "\n=== Services ===\n")
+			tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "ADDRESS\tSERVICE\tSOFTWARE\tFINDINGS\n")
+		}
+		software := strings.TrimSpace(r.Product + " " + r.Version)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", address, cmp.Or(r.Service, "-"), cmp.Or(software, "-"), cmp.Or(strings.Join(notes, "; "), "-"))
+	}
+	if tw != nil {
+		tw.Flush()
+	}
+}
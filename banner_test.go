@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServiceFromBanner(t *testing.T) {
+	tests := []struct {
+		banner   string
+		expected string
+	}{
+		{"SSH-2.0-OpenSSH_9.6", "ssh"},
+		{"HTTP/1.0 200 OK\r\nServer: nginx", "http"},
+		{"220 ProFTPD Server ready", "ftp"},
+		{"220 mail.example.com ESMTP Postfix", "smtp"},
+		{"+OK Dovecot ready.", "pop3"},
+		{"* OK [CAPABILITY IMAP4rev1] ready", "imap"},
+		{"RFB 003.008", "vnc"},
+		{"220 welcome", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := serviceFromBanner(tt.banner); got != tt.expected {
+			t.Errorf("serviceFromBanner(%q) = %q, expected %q", tt.banner, got, tt.expected)
+		}
+	}
+}
+
+func TestBannerGrabber(t *testing.T) {
+	ssh, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ssh.Close()
+	go func() {
+		for {
+			conn, err := ssh.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6 Debian-1\r\n"))
+			conn.Close()
+		}
+	}()
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test-server")
+	}))
+	defer web.Close()
+
+	grabber := BannerGrabber{Timeout: 200 * time.Millisecond}
+	tests := []struct {
+		name    string
+		addr    net.Addr
+		service string
+		banner  string
+	}{
+		{name: "Talks first", addr: ssh.Addr(), service: "ssh", banner: "SSH-2.0-OpenSSH_9.6"},
+		{name: "Waits for a request", addr: web.Listener.Addr(), service: "http", banner: "Server: test-server"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: tt.addr.(*net.TCPAddr).Port}
+			grabber.Enrich(&r, ProbeConfig{})
+			if r.Service != tt.service || !strings.Contains(r.Banner, tt.banner) {
+				t.Errorf("Enrich() service %q banner %q, expected %q containing %q", r.Service, r.Banner, tt.service, tt.banner)
+			}
+			if tt.service == "ssh" && (r.Product != "OpenSSH" || r.Version != "9.6" || r.SSH == nil || r.SSH.Comments != "Debian-1") {
+				t.Errorf("Enrich() product %q version %q ssh %+v, expected OpenSSH 9.6 on Debian-1", r.Product, r.Version, r.SSH)
+			}
+		})
+	}
+}
+
+func TestWriteServices(t *testing.T) {
+	results := []Result{
+		{IP: "10.0.0.9", Port: 2222, Service: "ssh", Product: "Cisco", Version: "1.25", SSH: &SSHInfo{Protocol: "1.99", Software: "Cisco-1.25"}},
+		{IP: "10.0.0.5", Port: 22, Service: "ssh", Product: "OpenSSH", Version: "8.9p1"},
+		{IP: "10.0.0.5", Port: 21, Service: "ftp", FTP: &FTPInfo{Anonymous: true}},
+		{IP: "10.0.0.5", Port: 80, Service: "http"},
+	}
+	var b strings.Builder
+	WriteServices(&b, results)
+	want := `
+=== Services ===
+ADDRESS        SERVICE  SOFTWARE       FINDINGS
+10.0.0.5:21    ftp      -              anonymous login allowed
+10.0.0.5:22    ssh      OpenSSH 8.9p1  -
+10.0.0.9:2222  ssh      Cisco 1.25     accepts SSH 1
+`
+	if b.String() != want {
+		t.Errorf("WriteServices() =\n%s\nexpected\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	WriteServices(&b, results[3:])
+	if b.Len() != 0 {
+		t.Errorf("WriteServices() with nothing identified = %q, expected nothing", b.String())
+	}
+}
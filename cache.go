@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheInfo is how a Redis or Memcached server answered a read-only
+// statistics command
+type CacheInfo struct {
+	Protocol        string `json:"protocol"`          // "redis" or "memcached"
+	Version         string `json:"version,omitempty"` // from the statistics, when they were given
+	Unauthenticated bool   `json:"unauthenticated"`   // answered without a password
+	Error           string `json:"error,omitempty"`   // the refusal, e.g. "NOAUTH Authentication required."
+}
+
+// cachePorts are the usual ports of each datastore, tried when the service of
+// a port isn't known
+var cachePorts = map[int]string{6379: "redis", 6380: "redis", 11211: "memcached"}
+
+// CacheProber is an enricher that asks Redis for INFO and Memcached for
+// stats, the commands that show whether they let anyone in. Neither reads or
+// changes any data.
+type CacheProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records whether a Redis or Memcached server requires authentication
+func (p CacheProber) Enrich(r *Result, probe ProbeConfig) {
+	protocol := r.Service
+	if protocol == "" {
+		protocol = cachePorts[r.Port]
+	}
+	var info *CacheInfo
+	switch protocol {
+	case "redis":
+		info = probeRedis(r.Host, r.Port, probe, p.Timeout)
+	case "memcached":
+		info = probeMemcached(r.Host, r.Port, probe, p.Timeout)
+	}
+	if info == nil {
+		return
+	}
+	r.Cache, r.Service = info, info.Protocol
+	if r.Product == "" && info.Version != "" {
+		r.Product, r.Version = strings.ToUpper(info.Protocol[:1])+info.Protocol[1:], info.Version
+	}
+}
+
+// dialCache connects to a datastore and sends one command, returning a
+// reader for the reply
+func dialCache(host string, port int, probe ProbeConfig, wait time.Duration, command string) (net.Conn, *bufio.Reader, error) {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(2 * wait))
+	if _, err := conn.Write([]byte(command)); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, bufio.NewReader(conn), nil
+}
+
+// probeRedis sends INFO server. The reply is a bulk string of "key:value"
+// lines, or an error when a password is required or protected mode is on.
+func probeRedis(host string, port int, probe ProbeConfig, wait time.Duration) *CacheInfo {
+	conn, reply, err := dialCache(host, port, probe, wait, "INFO server\r\n")
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	line, err := reply.ReadString('\n')
+	if err != nil {
+		return nil
+	}
+	line = strings.TrimRight(line, "\r\n")
+	info := &CacheInfo{Protocol: "redis"}
+	switch {
+	case strings.HasPrefix(line, "-"):
+		info.Error = line[1:]
+		if !strings.HasPrefix(info.Error, "NOAUTH") && !strings.HasPrefix(info.Error, "DENIED") && !strings.HasPrefix(info.Error, "WRONGPASS") {
+			return nil // an error from something else that speaks RESP, or not at all
+		}
+	case strings.HasPrefix(line, "$"):
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil
+		}
+		info.Unauthenticated = true
+		for read := 0; read < size; {
+			field, err := reply.ReadString('\n')
+			if err != nil {
+				break
+			}
+			read += len(field)
+			if v, ok := strings.CutPrefix(strings.TrimSpace(field), "redis_version:"); ok {
+				info.Version = v
+			}
+		}
+	default:
+		return nil
+	}
+	return info
+}
+
+// probeMemcached sends stats. Memcached has no authentication over its text
+// protocol unless SASL is enabled, which disables that protocol entirely.
+func probeMemcached(host string, port int, probe ProbeConfig, wait time.Duration) *CacheInfo {
+	conn, reply, err := dialCache(host, port, probe, wait, "stats\r\n")
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	info := &CacheInfo{Protocol: "memcached"}
+	for {
+		line, err := reply.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "END" {
+			info.Unauthenticated = true
+			return info
+		}
+		stat, ok := strings.CutPrefix(line, "STAT ")
+		if !ok {
+			return nil
+		}
+		if v, ok := strings.CutPrefix(stat, "version "); ok {
+			info.Version = v
+		}
+	}
+}
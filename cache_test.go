@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// answerCommand serves one reply to the first line a client sends
+func answerCommand(t *testing.T, reply string) int {
+	return serveOnce(t, func(conn net.Conn) {
+		if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+			conn.Write([]byte(reply))
+		}
+	})
+}
+
+func TestCacheProber(t *testing.T) {
+	info := "# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n"
+	tests := []struct {
+		name    string
+		reply   string
+		service string
+		want    *CacheInfo
+		product string
+	}{
+		{
+			name:    "Redis without a password",
+			reply:   fmt.Sprintf("$%d\r\n%s\r\n", len(info), info),
+			service: "redis",
+			want:    &CacheInfo{Protocol: "redis", Version: "7.2.4", Unauthenticated: true},
+			product: "Redis",
+		},
+		{
+			name:    "Redis with a password",
+			reply:   "-NOAUTH Authentication required.\r\n",
+			service: "redis",
+			want:    &CacheInfo{Protocol: "redis", Error: "NOAUTH Authentication required."},
+		},
+		{
+			name:    "Memcached",
+			reply:   "STAT pid 1\r\nSTAT uptime 10\r\nSTAT version 1.6.21\r\nEND\r\n",
+			service: "memcached",
+			want:    &CacheInfo{Protocol: "memcached", Version: "1.6.21", Unauthenticated: true},
+			product: "Memcached",
+		},
+		{
+			name:    "Not Redis",
+			reply:   "HTTP/1.1 400 Bad Request\r\n\r\n",
+			service: "redis",
+		},
+		{
+			name:    "Not Memcached",
+			reply:   "ERROR\r\n",
+			service: "memcached",
+		},
+		{
+			name:    "Other service",
+			reply:   "-NOAUTH Authentication required.\r\n",
+			service: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: answerCommand(t, tt.reply), Service: tt.service}
+			CacheProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+			if (r.Cache == nil) != (tt.want == nil) || r.Cache != nil && *r.Cache != *tt.want {
+				t.Fatalf("Enrich() cache = %+v, expected %+v", r.Cache, tt.want)
+			}
+			if r.Product != tt.product {
+				t.Errorf("Enrich() product = %q, expected %q", r.Product, tt.product)
+			}
+		})
+	}
+}
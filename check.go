@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exit codes of "pscanner check", those of Nagios plugins. Container and
+// load balancer healthchecks take any code but 0 as unhealthy.
+const (
+	checkOK       = 0 // the port is open and its banner matches
+	checkWarning  = 1 // the port is open but its banner doesn't match
+	checkCritical = 2 // the port is closed, filtered or its host unreachable
+	checkUnknown  = 3 // usage errors
+)
+
+// checkStatus names the exit codes of "pscanner check" in its output
+var checkStatus = []string{checkOK: "OK", checkWarning: "WARNING", checkCritical: "CRITICAL", checkUnknown: "UNKNOWN"}
+
+// HealthCheck probes one port, with a single connection attempt, and with
+// expect set reads its banner and matches it. It returns the exit code of
+// "pscanner check" and the line describing the outcome, with the time the
+// probe took as Nagios performance data.
+func HealthCheck(ctx context.Context, host string, port int, expect *regexp.Regexp, timeout time.Duration) (int, string) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	start := time.Now()
+	probe := ProbeConfig{Timeout: timeout, Retries: 1}
+	state, err := probePort(ctx, host, port, probe, probeHooks{})
+	elapsed := time.Since(start)
+	perf := fmt.Sprintf(" | time=%.6fs", elapsed.Seconds())
+	if state != StateOpen {
+		message := fmt.Sprintf("%s %s", addr, state)
+		if err != nil {
+			message += fmt.Sprintf(" (%v)", err)
+		}
+		return checkCritical, message + perf
+	}
+	if expect == nil {
+		return checkOK, fmt.Sprintf("%s open in %s%s", addr, formatDuration(elapsed), perf)
+	}
+	// The whole banner is matched, but only its first line fits the status
+	// line monitoring systems show
+	banner := grabBanner(host, port, probe, timeout)
+	first, _, _ := strings.Cut(banner, "\n")
+	first = strings.TrimSpace(first)
+	switch {
+	case banner == "":
+		return checkWarning, fmt.Sprintf("%s open but sent no banner%s", addr, perf)
+	case !expect.MatchString(banner):
+		return checkWarning, fmt.Sprintf("%s open but banner %q doesn't match %q%s", addr, first, expect, perf)
+	}
+	return checkOK, fmt.Sprintf("%s open, banner %q%s", addr, first, perf)
+}
+
+// runCheck implements the "check" subcommand, a single-port healthcheck for
+// containers, load balancers and monitoring systems
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	expectBanner := flags.String("expect-banner", "", "Require the port's banner to match this `regex`")
+	quiet := flags.Bool("q", false, "Print nothing; only the exit status tells the outcome")
+	var timeout time.Duration
+	durationVar(flags, &timeout, "t", 5*time.Second, "Connection and banner timeout as a `duration` (e.g., 5s; plain numbers are milliseconds)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner check [-t 5s] [-expect-banner regex] [-q] host:port\n")
+		flags.PrintDefaults()
+	}
+	// Flags may follow the address too, as in "check db:5432 -t 2s"
+	if err := flags.Parse(args); err != nil {
+		return checkUnknown
+	}
+	addr, rest := flags.Arg(0), flags.NArg()
+	if rest > 1 {
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return checkUnknown
+		}
+		rest = 1 + flags.NArg()
+	}
+	if addr == "" || rest != 1 {
+		flags.Usage()
+		return checkUnknown
+	}
+
+	report := func(code int, message string) int {
+		if !*quiet {
+			fmt.Printf("%s - %s\n", checkStatus[code], message)
+		}
+		return code
+	}
+	host, portText, err := net.SplitHostPort(addr)
+	port, portErr := strconv.Atoi(portText)
+	if err != nil || host == "" || portErr != nil || port < 1 || port > 65535 {
+		return report(checkUnknown, fmt.Sprintf("%q is not host:port", addr))
+	}
+	var expect *regexp.Regexp
+	if *expectBanner != "" {
+		if expect, err = regexp.Compile(*expectBanner); err != nil {
+			return report(checkUnknown, fmt.Sprintf("-expect-banner: %v", err))
+		}
+	}
+	return report(HealthCheck(context.Background(), host, port, expect, timeout))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	// A service that greets every connection the way an SSH server does
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// A port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		port    int
+		expect  string
+		want    int
+		message string
+	}{
+		{"open", port, "", checkOK, "open in"},
+		{"banner matches", port, `^SSH-2\.0-`, checkOK, `banner "SSH-2.0-OpenSSH_9.6"`},
+		{"banner differs", port, `^220 `, checkWarning, "doesn't match"},
+		{"closed", closedPort, "", checkCritical, "closed"},
+		{"closed with banner", closedPort, `^SSH-`, checkCritical, "closed"},
+	}
+	for _, tt := range tests {
+		var expect *regexp.Regexp
+		if tt.expect != "" {
+			expect = regexp.MustCompile(tt.expect)
+		}
+		code, message := HealthCheck(context.Background(), "127.0.0.1", tt.port, expect, time.Second)
+		if code != tt.want || !strings.Contains(message, tt.message) || !strings.Contains(message, " | time=") {
+			t.Errorf("%s: HealthCheck() = %d, %q, expected %d and %q", tt.name, code, message, tt.want, tt.message)
+		}
+	}
+
+	// Flags may come before or after the address
+	addr := ln.Addr().String()
+	for _, args := range [][]string{{"-q", addr}, {"-q", addr, "-expect-banner", "^SSH-"}, {addr, "-q", "-t", "1s"}} {
+		if code := runCheck(args); code != checkOK {
+			t.Errorf("runCheck(%q) = %d, expected %d", args, code, checkOK)
+		}
+	}
+}
+
+func TestRunCheckUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"example.com"},
+		{"example.com:99999"},
+		{"example.com:22", "-expect-banner", "("},
+		{"example.com:22", "extra"},
+	} {
+		if code := runCheck(append([]string{"-q"}, args...)); code != checkUnknown {
+			t.Errorf("runCheck(%q) = %d, expected %d", args, code, checkUnknown)
+		}
+	}
+}
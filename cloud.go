@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Cloud target sources list instance addresses through the providers' own
+// command-line tools (aws, gcloud, az), reusing whatever credentials and
+// profiles are already configured for them.
+
+// runCommand runs a CLI and returns its standard output; replaced in tests
+var runCommand = func(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", name, err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return out, nil
+}
+
+// cloudAddresses collects the public and/or private addresses of instances
+type cloudAddresses struct {
+	public, private bool
+	seen            map[string]bool
+	list            []string
+}
+
+// newCloudAddresses keeps "public", "private" or "all" addresses
+func newCloudAddresses(which string) (*cloudAddresses, error) {
+	c := &cloudAddresses{seen: make(map[string]bool)}
+	switch which {
+	case "public":
+		c.public = true
+	case "private":
+		c.private = true
+	case "all", "":
+		c.public, c.private = true, true
+	default:
+		return nil, fmt.Errorf("invalid address selection %q (use public, private or all)", which)
+	}
+	return c, nil
+}
+
+func (c *cloudAddresses) add(public bool, addrs ...string) {
+	if public && !c.public || !public && !c.private {
+		return
+	}
+	for _, a := range addrs {
+		if a != "" && !c.seen[a] {
+			c.seen[a] = true
+			c.list = append(c.list, a)
+		}
+	}
+}
+
+// AWSTargets lists running EC2 instances for a profile (and optional region)
+func AWSTargets(profile, region, which string) ([]string, error) {
+	args := []string{"ec2", "describe-instances", "--output", "json",
+		"--filters", "Name=instance-state-name,Values=running"}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	if region != "" {
+		args = append(args, "--region", region)
+	}
+	out, err := runCommand("aws", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseAWSInstances(out, which)
+}
+
+func parseAWSInstances(data []byte, which string) ([]string, error) {
+	addrs, err := newCloudAddresses(which)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		Reservations []struct {
+			Instances []struct {
+				PrivateIPAddress  string `json:"PrivateIpAddress"`
+				PublicIPAddress   string `json:"PublicIpAddress"`
+				NetworkInterfaces []struct {
+					PrivateIPAddresses []struct {
+						PrivateIPAddress string `json:"PrivateIpAddress"`
+						Association      struct {
+							PublicIP string `json:"PublicIp"`
+						} `json:"Association"`
+					} `json:"PrivateIpAddresses"`
+					IPv6Addresses []struct {
+						IPv6Address string `json:"Ipv6Address"`
+					} `json:"Ipv6Addresses"`
+				} `json:"NetworkInterfaces"`
+			} `json:"Instances"`
+		} `json:"Reservations"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("parsing aws output: %v", err)
+	}
+	for _, r := range body.Reservations {
+		for _, inst := range r.Instances {
+			addrs.add(true, inst.PublicIPAddress)
+			addrs.add(false, inst.PrivateIPAddress)
+			for _, nic := range inst.NetworkInterfaces {
+				for _, ip := range nic.PrivateIPAddresses {
+					addrs.add(true, ip.Association.PublicIP)
+					addrs.add(false, ip.PrivateIPAddress)
+				}
+				// EC2 IPv6 addresses are globally routable
+				for _, ip := range nic.IPv6Addresses {
+					addrs.add(true, ip.IPv6Address)
+				}
+			}
+		}
+	}
+	return addrs.list, nil
+}
+
+// GCPTargets lists running Compute Engine instances in a project
+func GCPTargets(project, which string) ([]string, error) {
+	out, err := runCommand("gcloud", "compute", "instances", "list", "--project", project, "--format", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseGCPInstances(out, which)
+}
+
+func parseGCPInstances(data []byte, which string) ([]string, error) {
+	addrs, err := newCloudAddresses(which)
+	if err != nil {
+		return nil, err
+	}
+	var body []struct {
+		Status            string `json:"status"`
+		NetworkInterfaces []struct {
+			NetworkIP     string `json:"networkIP"`
+			AccessConfigs []struct {
+				NatIP string `json:"natIP"`
+			} `json:"accessConfigs"`
+			IPv6AccessConfigs []struct {
+				ExternalIPv6 string `json:"externalIpv6"`
+			} `json:"ipv6AccessConfigs"`
+		} `json:"networkInterfaces"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("parsing gcloud output: %v", err)
+	}
+	for _, inst := range body {
+		if inst.Status != "RUNNING" {
+			continue
+		}
+		for _, nic := range inst.NetworkInterfaces {
+			addrs.add(false, nic.NetworkIP)
+			for _, ac := range nic.AccessConfigs {
+				addrs.add(true, ac.NatIP)
+			}
+			for _, ac := range nic.IPv6AccessConfigs {
+				addrs.add(true, ac.ExternalIPv6)
+			}
+		}
+	}
+	return addrs.list, nil
+}
+
+// AzureTargets lists virtual machine addresses in a subscription
+func AzureTargets(subscription, which string) ([]string, error) {
+	out, err := runCommand("az", "vm", "list-ip-addresses", "--subscription", subscription, "--output", "json")
+	if err != nil {
+		return nil, err
+	}
+	return parseAzureAddresses(out, which)
+}
+
+func parseAzureAddresses(data []byte, which string) ([]string, error) {
+	addrs, err := newCloudAddresses(which)
+	if err != nil {
+		return nil, err
+	}
+	var body []struct {
+		VirtualMachine struct {
+			Network struct {
+				PrivateIPAddresses []string `json:"privateIpAddresses"`
+				PublicIPAddresses  []struct {
+					IPAddress string `json:"ipAddress"`
+				} `json:"publicIpAddresses"`
+			} `json:"network"`
+		} `json:"virtualMachine"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("parsing az output: %v", err)
+	}
+	for _, vm := range body {
+		addrs.add(false, vm.VirtualMachine.Network.PrivateIPAddresses...)
+		for _, ip := range vm.VirtualMachine.Network.PublicIPAddresses {
+			addrs.add(true, ip.IPAddress)
+		}
+	}
+	return addrs.list, nil
+}
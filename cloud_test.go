@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const awsFixture = `{"Reservations": [{"Instances": [{
+	"PrivateIpAddress": "10.0.1.5", "PublicIpAddress": "54.1.2.3",
+	"NetworkInterfaces": [{
+		"PrivateIpAddresses": [
+			{"PrivateIpAddress": "10.0.1.5", "Association": {"PublicIp": "54.1.2.3"}},
+			{"PrivateIpAddress": "10.0.1.6"}
+		],
+		"Ipv6Addresses": [{"Ipv6Address": "2600:1f18::5"}]
+	}]
+}]}]}`
+
+const gcpFixture = `[
+	{"name": "web", "status": "RUNNING", "networkInterfaces": [
+		{"networkIP": "10.128.0.2", "accessConfigs": [{"natIP": "34.1.2.3"}]}]},
+	{"name": "stopped", "status": "TERMINATED", "networkInterfaces": [{"networkIP": "10.128.0.3"}]}
+]`
+
+const azureFixture = `[
+	{"virtualMachine": {"name": "vm1", "network": {
+		"privateIpAddresses": ["10.1.0.4"], "publicIpAddresses": [{"ipAddress": "20.1.2.3"}]}}}
+]`
+
+func TestParseCloudInventory(t *testing.T) {
+	tests := []struct {
+		name     string
+		parse    func([]byte, string) ([]string, error)
+		data     string
+		which    string
+		expected []string
+		wantErr  bool
+	}{
+		{name: "AWS all", parse: parseAWSInstances, data: awsFixture, which: "all", expected: []string{"54.1.2.3", "10.0.1.5", "10.0.1.6", "2600:1f18::5"}},
+		{name: "AWS public", parse: parseAWSInstances, data: awsFixture, which: "public", expected: []string{"54.1.2.3", "2600:1f18::5"}},
+		{name: "GCP all", parse: parseGCPInstances, data: gcpFixture, which: "all", expected: []string{"10.128.0.2", "34.1.2.3"}},
+		{name: "GCP private", parse: parseGCPInstances, data: gcpFixture, which: "private", expected: []string{"10.128.0.2"}},
+		{name: "Azure public", parse: parseAzureAddresses, data: azureFixture, which: "public", expected: []string{"20.1.2.3"}},
+		{name: "Invalid selection", parse: parseAzureAddresses, data: azureFixture, which: "external", wantErr: true},
+		{name: "Invalid JSON", parse: parseGCPInstances, data: "not json", which: "all", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse([]byte(tt.data), tt.which)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parse = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAWSTargetsCommand(t *testing.T) {
+	var command string
+	original := runCommand
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		command = name + " " + strings.Join(args, " ")
+		return []byte(awsFixture), nil
+	}
+	defer func() { runCommand = original }()
+
+	addrs, err := AWSTargets("prod", "eu-west-1", "private")
+	if err != nil {
+		t.Fatalf("AWSTargets() error = %v", err)
+	}
+	if !reflect.DeepEqual(addrs, []string{"10.0.1.5", "10.0.1.6"}) {
+		t.Errorf("AWSTargets() = %v", addrs)
+	}
+	for _, want := range []string{"aws ec2 describe-instances", "--profile prod", "--region eu-west-1", "instance-state-name,Values=running"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("command %q missing %q", command, want)
+		}
+	}
+}
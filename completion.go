@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// subcommands lists the commands completed in place of the first argument
+var subcommands = []string{"scan", "resume", "estimate", "report", "serve", "controller", "agent", "worker", "watch", "diff", "merge", "history", "audit", "connect", "check", "completion", "update"}
+
+// completionChoices are the fixed values of flags that take one of a set
+var completionChoices = map[string]string{
+	"format":    "text cef leef",
+	"state":     "open closed filtered all",
+	"cloud-ips": "public private all",
+}
+
+// completionFiles are the flags that take a file name
+var completionFiles = map[string]bool{
+	"hf": true, "cf": true, "o": true, "config": true, "history": true,
+	"pcap": true, "geoip": true, "kubeconfig": true, "audit-log": true,
+	"ports-file": true,
+}
+
+// completionFlag is a flag as the completion scripts need it
+type completionFlag struct {
+	name  string
+	usage string
+	value bool // takes a value
+}
+
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		b, ok := f.Value.(interface{ IsBoolFlag() bool })
+		_, usage := flag.UnquoteUsage(f)
+		flags = append(flags, completionFlag{name: f.Name, usage: usage, value: !ok || !b.IsBoolFlag()})
+	})
+	return flags
+}
+
+// WriteCompletion writes the completion script for a shell
+func WriteCompletion(w io.Writer, shell string, fs *flag.FlagSet) error {
+	flags := completionFlags(fs)
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, flags)
+	case "zsh":
+		writeZshCompletion(w, flags)
+	case "fish":
+		writeFishCompletion(w, flags)
+	default:
+		return fmt.Errorf("unsupported shell %q (use bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+func writeBashCompletion(w io.Writer, flags []completionFlag) {
+	var names, files []string
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+		if completionFiles[f.name] {
+			files = append(files, "-"+f.name)
+		}
+	}
+	fmt.Fprint(w, `# bash completion for pscanner; load with: source <(pscanner completion bash)
+_pscanner() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    case "${prev#-}" in
+`)
+	for _, name := range sortedKeys(completionChoices) {
+		fmt.Fprintf(w, "        %s|-%s)\n            COMPREPLY=($(compgen -W %q -- \"$cur\"))\n            return ;;\n",
+			name, name, completionChoices[name])
+	}
+	fmt.Fprintf(w, `        profile|-profile)
+            COMPREPLY=($(compgen -W "$(pscanner completion profiles 2>/dev/null)" -- "$cur"))
+            return ;;
+        %s)
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return ;;
+    esac
+    if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then
+        COMPREPLY=($(compgen -W %q -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(compgen -W %q -- "$cur"))
+}
+complete -o default -F _pscanner pscanner
+`, bashPattern(files), strings.Join(subcommands, " "), strings.Join(names, " "))
+}
+
+// bashPattern matches the flags with one or two leading dashes in a case label
+func bashPattern(flags []string) string {
+	var alts []string
+	for _, f := range flags {
+		name := strings.TrimPrefix(f, "-")
+		alts = append(alts, name, "-"+name)
+	}
+	return strings.Join(alts, "|")
+}
+
+var zshEscaper = strings.NewReplacer(`[`, `\[`, `]`, `\]`, `:`, `\:`, `'`, `'\''`)
+
+func writeZshCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintf(w, "#compdef pscanner\n# zsh completion for pscanner; load with: source <(pscanner completion zsh)\n\n")
+	fmt.Fprintf(w, "_pscanner_profiles() {\n    local -a profiles\n    profiles=(${(f)\"$(pscanner completion profiles 2>/dev/null)\"})\n    _describe 'profile' profiles\n}\n\n")
+	fmt.Fprintf(w, "_pscanner() {\n    _arguments \\\n")
+	for _, f := range flags {
+		spec := "'-" + f.name + "[" + zshEscaper.Replace(f.usage) + "]"
+		switch {
+		case !f.value:
+		case f.name == "profile":
+			spec += ":profile:_pscanner_profiles"
+		case completionChoices[f.name] != "":
+			spec += ":" + f.name + ":(" + completionChoices[f.name] + ")"
+		case completionFiles[f.name]:
+			spec += ":file:_files"
+		default:
+			spec += ":" + f.name + ": "
+		}
+		fmt.Fprintf(w, "        %s' \\\n", spec)
+	}
+	fmt.Fprintf(w, "        '1::command:(%s)'\n}\n\ncompdef _pscanner pscanner\n", strings.Join(subcommands, " "))
+}
+
+var fishEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+func writeFishCompletion(w io.Writer, flags []completionFlag) {
+	fmt.Fprintf(w, "# fish completion for pscanner; load with: pscanner completion fish | source\n")
+	fmt.Fprintf(w, "complete -c pscanner -f -n __fish_use_subcommand -a '%s'\n", strings.Join(subcommands, " "))
+	for _, f := range flags {
+		line := fmt.Sprintf("complete -c pscanner -o %s -d '%s'", f.name, fishEscaper.Replace(f.usage))
+		switch {
+		case !f.value:
+		case f.name == "profile":
+			line += " -x -a '(pscanner completion profiles 2>/dev/null)'"
+		case completionChoices[f.name] != "":
+			line += " -x -a '" + completionChoices[f.name] + "'"
+		case completionFiles[f.name]:
+			line += " -r -F"
+		default:
+			line += " -x"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// runCompletion implements "pscanner completion bash|zsh|fish" and the
+// "completion profiles" helper the scripts call to list profile names
+func runCompletion(args []string) int {
+	if len(args) == 0 || len(args) > 2 || len(args) == 2 && args[0] != "profiles" {
+		fmt.Fprintf(os.Stderr, "Usage: pscanner completion bash|zsh|fish\n")
+		return 2
+	}
+	if args[0] == "profiles" {
+		path := defaultConfigFile()
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if path == "" {
+			return 0
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return 1
+		}
+		entries, err := parseConfig(data)
+		if err != nil {
+			return 1
+		}
+		for _, name := range profileNames(entries) {
+			fmt.Println(name)
+		}
+		return 0
+	}
+	if err := WriteCompletion(os.Stdout, args[0], flag.CommandLine); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	fs := flag.NewFlagSet("pscanner", flag.ContinueOnError)
+	fs.String("format", "text", "Result format")
+	fs.String("profile", "", "Named profile")
+	fs.String("hf", "", "Hosts file")
+	fs.Bool("q", false, "Quiet: print only results")
+	fs.Int("c", 100, "Number of [concurrent] workers")
+
+	tests := []struct {
+		shell    string
+		expected []string
+	}{
+		{shell: "bash", expected: []string{
+			"complete -o default -F _pscanner pscanner",
+			`format|-format)` + "\n" + `            COMPREPLY=($(compgen -W "text cef leef" -- "$cur"))`,
+			"pscanner completion profiles",
+			"        hf|-hf)\n",
+			`compgen -W "-c -format -hf -profile -q"`,
+			"serve controller agent",
+		}},
+		{shell: "zsh", expected: []string{
+			"#compdef pscanner",
+			`'-c[Number of \[concurrent\] workers]:c: '`,
+			"'-format[Result format]:format:(text cef leef)'",
+			"'-profile[Named profile]:profile:_pscanner_profiles'",
+			"'-hf[Hosts file]:file:_files'",
+			"'-q[Quiet\\: print only results]'",
+			"'1::command:(scan resume estimate report serve controller",
+		}},
+		{shell: "fish", expected: []string{
+			"complete -c pscanner -f -n __fish_use_subcommand -a 'scan resume estimate report serve controller",
+			"complete -c pscanner -o format -d 'Result format' -x -a 'text cef leef'\n",
+			"complete -c pscanner -o profile -d 'Named profile' -x -a '(pscanner completion profiles 2>/dev/null)'\n",
+			"complete -c pscanner -o hf -d 'Hosts file' -r -F\n",
+			"complete -c pscanner -o q -d 'Quiet: print only results'\n",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			var b strings.Builder
+			if err := WriteCompletion(&b, tt.shell, fs); err != nil {
+				t.Fatalf("WriteCompletion() error: %v", err)
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("%s script is missing %q:\n%s", tt.shell, want, b.String())
+				}
+			}
+		})
+	}
+
+	if err := WriteCompletion(&strings.Builder{}, "tcsh", fs); err == nil {
+		t.Error("WriteCompletion(tcsh) expected an error")
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config files set the same options as the command line, one per line, in
+// either YAML ("ports: 22,80") or TOML ("ports = [22, 80]") style. Option
+// names are the flag names. Only the simple subset both formats share for
+// flat settings is understood: scalars, inline lists, YAML block lists,
+// nested YAML mappings and TOML [tables]. Named profiles live under
+// "profiles" (a YAML mapping or [profiles.name] tables).
+
+// configEntry is one option read from a config file
+type configEntry struct {
+	section string // dotted path of the enclosing table or mapping, "" at top level
+	key     string
+	value   string
+	line    int
+}
+
+// parseConfig reads the options in a YAML or TOML config file
+func parseConfig(data []byte) ([]configEntry, error) {
+	type pending struct {
+		indent int
+		entry  *configEntry
+		isList bool
+		isMap  bool
+	}
+	var (
+		entries  []*configEntry
+		mappings = make(map[*configEntry]bool) // keys that turned out to be mappings
+		table    string                        // current TOML table
+		stack    []*pending                    // open YAML keys with no inline value
+	)
+	sectionOf := func() string {
+		path := []string{}
+		if table != "" {
+			path = append(path, table)
+		}
+		for _, p := range stack {
+			path = append(path, p.entry.key)
+		}
+		return strings.Join(path, ".")
+	}
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		lineNo := i + 1
+		line := strings.TrimRight(stripConfigComment(raw), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		// YAML allows list items at the same indentation as their key
+		isItem := trimmed == "-" || strings.HasPrefix(trimmed, "- ")
+		for len(stack) > 0 && (stack[len(stack)-1].indent > indent ||
+			stack[len(stack)-1].indent == indent && !isItem) {
+			stack = stack[:len(stack)-1]
+		}
+
+		// TOML table header
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") && indent == 0 {
+			name := strings.Trim(trimmed, "[] ")
+			if name == "" || strings.HasPrefix(trimmed, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header %s", lineNo, trimmed)
+			}
+			table = name
+			stack = nil
+			continue
+		}
+
+		// YAML block list item belonging to the innermost open key
+		if isItem {
+			if len(stack) == 0 || stack[len(stack)-1].isMap {
+				return nil, fmt.Errorf("line %d: list item outside a list", lineNo)
+			}
+			p := stack[len(stack)-1]
+			p.isList = true
+			item, err := parseConfigValue(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if p.entry.value != "" {
+				p.entry.value += ","
+			}
+			p.entry.value += item
+			continue
+		}
+
+		key, value, ok := splitConfigLine(trimmed)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\" or \"key = value\"", lineNo)
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if parent.isList {
+				return nil, fmt.Errorf("line %d: option inside the list %q", lineNo, parent.entry.key)
+			}
+			// A key with indented options under it is a mapping, not an option
+			parent.isMap = true
+			mappings[parent.entry] = true
+		}
+		entry := &configEntry{section: sectionOf(), key: key, line: lineNo}
+		entries = append(entries, entry)
+		if value == "" {
+			stack = append(stack, &pending{indent: indent, entry: entry})
+			continue
+		}
+		v, err := parseConfigValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		entry.value = v
+	}
+
+	var result []configEntry
+	for _, e := range entries {
+		if !mappings[e] {
+			result = append(result, *e)
+		}
+	}
+	return result, nil
+}
+
+// splitConfigLine splits "key: value" or "key = value"
+func splitConfigLine(line string) (key, value string, ok bool) {
+	i := strings.IndexFunc(line, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.')
+	})
+	if i <= 0 {
+		return "", "", false
+	}
+	rest := strings.TrimLeft(line[i:], " \t")
+	switch {
+	case strings.HasPrefix(rest, "="):
+	case strings.HasPrefix(rest, ":") && (len(rest) == 1 || rest[1] == ' ' || rest[1] == '\t'):
+	default:
+		return "", "", false
+	}
+	return line[:i], strings.TrimSpace(rest[1:]), true
+}
+
+// stripConfigComment removes a trailing # comment outside of quotes
+func stripConfigComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseConfigValue unquotes a scalar and flattens an inline list into the
+// comma-separated form the flags accept
+func parseConfigValue(v string) (string, error) {
+	if strings.HasPrefix(v, "[") {
+		if !strings.HasSuffix(v, "]") {
+			return "", fmt.Errorf("unterminated list %s", v)
+		}
+		var items []string
+		for _, item := range strings.Split(strings.TrimSuffix(v[1:], "]"), ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			s, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	}
+	switch {
+	case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", v)
+		}
+		return s, nil
+	case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+		return v[1 : len(v)-1], nil
+	}
+	return v, nil
+}
+
+// LoadConfig applies a config file's options to a flag set. Flags already
+// given on the command line are left alone, so they override the file. A
+// non-empty profile applies that entry of the file's "profiles" section
+// first, so it overrides the file's top-level options.
+func LoadConfig(fs *flag.FlagSet, path, profile string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, err := parseConfig(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if profile != "" {
+		section := "profiles." + profile
+		found := false
+		for _, e := range entries {
+			found = found || e.section == section
+		}
+		if !found {
+			names := profileNames(entries)
+			if len(names) == 0 {
+				return fmt.Errorf("%s: no profiles defined", path)
+			}
+			return fmt.Errorf("%s: unknown profile %q (available: %s)", path, profile, strings.Join(names, ", "))
+		}
+		if err := applyConfig(fs, entries, section); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if err := applyConfig(fs, entries, ""); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// addConfigFlags adds -config and -profile to a subcommand's flag set
+func addConfigFlags(fs *flag.FlagSet) {
+	fs.StringVar(&configFile, "config", "", "YAML or TOML file setting any of these options; flags override it")
+	fs.StringVar(&profile, "profile", "", "Named profile from the config file to apply")
+}
+
+// loadSettings fills in the flags not given on the command line, first from
+// the environment and then from the config file named by -config, or the
+// default one when only -profile is given
+func loadSettings(fs *flag.FlagSet) error {
+	if err := LoadEnv(fs, os.LookupEnv); err != nil {
+		return err
+	}
+	if configFile == "" && profile != "" {
+		if configFile = defaultConfigFile(); configFile == "" {
+			return errors.New("-profile needs a config file (use -config or create pscanner.yaml)")
+		}
+	}
+	if configFile != "" {
+		if err := LoadConfig(fs, configFile, profile); err != nil {
+			return fmt.Errorf("loading config: %v", err)
+		}
+	}
+	return nil
+}
+
+// profileNames lists the profiles defined in a config file, in file order
+func profileNames(entries []configEntry) []string {
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.section, "profiles.")
+		if ok && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// defaultConfigFile returns the first config file found in the working
+// directory or the user config directory, or "" if there is none
+func defaultConfigFile() string {
+	candidates := []string{"pscanner.yaml", "pscanner.yml", "pscanner.toml"}
+	if dir, err := os.UserConfigDir(); err == nil {
+		for _, name := range []string{"config.yaml", "config.yml", "config.toml"} {
+			candidates = append(candidates, filepath.Join(dir, "pscanner", name))
+		}
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// applyConfig sets the flags named by the entries in one section
+func applyConfig(fs *flag.FlagSet, entries []configEntry, section string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for _, e := range entries {
+		if e.section != section {
+			if section == "" && !strings.HasPrefix(e.section, "profiles.") {
+				return fmt.Errorf("line %d: unknown section %q", e.line, e.section)
+			}
+			continue
+		}
+		if fs.Lookup(e.key) == nil {
+			return fmt.Errorf("line %d: unknown option %q", e.line, e.key)
+		}
+		if given[e.key] {
+			continue
+		}
+		if err := fs.Set(e.key, e.value); err != nil {
+			return fmt.Errorf("line %d: invalid value %q for %s: %v", e.line, e.value, e.key, err)
+		}
+	}
+	return nil
+}
+
+// envAliases gives the single-letter flags descriptive environment names
+var envAliases = map[string]string{
+	"h":  "HOST",
+	"hf": "HOSTS_FILE",
+	"cf": "CIDR_FILE",
+	"p":  "PORTS",
+	"o":  "OUTPUT",
+	"c":  "CONCURRENCY",
+	"r":  "RETRIES",
+	"t":  "TIMEOUT",
+	"s":  "SLEEP",
+}
+
+// envName returns the environment variable for a flag: PSCANNER_ followed by
+// the flag name in upper case with dashes as underscores (-kube-context is
+// PSCANNER_KUBE_CONTEXT, -c is PSCANNER_CONCURRENCY)
+func envName(flagName string) string {
+	if alias, ok := envAliases[flagName]; ok {
+		return "PSCANNER_" + alias
+	}
+	return "PSCANNER_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// LoadEnv sets every flag not given on the command line from its PSCANNER_*
+// environment variable. It runs before the config file is read, so the
+// environment overrides the file and the command line overrides both.
+func LoadEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envName(f.Name)
+		value, ok := lookup(name)
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, name, setErr)
+		}
+	})
+	return err
+}
+
+// getenv returns the first of the named environment variables that is set,
+// so PSCANNER_-prefixed names can stand in for the usual ones
+func getenv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
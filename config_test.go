@@ -0,0 +1,236 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []configEntry
+	}{
+		{
+			name:  "YAML",
+			input: "# scan settings\nhf: hosts.txt\nports: [22, 80, \"443\"]\nc: 200 # workers\nenrich:\n  - rdap\n  - shodan\n",
+			expected: []configEntry{
+				{key: "hf", value: "hosts.txt", line: 2},
+				{key: "ports", value: "22,80,443", line: 3},
+				{key: "c", value: "200", line: 4},
+				{key: "enrich", value: "rdap,shodan", line: 5},
+			},
+		},
+		{
+			name:  "TOML",
+			input: "h = \"example.com\"\np = '1-1024'\noutput-targets = true\nmetrics = \":9090/metrics\"\n",
+			expected: []configEntry{
+				{key: "h", value: "example.com", line: 1},
+				{key: "p", value: "1-1024", line: 2},
+				{key: "output-targets", value: "true", line: 3},
+				{key: "metrics", value: ":9090/metrics", line: 4},
+			},
+		},
+		{
+			name:  "YAML list at key indentation and URL value",
+			input: "consul: http://127.0.0.1:8500\ngeoip:\n- a.mmdb\n- b.mmdb\n",
+			expected: []configEntry{
+				{key: "consul", value: "http://127.0.0.1:8500", line: 1},
+				{key: "geoip", value: "a.mmdb,b.mmdb", line: 2},
+			},
+		},
+		{
+			name:  "Hash inside quotes",
+			input: "o: \"results #1.txt\"\n",
+			expected: []configEntry{
+				{key: "o", value: "results #1.txt", line: 1},
+			},
+		},
+		{
+			name:  "YAML mapping",
+			input: "c: 10\nweb:\n  p: 80,443\n  t: 1000\n",
+			expected: []configEntry{
+				{key: "c", value: "10", line: 1},
+				{section: "web", key: "p", value: "80,443", line: 3},
+				{section: "web", key: "t", value: "1000", line: 4},
+			},
+		},
+		{
+			name:  "TOML table",
+			input: "c = 10\n\n[web]\np = \"80,443\"\n",
+			expected: []configEntry{
+				{key: "c", value: "10", line: 1},
+				{section: "web", key: "p", value: "80,443", line: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfig([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("parseConfig() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseConfig() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "No separator", input: "ports 80\n"},
+		{name: "Stray list item", input: "- 80\n"},
+		{name: "Unterminated list", input: "ports = [80, 443\n"},
+		{name: "Bad string", input: "h = \"\\q\"\n"},
+		{name: "Array of tables", input: "[[scan]]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseConfig([]byte(tt.input)); err == nil {
+				t.Errorf("parseConfig(%q) expected an error", tt.input)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *string, *int) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		p := fs.String("p", "", "ports")
+		c := fs.Int("c", 100, "workers")
+		return fs, p, c
+	}
+	path := filepath.Join(t.TempDir(), "pscanner.yaml")
+	if err := os.WriteFile(path, []byte("p: 22,80\nc: 50\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Command-line flags win over the file
+	fs, p, c := newFlags()
+	fs.Parse([]string{"-c", "10"})
+	if err := LoadConfig(fs, path, ""); err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+	if *p != "22,80" || *c != 10 {
+		t.Errorf("got p=%q c=%d, expected p=\"22,80\" c=10", *p, *c)
+	}
+
+	for name, content := range map[string]string{
+		"unknown option":  "x: 1\n",
+		"invalid value":   "c: many\n",
+		"unknown section": "web:\n  p: 80\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fs, _, _ := newFlags()
+		err := LoadConfig(fs, path, "")
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("LoadConfig(%q) error = %v, expected %q", content, err, name)
+		}
+	}
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "YAML", content: "p: 1-1024\nc: 100\nprofiles:\n  quick-external:\n    p: 80,443\n    t: 300\n  deep:\n    p: 1-65535\n"},
+		{name: "TOML", content: "p = \"1-1024\"\nc = 100\n\n[profiles.quick-external]\np = \"80,443\"\nt = 300\n\n[profiles.deep]\np = \"1-65535\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pscanner.conf")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			p := fs.String("p", "", "ports")
+			c := fs.Int("c", 1, "workers")
+			to := fs.Int("t", 500, "timeout")
+			fs.Parse(nil)
+
+			if err := LoadConfig(fs, path, "quick-external"); err != nil {
+				t.Fatalf("LoadConfig() error: %v", err)
+			}
+			// The profile overrides the top level, which fills in the rest
+			if *p != "80,443" || *to != 300 || *c != 100 {
+				t.Errorf("got p=%q t=%d c=%d, expected p=\"80,443\" t=300 c=100", *p, *to, *c)
+			}
+
+			err := LoadConfig(flag.NewFlagSet("test", flag.ContinueOnError), path, "missing")
+			if err == nil || !strings.Contains(err.Error(), "available: quick-external, deep") {
+				t.Errorf("LoadConfig() with unknown profile error = %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"PSCANNER_CONCURRENCY":  "250",
+		"PSCANNER_PORTS":        "22,80",
+		"PSCANNER_KUBE_CONTEXT": "prod",
+		"PSCANNER_TIMEOUT":      "900",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c := fs.Int("c", 100, "workers")
+	p := fs.String("p", "", "ports")
+	kc := fs.String("kube-context", "", "context")
+	to := fs.Int("t", 500, "timeout")
+	o := fs.String("o", "", "output")
+	fs.Parse([]string{"-t", "300"})
+
+	if err := LoadEnv(fs, lookup); err != nil {
+		t.Fatalf("LoadEnv() error: %v", err)
+	}
+	if *c != 250 || *p != "22,80" || *kc != "prod" || *to != 300 || *o != "" {
+		t.Errorf("got c=%d p=%q kube-context=%q t=%d o=%q", *c, *p, *kc, *to, *o)
+	}
+
+	env["PSCANNER_CONCURRENCY"] = "lots"
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("c", 100, "workers")
+	if err := LoadEnv(fs, lookup); err == nil || !strings.Contains(err.Error(), "PSCANNER_CONCURRENCY") {
+		t.Errorf("LoadEnv() with invalid value error = %v", err)
+	}
+}
+
+func TestLoadSettings(t *testing.T) {
+	t.Cleanup(func() { configFile, profile = "", "" })
+	path := filepath.Join(t.TempDir(), "serve.yaml")
+	if err := os.WriteFile(path, []byte("listen: \":9000\"\nmax-jobs: 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PSCANNER_CONFIG", path)
+	t.Setenv("PSCANNER_MAX_JOBS", "4")
+
+	// A subcommand's own flag set picks up both the environment and the file
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", ":8080", "address")
+	maxJobs := fs.Int("max-jobs", 0, "jobs")
+	addConfigFlags(fs)
+	fs.Parse(nil)
+	if err := loadSettings(fs); err != nil {
+		t.Fatalf("loadSettings() error: %v", err)
+	}
+	if *listen != ":9000" || *maxJobs != 4 {
+		t.Errorf("got listen=%q max-jobs=%d, expected \":9000\" and 4", *listen, *maxJobs)
+	}
+}
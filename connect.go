@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// Relay copies in to conn and conn to out until the remote side closes. When
+// in reaches EOF the connection is half-closed so the remote sees the end of
+// input but can still reply.
+func Relay(conn net.Conn, in io.Reader, out io.Writer) error {
+	sent := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, in)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		sent <- err
+	}()
+
+	_, err := io.Copy(out, conn)
+	select {
+	case sendErr := <-sent:
+		if err == nil {
+			err = sendErr
+		}
+	default:
+		// The remote closed first; stdin may block forever, so don't wait
+	}
+	return err
+}
+
+// runConnect implements the "connect" subcommand, a minimal netcat for
+// poking at a port found by a scan
+func runConnect(args []string) int {
+	flags := flag.NewFlagSet("connect", flag.ExitOnError)
+	useTLS := flags.Bool("tls", false, "Wrap the connection in TLS")
+	insecure := flags.Bool("insecure", false, "With -tls, don't verify the server certificate")
+	var timeout time.Duration
+	durationVar(flags, &timeout, "t", 5*time.Second, "Connection timeout as a `duration` (e.g., 5s; plain numbers are milliseconds)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner connect [-tls] [-insecure] [-t ms] host:port\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	addr := flags.Arg(0)
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	if *useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host, InsecureSkipVerify: *insecure})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %v\n", addr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(os.Stderr, "Connected to %s", conn.RemoteAddr())
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		fmt.Fprintf(os.Stderr, " (%s", tls.VersionName(state.Version))
+		if len(state.PeerCertificates) > 0 {
+			fmt.Fprintf(os.Stderr, ", certificate for %s", state.PeerCertificates[0].Subject.CommonName)
+		}
+		fmt.Fprint(os.Stderr, ")")
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if err := Relay(conn, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
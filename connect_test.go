@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestRelay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	// Echo each line back upper-cased, then say goodbye once input ends
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			conn.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+		}
+		conn.Write([]byte("bye\n"))
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	var out bytes.Buffer
+	if err := Relay(conn, strings.NewReader("hello\nworld\n"), &out); err != nil {
+		t.Fatalf("Relay() error = %v", err)
+	}
+	if expected := "HELLO\nWORLD\nbye\n"; out.String() != expected {
+		t.Errorf("Relay() output = %q, expected %q", out.String(), expected)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// ANSI escape sequences used on the console
+const (
+	ansiReset = "\x1b[0m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiDim   = "\x1b[2m"
+)
+
+// Whether stdout and stderr get colored output, decided by setupColor
+var colorStdout, colorStderr bool
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// setupColor turns on colors for the streams that are terminals, unless
+// disabled by -no-color or the NO_COLOR convention (https://no-color.org)
+func setupColor(disabled bool) {
+	if disabled || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		colorStdout, colorStderr = false, false
+		return
+	}
+	colorStdout = isTerminal(os.Stdout)
+	colorStderr = isTerminal(os.Stderr)
+}
+
+// colorize wraps s in an ANSI color when enabled, leaving a trailing newline
+// outside the color
+func colorize(enabled bool, color, s string) string {
+	text := strings.TrimSuffix(s, "\n")
+	if !enabled || text == "" {
+		return s
+	}
+	return color + text + ansiReset + s[len(text):]
+}
+
+// errorf prints an error message to stderr, in red on a terminal
+func errorf(format string, args ...any) {
+	fmt.Fprint(os.Stderr, colorize(colorStderr, ansiRed, fmt.Sprintf(format, args...)))
+}
+
+// notef prints an informational message to stderr unless -q is set
+func notef(format string, args ...any) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// confirm asks a yes/no question on out and reads the answer from in; only
+// an explicit yes counts
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// Verbosity levels set by -q, -v and -vv
+const (
+	Quiet = iota - 1
+	Normal
+	Verbose
+	VeryVerbose
+)
+
+// verbosityLevel combines the -q, -v and -vv flags; -q wins
+func verbosityLevel(quiet, v, vv bool) int {
+	switch {
+	case quiet:
+		return Quiet
+	case vv:
+		return VeryVerbose
+	case v:
+		return Verbose
+	}
+	return Normal
+}
+
+// hostTracker follows each host through the scan. At Verbose it reports when
+// a host starts and finishes and at VeryVerbose why each port that is not
+// open failed. The level is read on every call, so it can change mid-scan.
+type hostTracker struct {
+	out   io.Writer
+	color bool
+	stats *Stats
+	level *atomic.Int32
+
+	mu        sync.Mutex
+	started   map[string]bool
+	remaining map[string]int
+	finished  int
+}
+
+// newHostTracker tracks hosts given the number of probes each one gets
+func newHostTracker(out io.Writer, color bool, stats *Stats, probes map[string]int, level *atomic.Int32) *hostTracker {
+	return &hostTracker{
+		out: out, color: color, stats: stats, level: level,
+		started: make(map[string]bool), remaining: probes,
+	}
+}
+
+// Queued notes that a probe of host was handed to the workers
+func (t *hostTracker) Queued(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.started[host] {
+		t.started[host] = true
+		if t.level.Load() >= Verbose {
+			fmt.Fprintf(t.out, "Starting %s (%d ports)\n", host, t.remaining[host])
+		}
+	}
+}
+
+// Probed records the outcome of one probe; it matches ScanOptions.OnProbe
+func (t *hostTracker) Probed(job ScanJob, state PortState, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	level := t.level.Load()
+	if level >= VeryVerbose && err != nil {
+		fmt.Fprint(t.out, colorize(t.color, ansiDim, fmt.Sprintf("%s %s: %v\n",
+			net.JoinHostPort(job.Host, strconv.Itoa(job.Port)), state, err)))
+	}
+	t.remaining[job.Host]--
+	if t.remaining[job.Host] != 0 {
+		return
+	}
+	t.finished++
+	if level < Verbose {
+		return
+	}
+	h, _ := t.stats.Host(job.Host)
+	fmt.Fprintf(t.out, "Finished %s: %d open, %d closed, %d filtered in %v\n", job.Host,
+		h.States[StateOpen], h.States[StateClosed], h.States[StateFiltered], h.End.Sub(h.Start).Round(time.Millisecond))
+}
+
+// Hosts returns how many hosts have finished, are being scanned, and are
+// tracked in total
+func (t *hostTracker) Hosts() (finished, active, total int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.finished, len(t.started) - t.finished, len(t.remaining)
+}
+
+// hostSummaryLimit is how many hosts the final summary lists below -v
+const hostSummaryLimit = 20
+
+// WriteHostSummary prints a line per host with its open and filtered counts,
+// how long it took, its average round-trip time, what seems to filter it and
+// why its probes failed.
+// Hosts with the most open ports come first; limit, if positive, caps the
+// number of lines. Hosts that answered no probe at all are counted at the
+// end, since their lack of open ports says nothing about them.
+func WriteHostSummary(w io.Writer, hosts map[string]HostStats, limit int) {
+	if len(hosts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if n := hosts[b].States[StateOpen] - hosts[a].States[StateOpen]; n != 0 {
+			return n
+		}
+		return strings.Compare(a, b)
+	})
+	more := 0
+	if limit > 0 && len(names) > limit {
+		names, more = names[:limit], len(names)-limit
+	}
+
+	fmt.Fprintf(w, "\n=== Hosts ===\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "HOST\tOPEN\tFILTERED\tTIME\tAVG RTT\tFIREWALL\tERRORS\n")
+	for _, name := range names {
+		h := hosts[name]
+		rtt := "-"
+		if h.States[StateOpen] > 0 {
+			rtt = formatDuration(h.AvgRTT())
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", name, h.States[StateOpen], h.States[StateFiltered],
+			formatDuration(h.End.Sub(h.Start)), rtt, h.Firewall(), h.Errors)
+	}
+	tw.Flush()
+	if more > 0 {
+		fmt.Fprintf(w, "... and %d more host(s) (-v lists them all)\n", more)
+	}
+
+	silent := 0
+	for _, h := range hosts {
+		if h.Ports > 0 && h.States[StateFiltered] == h.Ports {
+			silent++
+		}
+	}
+	if silent > 0 {
+		fmt.Fprintf(w, "%d host(s) answered no probe: every port timed out or failed, so they may be down or behind a firewall dropping everything\n", silent)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestColorize(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		input    string
+		expected string
+	}{
+		{name: "Disabled", enabled: false, input: "10.0.0.1:22\n", expected: "10.0.0.1:22\n"},
+		{name: "Newline kept outside", enabled: true, input: "10.0.0.1:22\n", expected: "\x1b[32m10.0.0.1:22\x1b[0m\n"},
+		{name: "No newline", enabled: true, input: "open", expected: "\x1b[32mopen\x1b[0m"},
+		{name: "Empty line", enabled: true, input: "\n", expected: "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := colorize(tt.enabled, ansiGreen, tt.input); got != tt.expected {
+				t.Errorf("colorize() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetupColorDisabled(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	setupColor(false)
+	if colorStdout || colorStderr {
+		t.Error("NO_COLOR should disable colors")
+	}
+}
+
+func TestVerbosityLevel(t *testing.T) {
+	tests := []struct {
+		name         string
+		quiet, v, vv bool
+		expected     int
+	}{
+		{name: "Default", expected: Normal},
+		{name: "Verbose", v: true, expected: Verbose},
+		{name: "Very verbose", vv: true, expected: VeryVerbose},
+		{name: "Both verbose flags", v: true, vv: true, expected: VeryVerbose},
+		{name: "Quiet wins", quiet: true, vv: true, expected: Quiet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verbosityLevel(tt.quiet, tt.v, tt.vv); got != tt.expected {
+				t.Errorf("verbosityLevel() = %d, expected %d", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHostTracker(t *testing.T) {
+	var out strings.Builder
+	stats := &Stats{startTime: time.Now()}
+	var level atomic.Int32
+	level.Store(VeryVerbose)
+	tracker := newHostTracker(&out, false, stats, map[string]int{"10.0.0.1": 2, "10.0.0.2": 1}, &level)
+
+	start := time.Now()
+	tracker.Queued("10.0.0.1")
+	tracker.Queued("10.0.0.1")
+	stats.RecordProbe("10.0.0.1", StateOpen, nil, start, time.Millisecond)
+	tracker.Probed(ScanJob{Host: "10.0.0.1", Port: 22}, StateOpen, nil)
+	stats.RecordProbe("10.0.0.1", StateClosed, nil, start, 2*time.Millisecond)
+	tracker.Probed(ScanJob{Host: "10.0.0.1", Port: 23}, StateClosed, errors.New("connection refused"))
+
+	expected := "Starting 10.0.0.1 (2 ports)\n" +
+		"10.0.0.1:23 closed: connection refused\n" +
+		"Finished 10.0.0.1: 1 open, 1 closed, 0 filtered in 2ms\n"
+	if out.String() != expected {
+		t.Errorf("tracker output = %q, expected %q", out.String(), expected)
+	}
+
+	// At Normal hosts are still counted but nothing is printed
+	level.Store(Normal)
+	out.Reset()
+	tracker.Queued("10.0.0.2")
+	tracker.Probed(ScanJob{Host: "10.0.0.2", Port: 22}, StateFiltered, errors.New("i/o timeout"))
+	if out.Len() != 0 {
+		t.Errorf("tracker printed %q at Normal verbosity", out.String())
+	}
+	if finished, active, total := tracker.Hosts(); finished != 2 || active != 0 || total != 2 {
+		t.Errorf("Hosts() = %d, %d, %d, expected 2, 0, 2", finished, active, total)
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false}, // end of input
+		{"sure\n", false},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if got := confirm(strings.NewReader(tt.answer), &out, "Scan?"); got != tt.want {
+			t.Errorf("confirm(%q) = %v, want %v", tt.answer, got, tt.want)
+		}
+		if out.String() != "Scan? [y/N] " {
+			t.Errorf("confirm() asked %q", out.String())
+		}
+	}
+}
+
+func TestWriteHostSummary(t *testing.T) {
+	start := time.Now()
+	stats := &Stats{startTime: start}
+	timedOut := &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	stats.RecordExhausted("10.0.0.1")
+	stats.RecordProbe("10.0.0.1", StateFiltered, timedOut, start, 500*time.Millisecond)
+	stats.RecordProbe("10.0.0.2", StateOpen, nil, start, 2*time.Millisecond)
+	stats.RecordProbe("10.0.0.2", StateOpen, nil, start, 4*time.Millisecond)
+	stats.RecordProbe("10.0.0.2", StateClosed, syscall.ECONNREFUSED, start.Add(time.Second), time.Millisecond)
+	stats.RecordProbe("10.0.0.3", StateOpen, nil, start, 10*time.Millisecond)
+
+	tests := []struct {
+		name     string
+		limit    int
+		expected string
+	}{
+		{
+			name: "All",
+			expected: "\n=== Hosts ===\n" +
+				"HOST      OPEN  FILTERED  TIME   AVG RTT  FIREWALL      ERRORS\n" +
+				"10.0.0.2  2     0         1s     3ms      no filtering  refused 1\n" +
+				"10.0.0.3  1     0         10ms   10ms     no filtering  -\n" +
+				"10.0.0.1  0     1         500ms  -        no reply      timeout 1, fd limit 1\n" +
+				"1 host(s) answered no probe: every port timed out or failed, so they may be down or behind a firewall dropping everything\n",
+		},
+		{
+			name: "Limited", limit: 1,
+			expected: "\n=== Hosts ===\n" +
+				"HOST      OPEN  FILTERED  TIME  AVG RTT  FIREWALL      ERRORS\n" +
+				"10.0.0.2  2     0         1s    3ms      no filtering  refused 1\n" +
+				"... and 2 more host(s) (-v lists them all)\n" +
+				"1 host(s) answered no probe: every port timed out or failed, so they may be down or behind a firewall dropping everything\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			WriteHostSummary(&out, stats.HostStats(), tt.limit)
+			if out.String() != tt.expected {
+				t.Errorf("WriteHostSummary() = %q, expected %q", out.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestHostFirewall(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name string
+		host HostStats
+		want string
+	}{
+		{"Nothing probed", HostStats{}, ""},
+		{"Closed ports refuse", HostStats{Ports: 100, States: [numPortStates]int{StateOpen: 2, StateClosed: 98}, Errors: ProbeErrors{Refused: 98}, OpenMin: 3 * ms, OpenMax: 4 * ms}, "no filtering"},
+		{"A lost packet", HostStats{Ports: 100, States: [numPortStates]int{StateOpen: 2, StateClosed: 97, StateFiltered: 1}, Errors: ProbeErrors{Refused: 97, Timeout: 1}, OpenMin: 3 * ms, OpenMax: 4 * ms}, "no filtering"},
+		{"Allowed ports only", HostStats{Ports: 100, States: [numPortStates]int{StateOpen: 2, StateFiltered: 98}, Errors: ProbeErrors{Timeout: 98}}, "dropping"},
+		{"ICMP rejects", HostStats{Ports: 100, States: [numPortStates]int{StateOpen: 1, StateFiltered: 99}, Errors: ProbeErrors{Unreachable: 99}}, "rejecting"},
+		{"Forwarded ports", HostStats{Ports: 100, States: [numPortStates]int{StateOpen: 3, StateClosed: 97}, Errors: ProbeErrors{Refused: 97}, OpenMin: 2 * ms, OpenMax: 30 * ms}, "NAT"},
+		{"Nothing answered", HostStats{Ports: 100, States: [numPortStates]int{StateFiltered: 100}, Errors: ProbeErrors{Timeout: 100}}, "no reply"},
+	}
+	for _, tt := range tests {
+		if got := tt.host.Firewall(); got != tt.want {
+			t.Errorf("%s: Firewall() = %q, expected %q", tt.name, got, tt.want)
+		}
+	}
+}
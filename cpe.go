@@ -0,0 +1,69 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cpeProduct is the CPE vendor and product of a piece of software
+type cpeProduct struct {
+	Vendor, Product string
+	Patch           bool // versions such as "8.9p1" put the patch level in the update field, as NVD does
+}
+
+// cpeProducts maps the software named by the enrichers, lowercased, to CPE
+// names as NVD uses them. Windows is left out: SMB gives its build number,
+// which doesn't say whether it is a desktop or a server release.
+var cpeProducts = map[string]cpeProduct{
+	"openssh":           {"openbsd", "openssh", true},
+	"dropbear":          {"dropbear_ssh_project", "dropbear_ssh", false},
+	"vsftpd":            {"beasts", "vsftpd", false},
+	"proftpd":           {"proftpd", "proftpd", false},
+	"pure-ftpd":         {"pureftpd", "pure-ftpd", false},
+	"filezilla server":  {"filezilla-project", "filezilla_server", false},
+	"serv-u ftp server": {"solarwinds", "serv-u", false},
+	"wu-ftpd":           {"washington_university", "wu-ftpd", false},
+	"postfix":           {"postfix", "postfix", false},
+	"exim":              {"exim", "exim", false},
+	"sendmail":          {"sendmail", "sendmail", false},
+	"opensmtpd":         {"openbsd", "opensmtpd", false},
+	"haraka":            {"haraka_project", "haraka", false},
+	"mdaemon":           {"alt-n", "mdaemon", false},
+	"hmailserver":       {"hmailserver", "hmailserver", false},
+	"mysql":             {"oracle", "mysql", false},
+	"mariadb":           {"mariadb", "mariadb", false},
+	"postgresql":        {"postgresql", "postgresql", false},
+	"redis":             {"redis", "redis", false},
+	"memcached":         {"memcached", "memcached", false},
+	"bind":              {"isc", "bind", false},
+	"unbound":           {"nlnetlabs", "unbound", false},
+	"dnsmasq":           {"thekelleys", "dnsmasq", false},
+	"powerdns recursor": {"powerdns", "recursor", false},
+	"ntpd":              {"ntp", "ntp", true},
+}
+
+// cpeVersion is the upstream part of a version, before distribution suffixes
+// such as "-1-Debian" or "+deb12u1"
+var cpeVersion = regexp.MustCompile(`^[0-9][0-9A-Za-z.]*`)
+
+// cpePatch splits a patch level off a version, as in "8.9p1"
+var cpePatch = regexp.MustCompile(`^([0-9.]+)(p[0-9]+)$`)
+
+// productCPE returns the CPE 2.3 name of identified software, e.g.
+// "cpe:2.3:a:openbsd:openssh:8.9:p1:*:*:*:*:*:*", or "" for software it
+// doesn't know. An unknown version is left as a wildcard.
+func productCPE(product, version string) string {
+	p, ok := cpeProducts[strings.ToLower(product)]
+	if !ok {
+		return ""
+	}
+	version = cpeVersion.FindString(version)
+	update := "*"
+	if m := cpePatch.FindStringSubmatch(version); p.Patch && m != nil {
+		version, update = m[1], m[2]
+	}
+	if version == "" {
+		version = "*"
+	}
+	return strings.Join([]string{"cpe", "2.3", "a", p.Vendor, p.Product, version, update, "*", "*", "*", "*", "*", "*"}, ":")
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestProductCPE(t *testing.T) {
+	tests := []struct {
+		product, version, want string
+	}{
+		{"OpenSSH", "8.9p1", "cpe:2.3:a:openbsd:openssh:8.9:p1:*:*:*:*:*:*"},
+		{"OpenSSH", "9.6", "cpe:2.3:a:openbsd:openssh:9.6:*:*:*:*:*:*:*"},
+		{"vsFTPd", "3.0.3", "cpe:2.3:a:beasts:vsftpd:3.0.3:*:*:*:*:*:*:*"},
+		{"BIND", "9.18.24-1-Debian", "cpe:2.3:a:isc:bind:9.18.24:*:*:*:*:*:*:*"},
+		{"PostgreSQL", "", "cpe:2.3:a:postgresql:postgresql:*:*:*:*:*:*:*:*"},
+		{"ntpd", "4.2.8p15", "cpe:2.3:a:ntp:ntp:4.2.8:p15:*:*:*:*:*:*"},
+		{"MariaDB", "10.11.6", "cpe:2.3:a:mariadb:mariadb:10.11.6:*:*:*:*:*:*:*"},
+		{"Windows", "10.0.20348", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := productCPE(tt.product, tt.version); got != tt.want {
+			t.Errorf("productCPE(%q, %q) = %q, expected %q", tt.product, tt.version, got, tt.want)
+		}
+	}
+}
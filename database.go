@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DatabaseInfo is what a MySQL or PostgreSQL server reveals before anyone
+// logs in
+type DatabaseInfo struct {
+	Protocol string `json:"protocol"`          // "mysql" or "postgresql"
+	Version  string `json:"version,omitempty"` // as the server gives it; PostgreSQL only tells logged in clients
+	Auth     string `json:"auth,omitempty"`    // authentication asked for, e.g. "caching_sha2_password" or "SCRAM-SHA-256"
+	TLS      bool   `json:"tls"`               // offers TLS
+	Error    string `json:"error,omitempty"`   // why the server turned the connection away, e.g. a host not allowed
+}
+
+// databasePorts are tried by DatabaseProber when the service of a port
+// isn't known to be something else
+var databasePorts = map[string]bool{"": true, "mysql": true, "postgresql": true}
+
+// DatabaseProber is an enricher that reads the handshake of MySQL servers,
+// which talk first, and starts a PostgreSQL session on ports that don't.
+// Neither is sent credentials.
+type DatabaseProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records the database server behind a port
+func (p DatabaseProber) Enrich(r *Result, probe ProbeConfig) {
+	if !databasePorts[r.Service] {
+		return
+	}
+	info := probeDatabase(r.Host, r.Port, probe, p.Timeout)
+	if info == nil {
+		return
+	}
+	r.Database, r.Service = info, info.Protocol
+	if r.Product == "" {
+		r.Product, r.Version = databaseProduct(*info)
+	}
+}
+
+// probeDatabase identifies a MySQL or PostgreSQL server, returning nil for
+// anything else
+func probeDatabase(host string, port int, probe ProbeConfig, wait time.Duration) *DatabaseInfo {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(wait))
+	buf := make([]byte, 1024)
+	if n, _ := io.ReadAtLeast(conn, buf, 4); n > 0 {
+		info, _ := parseMySQLHandshake(buf[:n])
+		return info
+	}
+
+	// PostgreSQL waits for the client. Asking for TLS is answered with a
+	// single byte, and the answer says whether it is offered.
+	conn.SetDeadline(time.Now().Add(wait))
+	if _, err := conn.Write(postgresSSLRequest); err != nil {
+		return nil
+	}
+	if n, _ := conn.Read(buf[:1]); n != 1 || buf[0] != 'S' && buf[0] != 'N' {
+		return nil
+	}
+	info := &DatabaseInfo{Protocol: "postgresql", TLS: buf[0] == 'S'}
+
+	// The answer to a startup message is the authentication the server
+	// wants, or why it won't have this client at all
+	session, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return info
+	}
+	defer session.Close()
+	session.SetDeadline(time.Now().Add(wait))
+	if _, err := session.Write(postgresStartup("pscanner")); err != nil {
+		return info
+	}
+	kind, body, err := readPostgresMessage(session)
+	if err == nil {
+		info.Auth, info.Error = parsePostgresAuth(kind, body)
+	}
+	session.Write([]byte{'X', 0, 0, 0, 4}) // Terminate, in case no password was asked for
+	return info
+}
+
+// mysqlClientSSL is the capability flag of a MySQL server that offers TLS
+const mysqlClientSSL = 0x0800
+
+// mysqlClientPluginAuth is the capability flag of a handshake that names its
+// authentication plugin
+const mysqlClientPluginAuth = 0x00080000
+
+// parseMySQLHandshake parses the first packet of a MySQL server: an initial
+// handshake, version 10, or an error such as the client's host not being
+// allowed
+func parseMySQLHandshake(data []byte) (*DatabaseInfo, error) {
+	if len(data) < 5 {
+		return nil, fmt.Errorf("short packet")
+	}
+	length := int(data[0]) | int(data[1])<<8 | int(data[2])<<16
+	if data[3] != 0 || length < 1 || length > len(data)-4 {
+		return nil, fmt.Errorf("not a MySQL packet")
+	}
+	payload := data[4 : 4+length]
+	info := &DatabaseInfo{Protocol: "mysql"}
+
+	switch payload[0] {
+	case 0xff:
+		if len(payload) < 3 {
+			return nil, fmt.Errorf("short error packet")
+		}
+		info.Error = fmt.Sprintf("%d: %s", binary.LittleEndian.Uint16(payload[1:3]), printable(payload[3:]))
+		return info, nil
+	case 0x0a:
+	default:
+		return nil, fmt.Errorf("unknown protocol version %d", payload[0])
+	}
+
+	version, rest, ok := bytes.Cut(payload[1:], []byte{0})
+	if !ok || len(version) == 0 || len(rest) < 4+8+1+2 {
+		return nil, fmt.Errorf("truncated handshake")
+	}
+	info.Version = printable(version)
+	rest = rest[4+8+1:] // connection id, first part of the challenge and a filler
+	capabilities := uint32(binary.LittleEndian.Uint16(rest))
+	info.TLS = capabilities&mysqlClientSSL != 0
+	if len(rest) < 2+1+2+2+1+10 {
+		return info, nil
+	}
+	capabilities |= uint32(binary.LittleEndian.Uint16(rest[5:7])) << 16
+	challenge := int(rest[7])
+	rest = rest[2+1+2+2+1+10:] // capabilities, charset, status, upper capabilities, challenge length, reserved
+	if capabilities&mysqlClientPluginAuth != 0 {
+		skip := max(13, challenge-8)
+		if len(rest) > skip {
+			plugin, _, _ := bytes.Cut(rest[skip:], []byte{0})
+			info.Auth = printable(plugin)
+		}
+	}
+	return info, nil
+}
+
+// postgresSSLRequest asks a PostgreSQL server whether it offers TLS
+var postgresSSLRequest = []byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}
+
+// postgresStartup is the startup message of a protocol 3.0 session for user
+func postgresStartup(user string) []byte {
+	var params bytes.Buffer
+	for _, kv := range [][2]string{{"user", user}, {"database", user}, {"application_name", "pscanner"}} {
+		params.WriteString(kv[0] + "\x00" + kv[1] + "\x00")
+	}
+	params.WriteByte(0)
+	msg := binary.BigEndian.AppendUint32(nil, uint32(8+params.Len()))
+	msg = binary.BigEndian.AppendUint32(msg, 3<<16)
+	return append(msg, params.Bytes()...)
+}
+
+// readPostgresMessage reads one message from a PostgreSQL server
+func readPostgresMessage(r io.Reader) (kind byte, body []byte, err error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 || length > 8192 {
+		return 0, nil, fmt.Errorf("bad message length %d", length)
+	}
+	body = make([]byte, length-4)
+	_, err = io.ReadFull(r, body)
+	return header[0], body, err
+}
+
+// postgresAuthMethods names the authentication requests of PostgreSQL
+var postgresAuthMethods = map[uint32]string{
+	0: "trust", 2: "kerberos", 3: "password", 5: "md5", 7: "gss", 9: "sspi",
+}
+
+// parsePostgresAuth reads the server's answer to a startup message: the
+// authentication it asks for, or the message of the error it sent instead
+func parsePostgresAuth(kind byte, body []byte) (auth, errMsg string) {
+	switch kind {
+	case 'R':
+		if len(body) < 4 {
+			return "", ""
+		}
+		code := binary.BigEndian.Uint32(body)
+		if code == 10 { // SASL, followed by the mechanisms offered
+			var mechanisms []string
+			for _, m := range bytes.Split(body[4:], []byte{0}) {
+				if len(m) > 0 {
+					mechanisms = append(mechanisms, printable(m))
+				}
+			}
+			return strings.Join(mechanisms, ","), ""
+		}
+		if method, ok := postgresAuthMethods[code]; ok {
+			return method, ""
+		}
+		return fmt.Sprintf("method %d", code), ""
+	case 'E':
+		for _, field := range bytes.Split(body, []byte{0}) {
+			if len(field) > 1 && field[0] == 'M' {
+				return "", printable(field[1:])
+			}
+		}
+	}
+	return "", ""
+}
+
+// databaseProduct names the server software from a handshake. MariaDB
+// reports itself as "5.5.5-" followed by its own version for old clients.
+func databaseProduct(info DatabaseInfo) (product, version string) {
+	if info.Protocol == "postgresql" {
+		return "PostgreSQL", ""
+	}
+	if info.Version == "" {
+		return "", ""
+	}
+	if before, _, ok := strings.Cut(info.Version, "-MariaDB"); ok {
+		return "MariaDB", strings.TrimPrefix(before, "5.5.5-")
+	}
+	return "MySQL", info.Version
+}
+
+// printable makes bytes from the network safe to show
+func printable(b []byte) string {
+	return strings.TrimSpace(strings.ToValidUTF8(string(b), "�"))
+}
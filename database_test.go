@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// mysqlHandshake builds the initial handshake packet of a MySQL server
+func mysqlHandshake(version string, capabilities uint32, plugin string) []byte {
+	var p bytes.Buffer
+	p.WriteByte(0x0a)
+	p.WriteString(version + "\x00")
+	p.Write([]byte{1, 0, 0, 0})   // connection id
+	p.WriteString("abcdefgh\x00") // challenge, first part, and filler
+	p.Write([]byte{byte(capabilities), byte(capabilities >> 8), 0xff, 2, 0})
+	p.Write([]byte{byte(capabilities >> 16), byte(capabilities >> 24), 21})
+	p.Write(make([]byte, 10))
+	p.WriteString("ijklmnopqrst\x00") // challenge, second part
+	p.WriteString(plugin + "\x00")
+	return append([]byte{byte(p.Len()), byte(p.Len() >> 8), 0, 0}, p.Bytes()...)
+}
+
+func TestParseMySQLHandshake(t *testing.T) {
+	refused := []byte{0x44, 0, 0, 0, 0xff, 0x6a, 0x04}
+	refused = append(refused, "Host '10.0.0.1' is not allowed to connect to this MySQL server"...)
+	refused[0] = byte(len(refused) - 4)
+
+	tests := []struct {
+		name string
+		data []byte
+		want *DatabaseInfo
+	}{
+		{
+			name: "MySQL 8",
+			data: mysqlHandshake("8.0.36", 0xffffffff, "caching_sha2_password"),
+			want: &DatabaseInfo{Protocol: "mysql", Version: "8.0.36", Auth: "caching_sha2_password", TLS: true},
+		},
+		{
+			name: "Without TLS",
+			data: mysqlHandshake("5.5.5-10.6.12-MariaDB-0ubuntu0.22.04.1", 0xffffffff&^mysqlClientSSL, "mysql_native_password"),
+			want: &DatabaseInfo{Protocol: "mysql", Version: "5.5.5-10.6.12-MariaDB-0ubuntu0.22.04.1", Auth: "mysql_native_password"},
+		},
+		{
+			name: "Host not allowed",
+			data: refused,
+			want: &DatabaseInfo{Protocol: "mysql", Error: "1130: Host '10.0.0.1' is not allowed to connect to this MySQL server"},
+		},
+		{name: "SSH", data: []byte("SSH-2.0-OpenSSH_9.6\r\n")},
+		{name: "Short", data: []byte{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMySQLHandshake(tt.data)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("parseMySQLHandshake() = %+v, expected an error", got)
+				}
+				return
+			}
+			if err != nil || *got != *tt.want {
+				t.Errorf("parseMySQLHandshake() = %+v, %v, expected %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePostgresAuth(t *testing.T) {
+	sasl := binary.BigEndian.AppendUint32(nil, 10)
+	sasl = append(sasl, "SCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00\x00"...)
+	tests := []struct {
+		name        string
+		kind        byte
+		body        []byte
+		auth, error string
+	}{
+		{"SCRAM", 'R', sasl, "SCRAM-SHA-256-PLUS,SCRAM-SHA-256", ""},
+		{"MD5", 'R', []byte{0, 0, 0, 5, 1, 2, 3, 4}, "md5", ""},
+		{"Trust", 'R', []byte{0, 0, 0, 0}, "trust", ""},
+		{"Refused", 'E', []byte("SFATAL\x00C28000\x00Mno pg_hba.conf entry for host \"10.0.0.1\"\x00\x00"), "", `no pg_hba.conf entry for host "10.0.0.1"`},
+	}
+
+	for _, tt := range tests {
+		if auth, errMsg := parsePostgresAuth(tt.kind, tt.body); auth != tt.auth || errMsg != tt.error {
+			t.Errorf("%s: parsePostgresAuth() = %q, %q, expected %q, %q", tt.name, auth, errMsg, tt.auth, tt.error)
+		}
+	}
+}
+
+func TestDatabaseProduct(t *testing.T) {
+	tests := []struct {
+		info             DatabaseInfo
+		product, version string
+	}{
+		{DatabaseInfo{Protocol: "mysql", Version: "8.0.36"}, "MySQL", "8.0.36"},
+		{DatabaseInfo{Protocol: "mysql", Version: "5.5.5-10.6.12-MariaDB-0ubuntu0.22.04.1"}, "MariaDB", "10.6.12"},
+		{DatabaseInfo{Protocol: "mysql", Version: "11.2.2-MariaDB"}, "MariaDB", "11.2.2"},
+		{DatabaseInfo{Protocol: "mysql", Error: "1130: not allowed"}, "", ""},
+		{DatabaseInfo{Protocol: "postgresql", Auth: "md5"}, "PostgreSQL", ""},
+	}
+
+	for _, tt := range tests {
+		if product, version := databaseProduct(tt.info); product != tt.product || version != tt.version {
+			t.Errorf("databaseProduct(%+v) = %q, %q, expected %q, %q", tt.info, product, version, tt.product, tt.version)
+		}
+	}
+}
+
+// serveOnce runs handle on every connection to a new listener
+func serveOnce(t *testing.T, handle func(net.Conn)) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestDatabaseProber(t *testing.T) {
+	mysql := serveOnce(t, func(conn net.Conn) {
+		conn.Write(mysqlHandshake("8.0.36", 0xffffffff, "caching_sha2_password"))
+	})
+	postgres := serveOnce(t, func(conn net.Conn) {
+		header := make([]byte, 8)
+		if _, err := conn.Read(header); err != nil {
+			return
+		}
+		if bytes.Equal(header, postgresSSLRequest) {
+			conn.Write([]byte("N"))
+			return
+		}
+		conn.Write([]byte{'R', 0, 0, 0, 12, 0, 0, 0, 5, 1, 2, 3, 4}) // md5, with its salt
+	})
+	silent := serveOnce(t, func(conn net.Conn) {
+		conn.Read(make([]byte, 64))
+	})
+
+	prober := DatabaseProber{Timeout: 200 * time.Millisecond}
+	tests := []struct {
+		name    string
+		port    int
+		service string
+		want    *DatabaseInfo
+		product string
+	}{
+		{"MySQL", mysql, "", &DatabaseInfo{Protocol: "mysql", Version: "8.0.36", Auth: "caching_sha2_password", TLS: true}, "MySQL"},
+		{"PostgreSQL", postgres, "postgresql", &DatabaseInfo{Protocol: "postgresql", Auth: "md5"}, "PostgreSQL"},
+		{"Neither", silent, "", nil, ""},
+		{"Other service", mysql, "http", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: tt.port, Service: tt.service}
+			prober.Enrich(&r, ProbeConfig{})
+			if (r.Database == nil) != (tt.want == nil) || r.Database != nil && *r.Database != *tt.want {
+				t.Fatalf("Enrich() database = %+v, expected %+v", r.Database, tt.want)
+			}
+			if r.Product != tt.product {
+				t.Errorf("Enrich() product = %q, expected %q", r.Product, tt.product)
+			}
+		})
+	}
+}
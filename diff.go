@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReadResultsFile loads a result set from any of the formats pscanner
+// writes: a JSON array of results (server mode), a watch baseline, JSON
+// lines (server data directory), or the plain "ip:port" lines of -o. Only
+// open ports are kept; closed and filtered ones written with -state are
+// dropped.
+func ReadResultsFile(filename string) ([]Result, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseResults(data)
+}
+
+func parseResults(data []byte) ([]Result, error) {
+	results, err := parseAllResults(data)
+	if err != nil {
+		return nil, err
+	}
+	open := results[:0]
+	for _, r := range results {
+		if r.State == StateOpen {
+			open = append(open, r)
+		}
+	}
+	return open, nil
+}
+
+// parseTextResult parses a line written by Result.String: "ip:port" or
+// "host (ip):port", followed by the state when -state added one or the
+// attempts a flapping port answered
+func parseTextResult(line string) (Result, error) {
+	var answered, attempts int
+	if i := strings.LastIndex(line, " ("); i > 0 && strings.HasSuffix(line, ")") {
+		if _, err := fmt.Sscanf(line[i:], " (%d/%d)", &answered, &attempts); err == nil {
+			line = line[:i]
+		}
+	}
+	host := ""
+	rest := line
+	if name, after, ok := strings.Cut(line, " ("); ok {
+		ip, port, ok := strings.Cut(after, "):")
+		if !ok {
+			return Result{}, fmt.Errorf("expected host (ip):port, got %q", line)
+		}
+		host, rest = name, ip+":"+port
+	}
+	addr, stateName, hasState := strings.Cut(rest, " ")
+	state := StateOpen
+	if hasState {
+		var err error
+		if state, err = ParsePortState(strings.TrimSpace(stateName)); err != nil {
+			return Result{}, err
+		}
+	}
+	addr, udp := strings.CutSuffix(addr, "/udp")
+	sep := strings.LastIndex(addr, ":")
+	port, err := strconv.Atoi(addr[sep+1:])
+	if sep <= 0 || err != nil {
+		return Result{}, fmt.Errorf("expected ip:port, got %q", line)
+	}
+	ip := addr[:sep]
+	if host == "" {
+		host = ip
+	}
+	r := Result{Host: host, IP: ip, Port: port, State: state, Answered: answered, Attempts: attempts}
+	if udp {
+		r.Transport = "udp"
+	}
+	return r, nil
+}
+
+func parseAllResults(data []byte) ([]Result, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var results []Result
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, err
+		}
+		return results, nil
+	case '{':
+		var baseline Baseline
+		if err := json.Unmarshal(trimmed, &baseline); err == nil && baseline.Results != nil {
+			return baseline.Results, nil
+		}
+	}
+
+	var results []Result
+	for i, line := range strings.Split(string(trimmed), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var r Result
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			results = append(results, r)
+			continue
+		}
+		r, err := parseTextResult(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// ScanDiff is the difference between two result sets
+type ScanDiff struct {
+	Opened   []Result `json:"opened"`
+	Closed   []Result `json:"closed"`
+	NewHosts []string `json:"new_hosts"`
+}
+
+// Empty reports whether the two result sets were the same
+func (d ScanDiff) Empty() bool {
+	return len(d.Opened) == 0 && len(d.Closed) == 0
+}
+
+// DiffScans compares two result sets. New hosts are addresses with open ports
+// in current that had none in previous.
+func DiffScans(previous, current []Result) ScanDiff {
+	var d ScanDiff
+	d.Opened, d.Closed = diffResults(previous, current)
+
+	known := make(map[string]bool)
+	for _, r := range previous {
+		known[r.IP] = true
+	}
+	for _, r := range d.Opened {
+		if !known[r.IP] {
+			known[r.IP] = true
+			d.NewHosts = append(d.NewHosts, r.IP)
+		}
+	}
+	sort.Strings(d.NewHosts)
+	return d
+}
+
+// WriteText prints the diff for people
+func (d ScanDiff) WriteText(w io.Writer) {
+	if d.Empty() {
+		fmt.Fprintln(w, "No differences")
+		return
+	}
+	if len(d.NewHosts) > 0 {
+		fmt.Fprintf(w, "New hosts (%d):\n", len(d.NewHosts))
+		for _, h := range d.NewHosts {
+			fmt.Fprintf(w, "  %s\n", h)
+		}
+	}
+	if len(d.Opened) > 0 {
+		fmt.Fprintf(w, "Opened ports (%d):\n", len(d.Opened))
+		for _, r := range d.Opened {
+			fmt.Fprintf(w, "  + %s\n", r)
+		}
+	}
+	if len(d.Closed) > 0 {
+		fmt.Fprintf(w, "Closed ports (%d):\n", len(d.Closed))
+		for _, r := range d.Closed {
+			fmt.Fprintf(w, "  - %s\n", r)
+		}
+	}
+}
+
+// runDiff implements the "diff" subcommand. Like diff(1) it exits with 0 when
+// the result sets match, 1 when they differ and 2 on errors.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the differences as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner diff [-json] old new\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	var sets [2][]Result
+	for i, filename := range flags.Args() {
+		results, err := ReadResultsFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filename, err)
+			return 2
+		}
+		sets[i] = results
+	}
+
+	d := DiffScans(sets[0], sets[1])
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+	} else {
+		d.WriteText(os.Stdout)
+	}
+	if d.Empty() {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseResults(t *testing.T) {
+	expected := []Result{{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22}, {Host: "10.0.0.2", IP: "10.0.0.2", Port: 443}}
+	tests := []struct {
+		name     string
+		input    string
+		expected []Result
+		wantErr  bool
+	}{
+		{name: "Text output", input: "10.0.0.1:22\n10.0.0.2:443\n", expected: expected},
+		{name: "JSON array", input: `[{"host":"10.0.0.1","ip":"10.0.0.1","port":22},{"host":"10.0.0.2","ip":"10.0.0.2","port":443}]`, expected: expected},
+		{name: "JSON lines", input: "{\"host\":\"10.0.0.1\",\"ip\":\"10.0.0.1\",\"port\":22}\n{\"host\":\"10.0.0.2\",\"ip\":\"10.0.0.2\",\"port\":443}\n", expected: expected},
+		{name: "Baseline", input: `{"time":"2024-01-01T00:00:00Z","results":[{"host":"10.0.0.1","ip":"10.0.0.1","port":22},{"host":"10.0.0.2","ip":"10.0.0.2","port":443}]}`, expected: expected},
+		{name: "IPv6 text", input: "::1:8080\n", expected: []Result{{Host: "::1", IP: "::1", Port: 8080}}},
+		{name: "Text with -state", input: "10.0.0.1:22\n10.0.0.1:23 closed\n10.0.0.2:443\n10.0.0.3:80 filtered\n", expected: expected},
+		{name: "JSON with states", input: `[{"host":"10.0.0.1","ip":"10.0.0.1","port":22},{"host":"10.0.0.1","ip":"10.0.0.1","port":23,"state":"closed"},{"host":"10.0.0.2","ip":"10.0.0.2","port":443}]`, expected: expected},
+		{name: "Hostname text", input: "web.example.com (10.0.0.1):22\nweb.example.com (10.0.0.1):25 filtered\n",
+			expected: []Result{{Host: "web.example.com", IP: "10.0.0.1", Port: 22}}},
+		{name: "Hostname IPv6 text", input: "localhost (::1):8080\n", expected: []Result{{Host: "localhost", IP: "::1", Port: 8080}}},
+		{name: "UDP text", input: "10.0.0.1:161/udp\nprinter (10.0.0.2):161/udp\n",
+			expected: []Result{{Host: "10.0.0.1", IP: "10.0.0.1", Port: 161, Transport: "udp"}, {Host: "printer", IP: "10.0.0.2", Port: 161, Transport: "udp"}}},
+		{name: "Unclosed hostname", input: "web.example.com (10.0.0.1:22\n", wantErr: true},
+		{name: "Unknown state", input: "10.0.0.1:22 ajar\n", wantErr: true},
+		{name: "Empty", input: "\n", expected: nil},
+		{name: "Missing port", input: "10.0.0.1\n", wantErr: true},
+		{name: "Bad JSON line", input: "{\"port\":\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResults([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("parseResults() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDiffScans(t *testing.T) {
+	r := func(ip string, port int) Result { return Result{Host: ip, IP: ip, Port: port} }
+	previous := []Result{r("10.0.0.1", 22), r("10.0.0.1", 80)}
+	current := []Result{r("10.0.0.1", 22), r("10.0.0.1", 443), r("10.0.0.9", 3306)}
+
+	d := DiffScans(previous, current)
+	if !reflect.DeepEqual(d.Opened, []Result{r("10.0.0.1", 443), r("10.0.0.9", 3306)}) {
+		t.Errorf("Opened = %v", d.Opened)
+	}
+	if !reflect.DeepEqual(d.Closed, []Result{r("10.0.0.1", 80)}) {
+		t.Errorf("Closed = %v", d.Closed)
+	}
+	if !reflect.DeepEqual(d.NewHosts, []string{"10.0.0.9"}) {
+		t.Errorf("NewHosts = %v, expected [10.0.0.9]", d.NewHosts)
+	}
+
+	var out bytes.Buffer
+	d.WriteText(&out)
+	expected := "New hosts (1):\n  10.0.0.9\nOpened ports (2):\n  + 10.0.0.1:443\n  + 10.0.0.9:3306\nClosed ports (1):\n  - 10.0.0.1:80\n"
+	if out.String() != expected {
+		t.Errorf("WriteText() = %q, expected %q", out.String(), expected)
+	}
+
+	if !DiffScans(previous, previous).Empty() {
+		t.Error("DiffScans() of identical sets is not empty")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Service discovery sources return endpoints with their own ports, which
+// are scanned as-is rather than combined with -p.
+
+// endpointSet collects unique host/port endpoints in discovery order
+type endpointSet struct {
+	seen map[ScanJob]bool
+	list []ScanJob
+}
+
+func (s *endpointSet) add(host string, port int) {
+	job := ScanJob{Host: host, Port: port}
+	if host == "" || port <= 0 || s.seen[job] {
+		return
+	}
+	if s.seen == nil {
+		s.seen = make(map[ScanJob]bool)
+	}
+	s.seen[job] = true
+	s.list = append(s.list, job)
+}
+
+// KubernetesEndpoints lists service cluster IPs and the pod addresses behind
+// them using kubectl, so the usual kubeconfig, contexts and auth plugins apply
+func KubernetesEndpoints(kubeconfig, kubeContext string) ([]ScanJob, error) {
+	args := []string{"get", "services,endpointslices", "--all-namespaces", "--output", "json"}
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig", kubeconfig)
+	}
+	if kubeContext != "" {
+		args = append(args, "--context", kubeContext)
+	}
+	out, err := runCommand("kubectl", args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseKubernetesList(out)
+}
+
+func parseKubernetesList(data []byte) ([]ScanJob, error) {
+	var list struct {
+		Items []struct {
+			Kind string `json:"kind"`
+			// Service
+			Spec struct {
+				ClusterIPs []string `json:"clusterIPs"`
+				Ports      []struct {
+					Port     int    `json:"port"`
+					Protocol string `json:"protocol"`
+				} `json:"ports"`
+			} `json:"spec"`
+			// EndpointSlice
+			Endpoints []struct {
+				Addresses []string `json:"addresses"`
+			} `json:"endpoints"`
+			Ports []struct {
+				Port     int    `json:"port"`
+				Protocol string `json:"protocol"`
+			} `json:"ports"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parsing kubectl output: %v", err)
+	}
+
+	// Only TCP ports can be probed; an empty protocol defaults to TCP
+	tcp := func(protocol string) bool { return protocol == "" || protocol == "TCP" }
+	var set endpointSet
+	for _, item := range list.Items {
+		switch item.Kind {
+		case "Service":
+			for _, ip := range item.Spec.ClusterIPs {
+				if ip == "None" {
+					continue // headless service
+				}
+				for _, p := range item.Spec.Ports {
+					if tcp(p.Protocol) {
+						set.add(ip, p.Port)
+					}
+				}
+			}
+		case "EndpointSlice":
+			for _, ep := range item.Endpoints {
+				for _, ip := range ep.Addresses {
+					for _, p := range item.Ports {
+						if tcp(p.Protocol) {
+							set.add(ip, p.Port)
+						}
+					}
+				}
+			}
+		}
+	}
+	return set.list, nil
+}
+
+// ConsulEndpoints lists every service instance registered in a Consul
+// catalog. CONSUL_HTTP_TOKEN is sent when set.
+func ConsulEndpoints(addr string) ([]ScanJob, error) {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	addr = strings.TrimRight(addr, "/")
+	client := &http.Client{Timeout: 10 * time.Second}
+	get := func(path string, v any) error {
+		req, err := http.NewRequest(http.MethodGet, addr+path, nil)
+		if err != nil {
+			return err
+		}
+		if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+			req.Header.Set("X-Consul-Token", token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("consul %s returned %s", path, resp.Status)
+		}
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	var services map[string][]string
+	if err := get("/v1/catalog/services", &services); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var set endpointSet
+	for _, name := range names {
+		var instances []struct {
+			Address        string `json:"Address"`
+			ServiceAddress string `json:"ServiceAddress"`
+			ServicePort    int    `json:"ServicePort"`
+		}
+		if err := get("/v1/catalog/service/"+url.PathEscape(name), &instances); err != nil {
+			return nil, err
+		}
+		for _, inst := range instances {
+			// ServiceAddress is empty when the service uses the node's address
+			host := inst.ServiceAddress
+			if host == "" {
+				host = inst.Address
+			}
+			set.add(host, inst.ServicePort)
+		}
+	}
+	return set.list, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseKubernetesList(t *testing.T) {
+	data := `{"kind": "List", "items": [
+		{"kind": "Service", "spec": {"clusterIPs": ["10.96.0.10"], "ports": [
+			{"port": 53, "protocol": "UDP"}, {"port": 53, "protocol": "TCP"}, {"port": 9153}]}},
+		{"kind": "Service", "spec": {"clusterIPs": ["None"], "ports": [{"port": 5432}]}},
+		{"kind": "EndpointSlice", "endpoints": [
+			{"addresses": ["10.244.0.5"]}, {"addresses": ["10.244.1.7"]}],
+			"ports": [{"port": 8080, "protocol": "TCP"}]},
+		{"kind": "EndpointSlice", "endpoints": [{"addresses": ["10.244.0.5"]}],
+			"ports": [{"port": 8080, "protocol": "TCP"}]}
+	]}`
+
+	got, err := parseKubernetesList([]byte(data))
+	if err != nil {
+		t.Fatalf("parseKubernetesList() error = %v", err)
+	}
+	expected := []ScanJob{
+		{Host: "10.96.0.10", Port: 53},
+		{Host: "10.96.0.10", Port: 9153},
+		{Host: "10.244.0.5", Port: 8080},
+		{Host: "10.244.1.7", Port: 8080},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("parseKubernetesList() = %v, expected %v", got, expected)
+	}
+}
+
+func TestConsulEndpoints(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_TOKEN", "secret")
+	catalog := map[string]any{
+		"/v1/catalog/services":       map[string][]string{"web": {"v1"}, "consul": {}},
+		"/v1/catalog/service/web":    []map[string]any{{"Address": "10.0.0.1", "ServiceAddress": "", "ServicePort": 8080}, {"Address": "10.0.0.2", "ServiceAddress": "172.17.0.4", "ServicePort": 8080}},
+		"/v1/catalog/service/consul": []map[string]any{{"Address": "10.0.0.9", "ServicePort": 8300}},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "ACL not found", http.StatusForbidden)
+			return
+		}
+		body, ok := catalog[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer ts.Close()
+
+	got, err := ConsulEndpoints(ts.URL)
+	if err != nil {
+		t.Fatalf("ConsulEndpoints() error = %v", err)
+	}
+	expected := []ScanJob{
+		{Host: "10.0.0.9", Port: 8300},
+		{Host: "10.0.0.1", Port: 8080},
+		{Host: "172.17.0.4", Port: 8080},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ConsulEndpoints() = %v, expected %v", got, expected)
+	}
+}
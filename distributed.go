@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// A distributed scan is run by one controller and any number of agents. The
+// controller splits the targets into shards of hosts, hands them out to agents
+// that poll for work, and collects their results. Agents report progress
+// periodically; an agent that stays silent longer than the agent timeout is
+// considered dead and its shards are handed to the remaining agents.
+
+// Shard is a slice of the targets assigned to one agent at a time
+type Shard struct {
+	ID    int      `json:"id"`
+	Hosts []string `json:"hosts"`
+	Ports string   `json:"ports"`
+
+	agent   string
+	scanned int
+	done    bool
+}
+
+// ShardReport is sent by an agent while and after scanning a shard
+type ShardReport struct {
+	ShardID  int      `json:"shard_id"`
+	Scanned  int      `json:"scanned"`
+	Results  []Result `json:"results"`
+	Complete bool     `json:"complete"`
+}
+
+type agentInfo struct {
+	name     string
+	lastSeen time.Time
+}
+
+// Controller hands out shards to agents and aggregates their results
+type Controller struct {
+	mu        sync.Mutex
+	shards    []*Shard
+	pending   []*Shard
+	agents    map[string]*agentInfo
+	seen      map[string]bool
+	remaining int
+	portCount int
+	token     string
+	maxAgents int // 0 = unlimited
+	timeout   time.Duration
+	onResult  func(Result)
+	done      chan struct{}
+}
+
+// NewController splits hosts into shards of at most shardSize hosts
+func NewController(hosts []string, portSpec string, shardSize int, timeout time.Duration, onResult func(Result)) (*Controller, error) {
+	portList, err := PortsOrDefault(portSpec)
+	if err != nil {
+		return nil, err
+	}
+	if shardSize < 1 {
+		shardSize = 1
+	}
+	c := &Controller{
+		agents:    make(map[string]*agentInfo),
+		seen:      make(map[string]bool),
+		portCount: len(portList),
+		timeout:   timeout,
+		onResult:  onResult,
+		done:      make(chan struct{}),
+	}
+	for start := 0; start < len(hosts); start += shardSize {
+		end := min(start+shardSize, len(hosts))
+		shard := &Shard{ID: len(c.shards), Hosts: hosts[start:end], Ports: portSpec}
+		c.shards = append(c.shards, shard)
+		c.pending = append(c.pending, shard)
+	}
+	c.remaining = len(c.shards)
+	if c.remaining == 0 {
+		close(c.done)
+	}
+	return c, nil
+}
+
+// Done is closed once every shard has been completed
+func (c *Controller) Done() <-chan struct{} {
+	return c.done
+}
+
+// Progress returns the ports scanned so far, the total, and the number of live agents
+func (c *Controller) Progress() (int, int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	scanned, total := 0, 0
+	for _, shard := range c.shards {
+		scanned += shard.scanned
+		total += len(shard.Hosts) * c.portCount
+	}
+	return scanned, total, len(c.agents)
+}
+
+// Handler returns the HTTP routes agents talk to
+func (c *Controller) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /agents", c.handleRegister)
+	mux.HandleFunc("POST /agents/{id}/lease", c.handleLease)
+	mux.HandleFunc("POST /agents/{id}/report", c.handleReport)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented := []byte(r.Header.Get("Authorization"))
+		if c.token != "" && subtle.ConstantTimeCompare(presented, []byte("Bearer "+c.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// touch marks an agent as alive; c.mu must be held
+func (c *Controller) touch(id string) *agentInfo {
+	agent := c.agents[id]
+	if agent != nil {
+		agent.lastSeen = time.Now()
+	}
+	return agent
+}
+
+func (c *Controller) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	id := randomID(8)
+	c.mu.Lock()
+	if c.maxAgents > 0 && len(c.agents) >= c.maxAgents {
+		c.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "too many agents: at most %d may be registered", c.maxAgents)
+		return
+	}
+	c.agents[id] = &agentInfo{name: req.Name, lastSeen: time.Now()}
+	c.mu.Unlock()
+	slog.Info("agent registered", "agent", req.Name, "id", id)
+	writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+}
+
+func (c *Controller) handleLease(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.touch(id) == nil {
+		writeError(w, http.StatusNotFound, "unknown agent")
+		return
+	}
+	if c.remaining == 0 {
+		writeError(w, http.StatusGone, "scan complete")
+		return
+	}
+	if len(c.pending) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	shard := c.pending[0]
+	c.pending = c.pending[1:]
+	shard.agent = id
+	shard.scanned = 0
+	writeJSON(w, http.StatusOK, shard)
+}
+
+func (c *Controller) handleReport(w http.ResponseWriter, r *http.Request) {
+	var report ShardReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid report: %v", err)
+		return
+	}
+	id := r.PathValue("id")
+
+	c.mu.Lock()
+	if report.ShardID < 0 || report.ShardID >= len(c.shards) {
+		c.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "unknown shard %d", report.ShardID)
+		return
+	}
+	shard := c.shards[report.ShardID]
+
+	// Results are kept even from an agent that lost its shard, or was reaped
+	// while it was still scanning, since the ports were genuinely found
+	// open; duplicates are dropped.
+	var fresh []Result
+	for _, res := range report.Results {
+		key := res.Key()
+		if !c.seen[key] {
+			c.seen[key] = true
+			fresh = append(fresh, res)
+		}
+	}
+	known := c.touch(id) != nil
+	owned := known && shard.agent == id && !shard.done
+	if owned {
+		shard.scanned = report.Scanned
+		if report.Complete {
+			shard.done = true
+			c.remaining--
+			if c.remaining == 0 {
+				close(c.done)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	for _, res := range fresh {
+		c.onResult(res)
+	}
+	if !known {
+		writeError(w, http.StatusNotFound, "unknown agent")
+		return
+	}
+	if !owned {
+		writeError(w, http.StatusConflict, "shard %d is no longer assigned to this agent", shard.ID)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reap forgets agents that have been silent longer than the agent timeout
+// and puts their unfinished shards back in the queue
+func (c *Controller) Reap() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, agent := range c.agents {
+		if time.Since(agent.lastSeen) <= c.timeout {
+			continue
+		}
+		delete(c.agents, id)
+		requeued := 0
+		for _, shard := range c.shards {
+			if shard.agent == id && !shard.done {
+				shard.agent = ""
+				shard.scanned = 0
+				c.pending = append(c.pending, shard)
+				requeued++
+			}
+		}
+		slog.Warn("agent stopped responding; reassigning its shards", "agent", agent.name, "id", id, "shards", requeued)
+	}
+}
+
+// runController implements the "controller" subcommand
+func runController(args []string) int {
+	flags := flag.NewFlagSet("controller", flag.ExitOnError)
+	listen := flags.String("listen", ":7000", "Address agents connect to")
+	token := flags.String("token", "", "Shared secret agents must present; required unless -listen is a loopback address")
+	maxAgents := flags.Int("max-agents", 256, "Maximum number of agents registered at once (0 = unlimited)")
+	shardSize := flags.Int("shard-size", 16, "Number of hosts handed to an agent at a time")
+	agentTimeout := flags.Duration("agent-timeout", 30*time.Second, "Reassign an agent's shards after this long without contact")
+	addTargetFlags(flags)
+	flags.StringVar(&outputFile, "o", "", "Output file to save results")
+	addLogFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+
+	if *token == "" && !isLoopbackAddr(*listen) {
+		fmt.Fprintf(os.Stderr, "Error: -token is required when -listen is not a loopback address\n")
+		return exitError
+	}
+	if *maxAgents < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-agents must not be negative\n")
+		return exitError
+	}
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no targets given (use -h, -hf or -cf)\n")
+		return exitError
+	}
+
+	var output io.Writer
+	if outputFile != "" {
+		f, err := os.Create(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
+			return exitError
+		}
+		defer f.Close()
+		output = f
+	}
+
+	found := 0
+	var outputMu sync.Mutex
+	if err := resolvePorts(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	c, err := NewController(hosts, ports, *shardSize, *agentTimeout, func(r Result) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		found++
+		line := r.String() + "\n"
+		fmt.Print(line)
+		if output != nil {
+			output.Write([]byte(line))
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing ports: %v\n", err)
+		return exitError
+	}
+	c.token, c.maxAgents = *token, *maxAgents
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	go func() {
+		if err := http.Serve(ln, c.Handler()); err != nil {
+			slog.Error("running controller", "err", err)
+		}
+	}()
+	slog.Info("controller listening", "addr", ln.Addr().String(), "shards", len(c.shards), "shard_size", *shardSize)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	interrupted := false
+	for {
+		select {
+		case <-ticker.C:
+			c.Reap()
+			scanned, total, agents := c.Progress()
+			slog.Info("progress", "percent", math.Round(float64(scanned)*10000/float64(total))/100,
+				"scanned", scanned, "total", total, "agents", agents)
+			continue
+		case <-ctx.Done():
+			interrupted = true
+		case <-c.Done():
+			// Give agents a moment to learn the scan is over before exiting
+			time.Sleep(2 * time.Second)
+		}
+		break
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if interrupted {
+		fmt.Printf("\n=== Scan Interrupted ===\n")
+	} else {
+		fmt.Printf("\n=== Scan Complete ===\n")
+	}
+	fmt.Printf("Hosts scanned: %d\n", len(hosts))
+	fmt.Printf("Open ports found: %d\n", found)
+	fmt.Printf("Time elapsed: %v\n", time.Since(start).Round(time.Second))
+	switch {
+	case interrupted:
+		return exitPartial
+	case found == 0:
+		return exitNoneOpen
+	}
+	return exitOpen
+}
+
+// isLoopbackAddr reports whether a listen address only accepts connections
+// from this machine
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// agentClient talks to a controller on behalf of an agent
+type agentClient struct {
+	base  string
+	token string
+	id    string
+	http  *http.Client
+	probe ProbeConfig // how shards are scanned
+}
+
+func (a *agentClient) post(path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.base+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	return a.http.Do(req)
+}
+
+func (a *agentClient) register(name string) error {
+	resp, err := a.post("/agents", map[string]string{"name": name})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("controller returned %s", resp.Status)
+	}
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	a.id = body.ID
+	return nil
+}
+
+// lease asks the controller for a shard. A nil shard with a nil error means
+// the status code explains why no work was handed out.
+func (a *agentClient) lease() (*Shard, int, error) {
+	resp, err := a.post("/agents/"+a.id+"/lease", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, nil
+	}
+	shard := &Shard{}
+	if err := json.NewDecoder(resp.Body).Decode(shard); err != nil {
+		return nil, resp.StatusCode, err
+	}
+	return shard, resp.StatusCode, nil
+}
+
+// report sends progress for a shard and returns the controller's status code
+func (a *agentClient) report(report ShardReport) (int, error) {
+	resp, err := a.post("/agents/"+a.id+"/report", report)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// scanShard scans one shard, reporting progress and results every interval.
+// The scan is abandoned if the controller says the shard was reassigned.
+func (a *agentClient) scanShard(shard *Shard, workers int, interval time.Duration) error {
+	portList, err := PortsOrDefault(shard.Ports)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stats := &Stats{startTime: time.Now()}
+	var mu sync.Mutex
+	var batch []Result
+	// flush sends the results gathered so far and reports whether the
+	// controller accepted them; unsent results are kept for the next attempt
+	flush := func(complete bool) bool {
+		mu.Lock()
+		results := batch
+		batch = nil
+		mu.Unlock()
+		scanned, _, _ := stats.GetStats()
+		status, err := a.report(ShardReport{ShardID: shard.ID, Scanned: scanned, Results: results, Complete: complete})
+		if err != nil || status >= http.StatusInternalServerError {
+			mu.Lock()
+			batch = append(results, batch...)
+			mu.Unlock()
+			if err != nil {
+				slog.Warn("reporting to controller", "shard", shard.ID, "err", err)
+			}
+			return false
+		}
+		if status == http.StatusConflict || status == http.StatusNotFound {
+			cancel()
+		}
+		return true
+	}
+
+	stopReports := make(chan struct{})
+	reportsDone := make(chan struct{})
+	go func() {
+		defer close(reportsDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush(false)
+			case <-stopReports:
+				return
+			}
+		}
+	}()
+
+	RunScan(ctx, shard.Hosts, portList, ScanOptions{Workers: workers, Probe: a.probe}, stats, func(r Result) {
+		mu.Lock()
+		batch = append(batch, r)
+		mu.Unlock()
+	})
+	close(stopReports)
+	<-reportsDone
+	if ctx.Err() != nil {
+		return fmt.Errorf("shard %d was reassigned", shard.ID)
+	}
+	for attempt := 0; attempt < 5; attempt++ {
+		if flush(true) {
+			return nil
+		}
+		time.Sleep(interval)
+	}
+	return fmt.Errorf("could not deliver results for shard %d", shard.ID)
+}
+
+// runAgent implements the "agent" subcommand
+func runAgent(args []string) int {
+	hostname, _ := os.Hostname()
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	controller := flags.String("controller", "", "Controller URL (e.g., http://controller:7000)")
+	token := flags.String("token", "", "Shared secret expected by the controller")
+	name := flags.String("name", hostname, "Name reported to the controller")
+	addProbeFlags(flags)
+	addLogFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if !checkProbeFlags() {
+		return 2
+	}
+
+	if *controller == "" {
+		fmt.Fprintf(os.Stderr, "Error: -controller is required\n")
+		return 2
+	}
+	a := &agentClient{
+		base:  strings.TrimRight(*controller, "/"),
+		token: *token,
+		http:  &http.Client{Timeout: 30 * time.Second},
+		probe: probeConfig,
+	}
+	const pollInterval = 2 * time.Second
+
+	for {
+		if a.id == "" {
+			if err := a.register(*name); err != nil {
+				slog.Warn("registering with controller", "err", err)
+				time.Sleep(pollInterval)
+				continue
+			}
+			slog.Info("registered with controller", "controller", a.base, "id", a.id)
+		}
+
+		shard, status, err := a.lease()
+		switch {
+		case err != nil:
+			slog.Warn("contacting controller", "err", err)
+			time.Sleep(pollInterval)
+			continue
+		case status == http.StatusGone:
+			slog.Info("scan complete")
+			return 0
+		case status == http.StatusNotFound:
+			a.id = "" // the controller forgot us; register again
+			continue
+		case shard == nil:
+			time.Sleep(pollInterval)
+			continue
+		}
+
+		slog.Info("scanning shard", "shard", shard.ID, "hosts", len(shard.Hosts))
+		if err := a.scanShard(shard, concurrency, pollInterval); err != nil {
+			slog.Error("scanning shard", "shard", shard.ID, "err", err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewControllerShards(t *testing.T) {
+	tests := []struct {
+		name      string
+		hosts     int
+		shardSize int
+		expected  int
+	}{
+		{name: "Even split", hosts: 8, shardSize: 4, expected: 2},
+		{name: "Remainder", hosts: 9, shardSize: 4, expected: 3},
+		{name: "Single shard", hosts: 3, shardSize: 16, expected: 1},
+		{name: "Zero size", hosts: 2, shardSize: 0, expected: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts := make([]string, tt.hosts)
+			for i := range hosts {
+				hosts[i] = fmt.Sprintf("10.0.0.%d", i+1)
+			}
+			c, err := NewController(hosts, "80", tt.shardSize, time.Minute, func(Result) {})
+			if err != nil {
+				t.Fatalf("NewController() error = %v", err)
+			}
+			if len(c.shards) != tt.expected {
+				t.Errorf("NewController() made %d shards, expected %d", len(c.shards), tt.expected)
+			}
+		})
+	}
+}
+
+func TestControllerAgentScan(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	var mu sync.Mutex
+	var results []Result
+	c, err := NewController([]string{"127.0.0.1"}, fmt.Sprint(port), 1, time.Minute, func(r Result) {
+		mu.Lock()
+		results = append(results, r)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	c.token = "secret"
+	ts := httptest.NewServer(c.Handler())
+	defer ts.Close()
+
+	intruder := &agentClient{base: ts.URL, token: "wrong", http: ts.Client()}
+	if err := intruder.register("intruder"); err == nil {
+		t.Error("register() with a wrong token succeeded")
+	}
+
+	a := &agentClient{base: ts.URL, token: "secret", http: ts.Client(), probe: quickProbe}
+	if err := a.register("test"); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	shard, _, err := a.lease()
+	if err != nil || shard == nil {
+		t.Fatalf("lease() = %v, %v", shard, err)
+	}
+	if _, status, _ := a.lease(); status != http.StatusNoContent {
+		t.Errorf("lease() with no pending work = %d, expected %d", status, http.StatusNoContent)
+	}
+	if err := a.scanShard(shard, 10, 50*time.Millisecond); err != nil {
+		t.Fatalf("scanShard() error = %v", err)
+	}
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("controller not done after the only shard completed")
+	}
+	if _, status, _ := a.lease(); status != http.StatusGone {
+		t.Errorf("lease() after completion = %d, expected %d", status, http.StatusGone)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 1 || results[0].Port != port {
+		t.Errorf("results = %+v, expected port %d", results, port)
+	}
+}
+
+func TestControllerReassignsSilentAgent(t *testing.T) {
+	var found []Result
+	c, err := NewController([]string{"10.0.0.1"}, "80", 1, 10*time.Millisecond, func(r Result) { found = append(found, r) })
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	ts := httptest.NewServer(c.Handler())
+	defer ts.Close()
+
+	first := &agentClient{base: ts.URL, http: ts.Client()}
+	second := &agentClient{base: ts.URL, http: ts.Client()}
+	for _, a := range []*agentClient{first, second} {
+		if err := a.register("test"); err != nil {
+			t.Fatalf("register() error = %v", err)
+		}
+	}
+	shard, _, err := first.lease()
+	if err != nil || shard == nil {
+		t.Fatalf("lease() = %v, %v", shard, err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	second.lease() // keeps the second agent alive through the reap
+	c.Reap()
+
+	reassigned, _, err := second.lease()
+	if err != nil || reassigned == nil || reassigned.ID != shard.ID {
+		t.Fatalf("lease() after reap = %v, %v, expected shard %d", reassigned, err, shard.ID)
+	}
+	// What the reaped agent found before it was given up on still counts
+	open := Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80}
+	if status, _ := first.report(ShardReport{ShardID: shard.ID, Results: []Result{open}, Complete: true}); status != http.StatusNotFound {
+		t.Errorf("report() from reaped agent = %d, expected %d", status, http.StatusNotFound)
+	}
+	if len(found) != 1 || found[0].Key() != open.Key() {
+		t.Errorf("results after report from reaped agent = %+v, expected %s", found, open)
+	}
+	if status, _ := second.report(ShardReport{ShardID: shard.ID, Scanned: 1, Complete: true}); status != http.StatusNoContent {
+		t.Errorf("report() from new owner = %d, expected %d", status, http.StatusNoContent)
+	}
+}
+
+func TestControllerMaxAgents(t *testing.T) {
+	c, err := NewController([]string{"10.0.0.1"}, "80", 1, 10*time.Millisecond, func(Result) {})
+	if err != nil {
+		t.Fatalf("NewController() error = %v", err)
+	}
+	c.maxAgents = 1
+	ts := httptest.NewServer(c.Handler())
+	defer ts.Close()
+
+	first := &agentClient{base: ts.URL, http: ts.Client()}
+	if err := first.register("first"); err != nil {
+		t.Fatalf("register() error = %v", err)
+	}
+	second := &agentClient{base: ts.URL, http: ts.Client()}
+	if err := second.register("second"); err == nil {
+		t.Error("register() beyond -max-agents succeeded")
+	}
+
+	// A reaped agent frees its place
+	time.Sleep(20 * time.Millisecond)
+	c.Reap()
+	if err := second.register("second"); err != nil {
+		t.Errorf("register() after reap error = %v", err)
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected bool
+	}{
+		{"127.0.0.1:7000", true},
+		{"[::1]:7000", true},
+		{"localhost:7000", true},
+		{":7000", false},
+		{"0.0.0.0:7000", false},
+		{"10.0.0.5:7000", false},
+		{"controller:7000", false},
+		{"7000", false},
+	}
+	for _, tt := range tests {
+		if got := isLoopbackAddr(tt.addr); got != tt.expected {
+			t.Errorf("isLoopbackAddr(%q) = %v, expected %v", tt.addr, got, tt.expected)
+		}
+	}
+}
+
+func TestRunControllerRequiresToken(t *testing.T) {
+	if code := runController([]string{"-listen", ":0", "-h", "10.0.0.1", "-p", "80"}); code != exitError {
+		t.Errorf("runController() without -token on all interfaces = %d, expected %d", code, exitError)
+	}
+}
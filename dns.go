@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DNSInfo is how a DNS server answered a query for the root name servers
+type DNSInfo struct {
+	Rcode     string `json:"rcode"`             // response code, e.g. "NOERROR" or "REFUSED"
+	Recursion bool   `json:"recursion"`         // resolved the query for us: an open resolver, unless meant for these clients
+	Version   string `json:"version,omitempty"` // answer to version.bind with -dns-version
+}
+
+// dnsVersion is the -dns-version flag
+var dnsVersion bool
+
+// DNS record types and classes used by the probes
+const (
+	dnsTypeNS    = 2
+	dnsTypeTXT   = 16
+	dnsClassIN   = 1
+	dnsClassCH   = 3
+	dnsProbeID   = 0x7073
+	dnsVersionID = 0x7074
+)
+
+// dnsRcodes names the response codes
+var dnsRcodes = []string{"NOERROR", "FORMERR", "SERVFAIL", "NXDOMAIN", "NOTIMP", "REFUSED"}
+
+// dnsQuery encodes a query for one name, with recursion desired
+func dnsQuery(id uint16, name string, qtype, qclass uint16) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, id)
+	msg = append(msg, 0x01, 0, 0, 1, 0, 0, 0, 0, 0, 0) // RD, one question
+	for _, label := range strings.Split(strings.Trim(name, "."), ".") {
+		if label != "" {
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, qclass)
+}
+
+// dnsProbeQuery asks for the root name servers, which any resolver can
+// answer and any other server at least refuses
+var dnsProbeQuery = dnsQuery(dnsProbeID, ".", dnsTypeNS, dnsClassIN)
+
+// dnsVersionQuery asks for version.bind in the CHAOS class, which BIND,
+// Unbound, dnsmasq and others answer with their software unless told not to
+var dnsVersionQuery = dnsQuery(dnsVersionID, "version.bind", dnsTypeTXT, dnsClassCH)
+
+// dnsReply is the part of a DNS response the probes look at
+type dnsReply struct {
+	Rcode     int
+	Recursion bool     // recursion available
+	Answers   int      // records in the answer section
+	TXT       []string // strings of the TXT answers
+}
+
+// parseDNSReply decodes the response to a query with the given ID
+func parseDNSReply(msg []byte, id uint16) (dnsReply, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id || msg[2]&0x80 == 0 {
+		return dnsReply{}, fmt.Errorf("not a DNS response")
+	}
+	reply := dnsReply{Rcode: int(msg[3] & 0x0f), Recursion: msg[3]&0x80 != 0}
+	questions, answers := binary.BigEndian.Uint16(msg[4:]), binary.BigEndian.Uint16(msg[6:])
+	reply.Answers = int(answers)
+	offset := 12
+	for i := 0; i < int(questions); i++ {
+		if offset = skipDNSName(msg, offset); offset < 0 || offset+4 > len(msg) {
+			return reply, nil
+		}
+		offset += 4
+	}
+	for i := 0; i < int(answers); i++ {
+		if offset = skipDNSName(msg, offset); offset < 0 || offset+10 > len(msg) {
+			break
+		}
+		rtype, length := binary.BigEndian.Uint16(msg[offset:]), int(binary.BigEndian.Uint16(msg[offset+8:]))
+		offset += 10
+		if offset+length > len(msg) {
+			break
+		}
+		if rtype == dnsTypeTXT {
+			for data := msg[offset : offset+length]; len(data) > 0 && int(data[0]) < len(data); data = data[1+data[0]:] {
+				reply.TXT = append(reply.TXT, printable(data[1:1+data[0]]))
+			}
+		}
+		offset += length
+	}
+	return reply, nil
+}
+
+// skipDNSName returns the offset just past the name at offset, or -1 if it
+// runs off the end of the message
+func skipDNSName(msg []byte, offset int) int {
+	for offset < len(msg) {
+		switch n := int(msg[offset]); {
+		case n == 0:
+			return offset + 1
+		case n&0xc0 == 0xc0: // pointer to a name earlier in the message
+			return offset + 2
+		default:
+			offset += 1 + n
+		}
+	}
+	return -1
+}
+
+// dnsInfo summarizes the response to dnsProbeQuery
+func dnsInfo(reply dnsReply) *DNSInfo {
+	info := &DNSInfo{Rcode: fmt.Sprintf("RCODE%d", reply.Rcode)}
+	if reply.Rcode < len(dnsRcodes) {
+		info.Rcode = dnsRcodes[reply.Rcode]
+	}
+	info.Recursion = reply.Recursion && reply.Rcode == 0 && reply.Answers > 0
+	return info
+}
+
+// applyDNSVersion records the answer to dnsVersionQuery, naming the software
+// when it is recognizable
+func applyDNSVersion(r *Result, msg []byte) {
+	reply, err := parseDNSReply(msg, dnsVersionID)
+	if err != nil || reply.Rcode != 0 || len(reply.TXT) == 0 {
+		return
+	}
+	r.DNS.Version = reply.TXT[0]
+	if r.Product == "" {
+		r.Product, r.Version = dnsProduct(r.DNS.Version)
+	}
+}
+
+// dnsProduct splits a version.bind answer such as "9.18.24-1-Debian",
+// "unbound 1.17.1" or "dnsmasq-2.89" into product and version. BIND gives
+// its version alone.
+func dnsProduct(version string) (product, v string) {
+	if version == "" {
+		return "", ""
+	}
+	if unicode.IsDigit(rune(version[0])) {
+		return "BIND", version
+	}
+	if i := strings.LastIndex(version, " "); i > 0 && i+1 < len(version) && unicode.IsDigit(rune(version[i+1])) {
+		return version[:i], version[i+1:]
+	}
+	return splitProduct(version)
+}
+
+// parseDNSUDPReply is the Parse of the -udp dns probe
+func parseDNSUDPReply(r *Result, request, reply []byte) bool {
+	parsed, err := parseDNSReply(reply, dnsProbeID)
+	if err != nil {
+		return false
+	}
+	r.DNS, r.Service = dnsInfo(parsed), "dns"
+	return true
+}
+
+// followDNSUDP asks a DNS server found over UDP for its version with
+// -dns-version
+func followDNSUDP(r *Result, exchange func(request []byte) ([]byte, error)) {
+	if !dnsVersion {
+		return
+	}
+	if reply, err := exchange(dnsVersionQuery); err == nil {
+		applyDNSVersion(r, reply)
+	}
+}
+
+// DNSProber is an enricher that queries DNS servers over TCP
+type DNSProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records how the DNS server behind a port answers
+func (p DNSProber) Enrich(r *Result, probe ProbeConfig) {
+	if r.Service != "dns" && r.Service != "domain" && (r.Service != "" || r.Port != 53) {
+		return
+	}
+	conn, err := probe.Dial(r.Host, r.Port, p.Timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * p.Timeout))
+	msg, err := exchangeDNSTCP(conn, dnsProbeQuery)
+	if err != nil {
+		return
+	}
+	parsed, err := parseDNSReply(msg, dnsProbeID)
+	if err != nil {
+		return
+	}
+	r.DNS, r.Service = dnsInfo(parsed), "dns"
+	if dnsVersion {
+		if msg, err := exchangeDNSTCP(conn, dnsVersionQuery); err == nil {
+			applyDNSVersion(r, msg)
+		}
+	}
+}
+
+// exchangeDNSTCP sends a query over a TCP connection, where each message is
+// prefixed with its length, and reads the response
+func exchangeDNSTCP(conn net.Conn, query []byte) ([]byte, error) {
+	framed := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(header))
+	_, err := io.ReadFull(conn, msg)
+	return msg, err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// dnsResponse answers a query with the given response code, recursion
+// available flag and answer records, each a TXT record if txt is set
+func dnsResponse(query []byte, rcode byte, recursion bool, answers int, txt string) []byte {
+	msg := append([]byte(nil), query...)
+	msg[2] |= 0x80
+	msg[3] = rcode
+	if recursion {
+		msg[3] |= 0x80
+	}
+	binary.BigEndian.PutUint16(msg[6:], uint16(answers))
+	for i := 0; i < answers; i++ {
+		msg = append(msg, 0xc0, 12) // the name in the question
+		if txt != "" {
+			msg = append(msg, 0, dnsTypeTXT, 0, dnsClassCH, 0, 0, 0, 0, 0, byte(len(txt)+1), byte(len(txt)))
+			msg = append(msg, txt...)
+		} else {
+			msg = append(msg, 0, dnsTypeNS, 0, dnsClassIN, 0, 0, 0, 60, 0, 4, 1, 'a', 0xc0, 12)
+		}
+	}
+	return msg
+}
+
+func TestParseDNSReply(t *testing.T) {
+	if _, err := parseDNSReply(dnsVersionQuery, dnsVersionID); err == nil {
+		t.Errorf("parseDNSReply() accepted a query")
+	}
+	if _, err := parseDNSReply(dnsResponse(dnsProbeQuery, 0, true, 1, ""), dnsVersionID); err == nil {
+		t.Errorf("parseDNSReply() accepted a response to another query")
+	}
+	got, err := parseDNSReply(dnsResponse(dnsVersionQuery, 0, false, 1, "unbound 1.17.1"), dnsVersionID)
+	if want := (dnsReply{Answers: 1, TXT: []string{"unbound 1.17.1"}}); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("parseDNSReply() = %+v, %v, expected %+v", got, err, want)
+	}
+}
+
+func TestDNSProduct(t *testing.T) {
+	tests := []struct{ version, product, v string }{
+		{"9.18.24-1-Debian", "BIND", "9.18.24-1-Debian"},
+		{"unbound 1.17.1", "unbound", "1.17.1"},
+		{"PowerDNS Recursor 4.8.4", "PowerDNS Recursor", "4.8.4"},
+		{"dnsmasq-2.89", "dnsmasq", "2.89"},
+		{"none of your business", "none of your business", ""},
+	}
+	for _, tt := range tests {
+		if product, v := dnsProduct(tt.version); product != tt.product || v != tt.v {
+			t.Errorf("dnsProduct(%q) = %q, %q, expected %q, %q", tt.version, product, v, tt.product, tt.v)
+		}
+	}
+}
+
+// dnsTCPServer answers DNS queries over TCP with answer
+func dnsTCPServer(t *testing.T, answer func(query []byte) []byte) int {
+	return serveOnce(t, func(conn net.Conn) {
+		for {
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			query := make([]byte, binary.BigEndian.Uint16(header))
+			if _, err := io.ReadFull(conn, query); err != nil {
+				return
+			}
+			reply := answer(query)
+			conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+		}
+	})
+}
+
+func TestDNSProber(t *testing.T) {
+	resolver := dnsTCPServer(t, func(query []byte) []byte {
+		if bytes.Equal(query, dnsVersionQuery) {
+			return dnsResponse(query, 0, true, 1, "9.18.24")
+		}
+		return dnsResponse(query, 0, true, 1, "")
+	})
+	authoritative := dnsTCPServer(t, func(query []byte) []byte {
+		return dnsResponse(query, 5, false, 0, "")
+	})
+	other := answerCommand(t, "HTTP/1.1 400 Bad Request\r\n\r\n")
+
+	saved := dnsVersion
+	defer func() { dnsVersion = saved }()
+	dnsVersion = true
+	tests := []struct {
+		name    string
+		port    int
+		want    *DNSInfo
+		product string
+	}{
+		{"Open resolver", resolver, &DNSInfo{Rcode: "NOERROR", Recursion: true, Version: "9.18.24"}, "BIND"},
+		{"Refusing server", authoritative, &DNSInfo{Rcode: "REFUSED"}, ""},
+		{"Not DNS", other, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Host: "127.0.0.1", Port: tt.port, Service: "dns"}
+			DNSProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+			if !reflect.DeepEqual(r.DNS, tt.want) || r.Product != tt.product {
+				t.Errorf("Enrich() dns = %+v, product %q, expected %+v, %q", r.DNS, r.Product, tt.want, tt.product)
+			}
+		})
+	}
+
+	r := Result{Host: "127.0.0.1", Port: resolver, Service: "http"}
+	DNSProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.DNS != nil {
+		t.Errorf("Enrich() probed a port known to be http")
+	}
+}
+
+func TestProbeUDPDNS(t *testing.T) {
+	port := udpAgent(t, func(query []byte) []byte {
+		if bytes.Equal(query, dnsVersionQuery) {
+			return dnsResponse(query, 0, false, 1, "dnsmasq-2.89")
+		}
+		return dnsResponse(query, 0, true, 2, "")
+	})
+	saved := dnsVersion
+	defer func() { dnsVersion = saved }()
+	dnsVersion = true
+	probe := udpProbes["dns"]
+	probe.Port = port
+	r, ok := probeUDP(context.Background(), "127.0.0.1", probe, ProbeConfig{Timeout: time.Second, Retries: 1})
+	want := &DNSInfo{Rcode: "NOERROR", Recursion: true, Version: "dnsmasq-2.89"}
+	if !ok || r.Service != "dns" || !reflect.DeepEqual(r.DNS, want) || r.Product != "dnsmasq" || r.Version != "2.89" {
+		t.Errorf("probeUDP() = %+v, %v, expected a dnsmasq resolver", r, ok)
+	}
+	if want := "cpe:2.3:a:thekelleys:dnsmasq:2.89:*:*:*:*:*:*:*"; r.CPE != want {
+		t.Errorf("probeUDP() cpe = %q, expected %q", r.CPE, want)
+	}
+	if got := serviceFindings(r); len(got) != 1 || got[0] != "resolves queries for anyone (open resolver)" {
+		t.Errorf("serviceFindings() = %q, expected the open resolver", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DockerContainer is a running container and the addresses it has on its networks
+type DockerContainer struct {
+	Name      string
+	Addresses []string
+}
+
+// dockerEndpoint returns the Docker API address from DOCKER_HOST, defaulting
+// to the local socket
+func dockerEndpoint() string {
+	if h := os.Getenv("DOCKER_HOST"); h != "" {
+		return h
+	}
+	return "unix:///var/run/docker.sock"
+}
+
+// ListDockerContainers asks the Docker Engine API at endpoint (unix:// or
+// tcp://) for running containers and their network addresses
+func ListDockerContainers(endpoint string) ([]DockerContainer, error) {
+	base := "http://docker"
+	transport := &http.Transport{}
+	switch {
+	case strings.HasPrefix(endpoint, "unix://"):
+		path := strings.TrimPrefix(endpoint, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+	case strings.HasPrefix(endpoint, "tcp://"):
+		base = "http://" + strings.TrimPrefix(endpoint, "tcp://")
+	default:
+		return nil, fmt.Errorf("unsupported Docker endpoint %q", endpoint)
+	}
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	resp, err := client.Get(base + "/containers/json")
+	if err != nil {
+		return nil, fmt.Errorf("querying Docker: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Docker API returned %s", resp.Status)
+	}
+
+	var body []struct {
+		Names           []string `json:"Names"`
+		NetworkSettings struct {
+			Networks map[string]struct {
+				IPAddress         string `json:"IPAddress"`
+				GlobalIPv6Address string `json:"GlobalIPv6Address"`
+			} `json:"Networks"`
+		} `json:"NetworkSettings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding Docker response: %v", err)
+	}
+
+	var containers []DockerContainer
+	for _, c := range body {
+		container := DockerContainer{}
+		if len(c.Names) > 0 {
+			container.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		for _, network := range c.NetworkSettings.Networks {
+			for _, addr := range []string{network.IPAddress, network.GlobalIPv6Address} {
+				if addr != "" {
+					container.Addresses = append(container.Addresses, addr)
+				}
+			}
+		}
+		sort.Strings(container.Addresses)
+		containers = append(containers, container)
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].Name < containers[j].Name })
+	return containers, nil
+}
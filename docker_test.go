@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListDockerContainers(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[
+			{"Names": ["/web-1"], "NetworkSettings": {"Networks": {
+				"app_default": {"IPAddress": "172.18.0.3", "GlobalIPv6Address": ""},
+				"frontend": {"IPAddress": "172.19.0.2", "GlobalIPv6Address": "fd00::2"}}}},
+			{"Names": ["/db-1"], "NetworkSettings": {"Networks": {
+				"app_default": {"IPAddress": "172.18.0.2"}}}},
+			{"Names": ["/host-net"], "NetworkSettings": {"Networks": {"host": {"IPAddress": ""}}}}
+		]`))
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	containers, err := ListDockerContainers("unix://" + socket)
+	if err != nil {
+		t.Fatalf("ListDockerContainers() error = %v", err)
+	}
+	expected := []DockerContainer{
+		{Name: "db-1", Addresses: []string{"172.18.0.2"}},
+		{Name: "host-net"},
+		{Name: "web-1", Addresses: []string{"172.18.0.3", "172.19.0.2", "fd00::2"}},
+	}
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("ListDockerContainers() = %+v, expected %+v", containers, expected)
+	}
+}
+
+func TestListDockerContainersBadEndpoint(t *testing.T) {
+	if _, err := ListDockerContainers("npipe:////./pipe/docker_engine"); err == nil {
+		t.Error("ListDockerContainers() with an npipe endpoint returned no error")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dualStack is the -dual-stack flag
+var dualStack bool
+
+// ExpandDualStack replaces each name with both IPv4 and IPv6 addresses by
+// the first address of each family, so that every port is probed over both.
+// It returns the name each address target stands for. Names with addresses
+// of one family only, and those that don't resolve, are left for
+// ResolveHosts.
+func ExpandDualStack(ctx context.Context, hosts []string, workers int) ([]string, map[string]string) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if parseHostIP(h) == nil && !seen[h] {
+			seen[h] = true
+			names = append(names, h)
+		}
+	}
+
+	pairs := make(map[string][2]string) // name to its IPv4 and IPv6 address
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < max(1, min(workers, len(names))); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				found, err := resolveName(ctx, name, "tcp")
+				if err != nil {
+					continue
+				}
+				v4, v6 := firstOfEachFamily(found)
+				if v4 != "" && v6 != "" {
+					mu.Lock()
+					pairs[name] = [2]string{v4, v6}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	expanded := make([]string, 0, len(hosts)+len(pairs))
+	addrNames := make(map[string]string)
+	for _, h := range hosts {
+		pair, ok := pairs[h]
+		if !ok {
+			expanded = append(expanded, h)
+			continue
+		}
+		for _, addr := range pair {
+			if _, seen := addrNames[addr]; !seen {
+				addrNames[addr] = h
+				expanded = append(expanded, addr)
+				addLabels(hostLabels, addr, hostLabels[h])
+			}
+		}
+	}
+	return expanded, addrNames
+}
+
+// firstOfEachFamily returns the first IPv4 and the first IPv6 address found
+func firstOfEachFamily(addrs []string) (v4, v6 string) {
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil && v4 == "":
+			v4 = a
+		case ip.To4() == nil && v6 == "":
+			v6 = a
+		}
+	}
+	return v4, v6
+}
+
+// familyOpen is a port of a dual-stack name that is open over one family only
+type familyOpen struct {
+	Name   string
+	Port   int
+	Family string // "IPv4" or "IPv6"
+}
+
+// FamilyDifferences compares the open ports of each dual-stack name over
+// IPv4 and IPv6, returning those open over one family only. Firewall rules
+// are often written for one family and forgotten for the other.
+func FamilyDifferences(results []Result, addrNames map[string]string) []familyOpen {
+	open := make(map[string]map[int]int) // name to port to families (1 IPv4, 2 IPv6)
+	for _, r := range results {
+		name, ok := addrNames[r.IP]
+		if !ok || r.State != StateOpen {
+			continue
+		}
+		if open[name] == nil {
+			open[name] = make(map[int]int)
+		}
+		if ip := net.ParseIP(r.IP); ip != nil && ip.To4() != nil {
+			open[name][r.Port] |= 1
+		} else {
+			open[name][r.Port] |= 2
+		}
+	}
+	var diffs []familyOpen
+	for name, ports := range open {
+		for port, families := range ports {
+			switch families {
+			case 1:
+				diffs = append(diffs, familyOpen{name, port, "IPv4"})
+			case 2:
+				diffs = append(diffs, familyOpen{name, port, "IPv6"})
+			}
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Name != diffs[j].Name {
+			return diffs[i].Name < diffs[j].Name
+		}
+		if diffs[i].Family != diffs[j].Family {
+			return diffs[i].Family < diffs[j].Family
+		}
+		return diffs[i].Port < diffs[j].Port
+	})
+	return diffs
+}
+
+// WriteFamilyDifferences lists the ports open over one family only, one line
+// per name and family
+func WriteFamilyDifferences(w io.Writer, diffs []familyOpen) {
+	if len(diffs) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n=== Open Over One Address Family Only ===\n")
+	for i := 0; i < len(diffs); {
+		j := i
+		var ports []string
+		for ; j < len(diffs) && diffs[j].Name == diffs[i].Name && diffs[j].Family == diffs[i].Family; j++ {
+			ports = append(ports, strconv.Itoa(diffs[j].Port))
+		}
+		fmt.Fprintf(w, "%s: %s only: %s\n", diffs[i].Name, diffs[i].Family, strings.Join(ports, ", "))
+		i = j
+	}
+}
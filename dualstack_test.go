@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandDualStack(t *testing.T) {
+	savedLookup, savedLabels := lookupHost, hostLabels
+	defer func() { lookupHost, hostLabels = savedLookup, savedLabels }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		switch name {
+		case "dual.example.com":
+			return []string{"2001:db8::1", "10.0.0.1", "10.0.0.2"}, nil
+		case "v4.example.com":
+			return []string{"10.0.0.3"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	hostLabels = map[string]map[string]string{"dual.example.com": {"env": "prod"}}
+
+	hosts, names := ExpandDualStack(context.Background(),
+		[]string{"dual.example.com", "v4.example.com", "missing.example.com", "10.0.0.9", "dual.example.com"}, 4)
+	expected := []string{"10.0.0.1", "2001:db8::1", "v4.example.com", "missing.example.com", "10.0.0.9"}
+	if !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("ExpandDualStack() = %v, expected %v", hosts, expected)
+	}
+	if expected := map[string]string{"10.0.0.1": "dual.example.com", "2001:db8::1": "dual.example.com"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("ExpandDualStack() names = %v, expected %v", names, expected)
+	}
+	if hostLabels["2001:db8::1"]["env"] != "prod" {
+		t.Errorf("labels of the IPv6 address = %v, expected those of the name", hostLabels["2001:db8::1"])
+	}
+}
+
+func TestFamilyDifferences(t *testing.T) {
+	names := map[string]string{"10.0.0.1": "dual.example.com", "2001:db8::1": "dual.example.com"}
+	results := []Result{
+		{Host: "dual.example.com", IP: "10.0.0.1", Port: 80},
+		{Host: "dual.example.com", IP: "2001:db8::1", Port: 80},
+		{Host: "dual.example.com", IP: "2001:db8::1", Port: 22},
+		{Host: "dual.example.com", IP: "2001:db8::1", Port: 3306},
+		{Host: "dual.example.com", IP: "10.0.0.1", Port: 8080},
+		{Host: "dual.example.com", IP: "10.0.0.1", Port: 443, State: StateClosed},
+		{Host: "10.0.0.5", IP: "10.0.0.5", Port: 25},
+	}
+	diffs := FamilyDifferences(results, names)
+	expected := []familyOpen{
+		{"dual.example.com", 8080, "IPv4"},
+		{"dual.example.com", 22, "IPv6"},
+		{"dual.example.com", 3306, "IPv6"},
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("FamilyDifferences() = %v, expected %v", diffs, expected)
+	}
+
+	var out strings.Builder
+	WriteFamilyDifferences(&out, diffs)
+	if want := "\n=== Open Over One Address Family Only ===\ndual.example.com: IPv4 only: 8080\ndual.example.com: IPv6 only: 22, 3306\n"; out.String() != want {
+		t.Errorf("WriteFamilyDifferences() = %q, expected %q", out.String(), want)
+	}
+}
+
+func TestRunScanNames(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	var got []Result
+	opts := ScanOptions{Workers: 1, Probe: quickProbe, Names: map[string]string{"127.0.0.1": "dual.example.com"}}
+	RunScan(context.Background(), []string{"127.0.0.1"}, []int{port}, opts, &Stats{startTime: time.Now()}, func(r Result) {
+		got = append(got, r)
+	})
+	if len(got) != 1 || got[0].Host != "dual.example.com" || got[0].IP != "127.0.0.1" {
+		t.Errorf("RunScan() = %+v, expected the result under the name it was resolved from", got)
+	}
+}
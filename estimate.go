@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Frame sizes on Ethernet for IPv4: a SYN carries about 20 bytes of TCP
+// options, a RST none
+const (
+	synBytes = 74
+	rstBytes = 54
+)
+
+// synRetransmits are the times at which the kernel sends a SYN while a
+// connect is outstanding (Linux starts with a 1s RTO and doubles it)
+var synRetransmits = []time.Duration{0, 1 * time.Second, 3 * time.Second, 7 * time.Second,
+	15 * time.Second, 31 * time.Second, 63 * time.Second}
+
+// Estimate predicts the cost of a scan
+type Estimate struct {
+	Ports      string
+	Probes     int
+	Best       time.Duration // every port answers within a round trip
+	Worst      time.Duration // every port is filtered
+	BestBytes  int64         // traffic in both directions
+	WorstBytes int64         // traffic sent; nothing comes back
+}
+
+// EstimateScan predicts how long probes ports take and how much traffic they
+// send. Like probePort, every attempt at a port that is not open is followed
+// by the retry sleep, and closed ports get all their attempts too. In the
+// best case each attempt takes one round trip; in the worst each one waits
+// out the timeout.
+func EstimateScan(probes, workers, retries int, timeout, sleep, rtt time.Duration) Estimate {
+	e := Estimate{Probes: probes}
+	if probes == 0 || workers < 1 || retries < 1 {
+		return e
+	}
+	rounds := time.Duration((probes + workers - 1) / workers)
+	e.Best = rounds * time.Duration(retries) * (rtt + sleep)
+	e.Worst = rounds * time.Duration(retries) * (timeout + sleep)
+
+	syns := 0
+	for _, at := range synRetransmits {
+		if at < timeout {
+			syns++
+		}
+	}
+	attempts := int64(probes) * int64(retries)
+	e.BestBytes = attempts * (synBytes + rstBytes)
+	e.WorstBytes = attempts * int64(syns) * synBytes
+	return e
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDuration rounds a duration to a precision that suits its size
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour:
+		return d.Round(time.Minute).String()
+	case d >= time.Second:
+		return d.Round(time.Second).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// WriteEstimates prints estimates as a table
+func WriteEstimates(w io.Writer, hosts int, estimates []Estimate) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PORTS\tPROBES\tBEST TIME\tWORST TIME\tBEST TRAFFIC\tWORST TRAFFIC\n")
+	for _, e := range estimates {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n", e.Ports, e.Probes,
+			formatDuration(e.Best), formatDuration(e.Worst), formatBytes(e.BestBytes), formatBytes(e.WorstBytes))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d host(s). Best case: every port answers within the round trip; worst case: every port is filtered.\n", hosts)
+}
+
+// runEstimate implements the "estimate" subcommand, which predicts the cost
+// of a scan without sending anything
+func runEstimate(args []string) int {
+	flags := flag.NewFlagSet("estimate", flag.ExitOnError)
+	rtt := flags.Duration("rtt", 20*time.Millisecond, "Expected round-trip time to the targets")
+	asJSON := flags.Bool("json", false, "Print the estimates as JSON")
+	addTargetFlags(flags)
+	addProbeFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if !checkProbeFlags() {
+		return 2
+	}
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no targets given (use -h, -hf or -cf)\n")
+		return 2
+	}
+	if err := resolvePorts(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	portList, err := PortsOrDefault(ports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing ports: %v\n", err)
+		return 1
+	}
+
+	// Show the usual alternatives next to the requested ports
+	choices := []struct {
+		spec  string
+		count int
+	}{{ports, len(portList)}, {"1-1024", 1024}, {"1-65535", 65535}}
+	if ports == "" {
+		choices[0].spec = "1-65535"
+	}
+	var estimates []Estimate
+	seen := make(map[int]bool)
+	for _, c := range choices {
+		if seen[c.count] {
+			continue
+		}
+		seen[c.count] = true
+		e := EstimateScan(len(hosts)*c.count, concurrency, probeConfig.Retries,
+			probeConfig.Timeout, probeConfig.Sleep, *rtt)
+		e.Ports = c.spec
+		estimates = append(estimates, e)
+	}
+
+	if *asJSON {
+		type row struct {
+			Ports        string  `json:"ports"`
+			Probes       int     `json:"probes"`
+			BestSeconds  float64 `json:"best_seconds"`
+			WorstSeconds float64 `json:"worst_seconds"`
+			BestBytes    int64   `json:"best_bytes"`
+			WorstBytes   int64   `json:"worst_bytes"`
+		}
+		rows := make([]row, len(estimates))
+		for i, e := range estimates {
+			rows[i] = row{e.Ports, e.Probes, e.Best.Seconds(), e.Worst.Seconds(), e.BestBytes, e.WorstBytes}
+		}
+		return printJSON(os.Stdout, rows)
+	}
+	WriteEstimates(os.Stdout, len(hosts), estimates)
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateScan(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name                  string
+		probes, workers       int
+		retries               int
+		timeout, sleep, rtt   time.Duration
+		best, worst           time.Duration
+		bestBytes, worstBytes int64
+	}{
+		{"one round", 3, 100, 5, 500 * ms, 100 * ms, 20 * ms, 600 * ms, 3 * time.Second, 3 * 5 * 128, 3 * 5 * 74},
+		{"partial last round", 250, 100, 1, 500 * ms, 0, 10 * ms, 30 * ms, 1500 * ms, 250 * 128, 250 * 74},
+		{"kernel resends the SYN", 1, 1, 1, 2 * time.Second, 0, 10 * ms, 10 * ms, 2 * time.Second, 128, 2 * 74},
+		{"no retries", 10, 1, 0, 500 * ms, 0, 10 * ms, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		e := EstimateScan(tt.probes, tt.workers, tt.retries, tt.timeout, tt.sleep, tt.rtt)
+		if e.Probes != tt.probes || e.Best != tt.best || e.Worst != tt.worst ||
+			e.BestBytes != tt.bestBytes || e.WorstBytes != tt.worstBytes {
+			t.Errorf("%s: EstimateScan() = %+v", tt.name, e)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{40 << 20, "40.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
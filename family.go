@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// ipv4Only and ipv6Only are the -4 and -6 flags
+var ipv4Only, ipv6Only bool
+
+// familyNetwork returns the network probes are dialed on: "tcp4" for -4,
+// "tcp6" for -6 and "tcp" for either family
+func familyNetwork(only4, only6 bool) (string, error) {
+	switch {
+	case only4 && only6:
+		return "", fmt.Errorf("-4 and -6 can't be used together")
+	case only4:
+		return "tcp4", nil
+	case only6:
+		return "tcp6", nil
+	}
+	return "tcp", nil
+}
+
+// setupProbe fills in the parts of probeConfig that come from flags needing
+// more than parsing: the source address, the address family and the FTP
+// server of a bounce scan, which is logged in to
+func setupProbe() error {
+	network, err := familyNetwork(ipv4Only, ipv6Only)
+	if err != nil {
+		return err
+	}
+	probeConfig.Network = network
+	if probeConfig.Source, err = ParseSource(sourceIP, sourceIface); err != nil || ftpBounce == "" {
+		return err
+	}
+	bounce, err := ParseFTPBounce(ftpBounce)
+	if err != nil {
+		return err
+	}
+	if err := bounce.Check(probeConfig); err != nil {
+		return fmt.Errorf("-ftp-bounce %v", err)
+	}
+	probeConfig.Bounce = bounce
+	return nil
+}
+
+// inFamily reports whether ip can be reached on network
+func inFamily(ip net.IP, network string) bool {
+	switch network {
+	case "tcp4":
+		return ip.To4() != nil
+	case "tcp6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
+// familyName describes the addresses of network for messages, e.g. "IPv4"
+func familyName(network string) string {
+	if network == "tcp6" {
+		return "IPv6"
+	}
+	return "IPv4"
+}
+
+// filterFamily keeps the addresses that can be reached on network
+func filterFamily(addrs []string, network string) []string {
+	var kept []string
+	for _, a := range addrs {
+		if ip := net.ParseIP(a); ip == nil || inFamily(ip, network) {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// splitFamily separates the IP address targets of the other family from
+// those that can be reached on network; names are kept, since the lookup
+// picks their addresses
+func splitFamily(hosts []string, network string) (kept []string, other []SkippedTarget) {
+	kept = hosts[:0:0]
+	for _, h := range hosts {
+		if ip := parseHostIP(h); ip != nil && !inFamily(ip, network) {
+			other = append(other, SkippedTarget{Target: h, Err: fmt.Errorf("not an %s address", familyName(network))})
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return kept, other
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestFamilyNetwork(t *testing.T) {
+	tests := []struct {
+		only4, only6 bool
+		expected     string
+		wantErr      bool
+	}{
+		{false, false, "tcp", false},
+		{true, false, "tcp4", false},
+		{false, true, "tcp6", false},
+		{true, true, "", true},
+	}
+	for _, tt := range tests {
+		got, err := familyNetwork(tt.only4, tt.only6)
+		if got != tt.expected || (err != nil) != tt.wantErr {
+			t.Errorf("familyNetwork(%v, %v) = %q, %v; expected %q", tt.only4, tt.only6, got, err, tt.expected)
+		}
+	}
+}
+
+func TestSplitFamily(t *testing.T) {
+	hosts := []string{"10.0.0.1", "2001:db8::1", "example.com", "::ffff:10.0.0.2"}
+	tests := []struct {
+		network string
+		kept    []string
+		other   []string
+	}{
+		{"tcp", hosts, nil},
+		{"tcp4", []string{"10.0.0.1", "example.com", "::ffff:10.0.0.2"}, []string{"2001:db8::1"}},
+		{"tcp6", []string{"2001:db8::1", "example.com"}, []string{"10.0.0.1", "::ffff:10.0.0.2"}},
+	}
+	for _, tt := range tests {
+		kept, other := splitFamily(hosts, tt.network)
+		var skipped []string
+		for _, s := range other {
+			skipped = append(skipped, s.Target)
+		}
+		if !reflect.DeepEqual(kept, tt.kept) || !reflect.DeepEqual(skipped, tt.other) {
+			t.Errorf("splitFamily(%s) = %v, %v; expected %v, %v", tt.network, kept, skipped, tt.kept, tt.other)
+		}
+	}
+	if hosts[1] != "2001:db8::1" {
+		t.Error("splitFamily() modified its input")
+	}
+}
+
+func TestResolveNameFamily(t *testing.T) {
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		if name == "v4only.example.com" {
+			return []string{"10.0.0.1"}, nil
+		}
+		return []string{"2001:db8::1", "10.0.0.1"}, nil
+	}
+
+	tests := []struct {
+		network  string
+		name     string
+		expected []string
+		wantErr  bool
+	}{
+		{"tcp", "dual.example.com", []string{"2001:db8::1", "10.0.0.1"}, false},
+		{"tcp4", "dual.example.com", []string{"10.0.0.1"}, false},
+		{"tcp6", "dual.example.com", []string{"2001:db8::1"}, false},
+		{"tcp6", "v4only.example.com", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := resolveName(context.Background(), tt.name, tt.network)
+		if !reflect.DeepEqual(got, tt.expected) || (err != nil) != tt.wantErr {
+			t.Errorf("resolveName(%s) with %s = %v, %v; expected %v", tt.name, tt.network, got, err, tt.expected)
+		}
+	}
+}
+
+func TestDefaultHostsFamily(t *testing.T) {
+	savedLabels, savedNetwork := hostLabels, probeConfig.Network
+	defer func() { hostLabels, probeConfig.Network = savedLabels, savedNetwork }()
+	hostLabels = make(map[string]map[string]string)
+
+	probeConfig.Network = "tcp4"
+	if hosts := DefaultHosts(); !reflect.DeepEqual(hosts, []string{"127.0.0.1"}) {
+		t.Errorf("DefaultHosts() with -4 = %v", hosts)
+	}
+	probeConfig.Network = "tcp6"
+	if hosts := DefaultHosts(); !reflect.DeepEqual(hosts, []string{"::1"}) {
+		t.Errorf("DefaultHosts() with -6 = %v", hosts)
+	}
+}
+
+func TestRunScanFamily(t *testing.T) {
+	defer flag.CommandLine.Set("4", "false")
+	base := []string{"-q", "-p", "1", "-r", "1", "-s", "0", "-resume-file", ""}
+	if got := runScan(append(slices.Clone(base), "-4", "-h", "::1"), nil); got != exitError {
+		t.Errorf("runScan() of an IPv6 target with -4 = %d, want %d", got, exitError)
+	}
+	if got := runScan(append(slices.Clone(base), "-4", "-h", "127.0.0.1"), nil); got != exitNoneOpen {
+		t.Errorf("runScan() of an IPv4 target with -4 = %d, want %d", got, exitNoneOpen)
+	}
+	if got := runScan(append(slices.Clone(base), "-4", "-6", "-h", "127.0.0.1"), nil); got != exitError {
+		t.Errorf("runScan() with -4 and -6 = %d, want %d", got, exitError)
+	}
+	flag.CommandLine.Set("6", "false")
+	flag.CommandLine.Set("h", "")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"math/bits"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPInfo is what an HTTP port served
+type HTTPInfo struct {
+	URL         string   `json:"url"`                    // base URL of the site
+	FaviconHash *int32   `json:"favicon_hash,omitempty"` // Shodan's http.favicon.hash of /favicon.ico
+	Screenshot  string   `json:"screenshot,omitempty"`   // file name of the picture taken with -screenshots
+	WebSockets  []string `json:"websockets,omitempty"`   // paths that accept a WebSocket upgrade, with -enrich websocket
+}
+
+// maxFavicon caps the size of a favicon that is hashed
+const maxFavicon = 1 << 20
+
+// FaviconHasher is an enricher that fetches /favicon.ico from HTTP ports and
+// hashes it the way Shodan does, so that sites can be matched against known
+// application fingerprints
+type FaviconHasher struct {
+	Timeout time.Duration
+}
+
+// Enrich records the site's URL and the hash of its favicon, if it has one
+func (f FaviconHasher) Enrich(r *Result, probe ProbeConfig) {
+	if r.Service != "" && r.Service != "http" && r.Service != "https" {
+		return
+	}
+	scheme := DetectHTTP(r.Host, r.Port, probe, f.Timeout)
+	if scheme == "" {
+		return
+	}
+	if r.Service == "" {
+		r.Service = scheme
+	}
+	if r.HTTP == nil {
+		r.HTTP = &HTTPInfo{URL: FormatTarget(*r, scheme)}
+	}
+	client := &http.Client{
+		Timeout: 2 * f.Timeout,
+		Transport: &http.Transport{
+			DialContext:     probe.Dialer(r.Host, f.Timeout).DialContext,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(r.HTTP.URL + "/favicon.ico")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFavicon))
+	if err != nil || resp.StatusCode != http.StatusOK || len(data) == 0 {
+		return
+	}
+	hash := faviconHash(data)
+	r.HTTP.FaviconHash = &hash
+}
+
+// faviconHash is MurmurHash3 of the favicon encoded as Python's
+// base64.encodebytes does, with a newline after every 76 characters and at
+// the end
+func faviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\n")
+	return int32(murmur3([]byte(b.String())))
+}
+
+// murmur3 is the 32-bit x86 MurmurHash3 with seed 0
+func murmur3(data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	n := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16 | uint32(data[3])<<24
+		h ^= bits.RotateLeft32(k*c1, 15) * c2
+		h = bits.RotateLeft32(h, 13)*5 + 0xe6546b64
+	}
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		h ^= bits.RotateLeft32(k*c1, 15) * c2
+	}
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		data string
+		want int32
+	}{
+		{"", 0},
+		{"foo", -156908512},
+		{"The quick brown fox jumps over the lazy dog", 0x2e4ff723},
+	}
+	for _, tt := range tests {
+		if got := int32(murmur3([]byte(tt.data))); got != tt.want {
+			t.Errorf("murmur3(%q) = %d, expected %d", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFaviconHash(t *testing.T) {
+	// Long enough to need line breaks in the encoding
+	icon := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, 20)
+	encoded := "AAECAwQFBgcAAQIDBAUGBwABAgMEBQYHAAECAwQFBgcAAQIDBAUGBwABAgMEBQYHAAECAwQFBgcA\n" +
+		"AQIDBAUGBwABAgMEBQYHAAECAwQFBgcAAQIDBAUGBwABAgMEBQYHAAECAwQFBgcAAQIDBAUGBwAB\n" +
+		"AgMEBQYHAAECAwQFBgcAAQIDBAUGBwABAgMEBQYHAAECAwQFBgcAAQIDBAUGBw==\n"
+	if got, want := faviconHash(icon), int32(murmur3([]byte(encoded))); got != want {
+		t.Errorf("faviconHash() = %d, expected %d, the hash of the encoding with line breaks", got, want)
+	}
+}
+
+func TestFaviconHasher(t *testing.T) {
+	icon := []byte("\x00\x00\x01\x00fake icon")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) { w.Write(icon) })
+	withIcon := httptest.NewTLSServer(mux)
+	defer withIcon.Close()
+	without := httptest.NewServer(http.NotFoundHandler())
+	defer without.Close()
+
+	port := func(srv *httptest.Server) int {
+		u, _ := url.Parse(srv.URL)
+		p, _ := strconv.Atoi(u.Port())
+		return p
+	}
+	r := Result{Host: "127.0.0.1", Port: port(withIcon)}
+	FaviconHasher{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.Service != "https" || r.HTTP == nil || r.HTTP.URL != "https://127.0.0.1:"+strconv.Itoa(r.Port) {
+		t.Fatalf("Enrich() = service %q, http %+v, expected an HTTPS site", r.Service, r.HTTP)
+	}
+	if r.HTTP.FaviconHash == nil || *r.HTTP.FaviconHash != faviconHash(icon) {
+		t.Errorf("Enrich() favicon hash = %v, expected %d", r.HTTP.FaviconHash, faviconHash(icon))
+	}
+
+	r = Result{Host: "127.0.0.1", Port: port(without), Service: "http"}
+	FaviconHasher{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.HTTP == nil || !strings.HasPrefix(r.HTTP.URL, "http://") || r.HTTP.FaviconHash != nil {
+		t.Errorf("Enrich() http = %+v, expected a site without a favicon", r.HTTP)
+	}
+
+	r = Result{Host: "127.0.0.1", Port: port(withIcon), Service: "ssh"}
+	FaviconHasher{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.HTTP != nil {
+		t.Errorf("Enrich() fetched a favicon from a port known to be ssh")
+	}
+}
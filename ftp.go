@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"time"
+)
+
+// FTPInfo is what an FTP server revealed beyond its banner
+type FTPInfo struct {
+	Anonymous bool `json:"anonymous"` // accepted an anonymous login
+}
+
+// ftpProducts matches the FTP servers that name themselves in their banner,
+// with the version that usually follows
+var ftpProducts = regexp.MustCompile(`(?i)\b(vsFTPd|ProFTPD|Pure-FTPd|FileZilla Server|Serv-U FTP Server|wu-ftpd|Microsoft FTP Service)(?:[ /v]+version)?[ /v-]*([0-9][0-9A-Za-z.\-]*)?`)
+
+// ftpProduct picks the server software and version out of an FTP banner
+func ftpProduct(banner string) (product, version string) {
+	m := ftpProducts.FindStringSubmatch(banner)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// FTPAnonChecker is an enricher that tries to log in to FTP servers as
+// "anonymous". It does nothing else once logged in: no listing, no transfers.
+type FTPAnonChecker struct {
+	Timeout time.Duration
+}
+
+// Enrich records whether an FTP server allows anonymous logins. Ports not
+// known to run another service are tried if they greet like an FTP server.
+func (c FTPAnonChecker) Enrich(r *Result, probe ProbeConfig) {
+	if r.Service != "" && r.Service != "ftp" {
+		return
+	}
+	anonymous, banner, err := ftpAnonymousLogin(r.Host, r.Port, probe, c.Timeout)
+	if err != nil {
+		return
+	}
+	r.FTP = &FTPInfo{Anonymous: anonymous}
+	r.Service = "ftp"
+	if r.Banner == "" {
+		r.Banner = banner
+	}
+	if r.Product == "" {
+		r.Product, r.Version = ftpProduct(banner)
+	}
+}
+
+// ftpAnonymousLogin connects to an FTP server and logs in with the
+// conventional anonymous user and e-mail address as password. It returns the
+// greeting, and an error if the server turned out not to speak FTP: other
+// protocols, SMTP among them, greet with 220 too.
+func ftpAnonymousLogin(host string, port int, probe ProbeConfig, wait time.Duration) (accepted bool, banner string, err error) {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return false, "", err
+	}
+	defer conn.Close()
+	// The whole exchange is a few round trips
+	conn.SetDeadline(time.Now().Add(4 * wait))
+	text := textproto.NewConn(conn)
+
+	code, banner, err := text.ReadResponse(0)
+	if err != nil || code != 220 {
+		return false, "", fmt.Errorf("not an FTP greeting: %d %q: %v", code, banner, err)
+	}
+	banner = fmt.Sprintf("%d %s", code, banner)
+	code, err = ftpCommand(text, "USER anonymous")
+	if err != nil || code != 230 && code != 331 && code != 530 {
+		if serviceFromBanner(banner) == "ftp" {
+			return false, banner, nil
+		}
+		return false, "", fmt.Errorf("no FTP reply to USER: %d: %v", code, err)
+	}
+	if code == 331 {
+		if code, err = ftpCommand(text, "PASS anonymous@example.com"); err != nil {
+			return false, banner, nil
+		}
+	}
+	text.PrintfLine("QUIT")
+	return code == 230, banner, nil
+}
+
+// ftpCommand sends a command and returns the code of the reply
+func ftpCommand(text *textproto.Conn, command string) (int, error) {
+	if err := text.PrintfLine("%s", command); err != nil {
+		return 0, err
+	}
+	code, _, err := text.ReadResponse(0)
+	if _, ok := err.(*textproto.Error); ok {
+		err = nil // an unexpected code is still an answer
+	}
+	return code, err
+}
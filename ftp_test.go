@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFTPProduct(t *testing.T) {
+	tests := []struct {
+		banner, product, version string
+	}{
+		{"220 (vsFTPd 3.0.3)", "vsFTPd", "3.0.3"},
+		{"220 ProFTPD 1.3.5e Server (Debian) [::ffff:10.0.0.5]", "ProFTPD", "1.3.5e"},
+		{"220---------- Welcome to Pure-FTPd [privsep] [TLS] ----------", "Pure-FTPd", ""},
+		{"220-FileZilla Server version 0.9.60 beta", "FileZilla Server", "0.9.60"},
+		{"220 Microsoft FTP Service", "Microsoft FTP Service", ""},
+		{"220 ready", "", ""},
+	}
+
+	for _, tt := range tests {
+		if product, version := ftpProduct(tt.banner); product != tt.product || version != tt.version {
+			t.Errorf("ftpProduct(%q) = %q, %q, expected %q, %q", tt.banner, product, version, tt.product, tt.version)
+		}
+	}
+}
+
+// scriptedServer serves a line-based conversation such as FTP or SMTP: the
+// greeting, then a reply to each command by its first word. It records the
+// commands it was sent.
+func scriptedServer(t *testing.T, greeting string, replies map[string]string) (port int, commands chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands = make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(greeting + "\r\n"))
+			lines := bufio.NewScanner(conn)
+			for lines.Scan() {
+				commands <- lines.Text()
+				verb, _, _ := strings.Cut(lines.Text(), " ")
+				if verb == "QUIT" {
+					break
+				}
+				conn.Write([]byte(replies[verb] + "\r\n"))
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, commands
+}
+
+func TestFTPAnonChecker(t *testing.T) {
+	tests := []struct {
+		name     string
+		greeting string
+		replies  map[string]string
+		service  string
+		want     *FTPInfo
+		product  string
+	}{
+		{
+			name:     "Anonymous allowed",
+			greeting: "220 (vsFTPd 3.0.3)",
+			replies:  map[string]string{"USER": "331 Please specify the password.", "PASS": "230 Login successful."},
+			want:     &FTPInfo{Anonymous: true},
+			product:  "vsFTPd",
+		},
+		{
+			name:     "Anonymous refused",
+			greeting: "220-Welcome\r\n220 ProFTPD 1.3.8 Server",
+			replies:  map[string]string{"USER": "331 Password required", "PASS": "530 Login incorrect."},
+			want:     &FTPInfo{Anonymous: false},
+			product:  "ProFTPD",
+		},
+		{
+			name:     "Not FTP",
+			greeting: "220 mail.example.com ESMTP Postfix",
+			replies:  map[string]string{"USER": "502 5.5.2 Error: command not recognized"},
+		},
+		{
+			name:     "Other service",
+			greeting: "220 (vsFTPd 3.0.3)",
+			service:  "smtp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, commands := scriptedServer(t, tt.greeting, tt.replies)
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: port, Service: tt.service}
+			FTPAnonChecker{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+			if (r.FTP == nil) != (tt.want == nil) || r.FTP != nil && *r.FTP != *tt.want {
+				t.Fatalf("Enrich() ftp = %+v, expected %+v", r.FTP, tt.want)
+			}
+			if r.Product != tt.product {
+				t.Errorf("Enrich() product = %q, expected %q", r.Product, tt.product)
+			}
+			if tt.want != nil && r.Service != "ftp" {
+				t.Errorf("Enrich() service = %q, expected ftp", r.Service)
+			}
+			for len(commands) > 0 {
+				if c := <-commands; !strings.HasPrefix(c, "USER ") && !strings.HasPrefix(c, "PASS ") && c != "QUIT" {
+					t.Errorf("sent %q, expected nothing beyond logging in and out", c)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ftpBounce is the -ftp-bounce flag
+var ftpBounce string
+
+// ftpBounceSessions caps the control connections kept open to the FTP
+// server; many servers allow only a few per client address
+const ftpBounceSessions = 4
+
+// ftpBounceCheck is where FTPBounce.Check asks the server to connect: an
+// address of TEST-NET-1, which is never a scan target
+const ftpBounceCheck = "PORT 192,0,2,1,0,80"
+
+// errBounceRefused is returned when the FTP server won't connect to the host
+// a PORT command names
+var errBounceRefused = errors.New("FTP server refuses to connect to other hosts")
+
+// FTPBounce probes ports through an FTP server instead of connecting to
+// them: the classic bounce scan. A PORT command (EPRT for IPv6) points the
+// server's data connection at the target, and the reply to LIST tells
+// whether the server could open it. Servers fixed since the late 1990s
+// refuse a PORT to any address but the client's, so this is for assessing
+// legacy networks.
+type FTPBounce struct {
+	Addr     string // host:port of the FTP server
+	User     string
+	Password string
+
+	slots chan struct{}   // control connections in use
+	idle  chan ftpSession // logged-in control connections not in use
+}
+
+// ftpSession is a logged-in control connection to the FTP server
+type ftpSession struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// ParseFTPBounce parses -ftp-bounce, [user[:password]@]host[:port], logging
+// in anonymously on port 21 by default. Characters such as @ in a password
+// are escaped as in URLs (%40).
+func ParseFTPBounce(spec string) (*FTPBounce, error) {
+	u, err := url.Parse("ftp://" + spec)
+	if err != nil || u.Hostname() == "" || u.Path != "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("-ftp-bounce %q is not [user[:password]@]host[:port]", spec)
+	}
+	b := &FTPBounce{
+		Addr: net.JoinHostPort(u.Hostname(), cmp.Or(u.Port(), "21")),
+		User: "anonymous", Password: "anonymous@example.com",
+		slots: make(chan struct{}, ftpBounceSessions),
+		idle:  make(chan ftpSession, ftpBounceSessions),
+	}
+	if u.User != nil {
+		b.User = u.User.Username()
+		b.Password, _ = u.User.Password()
+	}
+	return b, nil
+}
+
+// Check logs in and makes sure the server takes a PORT command naming
+// another host, so that a scan through a fixed server fails at once instead
+// of reporting every port filtered. The server is connected to as probe
+// connects to ports, within its timeout.
+func (b *FTPBounce) Check(probe ProbeConfig) error {
+	s, err := b.login(probe)
+	if err != nil {
+		return err
+	}
+	code, err := ftpCommand(s.text, ftpBounceCheck)
+	if err != nil || code != 200 {
+		s.conn.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", b.Addr, err)
+		}
+		return fmt.Errorf("%s: %w (PORT answered %d)", b.Addr, errBounceRefused, code)
+	}
+	b.idle <- s
+	return nil
+}
+
+// Probe asks the FTP server to connect to a port. A data connection opened
+// means the port is open and one that failed at once that it is closed;
+// when the server is still trying after four timeouts the port counts as
+// filtered. The timeout is probe's, and a target name is looked up in its
+// address family.
+func (b *FTPBounce) Probe(ctx context.Context, host string, port int, probe ProbeConfig) (PortState, error) {
+	wait := probe.Timeout
+	ip, err := GetHostIP(host, probe.Network)
+	if err != nil {
+		return StateFiltered, err
+	}
+	command, err := bounceCommand(ip, port)
+	if err != nil {
+		return StateFiltered, err
+	}
+	select {
+	case b.slots <- struct{}{}:
+	case <-ctx.Done():
+		return StateFiltered, ctx.Err()
+	}
+	defer func() { <-b.slots }()
+
+	for {
+		var s ftpSession
+		reused := true
+		select {
+		case s = <-b.idle:
+		default:
+			reused = false
+			if s, err = b.login(probe); err != nil {
+				return StateFiltered, err
+			}
+		}
+		state, err, healthy := s.bounce(command, wait)
+		if healthy {
+			b.idle <- s
+			return state, err
+		}
+		s.conn.Close()
+		var netErr net.Error
+		if state == StateOpen || !reused || errors.As(err, &netErr) && netErr.Timeout() {
+			return state, err
+		}
+		// The server hung up on an idle session; log in again
+	}
+}
+
+// login opens a control connection to the FTP server and logs in
+func (b *FTPBounce) login(probe ProbeConfig) (ftpSession, error) {
+	wait := probe.Timeout
+	host, _, _ := net.SplitHostPort(b.Addr)
+	conn, err := probe.Dialer(host, wait).Dial("tcp", b.Addr)
+	if err != nil {
+		return ftpSession{}, fmt.Errorf("FTP bounce server %v", err)
+	}
+	conn.SetDeadline(time.Now().Add(4 * wait))
+	s := ftpSession{conn: conn, text: textproto.NewConn(conn)}
+	if _, _, err := s.text.ReadResponse(220); err != nil {
+		conn.Close()
+		return ftpSession{}, fmt.Errorf("%s: not an FTP server: %v", b.Addr, err)
+	}
+	code, err := ftpCommand(s.text, "USER "+b.User)
+	if err == nil && code == 331 {
+		code, err = ftpCommand(s.text, "PASS "+b.Password)
+	}
+	if err != nil {
+		conn.Close()
+		return ftpSession{}, fmt.Errorf("%s: %v", b.Addr, err)
+	}
+	if code != 230 {
+		conn.Close()
+		return ftpSession{}, fmt.Errorf("%s: login as %s failed (%d)", b.Addr, b.User, code)
+	}
+	return s, nil
+}
+
+// bounce sends a PORT or EPRT command and LIST, reporting whether the
+// session can be used again
+func (s ftpSession) bounce(command string, wait time.Duration) (state PortState, err error, healthy bool) {
+	s.conn.SetDeadline(time.Now().Add(4 * wait))
+	code, err := ftpCommand(s.text, command)
+	if err != nil {
+		return StateFiltered, err, false
+	}
+	if code != 200 {
+		verb, _, _ := strings.Cut(command, " ")
+		return StateFiltered, fmt.Errorf("%w (%s answered %d)", errBounceRefused, verb, code), true
+	}
+	code, err = ftpCommand(s.text, "LIST")
+	switch {
+	case err != nil:
+		return StateFiltered, err, false
+	case code == 125 || code == 150:
+		// The listing goes to the target; the transfer ends with 226, or 426
+		// when the target drops the connection
+		_, _, err = s.text.ReadResponse(0)
+		var protoErr *textproto.Error
+		return StateOpen, nil, err == nil || errors.As(err, &protoErr)
+	case code == 425 || code == 426:
+		return StateClosed, fmt.Errorf("FTP bounce: data connection failed (%d): %w", code, syscall.ECONNREFUSED), true
+	}
+	return StateFiltered, fmt.Errorf("FTP bounce: LIST answered %d", code), true
+}
+
+// bounceCommand is the PORT command naming an IPv4 address and port, or the
+// EPRT command (RFC 2428) for an IPv6 one
+func bounceCommand(ip string, port int) (string, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", fmt.Errorf("can't bounce to %s", ip)
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return fmt.Sprintf("PORT %d,%d,%d,%d,%d,%d", v4[0], v4[1], v4[2], v4[3], port>>8, port&0xff), nil
+	}
+	return fmt.Sprintf("EPRT |2|%s|%d|", addr, port), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFTPBounce(t *testing.T) {
+	tests := []struct {
+		spec     string
+		addr     string
+		user     string
+		password string
+		wantErr  bool
+	}{
+		{"ftp.example.com", "ftp.example.com:21", "anonymous", "anonymous@example.com", false},
+		{"scan:s3cret@10.1.0.21:2121", "10.1.0.21:2121", "scan", "s3cret", false},
+		{"scan:p%40ss@[2001:db8::21]", "[2001:db8::21]:21", "scan", "p@ss", false},
+		{"", "", "", "", true},
+		{"ftp.example.com/pub", "", "", "", true},
+	}
+	for _, tt := range tests {
+		b, err := ParseFTPBounce(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFTPBounce(%q) error = %v", tt.spec, err)
+			continue
+		}
+		if err == nil && (b.Addr != tt.addr || b.User != tt.user || b.Password != tt.password) {
+			t.Errorf("ParseFTPBounce(%q) = %s %s:%s, expected %s %s:%s", tt.spec, b.Addr, b.User, b.Password, tt.addr, tt.user, tt.password)
+		}
+	}
+}
+
+func TestBounceCommand(t *testing.T) {
+	tests := []struct {
+		ip   string
+		port int
+		want string
+	}{
+		{"192.0.2.10", 8080, "PORT 192,0,2,10,31,144"},
+		{"2001:db8::1", 22, "EPRT |2|2001:db8::1|22|"},
+		{"fe80::1%eth0", 22, ""},
+	}
+	for _, tt := range tests {
+		got, err := bounceCommand(tt.ip, tt.port)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("bounceCommand(%q, %d) = %q, %v, expected %q", tt.ip, tt.port, got, err, tt.want)
+		}
+	}
+}
+
+// bounceServer is an FTP server that connects wherever PORT tells it to
+// when sent LIST, as servers before the bounce fixes did, unless fixed is
+// set
+func bounceServer(t *testing.T, fixed bool) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprintf(conn, "220 ready\r\n")
+				var target string
+				lines := bufio.NewScanner(conn)
+				for lines.Scan() {
+					verb, arg, _ := strings.Cut(lines.Text(), " ")
+					switch verb {
+					case "USER":
+						fmt.Fprintf(conn, "331 password please\r\n")
+					case "PASS":
+						fmt.Fprintf(conn, "230 logged in\r\n")
+					case "PORT":
+						var h [4]int
+						var p1, p2 int
+						fmt.Sscanf(arg, "%d,%d,%d,%d,%d,%d", &h[0], &h[1], &h[2], &h[3], &p1, &p2)
+						if fixed && h != [4]int{127, 0, 0, 1} {
+							fmt.Fprintf(conn, "500 Illegal PORT command.\r\n")
+							continue
+						}
+						target = fmt.Sprintf("%d.%d.%d.%d:%d", h[0], h[1], h[2], h[3], p1<<8|p2)
+						fmt.Fprintf(conn, "200 PORT command successful.\r\n")
+					case "LIST":
+						data, err := net.Dial("tcp", target)
+						if err != nil {
+							fmt.Fprintf(conn, "425 Can't open data connection.\r\n")
+							continue
+						}
+						fmt.Fprintf(conn, "150 Here comes the directory listing.\r\n")
+						fmt.Fprintf(data, "-rw-r--r-- 1 ftp ftp 0 Jan 01 00:00 README\r\n")
+						data.Close()
+						fmt.Fprintf(conn, "226 Directory send OK.\r\n")
+					default:
+						fmt.Fprintf(conn, "502 not implemented\r\n")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestFTPBounce(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	go func() {
+		for {
+			conn, err := open.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	b, err := ParseFTPBounce(bounceServer(t, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Check(ProbeConfig{Timeout: time.Second}); err != nil {
+		t.Fatalf("Check() = %v, expected the server to accept a PORT to another host", err)
+	}
+	for _, tt := range []struct {
+		port int
+		want PortState
+	}{
+		{open.Addr().(*net.TCPAddr).Port, StateOpen},
+		{closed.Addr().(*net.TCPAddr).Port, StateClosed},
+		{open.Addr().(*net.TCPAddr).Port, StateOpen},
+	} {
+		state, err := b.Probe(context.Background(), "127.0.0.1", tt.port, ProbeConfig{Timeout: time.Second})
+		if state != tt.want {
+			t.Errorf("Probe(%d) = %v, %v, expected %v", tt.port, state, err, tt.want)
+		}
+		if _, kind := classifyDialError(err); state == StateClosed && kind != "refused" {
+			t.Errorf("Probe(%d) error %v classified as %s, expected refused", tt.port, err, kind)
+		}
+	}
+
+	fixed, _ := ParseFTPBounce(bounceServer(t, true))
+	if err := fixed.Check(ProbeConfig{Timeout: time.Second}); !errors.Is(err, errBounceRefused) {
+		t.Errorf("Check() = %v with a fixed server, expected %v", err, errBounceRefused)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+)
+
+// GeoIP looks up addresses in MaxMind DB files (GeoLite2 Country, City or
+// ASN). The format is read directly: a binary search tree over the address
+// bits whose leaves point into a section of self-describing data records.
+type GeoIP struct {
+	dbs []*mmdb
+}
+
+// OpenGeoIP loads one or more .mmdb files given as a comma-separated list,
+// typically a Country or City database plus an ASN database
+func OpenGeoIP(files string) (*GeoIP, error) {
+	g := &GeoIP{}
+	for _, file := range strings.Split(files, ",") {
+		file = strings.TrimSpace(file)
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		db, err := parseMMDB(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		g.dbs = append(g.dbs, db)
+	}
+	return g, nil
+}
+
+// enableGeoIP loads the given databases and enriches every result with them
+func enableGeoIP(files string) error {
+	if files == "" {
+		return nil
+	}
+	g, err := OpenGeoIP(files)
+	if err != nil {
+		return fmt.Errorf("loading GeoIP databases: %v", err)
+	}
+	enrichers = append(enrichers, g)
+	return nil
+}
+
+// Enrich fills in the country, ASN and organization of a result from every
+// database that knows its address
+func (g *GeoIP) Enrich(r *Result, probe ProbeConfig) {
+	ip := net.ParseIP(r.IP)
+	if ip == nil {
+		return
+	}
+	for _, db := range g.dbs {
+		record, err := db.lookup(ip)
+		if err != nil || record == nil {
+			continue
+		}
+		if code, ok := mmdbPath(record, "country", "iso_code").(string); ok && r.Country == "" {
+			r.Country = code
+		}
+		if asn, ok := mmdbPath(record, "autonomous_system_number").(uint64); ok && r.ASN == 0 {
+			r.ASN = uint(asn)
+		}
+		if org, ok := mmdbPath(record, "autonomous_system_organization").(string); ok && r.Org == "" {
+			r.Org = org
+		}
+	}
+}
+
+// mmdbPath walks nested maps in a decoded record
+func mmdbPath(v any, keys ...string) any {
+	for _, k := range keys {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+type mmdb struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node reached after the 96 zero bits of ::/96
+}
+
+func parseMMDB(b []byte) (*mmdb, error) {
+	i := bytes.LastIndex(b, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB file")
+	}
+	meta, _, err := (&mmdbDecoder{data: b[i+len(mmdbMetadataMarker):]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	get := func(key string) uint {
+		v, _ := mmdbPath(meta, key).(uint64)
+		return uint(v)
+	}
+	db := &mmdb{nodeCount: get("node_count"), recordSize: get("record_size"), ipVersion: get("ip_version")}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("search tree larger than file")
+	}
+	db.tree = b[:treeSize]
+	db.data = b[treeSize+16 : i]
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for range 96 {
+			if node >= db.nodeCount {
+				break
+			}
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (db *mmdb) record(node, bit uint) uint {
+	n := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		n = n[bit*3:]
+		return uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+	case 28:
+		if bit == 0 {
+			return uint(n[3]&0xF0)<<20 | uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+		}
+		return uint(n[3]&0x0F)<<24 | uint(n[4])<<16 | uint(n[5])<<8 | uint(n[6])
+	default:
+		return uint(binary.BigEndian.Uint32(n[bit*4:]))
+	}
+}
+
+// lookup returns the decoded record for an address, or nil if it has none
+func (db *mmdb) lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = db.record(node, bit)
+	}
+	if node == db.nodeCount {
+		return nil, nil
+	}
+	if node < db.nodeCount {
+		return nil, errors.New("search tree ended early")
+	}
+	offset := node - db.nodeCount - 16
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("record points outside the data section")
+	}
+	v, _, err := (&mmdbDecoder{data: db.data}).decode(offset)
+	return v, err
+}
+
+// mmdbDecoder decodes values from the MaxMind DB data section
+type mmdbDecoder struct {
+	data []byte
+}
+
+var errMMDBTruncated = errors.New("truncated MaxMind DB data")
+
+func (d *mmdbDecoder) bytesAt(offset, n uint) ([]byte, error) {
+	if offset+n > uint(len(d.data)) {
+		return nil, errMMDBTruncated
+	}
+	return d.data[offset : offset+n], nil
+}
+
+func beUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// decode returns the value at offset and the offset just after it.
+// Integers decode to uint64 (int32 to int64), floats to float64, maps to
+// map[string]any and arrays to []any.
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	ctrl, err := d.bytesAt(offset, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset++
+	typ := uint(ctrl[0] >> 5)
+
+	if typ == 1 { // pointer
+		ss, vvv := uint(ctrl[0]>>3)&3, uint(ctrl[0]&7)
+		b, err := d.bytesAt(offset, ss+1)
+		if err != nil {
+			return nil, 0, err
+		}
+		target := uint(beUint(b))
+		switch ss {
+		case 0:
+			target |= vvv << 8
+		case 1:
+			target = (target | vvv<<16) + 2048
+		case 2:
+			target = (target | vvv<<24) + 526336
+		}
+		v, _, err := d.decode(target)
+		return v, offset + ss + 1, err
+	}
+
+	if typ == 0 { // extended type
+		ext, err := d.bytesAt(offset, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(ext[0])
+		offset++
+	}
+
+	size := uint(ctrl[0] & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.bytesAt(offset, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		offset += n
+		size = [...]uint{29, 285, 65821}[n-1] + uint(beUint(b))
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]any, size)
+		for range size {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]any, 0, size)
+		for range size {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean, stored in the size
+		return size != 0, offset, nil
+	case 13: // end marker
+		return nil, offset, nil
+	}
+
+	b, err := d.bytesAt(offset, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	offset += size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), offset, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case 4, 10: // bytes, uint128
+		return b, offset, nil
+	case 5, 6, 9: // uint16, uint32, uint64
+		return beUint(b), offset, nil
+	case 8: // int32
+		return int64(int32(beUint(b))), offset, nil
+	}
+	return nil, 0, fmt.Errorf("unknown data type %d", typ)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func mmdbString(s string) []byte {
+	if len(s) >= 29 {
+		return append([]byte{2<<5 | 29, byte(len(s) - 29)}, s...)
+	}
+	return append([]byte{2<<5 | byte(len(s))}, s...)
+}
+
+func mmdbUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{6<<5 | 4}, v)
+}
+
+func mmdbMap(pairs ...[]byte) []byte {
+	b := []byte{7<<5 | byte(len(pairs)/2)}
+	for _, p := range pairs {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// putRecord writes one side of a search tree node
+func putRecord(node []byte, recordSize, bit int, v uint32) {
+	switch recordSize {
+	case 24:
+		copy(node[bit*3:], []byte{byte(v >> 16), byte(v >> 8), byte(v)})
+	case 28:
+		if bit == 0 {
+			copy(node, []byte{byte(v >> 16), byte(v >> 8), byte(v)})
+			node[3] |= byte(v>>24) << 4
+		} else {
+			copy(node[4:], []byte{byte(v >> 16), byte(v >> 8), byte(v)})
+			node[3] |= byte(v>>24) & 0x0F
+		}
+	case 32:
+		binary.BigEndian.PutUint32(node[bit*4:], v)
+	}
+}
+
+// buildMMDB makes a database where 0.0.0.0/1 maps to a record with a country
+// and ASN and 128.0.0.0/1 has no data. IPv6 databases reach the IPv4 subtree
+// through a chain of 96 "zero" nodes, as real databases do.
+func buildMMDB(recordSize, ipVersion int) []byte {
+	chain := 0
+	if ipVersion == 6 {
+		chain = 96
+	}
+	nodeCount := chain + 1
+	nodeBytes := recordSize / 4
+	tree := make([]byte, nodeCount*nodeBytes)
+	for i := range chain {
+		node := tree[i*nodeBytes:]
+		putRecord(node, recordSize, 0, uint32(i+1))
+		putRecord(node, recordSize, 1, uint32(nodeCount))
+	}
+	root := tree[chain*nodeBytes:]
+	putRecord(root, recordSize, 0, uint32(nodeCount+16))
+	putRecord(root, recordSize, 1, uint32(nodeCount))
+
+	data := mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("US")),
+		mmdbString("autonomous_system_number"), mmdbUint32(15169),
+		mmdbString("autonomous_system_organization"), mmdbString("Example Networks"),
+	)
+	meta := mmdbMap(
+		mmdbString("node_count"), mmdbUint32(uint32(nodeCount)),
+		mmdbString("record_size"), mmdbUint32(uint32(recordSize)),
+		mmdbString("ip_version"), mmdbUint32(uint32(ipVersion)),
+	)
+
+	b := append(tree, make([]byte, 16)...)
+	b = append(b, data...)
+	b = append(b, mmdbMetadataMarker...)
+	return append(b, meta...)
+}
+
+func TestGeoIPEnrich(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordSize int
+		ipVersion  int
+	}{
+		{name: "24-bit IPv4", recordSize: 24, ipVersion: 4},
+		{name: "28-bit IPv6", recordSize: 28, ipVersion: 6},
+		{name: "32-bit IPv6", recordSize: 32, ipVersion: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := parseMMDB(buildMMDB(tt.recordSize, tt.ipVersion))
+			if err != nil {
+				t.Fatalf("parseMMDB() error = %v", err)
+			}
+			g := &GeoIP{dbs: []*mmdb{db}}
+
+			found := Result{IP: "8.8.8.8", Port: 53}
+			g.Enrich(&found, ProbeConfig{})
+			if found.Country != "US" || found.ASN != 15169 || found.Org != "Example Networks" {
+				t.Errorf("Enrich(8.8.8.8) = %+v", found)
+			}
+
+			missing := Result{IP: "192.0.2.1", Port: 80}
+			g.Enrich(&missing, ProbeConfig{})
+			if missing.Country != "" || missing.ASN != 0 || missing.Org != "" {
+				t.Errorf("Enrich(192.0.2.1) = %+v, expected no data", missing)
+			}
+		})
+	}
+}
+
+func TestMMDBLookupIPv6InIPv4Database(t *testing.T) {
+	db, err := parseMMDB(buildMMDB(24, 4))
+	if err != nil {
+		t.Fatalf("parseMMDB() error = %v", err)
+	}
+	if record, err := db.lookup(net.ParseIP("2001:db8::1")); record != nil || err != nil {
+		t.Errorf("lookup() = %v, %v, expected nil, nil", record, err)
+	}
+}
+
+func TestParseMMDBInvalid(t *testing.T) {
+	if _, err := parseMMDB([]byte("not a database")); err == nil {
+		t.Error("parseMMDB() accepted data without metadata")
+	}
+}
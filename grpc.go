@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The gRPC service defined in proto/pscanner.proto is served directly over
+// HTTP/2 with a minimal protobuf encoder, so no generated code or gRPC
+// runtime is needed on the server side.
+
+const grpcServicePrefix = "/pscanner.v1.Scanner/"
+
+// gRPC status codes used by the service
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcNotFound          = 5
+	grpcPermissionDenied  = 7
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnauthenticated   = 16
+)
+
+// grpcMaxMessage is the largest request message accepted, gRPC's default
+const grpcMaxMessage = 4 << 20
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+func appendTag(b []byte, field, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendStringField(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendIntField(b []byte, field int, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, uint64(v))
+}
+
+func appendDoubleField(b []byte, field int, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, field, wireFixed64)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+// protoReader walks the fields of an encoded protobuf message
+type protoReader struct {
+	b []byte
+}
+
+func (r *protoReader) varint() (uint64, error) {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		return 0, errTruncated
+	}
+	r.b = r.b[n:]
+	return v, nil
+}
+
+// next returns the field number and wire type of the next field
+func (r *protoReader) next() (int, int, error) {
+	tag, err := r.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(tag >> 3), int(tag & 7), nil
+}
+
+func (r *protoReader) bytes() ([]byte, error) {
+	n, err := r.varint()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.b)) < n {
+		return nil, errTruncated
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v, nil
+}
+
+// skip discards a field value of the given wire type
+func (r *protoReader) skip(wireType int) error {
+	size := 0
+	switch wireType {
+	case wireVarint:
+		_, err := r.varint()
+		return err
+	case wireBytes:
+		_, err := r.bytes()
+		return err
+	case wireFixed64:
+		size = 8
+	case wireFixed32:
+		size = 4
+	default:
+		return fmt.Errorf("unsupported wire type %d", wireType)
+	}
+	if len(r.b) < size {
+		return errTruncated
+	}
+	r.b = r.b[size:]
+	return nil
+}
+
+func decodeScanRequest(b []byte) (ScanRequest, error) {
+	var req ScanRequest
+	r := protoReader{b}
+	for len(r.b) > 0 {
+		field, wireType, err := r.next()
+		if err != nil {
+			return req, err
+		}
+		switch {
+		case field >= 1 && field <= 3 && wireType == wireBytes:
+			v, err := r.bytes()
+			if err != nil {
+				return req, err
+			}
+			switch field {
+			case 1:
+				req.Hosts = append(req.Hosts, string(v))
+			case 2:
+				req.CIDRs = append(req.CIDRs, string(v))
+			case 3:
+				req.Ports = string(v)
+			}
+		case (field == 4 || field == 5) && wireType == wireVarint:
+			v, err := r.varint()
+			if err != nil {
+				return req, err
+			}
+			if field == 4 {
+				req.Concurrency = int(int32(v))
+			} else {
+				req.Rate = int(int32(v))
+			}
+		default:
+			if err := r.skip(wireType); err != nil {
+				return req, err
+			}
+		}
+	}
+	return req, nil
+}
+
+func decodeScanRef(b []byte) (string, error) {
+	var id string
+	r := protoReader{b}
+	for len(r.b) > 0 {
+		field, wireType, err := r.next()
+		if err != nil {
+			return "", err
+		}
+		if field == 1 && wireType == wireBytes {
+			v, err := r.bytes()
+			if err != nil {
+				return "", err
+			}
+			id = string(v)
+			continue
+		}
+		if err := r.skip(wireType); err != nil {
+			return "", err
+		}
+	}
+	return id, nil
+}
+
+func encodeScanStatus(s JobStatus) []byte {
+	var b []byte
+	b = appendStringField(b, 1, s.ID)
+	b = appendStringField(b, 2, s.Status)
+	b = appendIntField(b, 3, int64(s.Total))
+	b = appendIntField(b, 4, int64(s.Scanned))
+	b = appendIntField(b, 5, int64(s.Open))
+	b = appendDoubleField(b, 6, s.Progress)
+	b = appendDoubleField(b, 7, s.Rate)
+	b = appendStringField(b, 8, s.Error)
+	return b
+}
+
+func encodeScanResult(r Result) []byte {
+	var b []byte
+	b = appendStringField(b, 1, r.Host)
+	b = appendStringField(b, 2, r.IP)
+	b = appendIntField(b, 3, int64(r.Port))
+	b = appendIntField(b, 4, r.Time.UnixNano())
+	return b
+}
+
+// grpcError is a failed call with a gRPC status code
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...any) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// readGRPCMessage reads one length-prefixed message from a request body,
+// refusing any longer than grpcMaxMessage before reading it
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "reading message header: %v", err)
+	}
+	if header[0] != 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > grpcMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "message of %d bytes is larger than the maximum of %d", size, grpcMaxMessage)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "reading message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage writes one length-prefixed message and flushes it
+func writeGRPCMessage(w http.ResponseWriter, msg []byte) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// GRPCHandler serves the Scanner gRPC service backed by the server's jobs
+func (s *Server) GRPCHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ProtoMajor != 2 ||
+			!strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+
+		err := s.serveGRPC(w, r)
+		code, msg := grpcOK, ""
+		if err != nil {
+			code, msg = grpcInternal, err.Error()
+			var gerr *grpcError
+			if errors.As(err, &gerr) {
+				code = gerr.code
+			}
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+		if msg != "" {
+			w.Header().Set(http.TrailerPrefix+"Grpc-Message", url.PathEscape(msg))
+		}
+	})
+}
+
+func (s *Server) serveGRPC(w http.ResponseWriter, r *http.Request) error {
+	// Authentication is checked here rather than by Authenticate, so a
+	// failure reaches the client as a gRPC status
+	key := s.requestKey(r)
+	if len(s.keys) > 0 && key == nil {
+		return grpcErrorf(grpcUnauthenticated, "missing or invalid API key")
+	}
+	method, ok := strings.CutPrefix(r.URL.Path, grpcServicePrefix)
+	if !ok {
+		return grpcErrorf(grpcUnimplemented, "unknown service %s", r.URL.Path)
+	}
+	switch method {
+	case "SubmitScan", "GetStatus", "Cancel", "StreamResults":
+	default:
+		return grpcErrorf(grpcUnimplemented, "unknown method %s", method)
+	}
+	msg, err := readGRPCMessage(r.Body)
+	if err != nil {
+		return err
+	}
+
+	if method == "SubmitScan" {
+		req, err := decodeScanRequest(msg)
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		job, err := s.Submit(req, key)
+		if errors.Is(err, errOutOfScope) {
+			return grpcErrorf(grpcPermissionDenied, "%v", err)
+		}
+		if errors.Is(err, errTooManyScans) {
+			return grpcErrorf(grpcResourceExhausted, "%v", err)
+		}
+		if err != nil {
+			return grpcErrorf(grpcInvalidArgument, "%v", err)
+		}
+		return writeGRPCMessage(w, encodeScanStatus(job.Progress()))
+	}
+
+	id, err := decodeScanRef(msg)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "%v", err)
+	}
+	job := s.Job(id, key)
+	if job == nil {
+		return grpcErrorf(grpcNotFound, "scan %q not found", id)
+	}
+
+	switch method {
+	case "GetStatus":
+		return writeGRPCMessage(w, encodeScanStatus(job.Progress()))
+	case "Cancel":
+		job.cancel()
+		return writeGRPCMessage(w, encodeScanStatus(job.Progress()))
+	case "StreamResults":
+		sent := 0
+		for {
+			results, done, changed := job.Wait(sent)
+			for _, res := range results {
+				if err := writeGRPCMessage(w, encodeScanResult(res)); err != nil {
+					return err
+				}
+			}
+			sent += len(results)
+			if done {
+				return nil
+			}
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return r.Context().Err()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeScanRequest(t *testing.T) {
+	var msg []byte
+	msg = appendStringField(msg, 1, "10.0.0.1")
+	msg = appendStringField(msg, 1, "example.com")
+	msg = appendStringField(msg, 2, "192.168.0.0/30")
+	msg = appendStringField(msg, 3, "22,80")
+	msg = appendIntField(msg, 4, 50)
+	msg = appendIntField(msg, 5, 200)
+	msg = appendStringField(msg, 9, "unknown field")
+
+	req, err := decodeScanRequest(msg)
+	if err != nil {
+		t.Fatalf("decodeScanRequest() error = %v", err)
+	}
+	expected := ScanRequest{
+		Hosts:       []string{"10.0.0.1", "example.com"},
+		CIDRs:       []string{"192.168.0.0/30"},
+		Ports:       "22,80",
+		Concurrency: 50,
+		Rate:        200,
+	}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("decodeScanRequest() = %+v, expected %+v", req, expected)
+	}
+
+	if _, err := decodeScanRequest(msg[:len(msg)-3]); err == nil {
+		t.Errorf("decodeScanRequest() expected error for truncated message")
+	}
+}
+
+func TestReadGRPCMessageTooLarge(t *testing.T) {
+	header := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], grpcMaxMessage+1)
+	_, err := readGRPCMessage(bytes.NewReader(header))
+	var gerr *grpcError
+	if !errors.As(err, &gerr) || gerr.code != grpcResourceExhausted {
+		t.Errorf("readGRPCMessage() error = %v, expected RESOURCE_EXHAUSTED", err)
+	}
+}
+
+// decodeFields returns the string and varint fields of an encoded message
+func decodeFields(t *testing.T, b []byte) map[int]any {
+	fields := map[int]any{}
+	r := protoReader{b}
+	for len(r.b) > 0 {
+		field, wireType, err := r.next()
+		if err != nil {
+			t.Fatalf("decoding field: %v", err)
+		}
+		switch wireType {
+		case wireBytes:
+			v, _ := r.bytes()
+			fields[field] = string(v)
+		case wireVarint:
+			v, _ := r.varint()
+			fields[field] = int64(v)
+		default:
+			r.skip(wireType)
+		}
+	}
+	return fields
+}
+
+func grpcCall(t *testing.T, client *http.Client, url, method string, msg []byte) [][]byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	req, _ := http.NewRequest("POST", url+grpcServicePrefix+method, bytes.NewReader(append(frame, msg...)))
+	req.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s error = %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var msgs [][]byte
+	for {
+		m, err := readGRPCMessage(resp.Body)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, m)
+	}
+	io.Copy(io.Discard, resp.Body)
+	if status := resp.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Fatalf("%s grpc-status = %q (%s)", method, status, resp.Trailer.Get("Grpc-Message"))
+	}
+	return msgs
+}
+
+func TestGRPCSubmitAndStream(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ts := httptest.NewUnstartedServer(NewServer(quickProbe).GRPCHandler())
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: transport}
+
+	var submit []byte
+	submit = appendStringField(submit, 1, "127.0.0.1")
+	submit = appendStringField(submit, 3, fmt.Sprint(port))
+	msgs := grpcCall(t, client, ts.URL, "SubmitScan", submit)
+	if len(msgs) != 1 {
+		t.Fatalf("SubmitScan returned %d messages, expected 1", len(msgs))
+	}
+	id, _ := decodeFields(t, msgs[0])[1].(string)
+	if id == "" {
+		t.Fatalf("SubmitScan returned no scan ID")
+	}
+
+	msgs = grpcCall(t, client, ts.URL, "StreamResults", appendStringField(nil, 1, id))
+	if len(msgs) != 1 {
+		t.Fatalf("StreamResults returned %d results, expected 1", len(msgs))
+	}
+	if got := decodeFields(t, msgs[0])[3]; got != int64(port) {
+		t.Errorf("StreamResults port = %v, expected %d", got, port)
+	}
+
+	msgs = grpcCall(t, client, ts.URL, "GetStatus", appendStringField(nil, 1, id))
+	if got := decodeFields(t, msgs[0])[2]; got != JobCompleted {
+		t.Errorf("GetStatus status = %v, expected %s", got, JobCompleted)
+	}
+}
+
+func TestGRPCErrorStatus(t *testing.T) {
+	keys, err := LoadAPIKeys(writeKeysFile(t, `[{"name": "ci", "key": "ci-key"}]`))
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	server := NewServer(quickProbe)
+	server.keys = keys
+	ts := httptest.NewUnstartedServer(server.GRPCHandler())
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: transport}
+
+	tests := []struct {
+		name   string
+		path   string
+		key    string
+		status string
+	}{
+		{name: "No key", path: grpcServicePrefix + "GetStatus", status: "16"},
+		{name: "Wrong key", path: grpcServicePrefix + "GetStatus", key: "wrong", status: "16"},
+		{name: "Unknown method", path: grpcServicePrefix + "Delete", key: "ci-key", status: "12"},
+		{name: "Unknown service", path: "/other.v1.Service/GetStatus", key: "ci-key", status: "12"},
+		{name: "Unknown scan", path: grpcServicePrefix + "GetStatus", key: "ci-key", status: "5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := appendStringField(nil, 1, "missing")
+			frame := make([]byte, 5, 5+len(msg))
+			binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+			req, _ := http.NewRequest("POST", ts.URL+tt.path, bytes.NewReader(append(frame, msg...)))
+			req.Header.Set("Content-Type", "application/grpc")
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("HTTP status = %d, expected 200 with the error in the trailers", resp.StatusCode)
+			}
+			if got := resp.Trailer.Get("Grpc-Status"); got != tt.status {
+				t.Errorf("grpc-status = %q (%s), expected %q", got, resp.Trailer.Get("Grpc-Message"), tt.status)
+			}
+		})
+	}
+}
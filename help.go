@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// flagGroups sorts the scan flags into the sections of -help. Flags not
+// listed here are shown under Advanced.
+var flagGroups = []struct {
+	name  string
+	flags []string
+}{
+	{"Targets", []string{"h", "hf", "cf", "docker", "aws-profile", "aws-region", "gcp-project",
+		"azure-subscription", "cloud-ips", "k8s", "kubeconfig", "kube-context", "consul", "rescan-open", "rescan-top", "sweep", "4", "6", "dual-stack", "zone", "resolvers", "dns-retries", "scan-unresolved", "scan-network-addrs"}},
+	{"Ports", []string{"p", "ports-file", "port-order", "state", "udp", "udp-payloads", "snmp-community", "dns-version", "randomize", "seed"}},
+	{"Timing", []string{"c", "r", "t", "s", "reprobe", "polite", "honeypots", "confirm-over", "yes"}},
+	{"Output", []string{"o", "format", "match-ports", "match-service", "match-banner", "output-targets", "q", "v", "vv", "progress-json",
+		"no-color", "resume-file", "history", "alert-over", "alert-webhook", "alert-slack"}},
+	{"Advanced", []string{"config", "profile", "source-ip", "iface", "ftp-bounce", "knock", "enrich", "oui-file", "tls-audit", "hints", "hints-file", "geoip", "pcap", "uptime", "run-as", "screenshots", "metrics", "otlp",
+		"log-level", "log-json", "policy", "audit-log", "audit-chain", "version"}},
+}
+
+// scanExamples are the sample command lines shown by -help
+var scanExamples = [][2]string{
+	{"pscanner -h example.com", "Scan all ports of one host"},
+	{"pscanner -h 192.168.1.1 -p 22,80,443", "Scan a few ports"},
+	{"pscanner -cf ranges.txt -p 1-1024 -c 500 -o open.txt", "Scan CIDR ranges and save the results"},
+	{"pscanner -hf hosts.txt -t 2s -r 2 -state all", "Slow links: longer timeout, report every state"},
+	{"pscanner -h example.com -p 80,443 -output-targets | httpx", "Feed open ports to another tool"},
+	{"pscanner resume", "Continue a scan interrupted with Ctrl+C"},
+}
+
+// writeUsage prints the help for the scan flags of fs: the commands,
+// examples and the flags in groups
+func writeUsage(out io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(out, "Usage: pscanner [command] [flags]\n\n")
+	fmt.Fprintf(out, "Commands:\n")
+	for _, c := range commandHelp {
+		fmt.Fprintf(out, "  %-11s %s\n", c[0], c[1])
+	}
+	fmt.Fprintf(out, "\nWithout a command pscanner scans. Run 'pscanner <command> -help' for a command's flags.\n")
+
+	fmt.Fprintf(out, "\nExamples:\n")
+	for _, e := range scanExamples {
+		fmt.Fprintf(out, "  %s\n      %s\n", e[0], e[1])
+	}
+
+	grouped := make(map[string]bool)
+	for _, g := range flagGroups {
+		for _, name := range g.flags {
+			grouped[name] = true
+		}
+	}
+	var others []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if !grouped[f.Name] {
+			others = append(others, f.Name)
+		}
+	})
+	for _, g := range flagGroups {
+		names := g.flags
+		if g.name == "Advanced" {
+			names = append(slices.Clone(names), others...)
+		}
+		fmt.Fprintf(out, "\n%s:\n", g.name)
+		for _, name := range names {
+			if f := fs.Lookup(name); f != nil {
+				writeFlagHelp(out, f)
+			}
+		}
+	}
+}
+
+// flagColumn is the width of the name column in the flag help
+const flagColumn = 24
+
+// writeFlagHelp prints one flag with its value type, usage and default. Like
+// flag.PrintDefaults the type comes from a backquoted word in the usage, and
+// zero defaults are left out.
+func writeFlagHelp(out io.Writer, f *flag.Flag) {
+	typeName, usage := flag.UnquoteUsage(f)
+	name := "-" + f.Name
+	if typeName != "" {
+		name += " " + typeName
+	}
+	switch f.DefValue {
+	case "", "0", "false", "0s":
+	default:
+		if typeName == "string" {
+			usage += fmt.Sprintf(" (default %q)", f.DefValue)
+		} else {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+	}
+	if len(name) >= flagColumn-2 {
+		fmt.Fprintf(out, "  %s\n  %s%s\n", name, strings.Repeat(" ", flagColumn), usage)
+		return
+	}
+	fmt.Fprintf(out, "  %-*s%s\n", flagColumn, name, usage)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteUsage(t *testing.T) {
+	var out strings.Builder
+	writeUsage(&out, flag.CommandLine)
+	help := out.String()
+
+	for _, g := range flagGroups {
+		if !strings.Contains(help, "\n"+g.name+":\n") {
+			t.Errorf("help is missing the %s section", g.name)
+		}
+		for _, name := range g.flags {
+			if flag.Lookup(name) == nil {
+				t.Errorf("flagGroups lists unknown flag -%s", name)
+			}
+		}
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if n := strings.Count(help, "\n  -"+f.Name+" ") + strings.Count(help, "\n  -"+f.Name+"\n"); n != 1 {
+			t.Errorf("-%s is listed %d times, expected once", f.Name, n)
+		}
+	})
+}
+
+func TestWriteFlagHelp(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("p", "", "Ports to scan")
+	fs.Int("c", 100, "Number of workers")
+	fs.String("format", "text", "Result format")
+	fs.Bool("q", false, "Quiet")
+	durationVar(fs, new(time.Duration), "t", 500*time.Millisecond, "Timeout as a `duration`")
+	fs.String("azure-subscription", "", "Scan an Azure subscription")
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"p", "  -p string               Ports to scan\n"},
+		{"c", "  -c int                  Number of workers (default 100)\n"},
+		{"format", "  -format string          Result format (default \"text\")\n"},
+		{"q", "  -q                      Quiet\n"},
+		{"t", "  -t duration             Timeout as a duration (default 500ms)\n"},
+		{"azure-subscription", "  -azure-subscription string\n                          Scan an Azure subscription\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			writeFlagHelp(&out, fs.Lookup(tt.name))
+			if out.String() != tt.expected {
+				t.Errorf("writeFlagHelp() = %q, expected %q", out.String(), tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Hint is a known vulnerability the software on a port may have. It is only
+// a hint: it comes from the product and version the port announced, which
+// may be wrong, and distributions often fix bugs without changing versions.
+type Hint struct {
+	ID         string   `json:"id"`
+	Summary    string   `json:"summary"`
+	References []string `json:"references,omitempty"`
+	Unverified bool     `json:"unverified"` // always true; nothing was tested
+}
+
+// HintRule matches the software of a port against a known vulnerability
+type HintRule struct {
+	ID         string   `json:"id"`
+	Product    string   `json:"product,omitempty"`  // product name, compared ignoring case
+	Versions   string   `json:"versions,omitempty"` // comma-separated constraints that must all hold, e.g. ">=4.87,<4.92"
+	Banner     string   `json:"banner,omitempty"`   // regular expression matched against the banner
+	Summary    string   `json:"summary"`
+	References []string `json:"references,omitempty"`
+
+	banner      *regexp.Regexp
+	constraints []versionConstraint
+}
+
+// versionConstraint is one of the constraints of a rule, such as "<4.92"
+type versionConstraint struct {
+	Op      string
+	Version string
+}
+
+// versionOps are the operators of version constraints, longest first
+var versionOps = []string{"<=", ">=", "<", ">", "="}
+
+//go:embed hints.json
+var bundledHints []byte
+
+// hintsEnabled and hintsFile are the -hints and -hints-file flags
+var (
+	hintsEnabled bool
+	hintsFile    string
+)
+
+// hintRules are the rules in use, none unless -hints is given
+var hintRules []HintRule
+
+// hintsPath is where a newer ruleset replaces the bundled one without a
+// new release of pscanner
+func hintsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pscanner", "hints.json")
+}
+
+// LoadHints reads the rules from filename, or else from hintsPath if it
+// exists, or else the bundled ones
+func LoadHints(filename string) ([]HintRule, error) {
+	data, source := bundledHints, "bundled hints"
+	if filename == "" {
+		if path := hintsPath(); path != "" {
+			if _, err := os.Stat(path); err == nil {
+				filename = path
+			}
+		}
+	}
+	if filename != "" {
+		var err error
+		if data, err = os.ReadFile(filename); err != nil {
+			return nil, err
+		}
+		source = filename
+	}
+	rules, err := ParseHints(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	return rules, nil
+}
+
+// ParseHints decodes and checks a JSON array of rules
+func ParseHints(data []byte) ([]HintRule, error) {
+	var rules []HintRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.ID == "" || rule.Summary == "" {
+			return nil, fmt.Errorf("rule %d: id and summary are required", i+1)
+		}
+		if rule.Product == "" && rule.Banner == "" {
+			return nil, fmt.Errorf("rule %s: needs a product or a banner to match", rule.ID)
+		}
+		if rule.Banner != "" {
+			re, err := regexp.Compile(rule.Banner)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: banner: %v", rule.ID, err)
+			}
+			rule.banner = re
+		}
+		for _, c := range strings.Split(rule.Versions, ",") {
+			if c = strings.TrimSpace(c); c == "" {
+				continue
+			}
+			i := slices.IndexFunc(versionOps, func(op string) bool { return strings.HasPrefix(c, op) })
+			if i < 0 {
+				return nil, fmt.Errorf("rule %s: version constraint %q must start with <, <=, >, >= or =", rule.ID, c)
+			}
+			op := versionOps[i]
+			rule.constraints = append(rule.constraints, versionConstraint{op, strings.TrimSpace(c[len(op):])})
+		}
+	}
+	return rules, nil
+}
+
+// matchHints returns the hints of the rules matching a result
+func matchHints(r Result, rules []HintRule) []Hint {
+	var hints []Hint
+	for _, rule := range rules {
+		if rule.matches(r) {
+			hints = append(hints, Hint{ID: rule.ID, Summary: rule.Summary, References: rule.References, Unverified: true})
+		}
+	}
+	return hints
+}
+
+// matches reports whether a result has the product, version and banner of
+// a rule. A rule with version constraints never matches an unknown version.
+func (rule HintRule) matches(r Result) bool {
+	if rule.Product != "" && !strings.EqualFold(rule.Product, r.Product) {
+		return false
+	}
+	if rule.banner != nil && !rule.banner.MatchString(r.Banner) {
+		return false
+	}
+	if len(rule.constraints) > 0 && r.Version == "" {
+		return false
+	}
+	for _, c := range rule.constraints {
+		order := compareSoftwareVersions(r.Version, c.Version)
+		ok := map[string]bool{"<": order < 0, "<=": order <= 0, ">": order > 0, ">=": order >= 0, "=": order == 0}[c.Op]
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// versionPart splits a version into runs of digits and of letters
+var versionPart = regexp.MustCompile(`[0-9]+|[A-Za-z]+`)
+
+// compareSoftwareVersions orders versions such as "4.94.2", "8.9p1" and
+// "1.3.3c" part by part: runs of digits by value, runs of letters
+// alphabetically. A version that goes on where the other stops, "9.8p1"
+// after "9.8", is the later one.
+func compareSoftwareVersions(a, b string) int {
+	pa, pb := versionPart.FindAllString(a, -1), versionPart.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, y := pa[i], pb[i]
+		xNum, yNum := x[0] >= '0' && x[0] <= '9', y[0] >= '0' && y[0] <= '9'
+		switch {
+		case xNum && yNum:
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				return cmp.Compare(len(x), len(y))
+			}
+		case xNum != yNum: // digits come after letters, so 1.0.1 follows 1.0rc1
+			if xNum {
+				return 1
+			}
+			return -1
+		}
+		if c := strings.Compare(strings.ToLower(x), strings.ToLower(y)); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(pa), len(pb))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCompareSoftwareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"4.94.2", "4.94.2", 0},
+		{"4.94", "4.94.2", -1},
+		{"4.96", "4.94.2", 1},
+		{"8.9p1", "9.8", -1},
+		{"9.8p1", "9.8", 1},
+		{"4.2.8p15", "4.2.7", 1},
+		{"1.3.3c", "1.3.3", 1},
+		{"1.3.3c", "1.3.3d", -1},
+		{"10.0", "9.9", 1},
+		{"1.0.1", "1.0rc1", 1},
+	}
+	for _, tt := range tests {
+		if got := compareSoftwareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareSoftwareVersions(%q, %q) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestBundledHints(t *testing.T) {
+	rules, err := ParseHints(bundledHints)
+	if err != nil {
+		t.Fatalf("ParseHints(bundled) = %v", err)
+	}
+	ids := func(r Result) []string {
+		var found []string
+		for _, h := range matchHints(r, rules) {
+			if !h.Unverified {
+				t.Errorf("hint %s is not marked unverified", h.ID)
+			}
+			found = append(found, h.ID)
+		}
+		return found
+	}
+	tests := []struct {
+		product, version string
+		want             []string
+	}{
+		{"vsFTPd", "2.3.4", []string{"vsftpd-backdoor"}},
+		{"vsFTPd", "3.0.3", nil},
+		{"Exim", "4.90", []string{"exim-wizard", "exim-21nails"}},
+		{"Exim", "4.96", nil},
+		{"OpenSSH", "8.9p1", []string{"openssh-regresshion"}},
+		{"OpenSSH", "9.8p1", nil},
+		{"OpenSSH", "7.4", []string{"openssh-user-enum"}},
+		{"OpenSSH", "", nil},
+		{"ProFTPD", "1.3.3c", []string{"proftpd-backdoor"}},
+	}
+	for _, tt := range tests {
+		if got := ids(Result{Product: tt.product, Version: tt.version}); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hints for %s %s = %q, expected %q", tt.product, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseHints(t *testing.T) {
+	bad := []string{
+		`{"id": "x"}`,
+		`[{"id": "x", "summary": "s"}]`,
+		`[{"id": "x", "summary": "s", "product": "p", "versions": "4.92"}]`,
+		`[{"id": "x", "summary": "s", "banner": "("}]`,
+	}
+	for _, data := range bad {
+		if _, err := ParseHints([]byte(data)); err == nil {
+			t.Errorf("ParseHints(%s) succeeded, expected an error", data)
+		}
+	}
+
+	rules, err := ParseHints([]byte(`[{"id": "old-box", "summary": "s", "banner": "(?i)ubuntu-4ubuntu0\\.[0-2]\\b", "references": ["USN-1"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Result{State: StateOpen, Product: "OpenSSH", Banner: "SSH-2.0-OpenSSH_8.2p1 Ubuntu-4ubuntu0.2"}
+	r.Hints = matchHints(r, rules)
+	if len(r.Hints) != 1 || r.Hints[0].ID != "old-box" {
+		t.Fatalf("matchHints() = %+v, expected the banner rule", r.Hints)
+	}
+	if got := serviceFindings(r); !reflect.DeepEqual(got, []string{"may be affected by USN-1 (unverified)"}) {
+		t.Errorf("serviceFindings() = %q, expected the hint", got)
+	}
+}
+
+func TestLoadHints(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	bundled, err := LoadHints("")
+	if err != nil || len(bundled) == 0 {
+		t.Fatalf("LoadHints() = %d rules, %v, expected the bundled ones", len(bundled), err)
+	}
+
+	// A ruleset in the config directory replaces the bundled one
+	path := hintsPath()
+	os.MkdirAll(filepath.Dir(path), 0o755)
+	os.WriteFile(path, []byte(`[{"id": "local", "summary": "s", "product": "p"}]`), 0o644)
+	if rules, err := LoadHints(""); err != nil || len(rules) != 1 || rules[0].ID != "local" {
+		t.Errorf("LoadHints() = %+v, %v, expected the rule from %s", rules, err, path)
+	}
+
+	if _, err := LoadHints(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("LoadHints() of a missing file succeeded")
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The history database is an append-only JSON-lines file with one line per
+// scan, so runs can be recorded without any database dependency and the file
+// stays greppable.
+
+// ScanRecord is one scan stored in the history database
+type ScanRecord struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Hosts    []string  `json:"hosts"`
+	Ports    string    `json:"ports"`
+	UDPPorts []int     `json:"udp_ports,omitempty"`
+	Results  []Result  `json:"results"`
+
+	hostSet map[string]bool
+	portSet map[int]bool
+	udpSet  map[int]bool
+}
+
+// covers reports whether the scan probed the given host and port over the
+// result's transport, so a port missing from its results is known to be
+// closed rather than just not scanned
+func (rec *ScanRecord) covers(r Result) bool {
+	if rec.hostSet == nil {
+		rec.hostSet = make(map[string]bool, len(rec.Hosts))
+		for _, h := range rec.Hosts {
+			rec.hostSet[h] = true
+		}
+		rec.portSet = make(map[int]bool)
+		portList, _ := PortsOrDefault(rec.Ports)
+		for _, p := range portList {
+			rec.portSet[p] = true
+		}
+		rec.udpSet = make(map[int]bool, len(rec.UDPPorts))
+		for _, p := range rec.UDPPorts {
+			rec.udpSet[p] = true
+		}
+	}
+	if !rec.hostSet[r.Host] && !rec.hostSet[r.IP] {
+		return false
+	}
+	switch r.Transport {
+	case "":
+		return rec.portSet[r.Port]
+	case "udp":
+		return rec.udpSet[r.Port]
+	}
+	return false
+}
+
+// AppendHistory records a scan at the end of the history file
+func AppendHistory(filename string, rec ScanRecord) error {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := writeHistory(f, rec); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeHistory is AppendHistory to a history file already open for
+// appending
+func writeHistory(f *os.File, rec ScanRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// LoadHistory reads every recorded scan, oldest first
+func LoadHistory(filename string) ([]*ScanRecord, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []*ScanRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		rec := &ScanRecord{}
+		if err := json.Unmarshal([]byte(text), rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filename, line, err)
+		}
+		records = append(records, rec)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, scanner.Err()
+}
+
+// PortHistory summarizes when an ip:port was seen open
+type PortHistory struct {
+	Result
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+	Open      bool      `json:"open"` // open in the latest scan that covered it
+}
+
+// Sightings returns the first and last time each ip:port was seen open
+func Sightings(records []*ScanRecord) []PortHistory {
+	byKey := make(map[string]*PortHistory)
+	for _, rec := range records {
+		for _, r := range rec.Results {
+			if r.State != StateOpen {
+				continue
+			}
+			h := byKey[r.Key()]
+			if h == nil {
+				h = &PortHistory{Result: r, FirstSeen: rec.Time}
+				byKey[r.Key()] = h
+			}
+			h.LastSeen = rec.Time
+			h.Count++
+		}
+	}
+
+	var out []PortHistory
+	for _, h := range byKey {
+		h.Open = true
+		for _, rec := range records {
+			if rec.Time.After(h.LastSeen) && rec.covers(h.Result) {
+				h.Open = false
+				break
+			}
+		}
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].IP != out[j].IP {
+			return out[i].IP < out[j].IP
+		}
+		return out[i].Port < out[j].Port
+	})
+	return out
+}
+
+// PortChange is a port opening or closing between two recorded scans
+type PortChange struct {
+	Time   time.Time `json:"time"`
+	Scan   string    `json:"scan"`
+	Change string    `json:"change"` // "opened" or "closed"
+	Result
+}
+
+// Changes replays the history and returns the changes recorded since the
+// given time. A port only counts as closed when a later scan covered it.
+func Changes(records []*ScanRecord, since time.Time) []PortChange {
+	open := make(map[string]Result)
+	var changes []PortChange
+	for i, rec := range records {
+		current := make(map[string]bool, len(rec.Results))
+		for _, r := range rec.Results {
+			if r.State != StateOpen {
+				continue
+			}
+			current[r.Key()] = true
+			if _, ok := open[r.Key()]; !ok {
+				open[r.Key()] = r
+				if i > 0 && !rec.Time.Before(since) {
+					changes = append(changes, PortChange{Time: rec.Time, Scan: rec.ID, Change: "opened", Result: r})
+				}
+			}
+		}
+		var closed []Result
+		for key, r := range open {
+			if !current[key] && rec.covers(r) {
+				delete(open, key)
+				closed = append(closed, r)
+			}
+		}
+		sortResults(closed)
+		if !rec.Time.Before(since) {
+			for _, r := range closed {
+				changes = append(changes, PortChange{Time: rec.Time, Scan: rec.ID, Change: "closed", Result: r})
+			}
+		}
+	}
+	return changes
+}
+
+// runHistory implements the "history" subcommand
+func runHistory(args []string) int {
+	usage := "Usage: pscanner history scans|seen|changes [-db file] [-days n] [-json]\n"
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	query := args[0]
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	db := flags.String("db", "pscanner-history.jsonl", "History database written by -history")
+	days := flags.Int("days", 30, "For changes: how many days back to report")
+	asJSON := flags.Bool("json", false, "Print JSON instead of a table")
+	flags.Parse(args[1:])
+
+	records, err := LoadHistory(*db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *asJSON {
+		out = io.Discard
+	}
+	var rows any
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	switch query {
+	case "scans":
+		rows = records
+		fmt.Fprintln(w, "SCAN\tTIME\tHOSTS\tOPEN")
+		for _, rec := range records {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", rec.ID, rec.Time.Format(time.RFC3339), len(rec.Hosts), len(rec.Results))
+		}
+	case "seen":
+		sightings := Sightings(records)
+		rows = sightings
+		fmt.Fprintln(w, "PORT\tHOST\tFIRST SEEN\tLAST SEEN\tSCANS\tSTATE")
+		for _, h := range sightings {
+			state := "closed"
+			if h.Open {
+				state = "open"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", h.Result, h.Host,
+				h.FirstSeen.Format(time.RFC3339), h.LastSeen.Format(time.RFC3339), h.Count, state)
+		}
+	case "changes":
+		changes := Changes(records, time.Now().AddDate(0, 0, -*days))
+		rows = changes
+		fmt.Fprintln(w, "TIME\tSCAN\tCHANGE\tPORT\tHOST")
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Time.Format(time.RFC3339), c.Scan, c.Change, c.Result, c.Host)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown history query %q\n%s", query, usage)
+		return 2
+	}
+
+	w.Flush()
+	if *asJSON {
+		return printJSON(os.Stdout, rows)
+	}
+	return 0
+}
+
+func printJSON(out io.Writer, v any) int {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		return 1
+	}
+	return 0
+}
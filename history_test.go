@@ -0,0 +1,136 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func historyFixture() []*ScanRecord {
+	day := func(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+	r := func(ip string, port int) Result { return Result{Host: ip, IP: ip, Port: port} }
+	return []*ScanRecord{
+		{ID: "a", Time: day(1), Hosts: []string{"10.0.0.1"}, Ports: "22,80", Results: []Result{r("10.0.0.1", 22), r("10.0.0.1", 80)}},
+		// Only covers port 22, so 10.0.0.1:80 is not known to be closed
+		{ID: "b", Time: day(2), Hosts: []string{"10.0.0.1"}, Ports: "22", Results: []Result{r("10.0.0.1", 22)}},
+		{ID: "c", Time: day(3), Hosts: []string{"10.0.0.1", "10.0.0.2"}, Ports: "22,80,443", Results: []Result{r("10.0.0.1", 22), r("10.0.0.2", 443)}},
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "history.jsonl")
+	records := historyFixture()
+	// Written out of order; LoadHistory sorts by time
+	for _, i := range []int{2, 0, 1} {
+		if err := AppendHistory(filename, *records[i]); err != nil {
+			t.Fatalf("AppendHistory() error = %v", err)
+		}
+	}
+
+	loaded, err := LoadHistory(filename)
+	if err != nil {
+		t.Fatalf("LoadHistory() error = %v", err)
+	}
+	if len(loaded) != 3 || loaded[0].ID != "a" || loaded[1].ID != "b" || loaded[2].ID != "c" {
+		t.Fatalf("LoadHistory() returned %d records in the wrong order", len(loaded))
+	}
+	if len(loaded[2].Results) != 2 || loaded[2].Results[1].Port != 443 {
+		t.Errorf("LoadHistory() results = %+v", loaded[2].Results)
+	}
+}
+
+func TestSightings(t *testing.T) {
+	tests := []struct {
+		key       string
+		firstSeen int
+		lastSeen  int
+		count     int
+		open      bool
+	}{
+		{key: "10.0.0.1:22", firstSeen: 1, lastSeen: 3, count: 3, open: true},
+		{key: "10.0.0.1:80", firstSeen: 1, lastSeen: 1, count: 1, open: false},
+		{key: "10.0.0.2:443", firstSeen: 3, lastSeen: 3, count: 1, open: true},
+	}
+
+	sightings := Sightings(historyFixture())
+	if len(sightings) != len(tests) {
+		t.Fatalf("Sightings() returned %d entries, expected %d", len(sightings), len(tests))
+	}
+	for i, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			h := sightings[i]
+			if h.Result.String() != tt.key || h.FirstSeen.Day() != tt.firstSeen || h.LastSeen.Day() != tt.lastSeen ||
+				h.Count != tt.count || h.Open != tt.open {
+				t.Errorf("Sightings()[%d] = %+v", i, h)
+			}
+		})
+	}
+}
+
+func TestChanges(t *testing.T) {
+	records := historyFixture()
+	changes := Changes(records, time.Time{})
+	expected := []struct {
+		scan   string
+		change string
+		key    string
+	}{
+		{scan: "c", change: "opened", key: "10.0.0.2:443"},
+		{scan: "c", change: "closed", key: "10.0.0.1:80"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Changes() = %+v, expected %d changes", changes, len(expected))
+	}
+	for i, e := range expected {
+		c := changes[i]
+		if c.Scan != e.scan || c.Change != e.change || c.Result.String() != e.key {
+			t.Errorf("Changes()[%d] = %+v, expected %+v", i, c, e)
+		}
+	}
+
+	if since := Changes(records, records[2].Time.Add(time.Second)); len(since) != 0 {
+		t.Errorf("Changes() after the last scan = %+v, expected none", since)
+	}
+}
+
+func TestChangesFlappingPort(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+	flapping := func(answered int) Result {
+		return Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Answered: answered, Attempts: 5}
+	}
+	records := []*ScanRecord{
+		{ID: "a", Time: day(1), Hosts: []string{"10.0.0.1"}, Ports: "80", Results: []Result{flapping(3)}},
+		{ID: "b", Time: day(2), Hosts: []string{"10.0.0.1"}, Ports: "80", Results: []Result{flapping(4)}},
+	}
+	if changes := Changes(records, time.Time{}); len(changes) != 0 {
+		t.Errorf("Changes() = %+v, expected none for a port open in both scans", changes)
+	}
+	if sightings := Sightings(records); len(sightings) != 1 || sightings[0].Count != 2 {
+		t.Errorf("Sightings() = %+v, expected one port seen twice", sightings)
+	}
+}
+
+func TestHistoryTransports(t *testing.T) {
+	day := func(n int) time.Time { return time.Date(2024, 1, n, 0, 0, 0, 0, time.UTC) }
+	dns := Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 53, Transport: "udp"}
+	records := []*ScanRecord{
+		{ID: "a", Time: day(1), Hosts: []string{"10.0.0.1"}, Ports: "53", UDPPorts: []int{53}, Results: []Result{dns}},
+		// A TCP-only rescan of port 53 says nothing about 53/udp
+		{ID: "b", Time: day(2), Hosts: []string{"10.0.0.1"}, Ports: "53"},
+	}
+	if changes := Changes(records, time.Time{}); len(changes) != 0 {
+		t.Errorf("Changes() = %+v, expected none after a TCP-only rescan", changes)
+	}
+	if sightings := Sightings(records); len(sightings) != 1 || !sightings[0].Open {
+		t.Errorf("Sightings() = %+v, expected 53/udp still open", sightings)
+	}
+
+	// A rescan that probed 53/udp again does close it
+	records = append(records, &ScanRecord{ID: "c", Time: day(3), Hosts: []string{"10.0.0.1"}, Ports: "53", UDPPorts: []int{53}})
+	if changes := Changes(records, time.Time{}); len(changes) != 1 || changes[0].Change != "closed" || changes[0].Transport != "udp" {
+		t.Errorf("Changes() = %+v, expected 53/udp closed", changes)
+	}
+	if sightings := Sightings(records); len(sightings) != 1 || sightings[0].Open {
+		t.Errorf("Sightings() = %+v, expected 53/udp closed", sightings)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// honeypotMode is the -honeypots flag: "label" or "skip"
+var honeypotMode string
+
+// The -honeypots heuristics. Real hosts rarely have more than a few percent
+// of their ports open; honeypots answer on most of them. Tarpits accept
+// connections and then hold them without a word or a close.
+const (
+	honeypotMinPorts = 100 // probes of a host before its share of open ports is judged
+	honeypotSample   = 5   // open ports of each host tested for accept-then-hang
+	honeypotMinHung  = 3   // tested ports needed before a host is called a tarpit
+)
+
+// honeypotHangWait is how long a tested port has to answer a request or
+// close the connection
+var honeypotHangWait = 3 * time.Second
+
+// errHoneypot is the outcome of the probes skipped with -honeypots skip
+var errHoneypot = errors.New("not probed: probable honeypot or tarpit")
+
+// HoneypotDetector labels the hosts of a scan that look like honeypots or
+// tarpits, from the share of their ports that are open and from how their
+// open ports behave once connected. Its methods do nothing on a nil
+// detector.
+type HoneypotDetector struct {
+	Skip bool // stop probing a host once it is labeled
+
+	mu    sync.Mutex
+	hosts map[string]*honeypotHost
+}
+
+// honeypotHost is the evidence gathered about one host
+type honeypotHost struct {
+	probed, open int
+	tested, hung int // open ports tested for accept-then-hang, and those that hung
+	testing      int // tests started, some of them still running
+	verdict      string
+}
+
+// Suspect is a host labeled by a HoneypotDetector and why
+type Suspect struct {
+	Host    string
+	Verdict string // "honeypot" or "tarpit"
+	Probed  int
+	Open    int
+	Tested  int
+	Hung    int
+}
+
+// NewHoneypotDetector returns the detector of a -honeypots mode, or nil when
+// it is empty
+func NewHoneypotDetector(mode string) (*HoneypotDetector, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case "label", "skip":
+		return &HoneypotDetector{Skip: mode == "skip", hosts: make(map[string]*honeypotHost)}, nil
+	}
+	return nil, fmt.Errorf("-honeypots must be label or skip, not %q", mode)
+}
+
+// Verdict returns "honeypot" or "tarpit" for a labeled host, and "" for
+// the others
+func (d *HoneypotDetector) Verdict(host string) string {
+	if d == nil {
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if h := d.hosts[host]; h != nil {
+		return h.verdict
+	}
+	return ""
+}
+
+// Skipping reports whether the remaining ports of host are left alone
+func (d *HoneypotDetector) Skipping(host string) bool {
+	return d != nil && d.Skip && d.Verdict(host) != ""
+}
+
+// Observe adds the outcome of a probe to the evidence about its host. The
+// first open ports of each host are connected to again to see whether they
+// hang.
+func (d *HoneypotDetector) Observe(ctx context.Context, host string, port int, state PortState, probe ProbeConfig) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	h := d.hosts[host]
+	if h == nil {
+		h = &honeypotHost{}
+		d.hosts[host] = h
+	}
+	h.probed++
+	test := false
+	if state == StateOpen {
+		h.open++
+		test = h.testing < honeypotSample && h.verdict == ""
+		if test {
+			h.testing++
+		}
+	}
+	h.judge()
+	d.mu.Unlock()
+	if !test {
+		return
+	}
+
+	hung := hangs(ctx, host, port, probe)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h.tested++
+	if hung {
+		h.hung++
+	}
+	h.judge()
+}
+
+// judge labels a host once the evidence is in; the detector's lock must be
+// held
+func (h *honeypotHost) judge() {
+	switch {
+	case h.verdict != "":
+	case h.tested >= honeypotMinHung && h.hung*2 > h.tested:
+		h.verdict = "tarpit"
+	case h.probed >= honeypotMinPorts && h.open*2 > h.probed:
+		h.verdict = "honeypot"
+	}
+}
+
+// Suspects returns the labeled hosts, sorted by name
+func (d *HoneypotDetector) Suspects() []Suspect {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var suspects []Suspect
+	for host, h := range d.hosts {
+		if h.verdict != "" {
+			suspects = append(suspects, Suspect{Host: host, Verdict: h.verdict, Probed: h.probed, Open: h.open, Tested: h.tested, Hung: h.hung})
+		}
+	}
+	sort.Slice(suspects, func(i, j int) bool { return suspects[i].Host < suspects[j].Host })
+	return suspects
+}
+
+// hangs connects to an open port and sends an HTTP request, which most
+// services answer or close the connection on, reporting whether the port
+// did neither for honeypotHangWait
+func hangs(ctx context.Context, host string, port int, probe ProbeConfig) bool {
+	conn, err := probe.Dialer(host, probe.Timeout).DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(honeypotHangWait))
+	if _, err := conn.Write([]byte("GET / HTTP/1.0\r\n\r\n")); err != nil {
+		return false
+	}
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// WriteSuspects lists the hosts labeled as honeypots or tarpits with the
+// evidence against each
+func WriteSuspects(w io.Writer, d *HoneypotDetector) {
+	suspects := d.Suspects()
+	if len(suspects) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n=== Probable Honeypots and Tarpits ===\n")
+	for _, s := range suspects {
+		var why string
+		if s.Verdict == "tarpit" {
+			why = fmt.Sprintf("%d of %d open ports tested accepted and hung", s.Hung, s.Tested)
+		} else {
+			why = fmt.Sprintf("%d of %d ports probed open", s.Open, s.Probed)
+		}
+		if d.Skip {
+			why += "; its other ports were skipped"
+		}
+		fmt.Fprintf(w, "%s: %s (%s)\n", s.Host, s.Verdict, why)
+	}
+}
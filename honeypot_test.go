@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewHoneypotDetector(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantNil bool
+		skip    bool
+		wantErr bool
+	}{
+		{"", true, false, false},
+		{"label", false, false, false},
+		{"skip", false, true, false},
+		{"drop", true, false, true},
+	}
+	for _, tt := range tests {
+		d, err := NewHoneypotDetector(tt.mode)
+		if (err != nil) != tt.wantErr || (d == nil) != tt.wantNil || d != nil && d.Skip != tt.skip {
+			t.Errorf("NewHoneypotDetector(%q) = %+v, %v", tt.mode, d, err)
+		}
+	}
+}
+
+func TestHoneypotJudge(t *testing.T) {
+	tests := []struct {
+		name string
+		host honeypotHost
+		want string
+	}{
+		{"most ports open", honeypotHost{probed: 1000, open: 812}, "honeypot"},
+		{"too few ports to tell", honeypotHost{probed: 20, open: 20}, ""},
+		{"a busy server", honeypotHost{probed: 1000, open: 40}, ""},
+		{"open ports hang", honeypotHost{probed: 10, open: 3, tested: 3, hung: 2}, "tarpit"},
+		{"one slow service", honeypotHost{probed: 10, open: 5, tested: 5, hung: 1}, ""},
+		{"too few tested", honeypotHost{probed: 10, open: 2, tested: 2, hung: 2}, ""},
+		{"labeled already", honeypotHost{probed: 1000, tested: 5, verdict: "honeypot"}, "honeypot"},
+	}
+	for _, tt := range tests {
+		tt.host.judge()
+		if tt.host.verdict != tt.want {
+			t.Errorf("%s: verdict %q, expected %q", tt.name, tt.host.verdict, tt.want)
+		}
+	}
+}
+
+func TestHoneypotSkipsTarpit(t *testing.T) {
+	defer func(wait time.Duration) { honeypotHangWait = wait }(honeypotHangWait)
+	honeypotHangWait = 100 * time.Millisecond
+
+	// Accepts every connection and holds it without a word
+	var ports []int
+	for range 4 {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+		ports = append(ports, listener.Addr().(*net.TCPAddr).Port)
+	}
+
+	honeypots, _ := NewHoneypotDetector("skip")
+	var got []Result
+	stats := &Stats{startTime: time.Now()}
+	RunScan(context.Background(), []string{"127.0.0.1"}, ports, ScanOptions{Workers: 1, Probe: quickProbe, Honeypots: honeypots}, stats, func(r Result) {
+		got = append(got, r)
+	})
+	if len(got) != 3 || got[1].Suspect != "" || got[2].Suspect != "tarpit" {
+		t.Fatalf("RunScan() = %+v, expected the third open port labeled and the fourth skipped", got)
+	}
+	if scanned, _, _ := stats.GetStats(); scanned != 4 {
+		t.Errorf("scanned %d ports, expected the skipped one counted too", scanned)
+	}
+	if s := honeypots.Suspects(); len(s) != 1 || s[0].Host != "127.0.0.1" || s[0].Hung != 3 {
+		t.Errorf("Suspects() = %+v", s)
+	}
+}
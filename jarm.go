@@ -0,0 +1,364 @@
+package main
+
+import (
+	"cmp"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jarmHello is one of the ten ClientHellos of a JARM fingerprint
+type jarmHello struct {
+	Version        uint16 // TLS version of the hello
+	NoTLS13        bool   // leave the TLS 1.3 suites out
+	Order          string // order of the cipher suites
+	Grease         bool   // add GREASE values
+	RareALPN       bool   // offer only rarely used application protocols
+	Supported      string // supported_versions extension: "1.2", "1.3" or none
+	ExtensionOrder string // order of the protocols and versions in the extensions
+}
+
+// jarmHellos are the hellos of JARM, in the order their answers are hashed
+var jarmHellos = []jarmHello{
+	{0x0303, false, "FORWARD", false, false, "1.2", "REVERSE"},
+	{0x0303, false, "REVERSE", false, false, "1.2", "FORWARD"},
+	{0x0303, false, "TOP_HALF", false, false, "", "FORWARD"},
+	{0x0303, false, "BOTTOM_HALF", false, true, "", "FORWARD"},
+	{0x0303, false, "MIDDLE_OUT", true, true, "", "REVERSE"},
+	{0x0302, false, "FORWARD", false, false, "", "FORWARD"},
+	{0x0304, false, "FORWARD", false, false, "1.3", "REVERSE"},
+	{0x0304, false, "REVERSE", false, false, "1.3", "FORWARD"},
+	{0x0304, true, "FORWARD", false, false, "1.3", "FORWARD"},
+	{0x0304, false, "MIDDLE_OUT", true, false, "1.3", "REVERSE"},
+}
+
+// jarmCiphers are the cipher suites JARM offers, in its forward order
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3, 0x009f, 0x0045, 0x00be, 0x0088,
+	0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac, 0xc0ae, 0xc02b, 0xc00a, 0xc024, 0xc0ad, 0xc0af, 0xc02c, 0xc072,
+	0xc073, 0xcca9, 0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013, 0xc027, 0xc02f, 0xc014, 0xc028, 0xc030, 0xc060,
+	0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304, 0x1303, 0xcc13, 0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0,
+	0x009c, 0x0035, 0x003d, 0xc09d, 0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// jarmALPN are the application protocols JARM offers, weakest first, and
+// jarmRareALPN those left when h2 and http/1.1 are taken out
+var (
+	jarmALPN     = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	jarmRareALPN = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// jarmOrder reorders the cipher suites, protocols or versions of a hello
+func jarmOrder[T any](items []T, order string) []T {
+	n := len(items)
+	switch order {
+	case "REVERSE":
+		reversed := slices.Clone(items)
+		slices.Reverse(reversed)
+		return reversed
+	case "BOTTOM_HALF":
+		return slices.Clone(items[n/2+n%2:])
+	case "TOP_HALF":
+		var out []T
+		if n%2 == 1 {
+			out = append(out, items[n/2])
+		}
+		return append(out, jarmOrder(jarmOrder(items, "REVERSE"), "BOTTOM_HALF")...)
+	case "MIDDLE_OUT":
+		var out []T
+		middle := n / 2
+		if n%2 == 1 {
+			out = append(out, items[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle+i], items[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle-1+i], items[middle-i])
+			}
+		}
+		return out
+	}
+	return slices.Clone(items)
+}
+
+// greaseValue is a random GREASE value, reserved so that servers ignore it
+func greaseValue() []byte {
+	var b [1]byte
+	rand.Read(b[:])
+	v := b[0]&0xf0 | 0x0a
+	return []byte{v, v}
+}
+
+// appendExtension appends a TLS extension of the given type and data
+func appendExtension(b []byte, kind uint16, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, kind)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// jarmClientHello encodes one JARM hello to host
+func jarmClientHello(host string, h jarmHello) []byte {
+	recordVersion, helloVersion := h.Version, h.Version
+	if h.Version == 0x0304 {
+		recordVersion, helloVersion = 0x0301, 0x0303
+	}
+	random := make([]byte, 64) // random, then session ID
+	rand.Read(random)
+	hello := binary.BigEndian.AppendUint16(nil, helloVersion)
+	hello = append(hello, random[:32]...)
+	hello = append(hello, 32)
+	hello = append(hello, random[32:]...)
+
+	ciphers := jarmCiphers
+	if h.NoTLS13 {
+		ciphers = slices.DeleteFunc(slices.Clone(ciphers), func(c uint16) bool { return c>>8 == 0x13 })
+	}
+	var suites []byte
+	if h.Grease {
+		suites = greaseValue()
+	}
+	for _, c := range jarmOrder(ciphers, h.Order) {
+		suites = binary.BigEndian.AppendUint16(suites, c)
+	}
+	hello = binary.BigEndian.AppendUint16(hello, uint16(len(suites)))
+	hello = append(hello, suites...)
+	hello = append(hello, 1, 0) // null compression
+
+	var ext []byte
+	if h.Grease {
+		ext = append(ext, greaseValue()...)
+		ext = append(ext, 0, 0)
+	}
+	sni := binary.BigEndian.AppendUint16(nil, uint16(len(host)+3))
+	sni = append(sni, 0)
+	sni = binary.BigEndian.AppendUint16(sni, uint16(len(host)))
+	ext = appendExtension(ext, 0x0000, append(sni, host...))
+	ext = appendExtension(ext, 0x0017, nil)                                              // extended_master_secret
+	ext = appendExtension(ext, 0x0001, []byte{1})                                        // max_fragment_length
+	ext = appendExtension(ext, 0xff01, []byte{0})                                        // renegotiation_info
+	ext = appendExtension(ext, 0x000a, []byte{0, 8, 0, 0x1d, 0, 0x17, 0, 0x18, 0, 0x19}) // supported_groups
+	ext = appendExtension(ext, 0x000b, []byte{1, 0})                                     // ec_point_formats
+	ext = appendExtension(ext, 0x0023, nil)                                              // session_ticket
+	protocols := jarmALPN
+	if h.RareALPN {
+		protocols = jarmRareALPN
+	}
+	var alpn []byte
+	for _, p := range jarmOrder(protocols, h.ExtensionOrder) {
+		alpn = append(append(alpn, byte(len(p))), p...)
+	}
+	ext = appendExtension(ext, 0x0010, append(binary.BigEndian.AppendUint16(nil, uint16(len(alpn))), alpn...))
+	ext = appendExtension(ext, 0x000d, []byte{0, 0x12, 4, 3, 8, 4, 4, 1, 5, 3, 8, 5, 5, 1, 8, 6, 6, 1, 2, 1}) // signature_algorithms
+	var share []byte
+	if h.Grease {
+		share = append(greaseValue(), 0, 1, 0)
+	}
+	share = append(share, 0, 0x1d, 0, 0x20)
+	share = append(share, random[:32]...)
+	ext = appendExtension(ext, 0x0033, append(binary.BigEndian.AppendUint16(nil, uint16(len(share))), share...)) // key_share
+	ext = appendExtension(ext, 0x002d, []byte{1, 1})                                                             // psk_key_exchange_modes
+	if h.Supported != "" {
+		versions := []uint16{0x0301, 0x0302, 0x0303}
+		if h.Supported == "1.3" {
+			versions = append(versions, 0x0304)
+		}
+		var list []byte
+		if h.Grease {
+			list = greaseValue()
+		}
+		for _, v := range jarmOrder(versions, h.ExtensionOrder) {
+			list = binary.BigEndian.AppendUint16(list, v)
+		}
+		ext = appendExtension(ext, 0x002b, append([]byte{byte(len(list))}, list...)) // supported_versions
+	}
+	hello = binary.BigEndian.AppendUint16(hello, uint16(len(ext)))
+	hello = append(hello, ext...)
+
+	handshake := append([]byte{1, 0}, binary.BigEndian.AppendUint16(nil, uint16(len(hello)))...)
+	handshake = append(handshake, hello...)
+	record := append([]byte{0x16}, binary.BigEndian.AppendUint16(nil, recordVersion)...)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+// serverHello is the part of a ServerHello that fingerprints are made of
+type serverHello struct {
+	Version    uint16
+	Cipher     uint16
+	ALPN       string
+	Extensions []uint16
+}
+
+// readServerHello reads the ServerHello that answers a hello, or returns
+// false for an alert or anything else
+func readServerHello(conn io.Reader) (serverHello, bool) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x16 {
+		return serverHello{}, false
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(conn, record); err != nil {
+		return serverHello{}, false
+	}
+	if len(record) < 4 || record[0] != 2 {
+		return serverHello{}, false
+	}
+	msg := record[4:]
+	if n := int(record[1])<<16 | int(binary.BigEndian.Uint16(record[2:])); n < len(msg) {
+		msg = msg[:n]
+	}
+	// version, random, session ID, cipher suite and compression
+	if len(msg) < 35 || len(msg) < 38+int(msg[34]) {
+		return serverHello{}, false
+	}
+	hello := serverHello{Version: binary.BigEndian.Uint16(msg)}
+	rest := msg[35+int(msg[34]):]
+	hello.Cipher = binary.BigEndian.Uint16(rest)
+	rest = rest[3:]
+	if len(rest) < 2 {
+		return hello, true
+	}
+	rest = rest[2:]
+	for len(rest) >= 4 {
+		kind, n := binary.BigEndian.Uint16(rest), int(binary.BigEndian.Uint16(rest[2:]))
+		if len(rest) < 4+n {
+			break
+		}
+		hello.Extensions = append(hello.Extensions, kind)
+		if data := rest[4 : 4+n]; kind == 0x0010 && len(data) > 3 {
+			hello.ALPN = string(data[3:])
+		}
+		rest = rest[4+n:]
+	}
+	return hello, true
+}
+
+// jarmHash combines the answers to the ten hellos into a JARM fingerprint:
+// for each answer the position of the cipher suite chosen among those JARM
+// offers and a letter for the version, followed by the start of a SHA-256 of
+// the application protocols and extension lists. No answers at all hash to
+// zeros.
+func jarmHash(answers []*serverHello) string {
+	// JARM numbers the suites in order, with the TLS 1.3 ones last
+	sorted := slices.Clone(jarmCiphers)
+	rank := func(c uint16) int {
+		if c>>8 == 0x13 {
+			return 0x10000 + int(c)
+		}
+		return int(c)
+	}
+	slices.SortFunc(sorted, func(a, b uint16) int { return cmp.Compare(rank(a), rank(b)) })
+	var fuzzy, rest strings.Builder
+	answered := false
+	for _, a := range answers {
+		if a == nil {
+			fuzzy.WriteString("000")
+			continue
+		}
+		answered = true
+		i := slices.Index(sorted, a.Cipher) + 1
+		if i == 0 {
+			i = len(sorted) + 1
+		}
+		fmt.Fprintf(&fuzzy, "%02x%c", i, "abcdef"[a.Version&0x0f])
+		types := make([]string, len(a.Extensions))
+		for j, e := range a.Extensions {
+			types[j] = fmt.Sprintf("%04x", e)
+		}
+		rest.WriteString(a.ALPN + strings.Join(types, "-"))
+	}
+	if !answered {
+		return strings.Repeat("0", 62)
+	}
+	sum := sha256.Sum256([]byte(rest.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+// ja3s is the JA3S fingerprint of a ServerHello: an MD5 of its version,
+// cipher suite and extensions in decimal
+func ja3s(h serverHello) string {
+	extensions := make([]string, len(h.Extensions))
+	for i, e := range h.Extensions {
+		extensions[i] = strconv.Itoa(int(e))
+	}
+	sum := md5.Sum([]byte(fmt.Sprintf("%d,%d,%s", h.Version, h.Cipher, strings.Join(extensions, "-"))))
+	return hex.EncodeToString(sum[:])
+}
+
+// JARMProber is an enricher that fingerprints TLS ports with JARM, and with
+// JA3S from the answer to the first JARM hello
+type JARMProber struct {
+	Timeout time.Duration
+}
+
+// Enrich sends the ten JARM hellos, one connection each
+func (p JARMProber) Enrich(r *Result, probe ProbeConfig) {
+	if r.TLS == nil {
+		TLSProber(p).Enrich(r, probe)
+	}
+	if r.TLS == nil {
+		return
+	}
+	answers := make([]*serverHello, len(jarmHellos))
+	for i, h := range jarmHellos {
+		answers[i] = p.exchange(r.Host, r.Port, probe, jarmClientHello(r.Host, h))
+	}
+	r.TLS.JARM = jarmHash(answers)
+	if answers[0] != nil {
+		r.TLS.JA3S = ja3s(*answers[0])
+	}
+}
+
+// exchange sends one hello and reads the ServerHello that answers it
+func (p JARMProber) exchange(host string, port int, probe ProbeConfig, hello []byte) *serverHello {
+	conn, err := probe.Dial(host, port, p.Timeout)
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * p.Timeout))
+	if _, err := conn.Write(hello); err != nil {
+		return nil
+	}
+	if h, ok := readServerHello(conn); ok {
+		return &h
+	}
+	return nil
+}
+
+// WriteSharedJARM lists the JARM fingerprints found on more than one address
+// with the ports that share them, a sign of one operator or frontend
+func WriteSharedJARM(w io.Writer, results []Result) {
+	results = append([]Result(nil), results...)
+	sortResults(results)
+	shared := make(map[string][]string)
+	for _, r := range results {
+		if r.TLS != nil && r.TLS.JARM != "" && r.TLS.JARM != strings.Repeat("0", 62) {
+			shared[r.TLS.JARM] = append(shared[r.TLS.JARM], net.JoinHostPort(r.IP, strconv.Itoa(r.Port)))
+		}
+	}
+	var fingerprints []string
+	for jarm, addrs := range shared {
+		if len(addrs) > 1 {
+			fingerprints = append(fingerprints, jarm)
+		}
+	}
+	if len(fingerprints) == 0 {
+		return
+	}
+	slices.Sort(fingerprints)
+	fmt.Fprintf(w, "\n=== Shared JARM Fingerprints ===\n")
+	for _, jarm := range fingerprints {
+		fmt.Fprintf(w, "%s: %s\n", jarm, strings.Join(shared[jarm], ", "))
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJARMOrder(t *testing.T) {
+	odd, even := []int{1, 2, 3, 4, 5}, []int{1, 2, 3, 4}
+	tests := []struct {
+		order     string
+		odd, even []int
+	}{
+		{"FORWARD", []int{1, 2, 3, 4, 5}, []int{1, 2, 3, 4}},
+		{"REVERSE", []int{5, 4, 3, 2, 1}, []int{4, 3, 2, 1}},
+		{"BOTTOM_HALF", []int{4, 5}, []int{3, 4}},
+		{"TOP_HALF", []int{3, 2, 1}, []int{2, 1}},
+		{"MIDDLE_OUT", []int{3, 4, 2, 5, 1}, []int{3, 2, 4, 1}},
+	}
+	for _, tt := range tests {
+		if got := jarmOrder(odd, tt.order); !reflect.DeepEqual(got, tt.odd) {
+			t.Errorf("jarmOrder(%v, %s) = %v, expected %v", odd, tt.order, got, tt.odd)
+		}
+		if got := jarmOrder(even, tt.order); !reflect.DeepEqual(got, tt.even) {
+			t.Errorf("jarmOrder(%v, %s) = %v, expected %v", even, tt.order, got, tt.even)
+		}
+	}
+}
+
+func TestJARMHash(t *testing.T) {
+	if got := jarmHash(make([]*serverHello, 10)); got != strings.Repeat("0", 62) {
+		t.Errorf("jarmHash() of no answers = %q, expected zeros", got)
+	}
+	answers := make([]*serverHello, 10)
+	answers[0] = &serverHello{Version: 0x0303, Cipher: 0xc02f, ALPN: "h2", Extensions: []uint16{0xff01, 0x0010}}
+	answers[9] = &serverHello{Version: 0x0303, Cipher: 0x1301, Extensions: []uint16{0x002b, 0x0033}}
+	got := jarmHash(answers)
+	want := "29d" + strings.Repeat("000", 8) + "41d" + "423162c8102643532d3c2dc7b58e0858"
+	if got != want {
+		t.Errorf("jarmHash() = %q, expected %q with c02f as the 41st suite and 1301 as the 65th", got, want)
+	}
+}
+
+func TestReadServerHello(t *testing.T) {
+	msg := []byte{3, 3}
+	msg = append(msg, make([]byte, 32)...)
+	msg = append(msg, 0, 0xc0, 0x2f, 0)
+	msg = append(msg, 0, 13, 0xff, 1, 0, 1, 0, 0, 0x10, 0, 5, 0, 3, 2, 'h', '2')
+	record := append([]byte{0x16, 3, 3, 0, byte(len(msg) + 4), 2, 0, 0, byte(len(msg))}, msg...)
+	got, ok := readServerHello(bytes.NewReader(record))
+	want := serverHello{Version: 0x0303, Cipher: 0xc02f, ALPN: "h2", Extensions: []uint16{0xff01, 0x0010}}
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("readServerHello() = %+v, %v, expected %+v", got, ok, want)
+	}
+	if got := ja3s(got); got != "7bee5c1d424b7e5f943b06983bb11422" { // MD5 of "771,49199,65281-16"
+		t.Errorf("ja3s() = %q, expected the MD5 of its version, suite and extensions", got)
+	}
+	if _, ok := readServerHello(bytes.NewReader([]byte{0x15, 3, 3, 0, 2, 2, 40})); ok {
+		t.Errorf("readServerHello() accepted an alert")
+	}
+}
+
+func TestJARMProber(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	config := &tls.Config{Certificates: srv.TLS.Certificates, MinVersion: tls.VersionTLS12}
+	port := serveOnce(t, func(conn net.Conn) {
+		tls.Server(conn, config).Handshake()
+	})
+
+	r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: port, Service: "https", State: StateOpen}
+	JARMProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.TLS == nil || !regexp.MustCompile(`^[0-9a-f]{62}$`).MatchString(r.TLS.JARM) || len(r.TLS.JA3S) != 32 {
+		t.Fatalf("Enrich() tls = %+v, expected JARM and JA3S fingerprints", r.TLS)
+	}
+	// The TLS 1.1 hello is refused
+	if r.TLS.JARM[15:18] != "000" || r.TLS.JARM[:3] == "000" {
+		t.Errorf("Enrich() jarm = %q, expected only the TLS 1.1 hello unanswered", r.TLS.JARM)
+	}
+
+	other := r
+	other.IP = "127.0.0.2"
+	var out bytes.Buffer
+	WriteSharedJARM(&out, []Result{r, other})
+	want := "\n=== Shared JARM Fingerprints ===\n" + r.TLS.JARM + ": 127.0.0.1:" + strconv.Itoa(port) + ", 127.0.0.2:" + strconv.Itoa(port) + "\n"
+	if out.String() != want {
+		t.Errorf("WriteSharedJARM() = %q, expected %q", out.String(), want)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "os"
+
+// WatchKeys calls onKey for every key pressed while stdin is a terminal. On
+// Linux the terminal is switched to unbuffered input without echo so single
+// keys register at once; elsewhere they arrive when Enter is pressed. The
+// returned function restores the terminal and must be called before exiting.
+func WatchKeys(onKey func(key byte)) (restore func()) {
+	if !isTerminal(os.Stdin) {
+		return func() {}
+	}
+	reset, err := enableCbreak(int(os.Stdin.Fd()))
+	if err != nil {
+		reset = func() {}
+	}
+
+	go func() {
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			for _, key := range buf[:n] {
+				onKey(key)
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return reset
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// knockSpec is the -knock flag
+var knockSpec string
+
+// knockWait is how long a knock waits for an answer it doesn't need: the SYN
+// or datagram is out at once, and closing the socket keeps it from being
+// sent again out of sequence
+const knockWait = 100 * time.Millisecond
+
+// defaultKnockDelay separates the knocks when -knock doesn't say
+const defaultKnockDelay = 100 * time.Millisecond
+
+// Knock is a port knocking sequence, sent to each host before its ports are
+// probed so that services a daemon such as knockd hides can be found
+type Knock struct {
+	Ports []KnockPort
+	Delay time.Duration // pause after each knock
+}
+
+// KnockPort is one knock: a TCP connection attempt, or a UDP datagram
+type KnockPort struct {
+	Port int
+	UDP  bool
+}
+
+func (k KnockPort) String() string {
+	if k.UDP {
+		return strconv.Itoa(k.Port) + "/udp"
+	}
+	return strconv.Itoa(k.Port)
+}
+
+// ParseKnock parses -knock: ports knocked in order, comma-separated, TCP
+// unless followed by /udp, and optionally the delay between knocks, e.g.
+// "7000,8000/udp,9000:delay=200ms"
+func ParseKnock(spec string) (*Knock, error) {
+	ports, options, _ := strings.Cut(spec, ":")
+	k := &Knock{Delay: defaultKnockDelay}
+	for _, p := range strings.Split(ports, ",") {
+		p = strings.TrimSpace(p)
+		number, proto, _ := strings.Cut(p, "/")
+		port, err := strconv.Atoi(number)
+		if err != nil || port < 1 || port > 65535 || proto != "" && proto != "tcp" && proto != "udp" {
+			return nil, fmt.Errorf("-knock: %q is not a port, or a port followed by /tcp or /udp", p)
+		}
+		k.Ports = append(k.Ports, KnockPort{Port: port, UDP: proto == "udp"})
+	}
+	if options == "" {
+		return k, nil
+	}
+	for _, option := range strings.Split(options, ":") {
+		name, value, _ := strings.Cut(option, "=")
+		if name != "delay" {
+			return nil, fmt.Errorf("-knock: unknown option %q (supported: delay)", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("-knock: delay %q is not a duration such as 200ms", value)
+		}
+		k.Delay = d
+	}
+	return k, nil
+}
+
+// String formats a sequence the way ParseKnock reads it
+func (k *Knock) String() string {
+	ports := make([]string, len(k.Ports))
+	for i, p := range k.Ports {
+		ports[i] = p.String()
+	}
+	return strings.Join(ports, ",") + ":delay=" + k.Delay.String()
+}
+
+// Send knocks on a host's ports in turn, from each of the source addresses
+// probes take turns between, since the daemon opens the ports to the
+// address that knocked only. Whether a knock was answered is of no
+// interest; the daemon only watches for it.
+func (k *Knock) Send(ctx context.Context, host string, probe ProbeConfig) {
+	if !probe.Source.Rotating() {
+		k.send(ctx, host, probe.Source, probe.Network)
+		return
+	}
+	candidates := familyOf(probe.Source.IPs, host, probe.Network)
+	if len(candidates) == 0 {
+		candidates = probe.Source.IPs
+	}
+	for _, ip := range candidates {
+		source := probe.Source
+		source.IPs, source.next = []net.IP{ip}, nil
+		k.send(ctx, host, source, probe.Network)
+	}
+}
+
+// send knocks on a host's ports from one source address
+func (k *Knock) send(ctx context.Context, host string, source SourceAddr, network string) {
+	for _, p := range k.Ports {
+		if ctx.Err() != nil {
+			return
+		}
+		dialer := source.Dialer(host, network, knockWait)
+		dial := cmp.Or(network, "tcp")
+		if p.UDP {
+			if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok {
+				dialer.LocalAddr = &net.UDPAddr{IP: local.IP}
+			}
+			dial = "udp" + strings.TrimPrefix(dial, "tcp")
+		}
+		conn, err := dialer.DialContext(ctx, dial, net.JoinHostPort(host, strconv.Itoa(p.Port)))
+		if err == nil {
+			if p.UDP {
+				conn.Write([]byte{0})
+			}
+			conn.Close()
+		}
+		sleepContext(ctx, k.Delay)
+	}
+}
+
+// hostKnocker sends a knock sequence to each host of a scan once, before its
+// first probe; the other probes of the host wait for it to finish
+type hostKnocker struct {
+	knock *Knock
+	mu    sync.Mutex
+	hosts map[string]*sync.Once
+}
+
+func newHostKnocker(knock *Knock) *hostKnocker {
+	return &hostKnocker{knock: knock, hosts: make(map[string]*sync.Once)}
+}
+
+// Knock knocks on host unless that has been done
+func (h *hostKnocker) Knock(ctx context.Context, host string, probe ProbeConfig) {
+	h.mu.Lock()
+	once, ok := h.hosts[host]
+	if !ok {
+		once = new(sync.Once)
+		h.hosts[host] = once
+	}
+	h.mu.Unlock()
+	once.Do(func() { h.knock.Send(ctx, host, probe) })
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseKnock(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    *Knock
+		wantErr bool
+	}{
+		{"7000,8000,9000", &Knock{Ports: []KnockPort{{7000, false}, {8000, false}, {9000, false}}, Delay: defaultKnockDelay}, false},
+		{"7000, 8000/udp,9000/tcp:delay=200ms", &Knock{Ports: []KnockPort{{7000, false}, {8000, true}, {9000, false}}, Delay: 200 * time.Millisecond}, false},
+		{"7000:delay=0s", &Knock{Ports: []KnockPort{{7000, false}}, Delay: 0}, false},
+		{"", nil, true},
+		{"7000,70000", nil, true},
+		{"7000/sctp", nil, true},
+		{"7000:delay=soon", nil, true},
+		{"7000:wait=1s", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseKnock(tt.spec)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseKnock(%q) = %+v, %v, expected %+v", tt.spec, got, err, tt.want)
+		}
+	}
+	if k, _ := ParseKnock("7000,8000/udp:delay=200ms"); k.String() != "7000,8000/udp:delay=200ms" {
+		t.Errorf("String() = %q", k.String())
+	}
+}
+
+func TestKnockOpensPort(t *testing.T) {
+	// A knock daemon watching two TCP ports and a UDP one, which opens the
+	// guarded port once they were knocked on in order
+	knocks := make(chan int, 3)
+	var seq []KnockPort
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		port := ln.Addr().(*net.TCPAddr).Port
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+				knocks <- port
+			}
+		}()
+		seq = append(seq, KnockPort{Port: port})
+	}
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	udpPort := udp.LocalAddr().(*net.UDPAddr).Port
+	go func() {
+		buf := make([]byte, 16)
+		if _, _, err := udp.ReadFrom(buf); err == nil {
+			knocks <- udpPort
+		}
+	}()
+	seq = append(seq, KnockPort{Port: udpPort, UDP: true})
+
+	guarded, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardedPort := guarded.Addr().(*net.TCPAddr).Port
+	guarded.Close()
+	opened := make(chan net.Listener, 1)
+	go func() {
+		for i, want := range seq {
+			if got := <-knocks; got != want.Port {
+				t.Errorf("knock %d on %d, expected %d", i+1, got, want.Port)
+				close(opened)
+				return
+			}
+		}
+		ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(guardedPort))
+		if err != nil {
+			t.Error(err)
+		}
+		opened <- ln
+	}()
+
+	var got []Result
+	opts := ScanOptions{Workers: 2, Probe: quickProbe, Knock: &Knock{Ports: seq, Delay: 100 * time.Millisecond}}
+	RunScan(context.Background(), []string{"127.0.0.1"}, []int{guardedPort}, opts, &Stats{startTime: time.Now()}, func(r Result) {
+		got = append(got, r)
+	})
+	if ln, ok := <-opened; ok && ln != nil {
+		ln.Close()
+	}
+	if len(got) != 1 || got[0].Port != guardedPort {
+		t.Errorf("RunScan() = %+v, expected the guarded port open after the knocks", got)
+	}
+}
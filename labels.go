@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// hostLabels holds the labels given to targets in the -hf and -cf files,
+// by host, as filled in by CollectHosts
+var hostLabels map[string]map[string]string
+
+// parseTargetLine splits a line of a targets file into the target and the
+// key=value labels that may follow it, as in "10.0.0.5 env=prod team=payments"
+func parseTargetLine(line string) (string, map[string]string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("empty target")
+	}
+	var labels map[string]string
+	for _, f := range fields[1:] {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || key == "" {
+			return "", nil, fmt.Errorf("label %q of %s is not key=value", f, fields[0])
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = value
+	}
+	return fields[0], labels, nil
+}
+
+// addLabels merges labels into those of host; later values win
+func addLabels(all map[string]map[string]string, host string, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	if all[host] == nil {
+		all[host] = make(map[string]string, len(labels))
+	}
+	for k, v := range labels {
+		all[host][k] = v
+	}
+}
+
+// formatLabels renders labels as "key=value,key=value" sorted by key, for
+// formats without a place for structured data
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + labels[k]
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseTargetLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		target  string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{name: "Plain", line: "10.0.0.5", target: "10.0.0.5"},
+		{name: "Labels", line: "10.0.0.5 env=prod  team=payments", target: "10.0.0.5",
+			labels: map[string]string{"env": "prod", "team": "payments"}},
+		{name: "Empty value", line: "db.example.com owner=", target: "db.example.com", labels: map[string]string{"owner": ""}},
+		{name: "Value with =", line: "10.0.0.0/24 note=a=b", target: "10.0.0.0/24", labels: map[string]string{"note": "a=b"}},
+		{name: "Not key=value", line: "10.0.0.5 prod", wantErr: true},
+		{name: "No key", line: "10.0.0.5 =prod", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, labels, err := parseTargetLine(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTargetLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (target != tt.target || !reflect.DeepEqual(labels, tt.labels)) {
+				t.Errorf("parseTargetLine() = %q, %v, expected %q, %v", target, labels, tt.target, tt.labels)
+			}
+		})
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	if got := formatLabels(map[string]string{"team": "payments", "env": "prod"}); got != "env=prod,team=payments" {
+		t.Errorf("formatLabels() = %q", got)
+	}
+}
+
+func TestCollectHostsLabels(t *testing.T) {
+	dir := t.TempDir()
+	hf := filepath.Join(dir, "hosts.txt")
+	cf := filepath.Join(dir, "cidrs.txt")
+	os.WriteFile(hf, []byte("10.0.0.5 env=prod team=payments\n10.0.0.6\n10.0.0.5 team=billing\n"), 0o644)
+	os.WriteFile(cf, []byte("10.1.0.0/30 env=staging\n"), 0o644)
+
+	saved := [...]string{host, hostsFile, cidrFile}
+	defer func() { host, hostsFile, cidrFile = saved[0], saved[1], saved[2] }()
+	host, hostsFile, cidrFile = "", hf, cf
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		t.Fatalf("CollectHosts() error = %v", err)
+	}
+	if expected := []string{"10.0.0.5", "10.0.0.6", "10.0.0.5", "10.1.0.1", "10.1.0.2"}; !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("CollectHosts() = %v, expected %v", hosts, expected)
+	}
+	expected := map[string]map[string]string{
+		"10.0.0.5": {"env": "prod", "team": "billing"},
+		"10.1.0.1": {"env": "staging"},
+		"10.1.0.2": {"env": "staging"},
+	}
+	if !reflect.DeepEqual(hostLabels, expected) {
+		t.Errorf("hostLabels = %v, expected %v", hostLabels, expected)
+	}
+
+	os.WriteFile(hf, []byte("10.0.0.5 prod\n10.0.0.6\n"), 0o644)
+	cidrFile = ""
+	hosts, err = CollectHosts()
+	if err != nil || !reflect.DeepEqual(hosts, []string{"10.0.0.6"}) || len(skippedLines) != 1 {
+		t.Errorf("CollectHosts() = %v, %v with skipped %v; expected the line with a label that is not key=value skipped", hosts, err, skippedLines)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Operational logging of the scanner itself, as opposed to its results
+var (
+	logLevel string
+	logJSON  bool
+)
+
+// addLogFlags registers -log-level and -log-json
+func addLogFlags(fs *flag.FlagSet) {
+	fs.StringVar(&logLevel, "log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	fs.BoolVar(&logJSON, "log-json", false, "Write log messages as JSON lines")
+}
+
+// setupLogging points the default slog logger at w with the given minimum
+// level, as text or as JSON lines
+func setupLogging(w io.Writer, level string, asJSON bool) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if asJSON {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	tests := []struct {
+		level   string
+		json    bool
+		want    []string // messages expected in the output
+		wantErr bool
+	}{
+		{level: "info", want: []string{"info", "warn", "error"}},
+		{level: "debug", want: []string{"debug", "info", "warn", "error"}},
+		{level: "WARN", want: []string{"warn", "error"}},
+		{level: "error", json: true, want: []string{"error"}},
+		{level: "loud", wantErr: true},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		err := setupLogging(&out, tt.level, tt.json)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setupLogging(%q) error = %v, wantErr %v", tt.level, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		slog.Debug("debug")
+		slog.Info("info")
+		slog.Warn("warn")
+		slog.Error("error", "err", "boom")
+
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if tt.json {
+				var rec map[string]any
+				if err := json.Unmarshal([]byte(line), &rec); err != nil {
+					t.Fatalf("level %s: log line %q is not JSON: %v", tt.level, line, err)
+				}
+				got = append(got, rec["msg"].(string))
+				continue
+			}
+			_, msg, _ := strings.Cut(line, "msg=")
+			msg, _, _ = strings.Cut(msg, " ")
+			got = append(got, msg)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("level %s: logged %v, want %v", tt.level, got, tt.want)
+		}
+	}
+}
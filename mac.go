@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed mac-vendors.txt
+var bundledVendors []byte
+
+// ouiFile is the -oui-file flag
+var ouiFile string
+
+// neighborRefresh is how old the copy of the neighbor table may be before a
+// host missing from it has the table read again
+const neighborRefresh = time.Second
+
+// MACResolver is an enricher that looks up the hardware address of hosts on
+// the local network in the operating system's neighbor (ARP) table, where
+// the ARP replies to the probes left it, and the vendor of its prefix. It
+// sends nothing itself. Routed hosts are not in the table; IPv6 neighbors
+// are not read.
+type MACResolver struct {
+	Vendors map[string]string // vendor of each prefix, e.g. "B827EB"
+
+	mu    sync.Mutex
+	table map[string]string // hardware address of each IP address
+	read  time.Time
+}
+
+// NewMACResolver returns a resolver naming vendors from the OUI list in
+// filename, or the bundled one
+func NewMACResolver(filename string) (*MACResolver, error) {
+	data := bundledVendors
+	if filename != "" {
+		var err error
+		if data, err = os.ReadFile(filename); err != nil {
+			return nil, err
+		}
+	}
+	vendors := ParseVendors(data)
+	if len(vendors) == 0 {
+		return nil, fmt.Errorf("%s: no OUI prefixes found; expected the IEEE oui.txt or Wireshark's manuf", filename)
+	}
+	return &MACResolver{Vendors: vendors}, nil
+}
+
+// Enrich records the hardware address of a host on the local network and
+// the vendor it was assigned to
+func (m *MACResolver) Enrich(r *Result, probe ProbeConfig) {
+	if r.MAC != "" || r.IP == "" {
+		return
+	}
+	if r.MAC = m.lookup(r.IP); r.MAC != "" {
+		r.MACVendor = macVendor(m.Vendors, r.MAC)
+	}
+}
+
+// lookup finds an address in the neighbor table, reading it again when it
+// has had time to change
+func (m *MACResolver) lookup(ip string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mac, ok := m.table[ip]; ok || time.Since(m.read) < neighborRefresh {
+		return mac
+	}
+	table, err := readNeighbors()
+	if err != nil {
+		return ""
+	}
+	m.table, m.read = table, time.Now()
+	return m.table[ip]
+}
+
+// neighborLine matches an IPv4 address and a hardware address on one line
+// of /proc/net/arp or the output of arp -a, whose octets may be written
+// without leading zeros and with dashes on Windows
+var neighborLine = regexp.MustCompile(`\b(\d+\.\d+\.\d+\.\d+)\b.*?\b((?:[0-9A-Fa-f]{1,2}[:-]){5}[0-9A-Fa-f]{1,2})\b`)
+
+// parseNeighbors reads the hardware address of each IP address in a
+// neighbor table listing, leaving out incomplete and broadcast entries
+func parseNeighbors(listing []byte) map[string]string {
+	table := make(map[string]string)
+	lines := bufio.NewScanner(bytes.NewReader(listing))
+	for lines.Scan() {
+		m := neighborLine.FindStringSubmatch(lines.Text())
+		if m == nil {
+			continue
+		}
+		mac, err := net.ParseMAC(padMAC(m[2]))
+		if err != nil || bytes.Equal(mac, make([]byte, 6)) || bytes.Equal(mac, bytes.Repeat([]byte{0xff}, 6)) {
+			continue
+		}
+		table[m[1]] = mac.String()
+	}
+	return table
+}
+
+// padMAC writes each octet of a hardware address with two digits and colons,
+// as net.ParseMAC needs: macOS prints 0:1b:21:a:b:c
+func padMAC(s string) string {
+	octets := strings.FieldsFunc(s, func(c rune) bool { return c == ':' || c == '-' })
+	for i, o := range octets {
+		if len(o) == 1 {
+			octets[i] = "0" + o
+		}
+	}
+	return strings.Join(octets, ":")
+}
+
+// ParseVendors reads an OUI list: the IEEE's oui.txt, whose "(hex)" lines
+// name the vendor of each prefix, or Wireshark's manuf, whose lines give a
+// prefix, a short name and optionally the full one. Prefixes of other
+// lengths than 24 bits are left out.
+func ParseVendors(data []byte) map[string]string {
+	vendors := make(map[string]string)
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var prefix, vendor string
+		if before, after, ok := strings.Cut(line, "(hex)"); ok {
+			prefix, vendor = strings.TrimSpace(before), strings.TrimSpace(after)
+		} else {
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				continue
+			}
+			prefix, vendor = fields[0], strings.TrimSpace(fields[len(fields)-1])
+		}
+		prefix = strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(prefix))
+		if len(prefix) == 6 && vendor != "" {
+			vendors[prefix] = vendor
+		}
+	}
+	return vendors
+}
+
+// macVendor names the vendor of a hardware address. Addresses with the
+// locally administered bit set, such as the random ones of phones, are not
+// assigned to a vendor and are said to be so, unless listed like QEMU's.
+func macVendor(vendors map[string]string, mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return ""
+	}
+	if vendor, ok := vendors[fmt.Sprintf("%02X%02X%02X", hw[0], hw[1], hw[2])]; ok {
+		return vendor
+	}
+	if hw[0]&0x02 != 0 {
+		return "locally administered"
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+package main
+
+import "os"
+
+// readNeighbors reads the kernel's ARP table
+func readNeighbors() (map[string]string, error) {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbors(data), nil
+}
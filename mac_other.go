@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// readNeighbors lists the ARP table with the arp command
+func readNeighbors() (map[string]string, error) {
+	args := []string{"-an"}
+	if runtime.GOOS == "windows" {
+		args = []string{"-a"}
+	}
+	out, err := exec.Command("arp", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbors(out), nil
+}
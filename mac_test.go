@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseNeighbors(t *testing.T) {
+	tests := []struct {
+		name    string
+		listing string
+		want    map[string]string
+	}{
+		{
+			name: "Linux /proc/net/arp",
+			listing: "IP address       HW type     Flags       HW address            Mask     Device\n" +
+				"192.168.1.1      0x1         0x2         00:0c:42:aa:bb:cc     *        eth0\n" +
+				"192.168.1.23     0x1         0x2         B8:27:EB:12:34:56     *        eth0\n" +
+				"192.168.1.99     0x1         0x0         00:00:00:00:00:00     *        eth0\n",
+			want: map[string]string{"192.168.1.1": "00:0c:42:aa:bb:cc", "192.168.1.23": "b8:27:eb:12:34:56"},
+		},
+		{
+			name: "macOS arp -an",
+			listing: "? (10.0.0.1) at 0:1b:21:a:b:c on en0 ifscope [ethernet]\n" +
+				"? (10.0.0.7) at (incomplete) on en0 ifscope [ethernet]\n" +
+				"? (10.0.0.255) at ff:ff:ff:ff:ff:ff on en0 ifscope [ethernet]\n",
+			want: map[string]string{"10.0.0.1": "00:1b:21:0a:0b:0c"},
+		},
+		{
+			name: "Windows arp -a",
+			listing: "Interface: 10.0.0.5 --- 0x4\n" +
+				"  Internet Address      Physical Address      Type\n" +
+				"  10.0.0.1              00-50-56-c0-00-08     dynamic\n",
+			want: map[string]string{"10.0.0.1": "00:50:56:c0:00:08"},
+		},
+	}
+	for _, tt := range tests {
+		if got := parseNeighbors([]byte(tt.listing)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseNeighbors() = %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseVendors(t *testing.T) {
+	list := "# comment\n" +
+		"00-00-0C   (hex)\t\tCisco Systems, Inc\n" +
+		"00000C     (base 16)\t\tCisco Systems, Inc\n" +
+		"B8:27:EB\tRaspberr\tRaspberry Pi Foundation\n" +
+		"08:00:27\tVirtualBox\n" +
+		"00:1B:C5:00:00:00/36\tConverge\tConverging Systems Inc.\n"
+	want := map[string]string{"00000C": "Cisco Systems, Inc", "B827EB": "Raspberry Pi Foundation", "080027": "VirtualBox"}
+	if got := ParseVendors([]byte(list)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseVendors() = %v, expected %v", got, want)
+	}
+	if vendors := ParseVendors(bundledVendors); len(vendors) < 100 {
+		t.Errorf("ParseVendors() found %d bundled vendors", len(vendors))
+	}
+}
+
+func TestMACVendor(t *testing.T) {
+	vendors := map[string]string{"B827EB": "Raspberry Pi", "525400": "QEMU/KVM"}
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{"b8:27:eb:12:34:56", "Raspberry Pi"},
+		{"52:54:00:12:34:56", "QEMU/KVM"},
+		{"da:a1:19:12:34:56", "locally administered"},
+		{"00:11:22:33:44:55", ""},
+	}
+	for _, tt := range tests {
+		if got := macVendor(vendors, tt.mac); got != tt.want {
+			t.Errorf("macVendor(%q) = %q, expected %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func TestMACResolver(t *testing.T) {
+	m := &MACResolver{Vendors: map[string]string{"B827EB": "Raspberry Pi"}}
+	m.table = map[string]string{"192.168.1.23": "b8:27:eb:12:34:56"}
+	m.read = time.Now()
+	r := Result{IP: "192.168.1.23", Port: 22}
+	m.Enrich(&r, ProbeConfig{})
+	if r.MAC != "b8:27:eb:12:34:56" || r.MACVendor != "Raspberry Pi" {
+		t.Errorf("Enrich() = %q %q, expected the Raspberry Pi", r.MAC, r.MACVendor)
+	}
+	r = Result{IP: "203.0.113.9", Port: 22}
+	m.Enrich(&r, ProbeConfig{})
+	if r.MAC != "" || r.MACVendor != "" {
+		t.Errorf("Enrich() = %q %q for a host not in the table", r.MAC, r.MACVendor)
+	}
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
-	"bufio"
+	"cmp"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"math/rand/v2"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -19,69 +30,329 @@ var (
 	cidrFile    string
 	ports       string
 	outputFile  string
+	resumeFile  string
+	configFile  string
+	profile     string
+	format      string
+	stateSpec   string
+	metricsAddr string
+	otlpAddr    string
+	historyFile string
+	geoipFiles  string
+	enrich      string
+	pcapFile    string
+	targetsOnly bool
+	noColor     bool
+	showVersion bool
+	assumeYes   bool
+	confirmOver int = 10_000_000
+	quiet       bool
+	verbose     bool
+	veryVerbose bool
+	fromDocker  bool
+	awsProfile  string
+	awsRegion   string
+	gcpProject  string
+	azureSub    string
+	cloudIPs    string
+	kubernetes  bool
+	kubeconfig  string
+	kubeContext string
+	consulAddr  string
 	concurrency int = 100
-	retries     int = 5
-	timeout     int = 500
-	sleep       int = 100
 )
 
 func init() {
-	flag.StringVar(&host, "h", "", "Single host to scan")
-	flag.StringVar(&hostsFile, "hf", "", "File containing list of hosts (one per line)")
-	flag.StringVar(&cidrFile, "cf", "", "File containing list of CIDR ranges (one per line)")
-	flag.StringVar(&ports, "p", "", "Ports to scan (e.g., 80, 80-443, 80,443,8080)")
+	flag.StringVar(&configFile, "config", "", "YAML or TOML file setting any of these options; flags override it")
+	flag.StringVar(&profile, "profile", "", "Named profile from the config file to apply")
+	addTargetFlags(flag.CommandLine)
+	flag.BoolVar(&fromDocker, "docker", false, "Scan the addresses of running Docker containers")
+	flag.StringVar(&awsProfile, "aws-profile", "", "Scan running EC2 instances of this AWS CLI profile")
+	flag.StringVar(&awsRegion, "aws-region", "", "AWS region for -aws-profile (default from the profile)")
+	flag.StringVar(&gcpProject, "gcp-project", "", "Scan running Compute Engine instances of this GCP project")
+	flag.StringVar(&azureSub, "azure-subscription", "", "Scan virtual machines of this Azure subscription")
+	flag.StringVar(&cloudIPs, "cloud-ips", "all", "Cloud instance addresses to scan: public, private or all")
+	flag.BoolVar(&kubernetes, "k8s", false, "Scan Kubernetes services and endpoints on their own ports (uses kubectl)")
+	flag.StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig file for -k8s (default from kubectl)")
+	flag.StringVar(&kubeContext, "kube-context", "", "kubeconfig context for -k8s")
+	flag.StringVar(&consulAddr, "consul", "", "Scan the services in a Consul catalog on their own ports (e.g., 127.0.0.1:8500)")
+	flag.StringVar(&sweepPorts, "sweep", "", "First sweep every host on these ports, then scan only the hosts that answered with -p")
+	flag.StringVar(&rescanFile, "rescan-open", "", "Scan only the TCP ports found open in this results file, to check that they still are")
+	flag.IntVar(&rescanTop, "rescan-top", 0, "With -rescan-open, also scan this many of the most often open ports of each address in it")
 	flag.StringVar(&outputFile, "o", "", "Output file to save results")
-	flag.IntVar(&concurrency, "c", 100, "Number of concurrent workers")
-	flag.IntVar(&retries, "r", 5, "Number of retries for each port")
-	flag.IntVar(&timeout, "t", 500, "Connection timeout in milliseconds")
-	flag.IntVar(&sleep, "s", 100, "Sleep time between retries in milliseconds")
+	flag.StringVar(&format, "format", "text", "Result format for stdout and -o: text, cef or leef")
+	flag.StringVar(&stateSpec, "state", "open", "Port states to report, comma-separated: open, closed, filtered or all")
+	flag.StringVar(&matchPorts, "match-ports", "", "Only print and write results on these ports (same syntax as -p)")
+	flag.StringVar(&matchService, "match-service", "", "Only print and write open ports running these services, comma-separated (e.g., ssh,http)")
+	flag.StringVar(&matchBanner, "match-banner", "", "Only print and write open ports whose banner matches this regular expression")
+	addProbeFlags(flag.CommandLine)
+	addLogFlags(flag.CommandLine)
+	flag.BoolVar(&scanNetworkAddrs, "scan-network-addrs", false, "Also scan the network and broadcast addresses of IPv4 ranges from -cf")
+	flag.StringVar(&linkZone, "zone", "", "Network `interface` to reach IPv6 link-local targets given without a zone (fe80::1 instead of fe80::1%eth0)")
+	flag.BoolVar(&dualStack, "dual-stack", false, "Probe names with both IPv4 and IPv6 addresses over each family and report ports open over one only")
+	flag.IntVar(&dnsRetries, "dns-retries", 2, "Retries, with exponential backoff, of a name lookup that fails with a transient error such as SERVFAIL")
+	flag.StringVar(&dnsResolvers, "resolvers", "", "DNS servers to try when the system resolver fails, comma-separated (e.g., 1.1.1.1,9.9.9.9:53)")
+	flag.BoolVar(&scanUnresolved, "scan-unresolved", false, "Scan target names that fail to resolve instead of skipping them")
+	flag.StringVar(&knockSpec, "knock", "", "Knock on these ports of each host, in order, before scanning it (e.g., 7000,8000/udp,9000:delay=200ms)")
+	flag.StringVar(&honeypotMode, "honeypots", "", "Label hosts that look like honeypots or tarpits: label, or skip to also stop probing them")
+	flag.BoolVar(&politeScan, "polite", false, "Scan gently for fragile OT/embedded networks: low rate, one probe per host at a time, jitter and pauses between hosts")
+	flag.BoolVar(&randomize, "randomize", false, "Scan hosts and ports in random order")
+	flag.StringVar(&portOrder, "port-order", "sequential", "Order to probe each host's ports in: sequential, frequency (most often open first), learned (most often open in the host's network in -history) or random")
+	flag.Uint64Var(&seed, "seed", 0, "Seed for all randomization, to repeat a randomized scan exactly (0 picks one and prints it)")
+	flag.StringVar(&resumeFile, "resume-file", defaultResumeFile, "Where an interrupted scan saves its progress for 'pscanner resume'")
+	flag.StringVar(&metricsAddr, "metrics", "", "Expose Prometheus metrics on address (e.g., :9090/metrics)")
+	flag.StringVar(&geoipFiles, "geoip", "", "MaxMind DB files for country/ASN lookups, comma-separated")
+	flag.StringVar(&enrich, "enrich", "", "Extra lookups for open ports, comma-separated (rdap, banner, ftp-anon, smtp, smtp-relay, db, cache, smb, rdp, tls, jarm, favicon, websocket, mac, dns, shodan, censys)")
+	flag.StringVar(&udpServices, "udp", "", "Also look for these services over UDP on every host, comma-separated (dns, ntp, quic, snmp, or any in the payload library)")
+	flag.BoolVar(&tlsAudit, "tls-audit", false, "Enumerate the TLS versions and cipher suites of TLS ports, flagging deprecated ones")
+	flag.BoolVar(&hintsEnabled, "hints", false, "Add unverified hints of known vulnerabilities matching the software found")
+	flag.StringVar(&ouiFile, "oui-file", "", "MAC address vendor list for -enrich mac instead of the bundled one: the IEEE oui.txt or Wireshark's manuf")
+	flag.StringVar(&hintsFile, "hints-file", "", "Vulnerability hint rules to use instead of the bundled ones")
+	flag.BoolVar(&dnsVersion, "dns-version", false, "Also ask DNS servers found by -enrich dns or -udp dns for their software version (version.bind)")
+	flag.StringVar(&udpPayloadsFile, "udp-payloads", "", "JSON file of UDP payloads adding services to -udp or replacing those of the same name")
+	flag.StringVar(&snmpCommunities, "snmp-community", "public", "SNMP community strings tried by -udp snmp, comma-separated")
+	flag.StringVar(&screenshotDir, "screenshots", "", "Save screenshots of the web services found to this directory, with an index.html (needs Chrome or Chromium)")
+	flag.StringVar(&pcapFile, "pcap", "", "Capture the scan's packets to a pcap file (Linux, requires root)")
+	flag.BoolVar(&uptimeEnabled, "uptime", false, "Estimate each host's uptime and clock skew from the TCP timestamps in the -pcap capture")
+	flag.StringVar(&runAs, "run-as", "", "Switch from root to this `user` once the -pcap capture socket is open (default: the user who ran sudo, required as root without sudo; root keeps root)")
+	flag.BoolVar(&targetsOnly, "output-targets", false, "Print only host:port or URLs on stdout, for piping into other tools")
+	flag.BoolVar(&quiet, "q", false, "Quiet: print only results")
+	flag.BoolVar(&verbose, "v", false, "Verbose: report each host's start and finish and closed/filtered counts")
+	flag.BoolVar(&veryVerbose, "vv", false, "Very verbose: -v plus the error behind every port that is not open")
+	flag.BoolVar(&progressJSON, "progress-json", false, "Report progress on stderr as JSON lines every second instead of the human format")
+	flag.BoolVar(&noColor, "no-color", false, "Disable colored output (also set by NO_COLOR)")
+	flag.BoolVar(&showVersion, "version", false, "Print the version and build information and exit")
+	flag.BoolVar(&assumeYes, "yes", false, "Run scans larger than -confirm-over without asking")
+	flag.IntVar(&confirmOver, "confirm-over", 10_000_000, "Ask before scanning more than this many ports in total (0 never asks)")
+	flag.StringVar(&alertOver, "alert-over", "", "Alert and exit with status 4 when a host has more open ports than this, or on limits such as host=5,total=50")
+	flag.StringVar(&alertWebhook, "alert-webhook", "", "URL to POST a JSON alert to when -alert-over is exceeded")
+	flag.StringVar(&alertSlack, "alert-slack", "", "Slack incoming webhook URL to notify when -alert-over is exceeded")
+	flag.StringVar(&policyFile, "policy", "", "Scan policy file constraining the rate, ports, kinds of scanning and hours allowed in each network")
+	flag.StringVar(&auditFile, "audit-log", "", "Append a record of each scan (user, time, arguments, targets, outcome) to this file")
+	flag.BoolVar(&auditChain, "audit-chain", false, "Chain -audit-log entries with hashes so edits and removals can be detected")
+	flag.StringVar(&historyFile, "history", "", "Record the scan in a history database file (see 'pscanner history')")
+	flag.StringVar(&otlpAddr, "otlp", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "Export traces and metrics to an OTLP/HTTP endpoint (e.g., http://localhost:4318)")
+	flag.Usage = func() {
+		writeUsage(flag.CommandLine.Output(), flag.CommandLine)
+	}
+}
+
+// commandHelp describes the subcommands in the order they are listed
+var commandHelp = [][2]string{
+	{"scan", "Scan targets for open ports (the default)"},
+	{"resume", "Continue a scan interrupted with Ctrl+C"},
+	{"estimate", "Predict the time and traffic of a scan"},
+	{"report", "Summarize saved results per host"},
+	{"diff", "Compare two result sets"},
+	{"merge", "Combine results of partial or sharded runs"},
+	{"watch", "Rescan periodically and alert on changes"},
+	{"history", "Query the scan history database"},
+	{"audit", "Verify the hash chain of an audit log"},
+	{"serve", "Run the HTTP API server"},
+	{"controller", "Hand out shards of a scan to agents"},
+	{"agent", "Scan shards handed out by a controller"},
+	{"worker", "Scan batches from a Redis or NATS queue"},
+	{"connect", "Open an interactive connection to a port"},
+	{"check", "Probe one port as a healthcheck or monitoring plugin"},
+	{"completion", "Print a shell completion script"},
+	{"update", "Replace this binary with the latest release"},
+}
+
+// addTargetFlags registers the flags choosing what to scan, shared by the
+// subcommands that take targets
+func addTargetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&host, "h", "", "Single host to scan")
+	fs.StringVar(&hostsFile, "hf", "", "File containing list of hosts (one per line)")
+	fs.StringVar(&cidrFile, "cf", "", "File containing list of CIDR ranges (one per line)")
+	fs.StringVar(&ports, "p", "", "Ports to scan (e.g., 80, 80-443, 80,443,8080, @web for a named list)")
+	fs.StringVar(&portsFiles, "ports-file", "", "Files defining named port lists for -p @name, comma-separated (web.ports defines @web)")
+}
+
+// addProbeFlags registers the flags tuning how ports are probed, shared by
+// the subcommands that scan
+func addProbeFlags(fs *flag.FlagSet) {
+	fs.IntVar(&concurrency, "c", 100, "Number of concurrent workers")
+	defaults := DefaultProbeConfig()
+	fs.IntVar(&probeConfig.Retries, "r", defaults.Retries, "Number of retries for each port")
+	durationVar(fs, &probeConfig.Timeout, "t", defaults.Timeout, "Connection timeout as a `duration` (e.g., 500ms, 2s; plain numbers are milliseconds)")
+	durationVar(fs, &probeConfig.Sleep, "s", defaults.Sleep, "Sleep time between retries as a `duration` (e.g., 100ms; plain numbers are milliseconds)")
+	fs.IntVar(&probeConfig.Reprobe, "reprobe", 0, "Connect to each open port this many more times and report how many attempts it answered, to spot flapping ports")
+	fs.StringVar(&sourceIP, "source-ip", "", "Send probes from this local `address`, on machines with more than one; several, comma-separated, are taken in turn")
+	fs.StringVar(&sourceIface, "iface", "", "Send probes out of this network `interface`, such as eth1 or a VPN's tun0")
+	fs.StringVar(&ftpBounce, "ftp-bounce", "", "Probe ports through this FTP server's PORT command instead of connecting to them: [user[:password]@]host[:port]")
+	fs.BoolVar(&ipv4Only, "4", false, "Resolve and scan IPv4 addresses only")
+	fs.BoolVar(&ipv6Only, "6", false, "Resolve and scan IPv6 addresses only")
+}
+
+// validateProbeFlags rejects -c, -r and -t values that cannot scan anything
+// and returns warnings for combinations likely to report open ports as
+// filtered. Negative durations are already refused when parsing.
+func validateProbeFlags(workers int, probe ProbeConfig) (warnings []string, err error) {
+	switch {
+	case workers < 1:
+		return nil, fmt.Errorf("-c must be at least 1, got %d", workers)
+	case probe.Retries < 1:
+		return nil, fmt.Errorf("-r must be at least 1, got %d; it is the number of connection attempts per port", probe.Retries)
+	case probe.Timeout <= 0:
+		return nil, fmt.Errorf("-t must be greater than 0")
+	case probe.Reprobe < 0:
+		return nil, fmt.Errorf("-reprobe must not be negative, got %d", probe.Reprobe)
+	}
+	if workers >= 1000 && probe.Timeout < 200*time.Millisecond {
+		warnings = append(warnings, fmt.Sprintf("-c %d with -t %v: connections this many at a time are often slower than the timeout, so open ports may be reported as filtered", workers, probe.Timeout))
+	} else if probe.Timeout < 20*time.Millisecond {
+		warnings = append(warnings, fmt.Sprintf("-t %v is shorter than most round trips beyond this machine; open ports may be reported as filtered", probe.Timeout))
+	}
+	return warnings, nil
+}
+
+// checkProbeFlags runs validateProbeFlags for the subcommands other than
+// scan, printing its warnings and reporting whether the flags are usable
+func checkProbeFlags() bool {
+	warnings, err := validateProbeFlags(concurrency, probeConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return false
+	}
+	if err := setupProbe(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return false
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	return true
+}
+
+// durationValue is a flag.Value for durations that also takes a bare number
+// of milliseconds, the unit -t and -s used before they took durations
+type durationValue time.Duration
+
+func (d *durationValue) Set(s string) error {
+	if ms, err := strconv.Atoi(s); err == nil {
+		if ms < 0 {
+			return errors.New("duration must not be negative")
+		}
+		*d = durationValue(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.New("expected a duration such as 500ms or 2s, or milliseconds")
+	}
+	if v < 0 {
+		return errors.New("duration must not be negative")
+	}
+	*d = durationValue(v)
+	return nil
+}
+
+func (d *durationValue) String() string { return time.Duration(*d).String() }
+
+// durationVar defines a duration flag that also accepts milliseconds
+func durationVar(fs *flag.FlagSet, p *time.Duration, name string, value time.Duration, usage string) {
+	*p = value
+	fs.Var((*durationValue)(p), name, usage)
 }
 
-func GetHostIP(host string) (string, error) {
+// GetHostIP returns the first address of host that can be reached on
+// network, such as ProbeConfig.Network; an address target, zone included, is
+// its own
+func GetHostIP(host, network string) (string, error) {
+	if ip := parseHostIP(host); ip != nil {
+		if _, zone := splitZone(host); zone != "" {
+			return ip.String() + "%" + zone, nil
+		}
+	}
 	ips, err := net.LookupIP(host)
-	if err != nil || len(ips) == 0 {
-		return "", fmt.Errorf("unable to resolve host: %s", host)
+	if err == nil {
+		for _, ip := range ips {
+			if inFamily(ip, network) {
+				return ip.String(), nil
+			}
+		}
 	}
-	return ips[0].String(), nil
+	return "", fmt.Errorf("unable to resolve host: %s", host)
 }
 
 // ReadLines reads a file and returns a slice of non-empty lines
 func ReadLines(filename string) ([]string, error) {
-	file, err := os.Open(filename)
+	numbered, err := ReadFileLines(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
 	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			lines = append(lines, line)
-		}
+	for _, line := range numbered {
+		lines = append(lines, line.Text)
 	}
-	return lines, scanner.Err()
+	return lines, nil
 }
 
-// ExpandCIDR takes a CIDR notation and returns all IP addresses in that range
-func ExpandCIDR(cidr string) ([]string, error) {
-	ip, ipnet, err := net.ParseCIDR(cidr)
+// scanNetworkAddrs is the -scan-network-addrs flag
+var scanNetworkAddrs bool
+
+// maxCIDRHosts is the most addresses a range may expand to, an IPv4 /8 or an
+// IPv6 /104; an IPv6 /64 would never finish expanding
+const maxCIDRHosts = 1 << 24
+
+// ExpandCIDR takes a CIDR notation and returns all IP addresses in that range.
+// The network and broadcast addresses of IPv4 ranges of /30 and wider are
+// left out unless networkAddrs is set; /31 point-to-point links, single
+// hosts and IPv6 ranges, which have neither, keep every address. Ranges of
+// more than maxCIDRHosts addresses are refused.
+func ExpandCIDR(cidr string, networkAddrs bool) ([]string, error) {
+	if err := checkCIDRSize(cidr); err != nil {
+		return nil, err
+	}
+	prefix, zone := splitZone(cidr)
+	ip, ipnet, err := net.ParseCIDR(prefix)
 	if err != nil {
 		return nil, err
 	}
+	if zone != "" {
+		if ip.To4() != nil || !ip.IsLinkLocalUnicast() {
+			return nil, fmt.Errorf("a zone only applies to IPv6 link-local ranges")
+		}
+		zone = "%" + zone
+	}
 
 	var ips []string
 	for ip := ip.Mask(ipnet.Mask); ipnet.Contains(ip); inc(ip) {
-		ips = append(ips, ip.String())
+		ips = append(ips, ip.String()+zone)
 	}
-	// Remove network and broadcast addresses for typical use
-	if len(ips) > 2 {
+	if ones, bits := ipnet.Mask.Size(); bits == 32 && ones <= 30 && !networkAddrs {
 		return ips[1 : len(ips)-1], nil
 	}
 	return ips, nil
 }
 
+// CIDRSize returns the number of addresses in a CIDR range, or
+// math.MaxUint64 when it has 2^64 or more
+func CIDRSize(cidr string) (uint64, error) {
+	prefix, _ := splitZone(cidr)
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return 0, err
+	}
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones >= 64 {
+		return math.MaxUint64, nil
+	}
+	return 1 << (bits - ones), nil
+}
+
+// checkCIDRSize refuses a range of more than maxCIDRHosts addresses
+func checkCIDRSize(cidr string) error {
+	size, err := CIDRSize(cidr)
+	if err != nil {
+		return err
+	}
+	if size > maxCIDRHosts {
+		return fmt.Errorf("range too large: at most %d addresses (an IPv4 /8 or IPv6 /104) can be scanned", maxCIDRHosts)
+	}
+	return nil
+}
+
 // inc increments an IP address
 func inc(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
@@ -92,7 +363,8 @@ func inc(ip net.IP) {
 	}
 }
 
-// ParsePorts parses port specification and returns a list of ports
+// ParsePorts parses port specification and returns a list of ports in
+// ascending order
 // Supports:
 // - Single port: "80"
 // - Range: "80-443"
@@ -154,199 +426,1321 @@ func ParsePorts(portSpec string) ([]int, error) {
 	for port := range portSet {
 		ports = append(ports, port)
 	}
+	slices.Sort(ports)
 
 	return ports, nil
 }
 
-// TryConnect attempts to connect to a single port with retries
-func TryConnect(host string, port int, retries int) bool {
-	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+// PortState is the outcome of probing a single port
+type PortState int
 
-	for i := 0; i < retries; i++ {
-		conn, err := net.DialTimeout("tcp", address, time.Duration(timeout)*time.Millisecond)
-		if err == nil {
-			conn.Close()
-			return true
+const (
+	StateOpen PortState = iota
+	StateClosed
+	StateFiltered
+	numPortStates
+)
+
+// ParsePortState parses the name of a port state
+func ParsePortState(name string) (PortState, error) {
+	for s := StateOpen; s < numPortStates; s++ {
+		if s.String() == name {
+			return s, nil
 		}
-		time.Sleep(time.Duration(sleep) * time.Millisecond) // avoid hammering the host
 	}
-	return false
+	return 0, fmt.Errorf("unknown port state %q (use open, closed or filtered)", name)
 }
 
-type ScanJob struct {
-	Host string
-	Port int
+func (s PortState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
 }
 
-type Stats struct {
-	mu        sync.Mutex
-	scanned   int
-	openPorts int
-	startTime time.Time
-	output    io.Writer
+func (s *PortState) UnmarshalText(text []byte) error {
+	state, err := ParsePortState(string(text))
+	if err == nil {
+		*s = state
+	}
+	return err
 }
 
-func (s *Stats) IncrementScanned() {
-	s.mu.Lock()
-	s.scanned++
-	s.mu.Unlock()
+// StateSet is a set of port states
+type StateSet uint8
+
+// Has reports whether s is in the set
+func (set StateSet) Has(s PortState) bool {
+	return set&(1<<s) != 0
 }
 
-func (s *Stats) IncrementOpen() {
-	s.mu.Lock()
-	s.openPorts++
-	s.mu.Unlock()
+// ParseStates parses a comma-separated list of port states, or "all"
+func ParseStates(spec string) (StateSet, error) {
+	var set StateSet
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "all" {
+			return 1<<numPortStates - 1, nil
+		}
+		s, err := ParsePortState(name)
+		if err != nil {
+			return 0, err
+		}
+		set |= 1 << s
+	}
+	return set, nil
 }
 
-func (s *Stats) GetStats() (int, int, time.Duration) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.scanned, s.openPorts, time.Since(s.startTime)
+func (s PortState) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateClosed:
+		return "closed"
+	case StateFiltered:
+		return "filtered"
+	}
+	return "unknown"
 }
 
-func worker(jobs <-chan ScanJob, wg *sync.WaitGroup, stats *Stats) {
-	defer wg.Done()
-	for job := range jobs {
-		if TryConnect(job.Host, job.Port, retries) {
-			ip, err := GetHostIP(job.Host)
-			if err != nil {
-				ip = job.Host
+// classifyDialError maps a failed dial to the port state it implies and a
+// short error kind used for accounting
+func classifyDialError(err error) (PortState, string) {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return StateClosed, "refused"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return StateFiltered, "timeout"
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return StateFiltered, "unreachable"
+	case isResourceExhausted(err):
+		return StateFiltered, "exhausted"
+	}
+	return StateFiltered, "other"
+}
+
+// isResourceExhausted reports whether a dial failed because this machine ran
+// out of file descriptors or socket buffers, which says nothing about the port
+func isResourceExhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+const (
+	exhaustedBackoff = 50 * time.Millisecond // first wait after running out of descriptors
+	exhaustedMaxWait = 2 * time.Second       // longest single wait
+	exhaustedGiveUp  = time.Minute           // total wait after which the probe fails
+)
+
+// dialProbe makes one connection attempt; tests replace it
+var dialProbe = func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	return d.DialContext(ctx, network, address)
+}
+
+// ProbePort attempts to connect to a single port with retries and reports its state
+func ProbePort(host string, port int, probe ProbeConfig) PortState {
+	state, _ := probePort(context.Background(), host, port, probe, probeHooks{})
+	return state
+}
+
+// probeHooks are told about parts of a probe that its outcome doesn't show.
+// Either may be nil.
+type probeHooks struct {
+	Exhausted func()                // an attempt was put off for lack of file descriptors
+	Resolved  func(d time.Duration) // looking up the target name took d
+}
+
+// probePort is ProbePort that also returns the error of the last failed
+// attempt. Cancelling ctx abandons the probe; its state is then meaningless.
+// A target name is looked up within the timeout of the first attempt, so
+// that a slow resolver can't stretch a probe past -t, and failing that of
+// the next. An attempt that fails for lack of file descriptors is not
+// counted: it is repeated after a growing backoff, calling hooks.Exhausted
+// each time, until exhaustedGiveUp has passed.
+func probePort(ctx context.Context, host string, port int, probe ProbeConfig, hooks probeHooks) (PortState, error) {
+	if probe.Bounce != nil {
+		metrics.ProbeStarted()
+		state, err := probe.Bounce.Probe(ctx, host, port, probe)
+		kind := ""
+		if err != nil {
+			_, kind = classifyDialError(err)
+		}
+		metrics.ProbeFinished(kind)
+		return state, err
+	}
+	target := host
+	if parseHostIP(host) != nil {
+		target = ""
+	}
+	var dialer *net.Dialer
+	network := cmp.Or(probe.Network, "tcp")
+
+	state := StateFiltered
+	var lastErr error
+	backoff, waited := exhaustedBackoff, time.Duration(0)
+	for i := 0; i < probe.Retries && ctx.Err() == nil; i++ {
+		metrics.ProbeStarted()
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if probe.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, probe.Timeout)
+		}
+		var conn net.Conn
+		var err error
+		if target != "" {
+			start := time.Now()
+			var ip string
+			if ip, err = resolveForProbe(attemptCtx, target, probe); err == nil {
+				host, target = ip, ""
+			}
+			if hooks.Resolved != nil {
+				hooks.Resolved(time.Since(start))
 			}
-			result := fmt.Sprintf("%s:%d\n", ip, job.Port)
-			fmt.Print(result)
-			if stats.output != nil {
-				stats.output.Write([]byte(result))
+		}
+		if err == nil {
+			if dialer == nil {
+				dialer = probe.Dialer(host, probe.Timeout)
 			}
-			stats.IncrementOpen()
+			conn, err = dialProbe(attemptCtx, dialer, network, net.JoinHostPort(host, strconv.Itoa(port)))
+		}
+		cancel()
+		if err == nil {
+			metrics.ProbeFinished("")
+			conn.Close()
+			return StateOpen, nil
+		}
+		var kind string
+		state, kind = classifyDialError(err)
+		lastErr = err
+		metrics.ProbeFinished(kind)
+		if kind == "exhausted" && waited < exhaustedGiveUp {
+			if hooks.Exhausted != nil {
+				hooks.Exhausted()
+			}
+			sleepContext(ctx, backoff)
+			waited += backoff
+			backoff = min(backoff*2, exhaustedMaxWait)
+			i-- // the attempt never reached the host
+			continue
 		}
-		stats.IncrementScanned()
+		time.Sleep(probe.Sleep) // avoid hammering the host
 	}
+	return state, lastErr
 }
 
-func main() {
-	flag.Parse()
+// resolveForProbe looks up a target name dialed directly in the address
+// family of probe and picks the address to probe: the first, or the first in
+// the family of the source address when one was given
+func resolveForProbe(ctx context.Context, name string, probe ProbeConfig) (string, error) {
+	found, err := resolveName(ctx, name, probe.Network)
+	if err != nil {
+		return "", err
+	}
+	if source := probe.Source; len(source.IPs) > 0 {
+		want4 := source.IPs[0].To4() != nil
+		for _, addr := range found {
+			if ip := net.ParseIP(addr); ip != nil && (ip.To4() != nil) == want4 {
+				return addr, nil
+			}
+		}
+	}
+	return found[0], nil
+}
 
-	// Collect all hosts to scan
+// reprobeOpen connects to a port found open probe.Reprobe more times, one
+// attempt each, and returns how many of all the connections, the first
+// included, it accepted. Attempts cut short by cancelling ctx are not
+// counted.
+func reprobeOpen(ctx context.Context, host string, port int, probe ProbeConfig, hooks probeHooks) (answered, attempts int) {
+	single := probe
+	single.Retries = 1
+	answered, attempts = 1, 1
+	for i := 0; i < probe.Reprobe; i++ {
+		sleepContext(ctx, probe.Sleep)
+		state, _ := probePort(ctx, host, port, single, hooks)
+		if ctx.Err() != nil {
+			break
+		}
+		attempts++
+		if state == StateOpen {
+			answered++
+		}
+	}
+	return answered, attempts
+}
+
+// countFlapping returns how many results are of flapping ports
+func countFlapping(results []Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Flapping() {
+			n++
+		}
+	}
+	return n
+}
+
+// TryConnect attempts to connect to a single port with retries
+func TryConnect(host string, port int, probe ProbeConfig) bool {
+	return ProbePort(host, port, probe) == StateOpen
+}
+
+// CollectHosts gathers the hosts given by -h, -hf, -cf and the Docker and
+// cloud inventory sources. Malformed file lines and CIDR ranges that fail
+// to expand are reported, skipped and kept in skippedLines.
+func CollectHosts() ([]string, error) {
 	var hosts []string
+	skippedLines = nil
 
 	// Add single host if specified
 	if host != "" {
 		hosts = append(hosts, host)
 	}
 
-	// Read hosts from file if specified
+	// Read hosts from file if specified; a host may be followed by labels.
+	// Malformed lines are skipped with a warning rather than failing the scan.
+	hostLabels = make(map[string]map[string]string)
 	if hostsFile != "" {
-		fileHosts, err := ReadLines(hostsFile)
+		lines, err := ReadFileLines(hostsFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading hosts file: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("reading hosts file: %v", err)
+		}
+		for _, line := range lines {
+			h, labels, err := parseTargetLine(line.Text)
+			if err == nil {
+				err = validateHost(h)
+			}
+			if err != nil {
+				skipLine(hostsFile, line, err)
+				continue
+			}
+			hosts = append(hosts, h)
+			addLabels(hostLabels, h, labels)
 		}
-		hosts = append(hosts, fileHosts...)
 	}
 
-	// Read and expand CIDR ranges if specified
+	// Read and expand CIDR ranges if specified, labelling every address
 	if cidrFile != "" {
-		cidrs, err := ReadLines(cidrFile)
+		lines, err := ReadFileLines(cidrFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading CIDR file: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("reading CIDR file: %v", err)
 		}
-		for _, cidr := range cidrs {
-			ips, err := ExpandCIDR(cidr)
+		for _, line := range lines {
+			cidr, labels, err := parseTargetLine(line.Text)
+			if err == nil {
+				err = validateCIDR(cidr)
+			}
+			var ips []string
+			if err == nil {
+				ips, err = ExpandCIDR(cidr, scanNetworkAddrs)
+			}
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error expanding CIDR %s: %v\n", cidr, err)
+				skipLine(cidrFile, line, err)
 				continue
 			}
 			hosts = append(hosts, ips...)
+			for _, ip := range ips {
+				addLabels(hostLabels, ip, labels)
+			}
+		}
+	}
+
+	// Add the addresses of running containers if requested
+	if fromDocker {
+		containers, err := ListDockerContainers(dockerEndpoint())
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range containers {
+			notef("Docker container %s: %s\n", c.Name, strings.Join(c.Addresses, ", "))
+			hosts = append(hosts, c.Addresses...)
+		}
+	}
+
+	// Add cloud instances if requested
+	sources := []struct {
+		name  string
+		used  bool
+		fetch func() ([]string, error)
+	}{
+		{"AWS", awsProfile != "", func() ([]string, error) { return AWSTargets(awsProfile, awsRegion, cloudIPs) }},
+		{"GCP", gcpProject != "", func() ([]string, error) { return GCPTargets(gcpProject, cloudIPs) }},
+		{"Azure", azureSub != "", func() ([]string, error) { return AzureTargets(azureSub, cloudIPs) }},
+	}
+	for _, src := range sources {
+		if !src.used {
+			continue
+		}
+		addrs, err := src.fetch()
+		if err != nil {
+			return nil, fmt.Errorf("listing %s instances: %v", src.name, err)
+		}
+		notef("%s: %d instance address(es)\n", src.name, len(addrs))
+		hosts = append(hosts, addrs...)
+	}
+	return hosts, nil
+}
+
+// DefaultHosts returns the targets scanned when none are given: the IPv4
+// loopback and, where this machine has one, the IPv6 loopback, labelled
+// loopback=ipv4 and loopback=ipv6 so their results can be told apart
+func DefaultHosts() []string {
+	var hosts []string
+	if probeConfig.Network != "tcp6" {
+		hosts = append(hosts, "127.0.0.1")
+		addLabels(hostLabels, "127.0.0.1", map[string]string{"loopback": "ipv4"})
+	}
+	if probeConfig.Network == "tcp6" || probeConfig.Network != "tcp4" && ipv6Available() {
+		hosts = append(hosts, "::1")
+		addLabels(hostLabels, "::1", map[string]string{"loopback": "ipv6"})
+	}
+	return hosts
+}
+
+// ipv6Available reports whether this machine can use the IPv6 loopback
+func ipv6Available() bool {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// CollectEndpoints gathers host/port pairs from service discovery (-k8s and
+// -consul); each is scanned on its own port regardless of -p
+func CollectEndpoints() ([]ScanJob, error) {
+	var endpoints []ScanJob
+	if kubernetes {
+		found, err := KubernetesEndpoints(kubeconfig, kubeContext)
+		if err != nil {
+			return nil, fmt.Errorf("listing Kubernetes services: %v", err)
+		}
+		notef("Kubernetes: %d endpoint(s)\n", len(found))
+		endpoints = append(endpoints, found...)
+	}
+	if consulAddr != "" {
+		found, err := ConsulEndpoints(consulAddr)
+		if err != nil {
+			return nil, fmt.Errorf("reading Consul catalog: %v", err)
+		}
+		notef("Consul: %d endpoint(s)\n", len(found))
+		endpoints = append(endpoints, found...)
+	}
+	return endpoints, nil
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "scan":
+			os.Exit(runScan(os.Args[2:], nil))
+		case "resume":
+			os.Exit(runResume(os.Args[2:]))
+		case "estimate":
+			os.Exit(runEstimate(os.Args[2:]))
+		case "update":
+			os.Exit(runUpdate(os.Args[2:]))
+		case "report":
+			os.Exit(runReport(os.Args[2:]))
+		case "serve":
+			os.Exit(runServe(os.Args[2:]))
+		case "controller":
+			os.Exit(runController(os.Args[2:]))
+		case "agent":
+			os.Exit(runAgent(os.Args[2:]))
+		case "worker":
+			os.Exit(runWorker(os.Args[2:]))
+		case "watch":
+			os.Exit(runWatch(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "merge":
+			os.Exit(runMerge(os.Args[2:]))
+		case "history":
+			os.Exit(runHistory(os.Args[2:]))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:]))
+		case "connect":
+			os.Exit(runConnect(os.Args[2:]))
+		case "check":
+			os.Exit(runCheck(os.Args[2:]))
+		case "completion":
+			os.Exit(runCompletion(os.Args[2:]))
+		}
+	}
+
+	// Flags without a subcommand still mean "scan"
+	os.Exit(runScan(os.Args[1:], nil))
+}
+
+// Exit codes of a scan and of watch -once, for scripts to branch on
+const (
+	exitOpen     = 0 // the scan completed and found open ports
+	exitNoneOpen = 1 // the scan completed and found none
+	exitError    = 2 // usage or other errors before the scan could run
+	exitPartial  = 3 // the scan was interrupted and is incomplete
+	exitAlert    = 4 // the scan found more open ports than -alert-over allows
+	exitChanged  = 5 // watch -once found ports opened or closed since the baseline
+)
+
+// heldResumeFile returns the resume file to open before dropping root, or ""
+// when the scan would only write the default one on an interruption: that
+// file is then created by the new user if it is needed at all, rather than
+// up front by root on every scan
+func heldResumeFile(fs *flag.FlagSet) string {
+	name := ""
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "resume-file" {
+			name = f.Value.String()
+		}
+	})
+	return name
+}
+
+// runScan scans the targets given by command-line flags, the environment
+// and the config file. A non-nil resume state continues an interrupted scan.
+func runScan(args []string, resume *ResumeState) (code int) {
+	flag.CommandLine.Parse(args)
+	if showVersion {
+		WriteVersion(os.Stdout, currentBuild())
+		return 0
+	}
+
+	if err := loadSettings(flag.CommandLine); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+
+	setupColor(noColor)
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	warnings, err := validateProbeFlags(concurrency, probeConfig)
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	if err := setupProbe(); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	if dualStack && probeConfig.Network != "tcp" {
+		errorf("Error -dual-stack can't be used with -4 or -6\n")
+		return exitError
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	// The files written at the end of a scan that drops root privileges,
+	// closed after the audit entry is written
+	var held *HeldFiles
+	defer func() { held.Close() }()
+
+	// Every run that gets this far is audited, including those that fail
+	audit := newAuditEntry(args)
+	if auditFile != "" {
+		defer func() {
+			audit.End, audit.Exit = time.Now().UTC(), code
+			if err := held.AppendAudit(auditFile, audit, auditChain); err != nil {
+				errorf("Error writing audit log: %v\n", err)
+			}
+		}()
+	}
+
+	if metricsAddr != "" {
+		if err := StartMetricsServer(metricsAddr); err != nil {
+			errorf("Error starting metrics server: %v\n", err)
+			return exitError
+		}
+	}
+
+	if err := enableGeoIP(geoipFiles); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	if err := enableEnrichers(enrich, probeConfig.Timeout); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	filter, err := NewResultFilter(matchPorts, matchService, matchBanner)
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	if filter.NeedsBanner() && !strings.Contains(enrich, "banner") {
+		enrichers = append(enrichers, BannerGrabber{Timeout: probeConfig.Timeout})
+	}
+	if tlsAudit {
+		enrichers = append(enrichers, TLSAuditor{Timeout: probeConfig.Timeout})
+	}
+	if targetsOnly {
+		enrichers = append(enrichers, HTTPDetector{Timeout: probeConfig.Timeout})
+	}
+	if hintsEnabled || hintsFile != "" {
+		if hintRules, err = LoadHints(hintsFile); err != nil {
+			errorf("Error loading hints: %v\n", err)
+			return exitError
+		}
+	}
+	if udpPayloadsFile != "" {
+		if err := LoadUDPPayloads(udpPayloadsFile); err != nil {
+			errorf("Error loading UDP payloads: %v\n", err)
+			return exitError
+		}
+	}
+	udpList, err := ParseUDPServices(udpServices)
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	var knock *Knock
+	if knockSpec != "" {
+		if knock, err = ParseKnock(knockSpec); err != nil {
+			errorf("Error %v\n", err)
+			return exitError
+		}
+	}
+	honeypots, err := NewHoneypotDetector(honeypotMode)
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	var threshold *AlertThreshold
+	if alertOver != "" {
+		if threshold, err = ParseAlertOver(alertOver); err != nil {
+			errorf("Error %v\n", err)
+			return exitError
+		}
+	} else if alertWebhook != "" || alertSlack != "" {
+		errorf("Error: -alert-webhook and -alert-slack need -alert-over\n")
+		return exitError
+	}
+	var policy *Policy
+	if policyFile != "" {
+		if policy, err = LoadPolicy(policyFile); err != nil {
+			errorf("Error reading scan policy: %v\n", err)
+			return exitError
+		}
+		policy.Network = probeConfig.Network
+	}
+	var browser string
+	var createdScreenshotDir bool
+	if screenshotDir != "" {
+		if browser, err = FindBrowser(); err != nil {
+			errorf("Error %v\n", err)
+			return exitError
+		}
+		_, err := os.Stat(screenshotDir)
+		createdScreenshotDir = errors.Is(err, os.ErrNotExist)
+		if err := os.MkdirAll(screenshotDir, 0o755); err != nil {
+			errorf("Error %v\n", err)
+			return exitError
+		}
+	}
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+
+	endpoints, err := CollectEndpoints()
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	var rescanNames map[string]string
+	if rescanFile != "" {
+		var found []ScanJob
+		if found, rescanNames, err = RescanJobs(rescanFile, rescanTop); err != nil {
+			errorf("Error %v\n", err)
+			return exitError
 		}
+		if len(found) == 0 {
+			errorf("Error: %s lists no open TCP ports to rescan\n", rescanFile)
+			return exitError
+		}
+		notef("Rescanning %d port(s) found open in %s\n", len(found), rescanFile)
+		endpoints = append(endpoints, found...)
+	} else if rescanTop != 0 {
+		errorf("Error: -rescan-top needs -rescan-open\n")
+		return exitError
 	}
 
-	// Default to localhost if no hosts specified
-	if len(hosts) == 0 {
-		hosts = []string{"127.0.0.1"}
+	// Default to localhost if no targets specified; targets that were given
+	// but all failed to expand are an error, not a request to scan localhost
+	if len(hosts) == 0 && len(endpoints) == 0 {
+		if len(skippedLines) > 0 {
+			errorf("Error: none of the lines in the target files are valid\n")
+			return exitError
+		}
+		hosts = DefaultHosts()
+	}
+
+	formatResult, err := NewFormatter(format)
+	if err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	states, err := ParseStates(stateSpec)
+	if err != nil {
+		errorf("Error parsing -state: %v\n", err)
+		return exitError
 	}
 
 	// Parse ports
-	var portList []int
-	if ports != "" {
-		var err error
-		portList, err = ParsePorts(ports)
+	if err := resolvePorts(); err != nil {
+		errorf("Error %v\n", err)
+		return exitError
+	}
+	portList, err := PortsOrDefault(ports)
+	if err != nil {
+		errorf("Error parsing ports: %v\n", err)
+		return exitError
+	}
+	if !slices.Contains(portOrders, portOrder) {
+		errorf("Error unknown -port-order %q (use sequential, frequency, learned or random)\n", portOrder)
+		return exitError
+	}
+	if randomize && (portOrder == "frequency" || portOrder == "learned") {
+		errorf("Error -randomize shuffles the ports, so it cannot be combined with -port-order %s\n", portOrder)
+		return exitError
+	}
+	var learned *LearnedOrder
+	if portOrder == "learned" {
+		if historyFile == "" {
+			errorf("Error -port-order learned learns from the scans recorded with -history, which is missing\n")
+			return exitError
+		}
+		records, err := LoadHistory(historyFile)
+		if err != nil && !os.IsNotExist(err) {
+			errorf("Error %v\n", err)
+			return exitError
+		}
+		if len(records) == 0 {
+			notef("No scans recorded in %s yet; ordering ports by frequency\n", historyFile)
+		}
+		learned = LearnPortOrder(records)
+	}
+
+	// With -output-targets or an event format stdout carries nothing but
+	// results, so it can be piped straight into another tool or a SIEM
+	infoFile := os.Stdout
+	infoColor, resultColor := colorStdout, colorStdout
+	if targetsOnly || format == "cef" || format == "leef" {
+		infoFile, infoColor = os.Stderr, colorStderr
+		// Events are machine-read even on a terminal
+		resultColor = colorStdout && targetsOnly
+	}
+	var info io.Writer = infoFile
+	verbosity := verbosityLevel(quiet, verbose, veryVerbose)
+	if verbosity == Quiet {
+		info = io.Discard
+	}
+	// Keypresses can change the verbosity while the scan runs
+	var level atomic.Int32
+	level.Store(int32(verbosity))
+
+	// Names that don't resolve would only produce probes that all fail, and
+	// targets sharing an address would have it probed twice
+	fallbacks, err := ParseResolvers(dnsResolvers)
+	if err != nil {
+		errorf("Error in -resolvers: %v\n", err)
+		return exitError
+	}
+	fallbackLookups = fallbacks
+
+	// IPv6 link-local addresses can only be dialed on a given interface
+	if linkZone != "" {
+		if err := checkZone(linkZone); err != nil {
+			errorf("Error in -zone: %v\n", err)
+			return exitError
+		}
+	}
+	var unzoned []SkippedTarget
+	hosts, unzoned = ApplyZone(hosts, linkZone)
+	if len(unzoned) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %d link-local target(s) without a usable zone\n", len(unzoned))
+		WriteSkipped(os.Stderr, "Link-Local Targets", unzoned)
+		if len(hosts) == 0 && len(endpoints) == 0 {
+			errorf("Error: no targets left to scan\n")
+			return exitError
+		}
+	}
+	if probeConfig.Network != "tcp" {
+		var other []SkippedTarget
+		hosts, other = splitFamily(hosts, probeConfig.Network)
+		endpoints = slices.DeleteFunc(endpoints, func(job ScanJob) bool {
+			ip := parseHostIP(job.Host)
+			if ip != nil && !inFamily(ip, probeConfig.Network) {
+				other = append(other, SkippedTarget{Target: job.Host, Err: fmt.Errorf("not an %s address", familyName(probeConfig.Network))})
+				return true
+			}
+			return false
+		})
+		if len(other) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %d target(s) that are not %s addresses\n", len(other), familyName(probeConfig.Network))
+			if len(hosts) == 0 && len(endpoints) == 0 {
+				errorf("Error: none of the targets are %s addresses\n", familyName(probeConfig.Network))
+				return exitError
+			}
+		}
+	}
+	var addrNames map[string]string
+	if dualStack {
+		hosts, addrNames = ExpandDualStack(context.Background(), hosts, concurrency)
+		if n := len(addrNames) / 2; n > 0 {
+			fmt.Fprintf(info, "Probing %d dual-stack name(s) over IPv4 and IPv6\n", n)
+		}
+	}
+	hosts, aliases, unresolved := ResolveHosts(context.Background(), hosts, concurrency, probeConfig.Network, scanUnresolved)
+	for kept, names := range aliases {
+		for _, name := range names {
+			addLabels(hostLabels, kept, hostLabels[name])
+		}
+	}
+	if len(unresolved) > 0 && !scanUnresolved {
+		fmt.Fprintf(os.Stderr, "Warning: skipping %d host(s) that could not be resolved (-scan-unresolved scans them anyway)\n", len(unresolved))
+		if len(hosts) == 0 && len(endpoints) == 0 {
+			errorf("Error: none of the targets could be resolved\n")
+			WriteSkipped(os.Stderr, "Unresolvable Hosts", unresolved)
+			return exitError
+		}
+	}
+
+	// -sweep narrows the hosts down to those that answer on a few ports
+	// before the deep scan; discovered endpoints have ports of their own
+	if sweepPorts != "" && len(hosts) > 0 {
+		sweepList, err := ParsePorts(sweepPorts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error parsing ports: %v\n", err)
-			os.Exit(1)
+			errorf("Error parsing -sweep ports: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(info, "Sweeping %d host(s) on %d port(s)...\n", len(hosts), len(sweepList))
+		sweepOpts := ScanOptions{Workers: concurrency, Probe: probeConfig, Labels: hostLabels, Policy: policy}
+		if politeScan {
+			makePolite(&sweepOpts)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		up := Sweep(ctx, hosts, sweepList, sweepOpts)
+		interrupted := ctx.Err() != nil
+		stop()
+		if interrupted {
+			errorf("Sweep interrupted; nothing was scanned in depth\n")
+			return exitPartial
+		}
+		fmt.Fprintf(info, "%d of %d host(s) answered the sweep\n", len(up), len(hosts))
+		hosts = up
+		if len(hosts) == 0 && len(endpoints) == 0 {
+			return exitNoneOpen
+		}
+	}
+
+	// Resuming needs the jobs in the same order every time, so the seed is
+	// kept with the arguments to shuffle the targets the same way again
+	if randomize || portOrder == "random" {
+		if seed == 0 {
+			seed = rand.Uint64()
+			args = append(slices.Clone(args), "-seed", strconv.FormatUint(seed, 10))
+		}
+		if randomize {
+			shuffleTargets(newRand(seed), hosts, portList)
+			fmt.Fprintf(info, "Scanning in random order (-seed %d)\n", seed)
+		} else {
+			OrderPorts(portList, portOrder, newRand(seed))
+			fmt.Fprintf(info, "Scanning ports in random order (-seed %d)\n", seed)
 		}
 	} else {
-		// Default to all ports
-		for p := 1; p <= 65535; p++ {
-			portList = append(portList, p)
+		OrderPorts(portList, portOrder, nil)
+	}
+
+	// A resumed scan skips the jobs finished before it was interrupted, which
+	// only line up if the targets expand exactly as they did then
+	allJobs := len(hosts)*len(portList) + len(endpoints)
+	fingerprint := targetFingerprint(hosts, portList, endpoints)
+	audit.Targets, audit.Hosts, audit.Ports = fingerprint, len(hosts), len(portList)
+	skip := 0
+	if resume != nil {
+		if resume.Targets != fingerprint || resume.Total != allJobs {
+			errorf("Error: the targets have changed since the scan was interrupted; start a new scan instead\n")
+			return exitError
 		}
+		skip = resume.Completed
 	}
+	totalJobs := allJobs - skip
 
-	totalJobs := len(hosts) * len(portList)
-	fmt.Printf("Scanning %d host(s) across %d ports (%d total combinations)...\n", len(hosts), len(portList), totalJobs)
+	// Catch the classic forgotten -p across a large range before it starts;
+	// a resumed scan was already confirmed
+	if resume == nil && !assumeYes && confirmOver > 0 && allJobs > confirmOver {
+		e := EstimateScan(allJobs, concurrency, probeConfig.Retries, probeConfig.Timeout, probeConfig.Sleep, 20*time.Millisecond)
+		question := fmt.Sprintf("This scan probes %d ports (%d host(s) x %d ports) and may take %s to %s.",
+			allJobs, len(hosts), len(portList), formatDuration(e.Best), formatDuration(e.Worst))
+		if !isTerminal(os.Stdin) {
+			errorf("Error: %s\nPass -yes to run it anyway, or narrow it with -p.\n", question)
+			return exitError
+		}
+		if !confirm(os.Stdin, os.Stderr, question+" Continue?") {
+			fmt.Fprintf(os.Stderr, "Scan cancelled (-yes skips this question)\n")
+			return exitError
+		}
+	}
 
-	// Create job channel for host-port combinations
-	jobs := make(chan ScanJob, concurrency*10)
-	var wg sync.WaitGroup
+	fmt.Fprintf(info, "Scanning %d host(s) across %d ports (%d total combinations)...\n", len(hosts), len(portList), len(hosts)*len(portList))
+	if len(endpoints) > 0 {
+		fmt.Fprintf(info, "Scanning %d discovered service endpoint(s)...\n", len(endpoints))
+	}
+	if skip > 0 {
+		fmt.Fprintf(info, "Resuming: %d of %d already scanned, %d to go\n", skip, allJobs, totalJobs)
+	}
 
 	// Initialize stats and output writer
-	var outputWriter io.Writer
-	var outputFileHandle *os.File
+	var output *OutputFile
 	if outputFile != "" {
 		var err error
-		outputFileHandle, err = os.Create(outputFile)
+		// A resumed scan keeps the results found before the interruption
+		output, err = OpenOutputFile(outputFile, resume != nil, outputFlushInterval)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error creating output file: %v\n", err)
-			os.Exit(1)
+			errorf("Error creating output file: %v\n", err)
+			return exitError
 		}
-		defer outputFileHandle.Close()
-		outputWriter = outputFileHandle
-		fmt.Printf("Output will be saved to: %s\n", outputFile)
+		// Covers the early returns and panics; the normal path closes it
+		// below to report errors
+		defer output.Close()
+		fmt.Fprintf(info, "Output will be saved to: %s\n", outputFile)
 	}
 
-	stats := &Stats{startTime: time.Now(), output: outputWriter}
+	var capture *Capture
+	if uptimeEnabled && pcapFile == "" {
+		errorf("Error: -uptime reads TCP timestamps from the -pcap capture, which is missing\n")
+		return exitError
+	}
+	// Whom to switch to is settled before the capture file is created
+	var privs *Privileges
+	if pcapFile != "" && os.Geteuid() == 0 {
+		if privs, err = PrivilegeTarget(runAs, os.Getenv); err != nil {
+			errorf("Error: %v\n", err)
+			return exitError
+		}
+	}
+	if pcapFile != "" {
+		captureHosts := append([]string(nil), hosts...)
+		for _, job := range endpoints {
+			captureHosts = append(captureHosts, job.Host)
+		}
+		capture, err = StartCapture(pcapFile, captureHosts)
+		if err != nil {
+			errorf("Error starting packet capture: %v\n", err)
+			return exitError
+		}
+		fmt.Fprintf(info, "Capturing packets to: %s\n", pcapFile)
+	}
 
-	// Start workers
-	for i := 0; i < concurrency; i++ {
-		wg.Add(1)
-		go worker(jobs, &wg, stats)
+	// Root is needed for the capture socket alone, which is open by now; the
+	// probes and the parsing of what targets send back run as the user who
+	// ran sudo, or the -run-as one. The files written later are opened first,
+	// and a screenshot directory this scan made is handed over to that user.
+	if capture != nil && os.Geteuid() == 0 {
+		if privs != nil {
+			held, err = HoldFiles(privs, auditFile, historyFile, heldResumeFile(flag.CommandLine))
+			if err == nil && createdScreenshotDir {
+				err = os.Chown(screenshotDir, privs.UID, privs.GID)
+			}
+			if err == nil {
+				err = DropPrivileges(privs)
+			}
+			if err == nil && sourceIface != "" {
+				if err = checkBindToDevice(sourceIface); err != nil {
+					err = fmt.Errorf("%v; -run-as root keeps root privileges for it", err)
+				}
+			}
+			if err == nil {
+				fmt.Fprintf(info, "Running as %s from now on\n", privs.User)
+			}
+		}
+		if err != nil {
+			errorf("Error dropping root privileges: %v\n", err)
+			capture.Stop()
+			return exitError
+		}
+	} else if runAs != "" {
+		notef("-run-as has no effect unless a -pcap capture runs as root\n")
+	}
+
+	stats := &Stats{startTime: time.Now()}
+
+	// On a terminal progress is a bar kept below the other output; otherwise
+	// a line is printed every 5 seconds. -progress-json replaces both with a
+	// JSON line on stderr every second.
+	var bar *ProgressBar
+	var stdout io.Writer = os.Stdout
+	if verbosity != Quiet && !progressJSON && isTerminal(infoFile) {
+		bar = NewProgressBar(infoFile, infoColor)
+		info = bar.Writer(info)
+		if isTerminal(os.Stdout) {
+			stdout = bar.Writer(os.Stdout)
+		}
+	} else {
+		// Results and status lines can reach the same stream from different
+		// goroutines; the bar's writers already take turns
+		var mu sync.Mutex
+		info, stdout = lockedWriter{mu: &mu, w: info}, lockedWriter{mu: &mu, w: stdout}
 	}
 
+	// Probes that ended in an error other than a refusal or a timeout, such
+	// as an unreachable network, for -progress-json
+	var probeErrors atomic.Int64
+
 	// Start progress reporter
 	done := make(chan bool)
+	stopped := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(5 * time.Second)
+		defer close(stopped)
+		interval := 5 * time.Second
+		switch {
+		case progressJSON:
+			interval = time.Second
+		case bar != nil:
+			interval = 250 * time.Millisecond
+		}
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
+		warned := false
+		warnExhausted := func(exhausted int) {
+			// Shown even with -q: the scan slows down until it is fixed
+			if exhausted > 0 && !warned {
+				warned = true
+				if bar != nil {
+					fmt.Fprint(info, colorize(infoColor, ansiRed, exhaustedWarning))
+				} else {
+					errorf("%s", exhaustedWarning)
+				}
+			}
+		}
 		for {
 			select {
 			case <-ticker.C:
 				scanned, openPorts, elapsed := stats.GetStats()
-				progress := float64(scanned) * 100 / float64(totalJobs)
-				rate := float64(scanned) / elapsed.Seconds()
-				eta := time.Duration(float64(totalJobs-scanned)/rate) * time.Second
-				fmt.Printf("[Progress] %.2f%% | Scanned: %d/%d | Open: %d | Rate: %.0f/s | ETA: %v\n",
-					progress, scanned, totalJobs, openPorts, rate, eta.Round(time.Second))
+				exhausted := stats.Exhausted()
+				warnExhausted(exhausted)
+				if progressJSON {
+					e := newProgressEvent(scanned, totalJobs, openPorts, probeErrors.Load(), elapsed)
+					e.Exhausted = exhausted
+					writeProgressEvent(os.Stderr, e)
+				} else if bar != nil {
+					bar.Update(renderProgressBar(scanned, totalJobs, openPorts, elapsed) + exhaustedNote(exhausted))
+				} else {
+					fmt.Fprint(info, colorize(infoColor, ansiDim, progressLine(scanned, totalJobs, openPorts, elapsed)+exhaustedNote(exhausted)+"\n"))
+				}
 			case <-done:
+				warnExhausted(stats.Exhausted())
+				if progressJSON {
+					scanned, openPorts, elapsed := stats.GetStats()
+					e := newProgressEvent(scanned, totalJobs, openPorts, probeErrors.Load(), elapsed)
+					e.Exhausted = stats.Exhausted()
+					e.Done = true
+					writeProgressEvent(os.Stderr, e)
+				}
+				if bar != nil {
+					scanned, openPorts, elapsed := stats.GetStats()
+					bar.Update(renderProgressBar(scanned, totalJobs, openPorts, elapsed))
+					bar.Finish()
+				}
 				return
 			}
 		}
 	}()
 
-	// Generate all host-port combinations
-	for _, targetHost := range hosts {
-		for _, port := range portList {
-			jobs <- ScanJob{Host: targetHost, Port: port}
+	tracker := newHostTracker(info, infoColor, stats, jobsPerHost(hosts, portList, endpoints, skip), &level)
+	cursor := newJobCursor(skip)
+	pauser := &Pauser{}
+	// Rescanned addresses are reported under the names they were found as
+	names := addrNames
+	if len(rescanNames) > 0 {
+		names = maps.Clone(rescanNames)
+		maps.Copy(names, addrNames)
+	}
+	opts := ScanOptions{Workers: concurrency, Probe: probeConfig, Pause: pauser, Report: states, Labels: hostLabels, Aliases: aliases, Names: names, Knock: knock, Honeypots: honeypots, Policy: policy}
+	if politeScan {
+		makePolite(&opts)
+		fmt.Fprintf(info, "Polite mode: at most %d ports/s, one probe at a time per host, %v jitter, %v between hosts\n",
+			opts.Rate, opts.Jitter, opts.Cooldown)
+	}
+	if knock != nil {
+		fmt.Fprintf(info, "Knocking on %s before scanning each host\n", knock)
+	}
+	if policy != nil {
+		fmt.Fprintf(info, "Enforcing the scan policy of %d network(s) in %s\n", len(policy.Rules), policyFile)
+	}
+	opts.OnProbe = func(job ScanJob, state PortState, err error) {
+		if err != nil && err != errHoneypot && !errors.Is(err, errPolicy) {
+			if _, kind := classifyDialError(err); kind != "refused" && kind != "timeout" {
+				probeErrors.Add(1)
+			}
+		}
+		tracker.Probed(job, state, err)
+		cursor.Finished(job)
+	}
+	togglePause := func() {
+		if pauser.Toggle() {
+			fmt.Fprintf(info, "Paused; probes in flight will finish (press p or send SIGUSR1 to resume)\n")
+		} else {
+			fmt.Fprintf(info, "Resumed\n")
+		}
+	}
+	pauseSignals := make(chan os.Signal, 1)
+	notifyPause(pauseSignals)
+	go func() {
+		for range pauseSignals {
+			togglePause()
 		}
+	}()
+
+	// Enter prints a status snapshot, p pauses and resumes, and + and -
+	// change the verbosity
+	restoreTerminal := func() {}
+	if verbosity != Quiet {
+		restoreTerminal = WatchKeys(func(key byte) {
+			switch key {
+			case '\n', '\r', ' ':
+				fmt.Fprint(info, statusSnapshot(stats, totalJobs, tracker))
+				if pauser.Paused() {
+					fmt.Fprintf(info, "Paused (press p to resume)\n")
+				}
+			case 'p':
+				togglePause()
+			case '+':
+				if level.Load() < VeryVerbose {
+					fmt.Fprintf(info, "Verbosity increased to %d\n", level.Add(1))
+				}
+			case '-':
+				if level.Load() > Normal {
+					fmt.Fprintf(info, "Verbosity decreased to %d\n", level.Add(-1))
+				}
+			}
+		})
 	}
 
-	close(jobs)
-	wg.Wait()
+	// The first Ctrl+C (or SIGTERM) stops the scan and keeps what was found;
+	// a second one quits at once
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintf(info, "\nInterrupted, stopping the scan (press Ctrl+C again to quit immediately)...\n")
+		cancel()
+		output.Flush()
+		<-signals
+		restoreTerminal()
+		output.Close()
+		os.Exit(exitPartial)
+	}()
+
+	var results []Result
+	matched := 0 // open ports passing the -match filters
+	jobs := func(yield func(ScanJob) bool) {
+		for job := range scanJobs(hosts, portList, learned, endpoints, skip) {
+			tracker.Queued(job.Host)
+			cursor.Queued(job)
+			if !yield(job) {
+				return
+			}
+		}
+	}
+	report := func(r Result) {
+		// Open ports are always kept for history, even when -state or the
+		// -match filters leave them out of the output; -output-targets only
+		// lists open ports
+		show := states.Has(r.State) && (!targetsOnly || r.State == StateOpen) && filter.Match(r)
+		line, color := formatResult(r)+"\n", ansiGreen
+		if r.State != StateOpen {
+			color = ansiDim
+		}
+		if show && targetsOnly {
+			line = FormatTarget(r, r.Scheme) + "\n"
+		}
+		if show {
+			fmt.Fprint(stdout, colorize(resultColor, color, line))
+			output.WriteString(line)
+		}
+		if r.State == StateOpen {
+			results = append(results, r)
+			if filter.Match(r) {
+				matched++
+			}
+		}
+	}
+	RunJobs(ctx, jobs, opts, stats, report)
+	if len(udpList) > 0 && ctx.Err() == nil {
+		RunUDP(ctx, hosts, udpList, opts, stats, report)
+	}
+	interrupted := ctx.Err() != nil
+	// Results found before their host was labeled get the label too; hosts
+	// given as names are labeled by name, the others by address
+	for i, r := range results {
+		if v := cmp.Or(honeypots.Verdict(r.Host), honeypots.Verdict(r.IP)); v != "" {
+			results[i].Suspect = v
+		}
+	}
+	restoreTerminal()
 	done <- true
+	<-stopped
+
+	if err := output.Close(); err != nil {
+		errorf("Error writing output file: %v\n", err)
+	}
+
+	if capture != nil {
+		if uptimeEnabled && !interrupted {
+			capture.Timestamps.Resample(ctx, results, probeConfig)
+		}
+		// Let replies to the last probes arrive
+		time.Sleep(100 * time.Millisecond)
+		packets, err := capture.Stop()
+		if err != nil {
+			errorf("Error writing packet capture: %v\n", err)
+		}
+		fmt.Fprintf(info, "Captured %d packets to %s\n", packets, pcapFile)
+		if uptimeEnabled {
+			uptimes := capture.Timestamps.Estimates()
+			for i, r := range results {
+				results[i].Uptime = uptimes[r.IP]
+			}
+		}
+	}
+
+	if screenshotDir != "" && !interrupted {
+		shots, err := TakeScreenshots(ctx, browser, screenshotDir, results, probeConfig)
+		if err != nil {
+			errorf("Error writing screenshot index: %v\n", err)
+		}
+		saved := 0
+		for _, shot := range shots {
+			if shot.Err == nil {
+				saved++
+			} else {
+				slog.Warn("screenshot failed", "url", shot.URL, "err", shot.Err)
+			}
+		}
+		fmt.Fprintf(info, "Saved %d screenshot(s) of %d web service(s), see %s\n", saved, len(shots), filepath.Join(screenshotDir, "index.html"))
+	}
 
 	scanned, openPorts, elapsed := stats.GetStats()
-	fmt.Printf("\n=== Scan Complete ===\n")
-	fmt.Printf("Total scanned: %d\n", scanned)
-	fmt.Printf("Open ports found: %d\n", openPorts)
-	fmt.Printf("Time elapsed: %v\n", elapsed.Round(time.Second))
-	fmt.Printf("Average rate: %.0f ports/second\n", float64(scanned)/elapsed.Seconds())
+	audit.Scanned, audit.Open = scanned, openPorts
+	if interrupted {
+		fmt.Fprintf(info, "\n=== Scan Interrupted ===\n")
+		fmt.Fprintf(info, "Total scanned: %d of %d\n", scanned, totalJobs)
+	} else {
+		fmt.Fprintf(info, "\n=== Scan Complete ===\n")
+		fmt.Fprintf(info, "Total scanned: %d\n", scanned)
+	}
+	fmt.Fprintf(info, "Open ports found: %d\n", openPorts)
+	if flapping := countFlapping(results); flapping > 0 {
+		fmt.Fprintf(info, "Flapping ports (answered only some of the -reprobe attempts): %d\n", flapping)
+	}
+	if n := stats.Exhausted(); n > 0 {
+		fmt.Fprintf(info, "Probe attempts delayed by the open file limit: %d\n", n)
+	}
+	if d := stats.DNSTime(); d > 0 {
+		fmt.Fprintf(info, "Time probes spent resolving target names: %s\n", formatDuration(d))
+	}
+	if n := stats.Panics(); n > 0 {
+		fmt.Fprintf(info, "Probes abandoned after an internal error: %d (see the log)\n", n)
+	}
+	if n := policy.Skipped(); n > 0 {
+		fmt.Fprintf(info, "Probes not allowed by the scan policy: %d\n", n)
+	}
+	if len(skippedLines) > 0 {
+		fmt.Fprintf(info, "Invalid target lines skipped: %d\n", len(skippedLines))
+	}
+	if len(unresolved) > 0 && !scanUnresolved {
+		fmt.Fprintf(info, "Unresolvable hosts skipped: %d\n", len(unresolved))
+	}
+	if filter != nil {
+		fmt.Fprintf(info, "Matching the filters: %d\n", matched)
+	}
+	if level.Load() >= Verbose {
+		var closed, filtered int
+		for _, h := range stats.HostStats() {
+			closed += h.States[StateClosed]
+			filtered += h.States[StateFiltered]
+		}
+		fmt.Fprintf(info, "Closed ports: %d\n", closed)
+		fmt.Fprintf(info, "Filtered ports: %d\n", filtered)
+	}
+	fmt.Fprintf(info, "Time elapsed: %v\n", elapsed.Round(time.Second))
+	_, rate, _, _ := progressMath(scanned, totalJobs, elapsed)
+	fmt.Fprintf(info, "Average rate: %.0f ports/second\n", rate)
+	summaryLimit := hostSummaryLimit
+	if level.Load() >= Verbose {
+		summaryLimit = 0
+	}
+	WriteHostSummary(info, stats.HostStats(), summaryLimit)
+	WriteServices(info, results)
+	WriteSharedJARM(info, results)
+	WriteFamilyDifferences(info, FamilyDifferences(results, addrNames))
+	WriteSuspects(info, honeypots)
+	WriteUptimes(info, results)
+	var exposure *ExposureAlert
+	if threshold != nil {
+		exposure = threshold.Check(results)
+	}
+	WriteExposure(info, exposure)
+	WriteSkipped(info, "Invalid Target Lines", skippedLines)
+	if !scanUnresolved {
+		WriteSkipped(info, "Unresolvable Hosts", unresolved)
+	}
+
+	// A partial scan would show the unscanned ports as closed in history
+	if interrupted && resumeFile != "" {
+		scanArgs := args
+		if resume != nil {
+			scanArgs = resume.Args
+		}
+		state := &ResumeState{Args: scanArgs, Targets: fingerprint, Completed: cursor.Completed(), Total: allJobs, Time: time.Now()}
+		if err := held.SaveResumeState(resumeFile, state); err != nil {
+			errorf("Error saving scan progress: %v\n", err)
+		} else if resumeFile == defaultResumeFile {
+			fmt.Fprintf(info, "Progress saved; continue with: pscanner resume\n")
+		} else {
+			fmt.Fprintf(info, "Progress saved; continue with: pscanner resume %s\n", resumeFile)
+		}
+	} else if resumeFile != "" {
+		held.DiscardResumeState(resumeFile, resume != nil)
+	}
+
+	if historyFile != "" && interrupted {
+		fmt.Fprintf(info, "Not recording the interrupted scan in %s\n", historyFile)
+	} else if historyFile != "" {
+		sortResults(results)
+		rec := ScanRecord{ID: randomID(8), Time: stats.startTime, Hosts: hosts, Ports: ports, UDPPorts: udpPorts(udpList), Results: results}
+		if err := held.AppendHistory(historyFile, rec); err != nil {
+			errorf("Error recording history: %v\n", err)
+		} else {
+			fmt.Fprintf(info, "Recorded as scan %s in %s\n", rec.ID, historyFile)
+		}
+	}
+
+	if otlpAddr != "" {
+		if err := ExportTelemetry(otlpAddr, stats, time.Now()); err != nil {
+			errorf("Error exporting telemetry: %v\n", err)
+		}
+	}
+
+	// Open ports only add up, so an interrupted scan over the limit is too
+	if exposure != nil {
+		if err := SendAlert(exposure, alertWebhook, alertSlack); err != nil {
+			errorf("Error sending alert: %v\n", err)
+		}
+	}
+
+	switch {
+	case exposure != nil:
+		return exitAlert
+	case interrupted:
+		return exitPartial
+	case matched == 0:
+		return exitNoneOpen
+	}
+	return exitOpen
 }
@@ -1,10 +1,23 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
 	"reflect"
-	"sort"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestParsePorts(t *testing.T) {
@@ -151,15 +164,7 @@ func TestParsePorts(t *testing.T) {
 				return
 			}
 
-			// Sort both slices for comparison (order doesn't matter in port list)
-			if result != nil {
-				sort.Ints(result)
-			}
-			if tt.expected != nil {
-				sort.Ints(tt.expected)
-			}
-
-			// Compare results
+			// Compare results, which must come back in ascending order
 			if !reflect.DeepEqual(result, tt.expected) {
 				t.Errorf("ParsePorts() = %v, expected %v", result, tt.expected)
 			}
@@ -171,6 +176,7 @@ func TestExpandCIDR(t *testing.T) {
 	tests := []struct {
 		name     string
 		cidr     string
+		all      bool // -scan-network-addrs
 		wantErr  bool
 		minCount int // minimum number of IPs expected
 		maxCount int // maximum number of IPs expected
@@ -203,6 +209,37 @@ func TestExpandCIDR(t *testing.T) {
 			minCount: 254,
 			maxCount: 254,
 		},
+		{
+			name:     "Point-to-point /31",
+			cidr:     "192.168.1.0/31",
+			minCount: 2,
+			maxCount: 2,
+		},
+		{
+			name:     "Single host /32",
+			cidr:     "192.168.1.7/32",
+			minCount: 1,
+			maxCount: 1,
+		},
+		{
+			name:     "/24 with network addresses",
+			cidr:     "192.168.1.0/24",
+			all:      true,
+			minCount: 256,
+			maxCount: 256,
+		},
+		{
+			name:     "IPv6 /126",
+			cidr:     "2001:db8::/126",
+			minCount: 4,
+			maxCount: 4,
+		},
+		{
+			name:     "IPv6 /128",
+			cidr:     "2001:db8::1/128",
+			minCount: 1,
+			maxCount: 1,
+		},
 		{
 			name:     "Invalid CIDR format",
 			cidr:     "192.168.1.0",
@@ -221,7 +258,7 @@ func TestExpandCIDR(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ExpandCIDR(tt.cidr)
+			result, err := ExpandCIDR(tt.cidr, tt.all)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ExpandCIDR() error = %v, wantErr %v", err, tt.wantErr)
@@ -244,6 +281,7 @@ func TestGetHostIP(t *testing.T) {
 	tests := []struct {
 		name    string
 		host    string
+		network string
 		wantErr bool
 	}{
 		{
@@ -266,11 +304,17 @@ func TestGetHostIP(t *testing.T) {
 			host:    "",
 			wantErr: true,
 		},
+		{
+			name:    "IPv4 address probed over IPv6",
+			host:    "127.0.0.1",
+			network: "tcp6",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := GetHostIP(tt.host)
+			result, err := GetHostIP(tt.host, cmp.Or(tt.network, "tcp"))
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetHostIP() error = %v, wantErr %v", err, tt.wantErr)
@@ -335,6 +379,9 @@ example.com
 	}
 }
 
+// quickProbe tries each port once, for scans of local listeners
+var quickProbe = ProbeConfig{Timeout: 500 * time.Millisecond, Retries: 1}
+
 func TestTryConnect(t *testing.T) {
 	// Note: These tests require actual network connectivity
 	// For unit tests, you might want to mock the network calls
@@ -372,11 +419,7 @@ func TestTryConnect(t *testing.T) {
 			}
 
 			// Set short timeout for tests
-			originalTimeout := timeout
-			timeout = 100
-			defer func() { timeout = originalTimeout }()
-
-			result := TryConnect(tt.host, tt.port, tt.retries)
+			result := TryConnect(tt.host, tt.port, ProbeConfig{Timeout: 100 * time.Millisecond, Retries: tt.retries})
 			if result != tt.expected {
 				t.Errorf("TryConnect() = %v, expected %v", result, tt.expected)
 			}
@@ -384,6 +427,23 @@ func TestTryConnect(t *testing.T) {
 	}
 }
 
+func TestRunJobsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stats := &Stats{startTime: time.Now()}
+	var found []Result
+	RunScan(ctx, []string{"127.0.0.1"}, []int{1, 2, 3}, ScanOptions{Workers: 2, Probe: quickProbe}, stats, func(r Result) {
+		found = append(found, r)
+	})
+	if scanned, _, _ := stats.GetStats(); scanned != 0 || len(found) != 0 {
+		t.Errorf("cancelled scan probed %d ports and found %v", scanned, found)
+	}
+
+	if state, _ := probePort(ctx, "127.0.0.1", 1, ProbeConfig{Timeout: time.Second, Retries: 3}, probeHooks{}); state != StateFiltered {
+		t.Errorf("probePort() with cancelled context = %v, expected filtered without dialing", state)
+	}
+}
+
 func BenchmarkParsePorts(b *testing.B) {
 	testCases := []string{
 		"80",
@@ -400,3 +460,474 @@ func BenchmarkParsePorts(b *testing.B) {
 		})
 	}
 }
+
+func TestDurationValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{name: "Plain milliseconds", input: "500", expected: 500 * time.Millisecond},
+		{name: "Zero", input: "0", expected: 0},
+		{name: "Milliseconds unit", input: "250ms", expected: 250 * time.Millisecond},
+		{name: "Seconds", input: "2s", expected: 2 * time.Second},
+		{name: "Compound", input: "1m30s", expected: 90 * time.Second},
+		{name: "Negative milliseconds", input: "-5", wantErr: true},
+		{name: "Negative duration", input: "-1s", wantErr: true},
+		{name: "Missing unit on fraction", input: "1.5", wantErr: true},
+		{name: "Garbage", input: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			var d time.Duration
+			durationVar(fs, &d, "t", time.Minute, "timeout")
+			err := fs.Parse([]string{"-t", tt.input})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(-t %s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if err == nil && d != tt.expected {
+				t.Errorf("Parse(-t %s) = %v, want %v", tt.input, d, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunScanExitCodes(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	openPort := strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := strconv.Itoa(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"open port found", []string{"-p", openPort}, exitOpen},
+		{"nothing open", []string{"-p", closedPort}, exitNoneOpen},
+		{"bad ports", []string{"-p", "0-5"}, exitError},
+		{"over -alert-over", []string{"-p", openPort, "-alert-over", "0"}, exitAlert},
+		{"within -alert-over", []string{"-p", openPort, "-alert-over", "host=1,total=1"}, exitOpen},
+		{"bad -alert-over", []string{"-p", openPort, "-alert-over", "ports=1"}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-q", "-h", "127.0.0.1", "-r", "1", "-s", "0", "-resume-file", ""}, tt.args...)
+			if got := runScan(args, nil); got != tt.want {
+				t.Errorf("runScan(%v) = %d, want %d", args, got, tt.want)
+			}
+		})
+	}
+	flag.CommandLine.Set("alert-over", "")
+}
+
+func TestValidateProbeFlags(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		workers  int
+		probe    ProbeConfig
+		wantErr  bool
+		warnings int
+	}{
+		{"Defaults", 100, DefaultProbeConfig(), false, 0},
+		{"No workers", 0, DefaultProbeConfig(), true, 0},
+		{"Negative retries", 100, ProbeConfig{Timeout: 500 * ms, Retries: -3}, true, 0},
+		{"No attempts", 100, ProbeConfig{Timeout: 500 * ms, Retries: 0}, true, 0},
+		{"No timeout", 100, ProbeConfig{Retries: 1}, true, 0},
+		{"Negative reprobes", 100, ProbeConfig{Timeout: 500 * ms, Retries: 1, Reprobe: -1}, true, 0},
+		{"Huge concurrency, tiny timeout", 5000, ProbeConfig{Timeout: 50 * ms, Retries: 1}, false, 1},
+		{"Huge concurrency, long timeout", 5000, ProbeConfig{Timeout: time.Second, Retries: 1}, false, 0},
+		{"Tiny timeout", 10, ProbeConfig{Timeout: 5 * ms, Retries: 1}, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := validateProbeFlags(tt.workers, tt.probe)
+			if (err != nil) != tt.wantErr || len(warnings) != tt.warnings {
+				t.Errorf("validateProbeFlags() = %q, %v; expected %d warning(s), wantErr %v", warnings, err, tt.warnings, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunScanInvalidRanges(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.txt")
+	mixed := filepath.Join(dir, "mixed.txt")
+	os.WriteFile(invalid, []byte("10.0.0.0/33\n"), 0o644)
+	os.WriteFile(mixed, []byte("10.0.0.0/33\n127.0.0.1/32\n"), 0o644)
+
+	base := []string{"-q", "-h", "", "-p", "1", "-r", "1", "-s", "0", "-resume-file", ""}
+	// A scan whose every range is invalid must not fall back to localhost
+	if got := runScan(append(slices.Clone(base), "-cf", invalid), nil); got != exitError {
+		t.Errorf("runScan() with only invalid ranges = %d, want %d", got, exitError)
+	}
+	if len(skippedLines) != 1 || skippedLines[0].Target != "invalid.txt:1: 10.0.0.0/33" {
+		t.Errorf("skippedLines = %v, expected the invalid range", skippedLines)
+	}
+	if got := runScan(append(slices.Clone(base), "-cf", mixed), nil); got != exitNoneOpen {
+		t.Errorf("runScan() with a valid range left = %d, want %d", got, exitNoneOpen)
+	}
+	flag.CommandLine.Set("cf", "")
+}
+
+func TestParseStates(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []PortState
+		wantErr  bool
+	}{
+		{input: "open", expected: []PortState{StateOpen}},
+		{input: "open, closed", expected: []PortState{StateOpen, StateClosed}},
+		{input: "filtered", expected: []PortState{StateFiltered}},
+		{input: "all", expected: []PortState{StateOpen, StateClosed, StateFiltered}},
+		{input: "open,ajar", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		set, err := ParseStates(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStates(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		var got []PortState
+		for s := StateOpen; s < numPortStates; s++ {
+			if set.Has(s) {
+				got = append(got, s)
+			}
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ParseStates(%q) = %v, expected %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestRunScanReportStates(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	openPort := listener.Addr().(*net.TCPAddr).Port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	for _, report := range []StateSet{0, 1 << StateClosed} {
+		stats := &Stats{startTime: time.Now()}
+		got := make(map[int]PortState)
+		var mu sync.Mutex
+		RunScan(context.Background(), []string{"127.0.0.1"}, []int{openPort, closedPort}, ScanOptions{Workers: 2, Probe: quickProbe, Report: report}, stats, func(r Result) {
+			mu.Lock()
+			defer mu.Unlock()
+			got[r.Port] = r.State
+		})
+		expected := map[int]PortState{openPort: StateOpen}
+		if report.Has(StateClosed) {
+			expected[closedPort] = StateClosed
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Report %b: got %v, expected %v", report, got, expected)
+		}
+		if _, open, _ := stats.GetStats(); open != 1 {
+			t.Errorf("Report %b: counted %d open ports, expected 1", report, open)
+		}
+	}
+}
+
+func TestRunScanSerialResults(t *testing.T) {
+	portList := make([]int, 50)
+	for i := range portList {
+		portList[i] = i + 1
+	}
+	var inFlight, overlaps atomic.Int32
+	count := 0
+	stats := &Stats{startTime: time.Now()}
+	RunScan(context.Background(), []string{"127.0.0.1"}, portList, ScanOptions{Workers: 16, Probe: quickProbe, Report: 1<<StateClosed | 1<<StateFiltered}, stats, func(r Result) {
+		if inFlight.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		count++ // unsynchronized on purpose; -race flags concurrent calls
+		time.Sleep(time.Millisecond)
+		inFlight.Add(-1)
+	})
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("onResult was called concurrently %d times", n)
+	}
+	if count != len(portList) {
+		t.Errorf("onResult was called %d times, expected once per port (%d)", count, len(portList))
+	}
+}
+
+func TestRunScanProbeConfigs(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// Scans in one process keep their own settings; no attempts finds nothing
+	var wg sync.WaitGroup
+	found := make([]int, 2)
+	for i, probe := range []ProbeConfig{{Timeout: time.Second, Retries: 0}, quickProbe} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats := &Stats{startTime: time.Now()}
+			RunScan(context.Background(), []string{"127.0.0.1"}, []int{port}, ScanOptions{Workers: 1, Probe: probe}, stats, func(Result) {
+				found[i]++
+			})
+		}()
+	}
+	wg.Wait()
+	if found[0] != 0 || found[1] != 1 {
+		t.Errorf("open ports found with 0 and 1 attempts = %v, expected [0 1]", found)
+	}
+}
+
+// networkEnricher records the address family each result was enriched with
+type networkEnricher struct{}
+
+func (networkEnricher) Enrich(r *Result, probe ProbeConfig) {
+	r.Service = probe.Network
+}
+
+func TestRunScanEnrichesWithItsProbeConfig(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	saved := enrichers
+	defer func() { enrichers = saved }()
+	enrichers = []Enricher{networkEnricher{}}
+
+	// Scans run side by side, as server jobs do, each with its own family
+	var wg sync.WaitGroup
+	got := make([]string, 2)
+	for i, network := range []string{"tcp", "tcp4"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probe := quickProbe
+			probe.Network = network
+			RunScan(context.Background(), []string{"127.0.0.1"}, []int{port}, ScanOptions{Workers: 1, Probe: probe}, &Stats{startTime: time.Now()}, func(r Result) {
+				got[i] = r.Service
+			})
+		}()
+	}
+	wg.Wait()
+	if got[0] != "tcp" || got[1] != "tcp4" {
+		t.Errorf("results enriched with %v, expected each scan's own [tcp tcp4]", got)
+	}
+}
+
+// panicEnricher panics on one port, standing in for a buggy plugin
+type panicEnricher struct{ port int }
+
+func (p panicEnricher) Enrich(r *Result, probe ProbeConfig) {
+	if r.Port == p.port {
+		panic("enricher bug")
+	}
+}
+
+func TestRunScanRecoversPanics(t *testing.T) {
+	var ports []int
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+	}
+	savedEnrichers, savedLogger := enrichers, slog.Default()
+	defer func() { enrichers = savedEnrichers; slog.SetDefault(savedLogger) }()
+	enrichers = []Enricher{panicEnricher{port: ports[0]}}
+	var logged strings.Builder
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, nil)))
+
+	// The per-host limit and cool-down would hang the scan if the panicking
+	// job kept its slot or never counted as finished
+	var found []int
+	var probed atomic.Int32
+	stats := &Stats{startTime: time.Now()}
+	opts := ScanOptions{Workers: 1, Probe: quickProbe, HostLimit: 1, Cooldown: time.Millisecond,
+		OnProbe: func(ScanJob, PortState, error) { probed.Add(1) }}
+	RunScan(context.Background(), []string{"127.0.0.1", "localhost"}, ports, opts, stats, func(r Result) {
+		found = append(found, r.Port)
+	})
+	if scanned, _, _ := stats.GetStats(); scanned != 4 || probed.Load() != 4 {
+		t.Errorf("scanned %d jobs and reported %d, expected all 4", scanned, probed.Load())
+	}
+	if !reflect.DeepEqual(found, []int{ports[1], ports[1]}) {
+		t.Errorf("results for ports %v, expected only the port that didn't panic", found)
+	}
+	if stats.Panics() != 2 {
+		t.Errorf("Panics() = %d, expected 2", stats.Panics())
+	}
+	if h, _ := stats.Host("127.0.0.1"); h.Errors.Panic != 1 {
+		t.Errorf("host errors = %v, expected the panic recorded against it", h.Errors)
+	}
+	if !strings.Contains(logged.String(), "probe panicked") || !strings.Contains(logged.String(), "enricher bug") {
+		t.Errorf("log = %q, expected the panic", logged.String())
+	}
+}
+
+func TestProbePortResolvesWithinTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		if name == "slow.test" {
+			<-ctx.Done() // a resolver that never answers
+			return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+
+	var lookups int
+	hooks := probeHooks{Resolved: func(time.Duration) { lookups++ }}
+	start := time.Now()
+	state, err := probePort(context.Background(), "slow.test", port, ProbeConfig{Timeout: 50 * time.Millisecond, Retries: 2}, hooks)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("probePort() took %v with a 50ms timeout, expected resolution to count against it", elapsed)
+	}
+	if state != StateFiltered || err == nil || lookups != 2 {
+		t.Errorf("probePort() = %v, %v after %d lookups, expected filtered after one per attempt", state, err, lookups)
+	}
+
+	lookups = 0
+	if state, err := probePort(context.Background(), "svc.test", port, ProbeConfig{Timeout: time.Second, Retries: 2}, hooks); state != StateOpen || lookups != 1 {
+		t.Errorf("probePort() = %v, %v after %d lookups, expected open after one", state, err, lookups)
+	}
+}
+
+func TestProbePortExhausted(t *testing.T) {
+	saved := dialProbe
+	defer func() { dialProbe = saved }()
+
+	emfile := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("socket", syscall.EMFILE)}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	dials := 0
+	dialProbe = func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+		dials++
+		if dials <= 2 {
+			return nil, emfile
+		}
+		return nil, refused
+	}
+
+	if state, kind := classifyDialError(emfile); state != StateFiltered || kind != "exhausted" {
+		t.Errorf("classifyDialError(EMFILE) = %v, %q, expected filtered, \"exhausted\"", state, kind)
+	}
+	// Attempts that never left the machine are repeated, not counted
+	exhausted := 0
+	state, err := probePort(context.Background(), "127.0.0.1", 1, ProbeConfig{Timeout: time.Second, Retries: 1}, probeHooks{Exhausted: func() { exhausted++ }})
+	if state != StateClosed || err != refused {
+		t.Errorf("probePort() = %v, %v, expected closed after the descriptors freed up", state, err)
+	}
+	if dials != 3 || exhausted != 2 {
+		t.Errorf("%d dials and %d exhausted attempts, expected 3 and 2", dials, exhausted)
+	}
+}
+
+func TestReprobeOpen(t *testing.T) {
+	saved := dialProbe
+	defer func() { dialProbe = saved }()
+
+	// The port answers every other connection, like a pool behind a load
+	// balancer with one backend down
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	dials := 0
+	dialProbe = func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+		dials++
+		if dials%2 == 0 {
+			return nil, refused
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	probe := ProbeConfig{Timeout: time.Second, Retries: 3, Reprobe: 4}
+	answered, attempts := reprobeOpen(context.Background(), "127.0.0.1", 80, probe, probeHooks{})
+	if answered != 3 || attempts != 5 {
+		t.Errorf("reprobeOpen() = %d/%d, expected 3/5", answered, attempts)
+	}
+	// Each reprobe is a single attempt, whatever -r says
+	if dials != 4 {
+		t.Errorf("reprobeOpen() dialed %d times, expected 4", dials)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if answered, attempts := reprobeOpen(ctx, "127.0.0.1", 80, probe, probeHooks{}); answered != 1 || attempts != 1 {
+		t.Errorf("reprobeOpen() after cancelling = %d/%d, expected only the first attempt", answered, attempts)
+	}
+}
+
+func TestDefaultHosts(t *testing.T) {
+	saved := hostLabels
+	defer func() { hostLabels = saved }()
+	hostLabels = make(map[string]map[string]string)
+
+	expected := []string{"127.0.0.1"}
+	if ln, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		ln.Close()
+		expected = append(expected, "::1")
+	}
+	if hosts := DefaultHosts(); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("DefaultHosts() = %v, expected %v", hosts, expected)
+	}
+	if v := hostLabels["127.0.0.1"]["loopback"]; v != "ipv4" {
+		t.Errorf("127.0.0.1 labelled loopback=%q, expected ipv4", v)
+	}
+	if len(expected) == 2 && hostLabels["::1"]["loopback"] != "ipv6" {
+		t.Errorf("::1 labels = %v, expected loopback=ipv6", hostLabels["::1"])
+	}
+}
+
+func TestHeldResumeFile(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"-resume-file", defaultResumeFile}, defaultResumeFile},
+		{[]string{"-resume-file", "/var/lib/pscanner/scan.resume"}, "/var/lib/pscanner/scan.resume"},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.String("resume-file", defaultResumeFile, "resume file")
+		fs.Parse(tt.args)
+		if got := heldResumeFile(fs); got != tt.expected {
+			t.Errorf("heldResumeFile(%q) = %q, expected %q", tt.args, got, tt.expected)
+		}
+	}
+}
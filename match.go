@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The -match-ports, -match-service and -match-banner flags
+var matchPorts, matchService, matchBanner string
+
+// ResultFilter narrows the results that are printed and written to those on
+// given ports, running given services or with a banner matching a pattern.
+// A nil filter matches everything.
+type ResultFilter struct {
+	ports    map[int]bool
+	services []string
+	banner   *regexp.Regexp
+}
+
+// NewResultFilter builds a filter from the -match-ports, -match-service and
+// -match-banner values, returning nil when all are empty
+func NewResultFilter(ports, services, banner string) (*ResultFilter, error) {
+	if ports == "" && services == "" && banner == "" {
+		return nil, nil
+	}
+	f := &ResultFilter{}
+	if ports != "" {
+		list, err := ParsePorts(ports)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match-ports: %v", err)
+		}
+		f.ports = make(map[int]bool, len(list))
+		for _, p := range list {
+			f.ports[p] = true
+		}
+	}
+	for _, s := range strings.Split(services, ",") {
+		if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+			f.services = append(f.services, s)
+		}
+	}
+	if banner != "" {
+		re, err := regexp.Compile(banner)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -match-banner: %v", err)
+		}
+		f.banner = re
+	}
+	return f, nil
+}
+
+// NeedsBanner reports whether the filter looks at banners or services, which
+// must then be grabbed from every open port
+func (f *ResultFilter) NeedsBanner() bool {
+	return f != nil && (f.banner != nil || len(f.services) > 0)
+}
+
+// Match reports whether a result passes every condition of the filter. A
+// service matches when it was detected on the port or a passive source saw
+// it there.
+func (f *ResultFilter) Match(r Result) bool {
+	if f == nil {
+		return true
+	}
+	if f.ports != nil && !f.ports[r.Port] {
+		return false
+	}
+	if len(f.services) > 0 && !f.matchService(r) {
+		return false
+	}
+	return f.banner == nil || f.banner.MatchString(r.Banner)
+}
+
+func (f *ResultFilter) matchService(r Result) bool {
+	if slices.Contains(f.services, strings.ToLower(r.Service)) {
+		return true
+	}
+	for _, k := range r.Known {
+		if k.Port == r.Port && slices.Contains(f.services, strings.ToLower(k.Service)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestResultFilter(t *testing.T) {
+	ssh := Result{IP: "10.0.0.1", Port: 22, Service: "ssh", Banner: "SSH-2.0-OpenSSH_7.4"}
+	web := Result{IP: "10.0.0.1", Port: 8080, Service: "http", Banner: "HTTP/1.1 200 OK\r\nServer: nginx/1.18.0"}
+	passive := Result{IP: "10.0.0.2", Port: 9000, Known: []KnownService{{Source: "shodan", Port: 9000, Service: "HTTP"}}}
+
+	tests := []struct {
+		name     string
+		ports    string
+		services string
+		banner   string
+		expected []bool // ssh, web, passive
+	}{
+		{name: "No filter", expected: []bool{true, true, true}},
+		{name: "Ports", ports: "22,9000-9100", expected: []bool{true, false, true}},
+		{name: "Service", services: "http", expected: []bool{false, true, true}},
+		{name: "Services", services: " SSH, http ", expected: []bool{true, true, true}},
+		{name: "Banner", banner: `OpenSSH_[0-7]\.`, expected: []bool{true, false, false}},
+		{name: "All conditions", ports: "8080", services: "http", banner: "nginx", expected: []bool{false, true, false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := NewResultFilter(tt.ports, tt.services, tt.banner)
+			if err != nil {
+				t.Fatalf("NewResultFilter() error = %v", err)
+			}
+			for i, r := range []Result{ssh, web, passive} {
+				if got := f.Match(r); got != tt.expected[i] {
+					t.Errorf("Match(%s) = %v, expected %v", r, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNewResultFilterErrors(t *testing.T) {
+	if _, err := NewResultFilter("1-x", "", ""); err == nil {
+		t.Error("NewResultFilter() accepted bad ports")
+	}
+	if _, err := NewResultFilter("", "", "(["); err == nil {
+		t.Error("NewResultFilter() accepted a bad regular expression")
+	}
+	if f, _ := NewResultFilter("", "", ""); f != nil || f.NeedsBanner() {
+		t.Error("NewResultFilter() without conditions should return a nil filter")
+	}
+}
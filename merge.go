@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+)
+
+// MergeStats counts what MergeResults did with its input
+type MergeStats struct {
+	Duplicates int // results that repeated an address and port already seen
+}
+
+// MergeResults unions result sets from several runs of one scan, such as
+// the shards of a distributed scan or the runs before and after a resume.
+// Each address and port is kept once. When runs disagree about its state the
+// later result wins, or the open one if their times are the same, and details
+// such as banners and enrichment are filled in from the others.
+func MergeResults(sets ...[]Result) ([]Result, MergeStats) {
+	var stats MergeStats
+	index := make(map[string]int)
+	var merged []Result
+	for _, set := range sets {
+		for _, r := range set {
+			key := r.Key()
+			i, seen := index[key]
+			if !seen {
+				index[key] = len(merged)
+				merged = append(merged, r)
+				continue
+			}
+			stats.Duplicates++
+			merged[i] = mergeResult(merged[i], r)
+		}
+	}
+	sortResults(merged)
+	return merged, stats
+}
+
+// mergeResult combines two results for the same address and port
+func mergeResult(a, b Result) Result {
+	if b.Time.After(a.Time) || b.Time.Equal(a.Time) && b.State == StateOpen && a.State != StateOpen {
+		a, b = b, a
+	}
+	for _, f := range []struct{ dst, src *string }{
+		{&a.Host, &b.Host}, {&a.Country, &b.Country}, {&a.Org, &b.Org},
+		{&a.Network, &b.Network}, {&a.NetName, &b.NetName}, {&a.Owner, &b.Owner},
+		{&a.Banner, &b.Banner}, {&a.Service, &b.Service}, {&a.Source, &b.Source},
+		{&a.Product, &b.Product}, {&a.Version, &b.Version}, {&a.CPE, &b.CPE}, {&a.Suspect, &b.Suspect},
+		{&a.MAC, &b.MAC}, {&a.MACVendor, &b.MACVendor},
+	} {
+		if *f.dst == "" {
+			*f.dst = *f.src
+		}
+	}
+	if a.ASN == 0 {
+		a.ASN = b.ASN
+	}
+	if a.SSH == nil {
+		a.SSH = b.SSH
+	}
+	if a.FTP == nil {
+		a.FTP = b.FTP
+	}
+	if a.SMTP == nil {
+		a.SMTP = b.SMTP
+	}
+	if a.Database == nil {
+		a.Database = b.Database
+	}
+	if a.Cache == nil {
+		a.Cache = b.Cache
+	}
+	if a.SMB == nil {
+		a.SMB = b.SMB
+	}
+	if a.RDP == nil {
+		a.RDP = b.RDP
+	}
+	if a.SNMP == nil {
+		a.SNMP = b.SNMP
+	}
+	if a.DNS == nil {
+		a.DNS = b.DNS
+	}
+	if a.NTP == nil {
+		a.NTP = b.NTP
+	}
+	if a.TLS == nil {
+		a.TLS = b.TLS
+	}
+	if a.QUIC == nil {
+		a.QUIC = b.QUIC
+	}
+	if a.HTTP == nil {
+		a.HTTP = b.HTTP
+	}
+	if a.Hints == nil {
+		a.Hints = b.Hints
+	}
+	if a.Tags == nil {
+		a.Tags = b.Tags
+	}
+	if a.Known == nil {
+		a.Known = b.Known
+	}
+	if a.Aliases == nil {
+		a.Aliases = b.Aliases
+	}
+	if a.Uptime == nil {
+		a.Uptime = b.Uptime
+	}
+	if len(b.Labels) > 0 {
+		labels := maps.Clone(b.Labels)
+		maps.Copy(labels, a.Labels)
+		a.Labels = labels
+	}
+	return a
+}
+
+// runMerge implements the "merge" subcommand, which combines result files
+// from partial or sharded runs into one
+func runMerge(args []string) int {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	outFile := flags.String("o", "", "Write the merged results to this file instead of stdout")
+	mergeFormat := flags.String("format", "json", "Output format: json (an array diff and report read back), or any scan -format")
+	quiet := flags.Bool("q", false, "Don't print the summary of the merged results")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner merge [-o file] [-format json|...] results...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// Read every state so that closed and filtered ports written with -state
+	// survive the merge
+	var sets [][]Result
+	for _, filename := range flags.Args() {
+		data, err := os.ReadFile(filename)
+		if err == nil {
+			var results []Result
+			if results, err = parseAllResults(data); err == nil {
+				sets = append(sets, results)
+				continue
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filename, err)
+		return 2
+	}
+	merged, stats := MergeResults(sets...)
+
+	var formatResult func(Result) string
+	if *mergeFormat != "json" {
+		var err error
+		if formatResult, err = NewFormatter(*mergeFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 2
+		}
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 2
+		}
+		out = f
+	}
+	err := writeMerged(out, merged, formatResult)
+	if f, ok := out.(*os.File); ok && f != os.Stdout {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing results: %v\n", err)
+		return 2
+	}
+
+	if !*quiet {
+		fmt.Fprintf(os.Stderr, "Merged %d file(s): %d result(s), %d duplicate(s) dropped\n",
+			len(sets), len(merged), stats.Duplicates)
+		var open []Result
+		for _, r := range merged {
+			if r.State == StateOpen {
+				open = append(open, r)
+			}
+		}
+		WriteReport(os.Stderr, BuildReport(open))
+	}
+	return 0
+}
+
+// writeMerged writes results as an indented JSON array, or one line each in
+// a scan output format
+func writeMerged(w io.Writer, results []Result, formatResult func(Result) string) error {
+	if formatResult == nil {
+		if results == nil {
+			results = []Result{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for _, r := range results {
+		if _, err := fmt.Fprintln(w, formatResult(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeResults(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	shard1 := []Result{
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22, Time: t0, Banner: "SSH-2.0-OpenSSH"},
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Time: t0, State: StateClosed},
+	}
+	shard2 := []Result{
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22, Time: t0.Add(time.Minute), Labels: map[string]string{"env": "prod"}},
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Time: t0.Add(time.Minute)},
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 443},
+	}
+	text := []Result{{Host: "10.0.0.2", IP: "10.0.0.2", Port: 443, State: StateFiltered}}
+
+	merged, stats := MergeResults(shard1, shard2, text)
+	expected := []Result{
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22, Time: t0.Add(time.Minute), Banner: "SSH-2.0-OpenSSH", Labels: map[string]string{"env": "prod"}},
+		{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Time: t0.Add(time.Minute)},
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 443},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("MergeResults() = %+v, expected %+v", merged, expected)
+	}
+	if stats.Duplicates != 3 {
+		t.Errorf("MergeResults() duplicates = %d, expected 3", stats.Duplicates)
+	}
+}
+
+func TestRunMerge(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	b := filepath.Join(dir, "b.json")
+	out := filepath.Join(dir, "combined.json")
+	os.WriteFile(a, []byte("10.0.0.1:22\n10.0.0.1:80\n"), 0o644)
+	os.WriteFile(b, []byte(`[{"host":"10.0.0.1","ip":"10.0.0.1","port":80},{"host":"10.0.0.2","ip":"10.0.0.2","port":443}]`), 0o644)
+
+	if got := runMerge([]string{"-q", "-o", out, a, b}); got != 0 {
+		t.Fatalf("runMerge() = %d, want 0", got)
+	}
+	results, err := ReadResultsFile(out)
+	if err != nil {
+		t.Fatalf("ReadResultsFile() error = %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.String())
+	}
+	if expected := []string{"10.0.0.1:22", "10.0.0.1:80", "10.0.0.2:443"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("merged results = %v, expected %v", got, expected)
+	}
+
+	if got := runMerge([]string{"-q", "-o", out, filepath.Join(dir, "missing.txt")}); got != 2 {
+		t.Errorf("runMerge() with a missing file = %d, want 2", got)
+	}
+	var empty []Result
+	data, _ := os.ReadFile(out)
+	if err := json.Unmarshal(data, &empty); err != nil {
+		t.Errorf("output was overwritten by a failed merge: %v", err)
+	}
+}
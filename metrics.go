@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metrics holds the process-wide scan counters exposed by the metrics endpoint
+var metrics = NewMetrics()
+
+// Metrics tracks probe and port counters for the Prometheus endpoint
+type Metrics struct {
+	probesSent atomic.Int64
+	inFlight   atomic.Int64
+	ports      [numPortStates]atomic.Int64
+	startTime  time.Time
+
+	mu     sync.Mutex
+	errors map[string]int64
+}
+
+// NewMetrics returns an empty set of counters starting now
+func NewMetrics() *Metrics {
+	return &Metrics{startTime: time.Now(), errors: make(map[string]int64)}
+}
+
+// ProbeStarted records a connection attempt that is now in flight
+func (m *Metrics) ProbeStarted() {
+	m.probesSent.Add(1)
+	m.inFlight.Add(1)
+}
+
+// ProbeFinished records the end of a connection attempt and its error kind, if any
+func (m *Metrics) ProbeFinished(errKind string) {
+	m.inFlight.Add(-1)
+	if errKind == "" {
+		return
+	}
+	m.mu.Lock()
+	m.errors[errKind]++
+	m.mu.Unlock()
+}
+
+// RecordState records the final state of a scanned port
+func (m *Metrics) RecordState(state PortState) {
+	m.ports[state].Add(1)
+}
+
+// MetricsSnapshot is a point-in-time copy of the counters
+type MetricsSnapshot struct {
+	ProbesSent int64
+	InFlight   int64
+	Ports      [numPortStates]int64
+	Errors     map[string]int64
+}
+
+// Snapshot copies the current counter values
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	snap := MetricsSnapshot{
+		ProbesSent: m.probesSent.Load(),
+		InFlight:   m.inFlight.Load(),
+		Errors:     make(map[string]int64),
+	}
+	for s := PortState(0); s < numPortStates; s++ {
+		snap.Ports[s] = m.ports[s].Load()
+	}
+	m.mu.Lock()
+	for kind, n := range m.errors {
+		snap.Errors[kind] = n
+	}
+	m.mu.Unlock()
+	return snap
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	snap := m.Snapshot()
+
+	fmt.Fprintf(&b, "# HELP pscanner_probes_sent_total Connection attempts made.\n")
+	fmt.Fprintf(&b, "# TYPE pscanner_probes_sent_total counter\n")
+	fmt.Fprintf(&b, "pscanner_probes_sent_total %d\n", snap.ProbesSent)
+
+	fmt.Fprintf(&b, "# HELP pscanner_ports_total Ports scanned by final state.\n")
+	fmt.Fprintf(&b, "# TYPE pscanner_ports_total counter\n")
+	var scanned int64
+	for s := PortState(0); s < numPortStates; s++ {
+		scanned += snap.Ports[s]
+		fmt.Fprintf(&b, "pscanner_ports_total{state=%q} %d\n", s.String(), snap.Ports[s])
+	}
+
+	fmt.Fprintf(&b, "# HELP pscanner_errors_total Failed connection attempts by error type.\n")
+	fmt.Fprintf(&b, "# TYPE pscanner_errors_total counter\n")
+	kinds := make([]string, 0, len(snap.Errors))
+	for kind := range snap.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "pscanner_errors_total{type=%q} %d\n", kind, snap.Errors[kind])
+	}
+
+	fmt.Fprintf(&b, "# HELP pscanner_inflight_connections Connection attempts currently in flight.\n")
+	fmt.Fprintf(&b, "# TYPE pscanner_inflight_connections gauge\n")
+	fmt.Fprintf(&b, "pscanner_inflight_connections %d\n", snap.InFlight)
+
+	rate := 0.0
+	if elapsed := time.Since(m.startTime).Seconds(); elapsed > 0 {
+		rate = float64(scanned) / elapsed
+	}
+	fmt.Fprintf(&b, "# HELP pscanner_scan_rate Ports scanned per second since start.\n")
+	fmt.Fprintf(&b, "# TYPE pscanner_scan_rate gauge\n")
+	fmt.Fprintf(&b, "pscanner_scan_rate %g\n", rate)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// ParseMetricsAddr splits a metrics spec like ":9090/metrics" into a listen
+// address and an HTTP path. The path defaults to /metrics.
+func ParseMetricsAddr(spec string) (string, string, error) {
+	addr, path := spec, "/metrics"
+	if i := strings.Index(spec, "/"); i >= 0 {
+		addr, path = spec[:i], spec[i:]
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return "", "", fmt.Errorf("invalid metrics address: %s", spec)
+	}
+	return addr, path, nil
+}
+
+// StartMetricsServer starts serving metrics in the background and returns
+// once the listener is ready
+func StartMetricsServer(spec string) error {
+	addr, path, err := ParseMetricsAddr(spec)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(path, metrics)
+	go http.Serve(ln, mux)
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMetricsAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		wantAddr string
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "Port with path",
+			spec:     ":9090/metrics",
+			wantAddr: ":9090",
+			wantPath: "/metrics",
+			wantErr:  false,
+		},
+		{
+			name:     "Port without path",
+			spec:     ":9090",
+			wantAddr: ":9090",
+			wantPath: "/metrics",
+			wantErr:  false,
+		},
+		{
+			name:     "Host with custom path",
+			spec:     "127.0.0.1:9100/scan/metrics",
+			wantAddr: "127.0.0.1:9100",
+			wantPath: "/scan/metrics",
+			wantErr:  false,
+		},
+		{
+			name:     "Missing port",
+			spec:     "localhost/metrics",
+			wantAddr: "",
+			wantPath: "",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, path, err := ParseMetricsAddr(tt.spec)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMetricsAddr() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if addr != tt.wantAddr || path != tt.wantPath {
+				t.Errorf("ParseMetricsAddr() = %q, %q, expected %q, %q", addr, path, tt.wantAddr, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestMetricsWriteTo(t *testing.T) {
+	m := NewMetrics()
+	m.ProbeStarted()
+	m.ProbeFinished("refused")
+	m.ProbeStarted()
+	m.ProbeFinished("")
+	m.RecordState(StateOpen)
+	m.RecordState(StateClosed)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	expected := []string{
+		"pscanner_probes_sent_total 2\n",
+		"pscanner_ports_total{state=\"open\"} 1\n",
+		"pscanner_ports_total{state=\"closed\"} 1\n",
+		"pscanner_ports_total{state=\"filtered\"} 0\n",
+		"pscanner_errors_total{type=\"refused\"} 1\n",
+		"pscanner_inflight_connections 0\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("WriteTo() output missing %q", line)
+		}
+	}
+}
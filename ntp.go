@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+)
+
+// NTPInfo is what an NTP server answered
+type NTPInfo struct {
+	Stratum int    `json:"stratum"`           // 1 for a server with its own reference clock, 2 and up for those synced to another
+	RefID   string `json:"refid,omitempty"`   // the clock it is synced to: a source such as "GPS" at stratum 1, an address above
+	System  string `json:"system,omitempty"`  // the "version" system variable, answered to a mode 6 read
+	Monlist bool   `json:"monlist,omitempty"` // answers the mode 7 monlist query used for traffic amplification
+}
+
+// ntpClientRequest is an NTPv4 client (mode 3) request with nothing set but
+// the version and mode, as sent by SNTP clients
+var ntpClientRequest = append([]byte{0x23}, make([]byte, 47)...)
+
+// ntpReadVariables is an NTPv2 control (mode 6) request to read the system
+// variables, which ntpd answers with its version among others
+var ntpReadVariables = []byte{0x16, 0x02, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// ntpMonlist is an NTPv2 private (mode 7) MON_GETLIST_1 request to the ntpd
+// implementation. A reply of any kind other than an error means the server
+// still lists its recent clients to anyone, a tiny request with a reply many
+// times its size.
+var ntpMonlist = append([]byte{0x17, 0x00, 0x03, 0x2a}, make([]byte, 44)...)
+
+// parseNTPReply is the Parse of the -udp ntp probe, checking for a server
+// (mode 4) reply
+func parseNTPReply(r *Result, request, reply []byte) bool {
+	if len(reply) < 48 || reply[0]&0x07 != 4 || reply[0]>>3&0x07 == 0 {
+		return false
+	}
+	info := &NTPInfo{Stratum: int(reply[1])}
+	switch refid := reply[12:16]; {
+	case info.Stratum == 0 || info.Stratum == 1: // a kiss code or the reference source
+		info.RefID = printable(bytes.TrimRight(refid, "\x00"))
+	case reply[0]>>3&0x07 <= 3 || !isZero(refid): // an IPv4 address, or a hash of an IPv6 one for NTPv4
+		info.RefID = net.IP(refid).String()
+	}
+	r.NTP, r.Service = info, "ntp"
+	return true
+}
+
+// isZero reports whether every byte of b is zero
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// followNTP reads the system variables of an NTP server that answered and
+// checks whether it answers monlist
+func followNTP(r *Result, exchange func(request []byte) ([]byte, error)) {
+	if reply, err := exchange(ntpReadVariables); err == nil {
+		r.NTP.System = parseNTPVariables(reply)["version"]
+		if r.Product == "" {
+			r.Product, r.Version = ntpProduct(r.NTP.System)
+		}
+	}
+	if reply, err := exchange(ntpMonlist); err == nil {
+		r.NTP.Monlist = isMonlistReply(reply)
+	}
+}
+
+// parseNTPVariables decodes the variables in a mode 6 read response, such as
+// version="ntpd 4.2.8p15@1.3728-o", processor="x86_64"
+func parseNTPVariables(reply []byte) map[string]string {
+	if len(reply) < 12 || reply[0]&0x07 != 6 || reply[1] != 0x82 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(reply[10:]))
+	data := reply[12:]
+	if count < len(data) {
+		data = data[:count]
+	}
+	vars := make(map[string]string)
+	for _, field := range splitNTPVariables(string(data)) {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		if name != "" {
+			vars[name] = printable([]byte(strings.Trim(value, `"`)))
+		}
+	}
+	return vars
+}
+
+// splitNTPVariables splits a variable list on the commas outside quotes
+func splitNTPVariables(data string) []string {
+	var fields []string
+	start, quoted := 0, false
+	for i, c := range data {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			fields = append(fields, data[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, data[start:])
+}
+
+// ntpProduct splits the version variable, such as
+// "ntpd 4.2.8p15@1.3728-o Wed Sep 23 11:46:38 UTC 2020 (1)", into product and
+// version
+func ntpProduct(system string) (product, version string) {
+	fields := strings.Fields(system)
+	switch len(fields) {
+	case 0:
+		return "", ""
+	case 1:
+		return fields[0], ""
+	}
+	version, _, _ = strings.Cut(fields[1], "@")
+	return fields[0], version
+}
+
+// isMonlistReply reports whether a reply to ntpMonlist is a response without
+// an error
+func isMonlistReply(reply []byte) bool {
+	return len(reply) >= 8 && reply[0]&0x80 != 0 && reply[0]&0x07 == 7 && reply[3] == 0x2a && reply[4]>>4 == 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ntpServerReply is a server (mode 4) reply of the given version, stratum and
+// reference ID
+func ntpServerReply(version, stratum byte, refid string) []byte {
+	reply := make([]byte, 48)
+	reply[0], reply[1] = version<<3|4, stratum
+	copy(reply[12:16], refid)
+	return reply
+}
+
+// ntpVariablesReply is a mode 6 read response carrying data
+func ntpVariablesReply(data string) []byte {
+	reply := []byte{0x16, 0x82, 0, 1, 0, 0, 0, 0, 0, 0}
+	reply = binary.BigEndian.AppendUint16(reply, uint16(len(data)))
+	return append(reply, data...)
+}
+
+func TestParseNTPReply(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		want  *NTPInfo
+	}{
+		{"Stratum 1", ntpServerReply(4, 1, "GPS\x00"), &NTPInfo{Stratum: 1, RefID: "GPS"}},
+		{"Stratum 2", ntpServerReply(4, 2, "\xc0\x00\x02\x01"), &NTPInfo{Stratum: 2, RefID: "192.0.2.1"}},
+		{"Unsynchronized", ntpServerReply(4, 0, "INIT"), &NTPInfo{Stratum: 0, RefID: "INIT"}},
+		{"Client request", ntpClientRequest, nil},
+		{"Short", ntpServerReply(4, 2, "")[:20], nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r Result
+			ok := parseNTPReply(&r, ntpClientRequest, tt.reply)
+			if ok != (tt.want != nil) || !reflect.DeepEqual(r.NTP, tt.want) {
+				t.Errorf("parseNTPReply() = %v, %+v, expected %+v", ok, r.NTP, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNTPVariables(t *testing.T) {
+	got := parseNTPVariables(ntpVariablesReply(`version="ntpd 4.2.8p15@1.3728-o Wed Sep 23 2020 (1)", processor="x86_64",` + "\r\n" + `stratum=2`))
+	want := map[string]string{"version": "ntpd 4.2.8p15@1.3728-o Wed Sep 23 2020 (1)", "processor": "x86_64", "stratum": "2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNTPVariables() = %q, expected %q", got, want)
+	}
+	if product, version := ntpProduct(want["version"]); product != "ntpd" || version != "4.2.8p15" {
+		t.Errorf("ntpProduct() = %q, %q, expected ntpd 4.2.8p15", product, version)
+	}
+}
+
+func TestProbeUDPNTP(t *testing.T) {
+	tests := []struct {
+		name    string
+		monlist []byte
+		want    *NTPInfo
+	}{
+		{"Answers monlist", []byte{0x97, 0x00, 0x03, 0x2a, 0x00, 0x06, 0x00, 0x48}, &NTPInfo{Stratum: 2, RefID: "192.0.2.1", System: "ntpd 4.2.6p5@1.2349-o", Monlist: true}},
+		{"Refuses monlist", []byte{0x97, 0x00, 0x03, 0x2a, 0x40, 0x00, 0x00, 0x00}, &NTPInfo{Stratum: 2, RefID: "192.0.2.1", System: "ntpd 4.2.6p5@1.2349-o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := udpAgent(t, func(request []byte) []byte {
+				switch {
+				case bytes.Equal(request, ntpClientRequest):
+					return ntpServerReply(4, 2, "\xc0\x00\x02\x01")
+				case bytes.Equal(request, ntpReadVariables):
+					return ntpVariablesReply(`version="ntpd 4.2.6p5@1.2349-o"`)
+				case bytes.Equal(request, ntpMonlist):
+					return tt.monlist
+				}
+				return nil
+			})
+			probe := udpProbes["ntp"]
+			probe.Port = port
+			r, ok := probeUDP(context.Background(), "127.0.0.1", probe, ProbeConfig{Timeout: time.Second, Retries: 1})
+			if !ok || r.Service != "ntp" || !reflect.DeepEqual(r.NTP, tt.want) || r.Product != "ntpd" || r.Version != "4.2.6p5" {
+				t.Errorf("probeUDP() = %+v, ntp %+v, expected %+v", r, r.NTP, tt.want)
+			}
+			if got := len(serviceFindings(r)) > 0; got != tt.want.Monlist {
+				t.Errorf("serviceFindings() = %q, expected a finding: %v", serviceFindings(r), tt.want.Monlist)
+			}
+		})
+	}
+}
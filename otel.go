@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The types below follow the OTLP/HTTP JSON encoding closely enough for
+// collectors to accept them, without pulling in the OpenTelemetry SDK.
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *int64   `json:"intValue,omitempty,string"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        int64           `json:"startTimeUnixNano,string"`
+	End          int64           `json:"endTimeUnixNano,string"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpDataPoint struct {
+	Start      int64           `json:"startTimeUnixNano,string"`
+	Time       int64           `json:"timeUnixNano,string"`
+	AsInt      *int64          `json:"asInt,omitempty,string"`
+	AsDouble   *float64        `json:"asDouble,omitempty"`
+	Attributes []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpMetrics struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+const (
+	otlpSpanKindInternal      = 1
+	otlpSpanKindClient        = 3
+	otlpTemporalityCumulative = 2
+)
+
+func stringAttr(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int64) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &value}}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var otlpServiceResource = otlpResource{Attributes: []otlpAttribute{stringAttr("service.name", "pscanner")}}
+
+// BuildTraces creates a root span for the scan and one child span per host
+func BuildTraces(stats *Stats, end time.Time) otlpTraces {
+	traceID := randomID(16)
+	rootID := randomID(8)
+	scanned, openPorts, _ := stats.GetStats()
+
+	spans := []otlpSpan{{
+		TraceID: traceID,
+		SpanID:  rootID,
+		Name:    "scan",
+		Kind:    otlpSpanKindInternal,
+		Start:   stats.startTime.UnixNano(),
+		End:     end.UnixNano(),
+		Attributes: []otlpAttribute{
+			intAttr("pscanner.ports.scanned", int64(scanned)),
+			intAttr("pscanner.ports.open", int64(openPorts)),
+		},
+	}}
+
+	hostStats := stats.HostStats()
+	hosts := make([]string, 0, len(hostStats))
+	for h := range hostStats {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		hs := hostStats[h]
+		spans = append(spans, otlpSpan{
+			TraceID:      traceID,
+			SpanID:       randomID(8),
+			ParentSpanID: rootID,
+			Name:         "scan host",
+			Kind:         otlpSpanKindClient,
+			Start:        hs.Start.UnixNano(),
+			End:          hs.End.UnixNano(),
+			Attributes: []otlpAttribute{
+				stringAttr("server.address", h),
+				intAttr("pscanner.ports.scanned", int64(hs.Ports)),
+				intAttr("pscanner.ports.open", int64(hs.States[StateOpen])),
+				intAttr("pscanner.ports.closed", int64(hs.States[StateClosed])),
+				intAttr("pscanner.ports.filtered", int64(hs.States[StateFiltered])),
+				intAttr("pscanner.probe_time_ms", hs.ProbeTime.Milliseconds()),
+				intAttr("pscanner.dns_time_ms", hs.DNSTime.Milliseconds()),
+			},
+		})
+	}
+
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpServiceResource,
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "pscanner"}, Spans: spans}},
+	}}}
+}
+
+// BuildMetrics converts the process-wide counters into OTLP metrics
+func BuildMetrics(snap MetricsSnapshot, start, end time.Time) otlpMetrics {
+	point := func(v int64, attrs ...otlpAttribute) otlpDataPoint {
+		return otlpDataPoint{Start: start.UnixNano(), Time: end.UnixNano(), AsInt: &v, Attributes: attrs}
+	}
+	counter := func(name, unit string, points ...otlpDataPoint) otlpMetric {
+		return otlpMetric{Name: name, Unit: unit, Sum: &otlpSum{
+			DataPoints:             points,
+			AggregationTemporality: otlpTemporalityCumulative,
+			IsMonotonic:            true,
+		}}
+	}
+
+	var portPoints []otlpDataPoint
+	var scanned int64
+	for s := PortState(0); s < numPortStates; s++ {
+		scanned += snap.Ports[s]
+		portPoints = append(portPoints, point(snap.Ports[s], stringAttr("state", s.String())))
+	}
+	kinds := make([]string, 0, len(snap.Errors))
+	for kind := range snap.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	var errorPoints []otlpDataPoint
+	for _, kind := range kinds {
+		errorPoints = append(errorPoints, point(snap.Errors[kind], stringAttr("type", kind)))
+	}
+
+	rate := 0.0
+	if elapsed := end.Sub(start).Seconds(); elapsed > 0 {
+		rate = float64(scanned) / elapsed
+	}
+
+	list := []otlpMetric{
+		counter("pscanner.probes.sent", "{probe}", point(snap.ProbesSent)),
+		counter("pscanner.ports", "{port}", portPoints...),
+		{Name: "pscanner.scan.rate", Unit: "{port}/s", Gauge: &otlpGauge{DataPoints: []otlpDataPoint{
+			{Start: start.UnixNano(), Time: end.UnixNano(), AsDouble: &rate},
+		}}},
+	}
+	if len(errorPoints) > 0 {
+		list = append(list, counter("pscanner.errors", "{error}", errorPoints...))
+	}
+
+	return otlpMetrics{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpServiceResource,
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "pscanner"}, Metrics: list}},
+	}}}
+}
+
+func postOTLP(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// ExportTelemetry sends the scan's traces and metrics to an OTLP/HTTP endpoint
+func ExportTelemetry(endpoint string, stats *Stats, end time.Time) error {
+	base := strings.TrimRight(endpoint, "/")
+	if err := postOTLP(base+"/v1/traces", BuildTraces(stats, end)); err != nil {
+		return err
+	}
+	return postOTLP(base+"/v1/metrics", BuildMetrics(metrics.Snapshot(), stats.startTime, end))
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTraces(t *testing.T) {
+	start := time.Now()
+	stats := &Stats{startTime: start}
+	stats.RecordProbe("10.0.0.1", StateOpen, nil, start, 10*time.Millisecond)
+	stats.RecordProbe("10.0.0.1", StateClosed, nil, start.Add(5*time.Millisecond), 10*time.Millisecond)
+	stats.RecordProbe("10.0.0.2", StateFiltered, nil, start, 500*time.Millisecond)
+
+	traces := BuildTraces(stats, start.Add(time.Second))
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 3 {
+		t.Fatalf("BuildTraces() returned %d spans, expected 3", len(spans))
+	}
+	for _, span := range spans[1:] {
+		if span.ParentSpanID != spans[0].SpanID || span.TraceID != spans[0].TraceID {
+			t.Errorf("host span %q is not a child of the scan span", span.Name)
+		}
+	}
+	if got := spans[1].End - spans[1].Start; got != int64(15*time.Millisecond) {
+		t.Errorf("host span duration = %v, expected 15ms", time.Duration(got))
+	}
+
+	body, err := json.Marshal(traces)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(body), `"intValue":"1"`) {
+		t.Errorf("integer attributes must be encoded as strings: %s", body)
+	}
+}
+
+func TestBuildMetrics(t *testing.T) {
+	snap := MetricsSnapshot{ProbesSent: 7, Errors: map[string]int64{"timeout": 3}}
+	snap.Ports[StateOpen] = 2
+
+	start := time.Now()
+	m := BuildMetrics(snap, start, start.Add(2*time.Second))
+	names := map[string]bool{}
+	for _, metric := range m.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		names[metric.Name] = true
+	}
+	for _, name := range []string{"pscanner.probes.sent", "pscanner.ports", "pscanner.scan.rate", "pscanner.errors"} {
+		if !names[name] {
+			t.Errorf("BuildMetrics() missing metric %s", name)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lockedWriter serializes writes to w; writers sharing mu never interleave
+// their output
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (l lockedWriter) Write(data []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(data)
+}
+
+// outputFlushInterval is how often buffered -o lines are written to the file
+const outputFlushInterval = time.Second
+
+// OutputFile is the -o file. Lines are buffered but flushed every interval,
+// so the file keeps up with what was printed even if the process is killed,
+// and synced to disk on Close. A nil *OutputFile discards everything.
+type OutputFile struct {
+	mu     sync.Mutex
+	file   *os.File
+	w      *bufio.Writer
+	err    error // first write error
+	stop   chan struct{}
+	closed bool
+}
+
+// OpenOutputFile creates the output file, or appends to it if appendTo is
+// set, and starts flushing it every interval
+func OpenOutputFile(path string, appendTo bool, interval time.Duration) (*OutputFile, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	o := &OutputFile{file: file, w: bufio.NewWriter(file), stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.Flush()
+			case <-o.stop:
+				return
+			}
+		}
+	}()
+	return o, nil
+}
+
+// WriteString buffers a line; errors are kept for Flush and Close to report
+func (o *OutputFile) WriteString(s string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, err := o.w.WriteString(s); err != nil && o.err == nil {
+		o.err = err
+	}
+}
+
+// Flush writes the buffered lines to the file
+func (o *OutputFile) Flush() error {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.flush()
+}
+
+func (o *OutputFile) flush() error {
+	if o.closed {
+		return nil
+	}
+	if err := o.w.Flush(); err != nil && o.err == nil {
+		o.err = err
+	}
+	return o.err
+}
+
+// Close flushes, syncs and closes the file. Only the first call does
+// anything, so it can be both deferred and called to check the error.
+func (o *OutputFile) Close() error {
+	if o == nil {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil
+	}
+	close(o.stop)
+	err := o.flush()
+	if syncErr := o.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	o.closed = true
+	return err
+}
+
+// Formatter renders one result as a line of output
+type Formatter func(r Result) string
+
+// NewFormatter returns the formatter for an output format: "text" (ip:port),
+// "cef" (ArcSight Common Event Format) or "leef" (QRadar Log Event Extended
+// Format)
+func NewFormatter(format string) (Formatter, error) {
+	switch format {
+	case "text", "":
+		return Result.String, nil
+	case "cef":
+		return FormatCEF, nil
+	case "leef":
+		return FormatLEEF, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (use text, cef or leef)", format)
+}
+
+// eventClass is the event ID of a result in CEF and LEEF, e.g. "open-port"
+func eventClass(s PortState) string {
+	return s.String() + "-port"
+}
+
+// eventName is the human-readable CEF event name, e.g. "Open TCP port"
+func eventName(r Result) string {
+	name := r.State.String()
+	return strings.ToUpper(name[:1]) + name[1:] + " " + strings.ToUpper(cmp.Or(r.Transport, "tcp")) + " port"
+}
+
+// eventSeverity is the CEF severity: an open port is worth a look, a closed
+// or filtered one is informational
+func eventSeverity(s PortState) string {
+	if s == StateOpen {
+		return "3"
+	}
+	return "1"
+}
+
+// cefHeaderEscaper escapes the characters that are special in CEF header fields
+var cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+
+// cefValueEscaper escapes the characters that are special in CEF extension values
+var cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+
+// FormatCEF renders a result as a CEF:0 event
+func FormatCEF(r Result) string {
+	var ext []string
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefValueEscaper.Replace(value))
+		}
+	}
+	add("rt", strconv.FormatInt(r.Time.UnixMilli(), 10))
+	add("dst", r.IP)
+	add("dpt", strconv.Itoa(r.Port))
+	add("proto", strings.ToUpper(cmp.Or(r.Transport, "tcp")))
+	if r.Host != r.IP {
+		add("dhost", r.Host)
+	}
+	add("dmac", r.MAC)
+	if r.Org != "" {
+		add("cs1Label", "Organization")
+		add("cs1", r.Org)
+	}
+	if r.Country != "" {
+		add("cs2Label", "Country")
+		add("cs2", r.Country)
+	}
+	if r.ASN != 0 {
+		add("cn1Label", "ASN")
+		add("cn1", strconv.FormatUint(uint64(r.ASN), 10))
+	}
+	if len(r.Labels) > 0 {
+		add("cs3Label", "Labels")
+		add("cs3", formatLabels(r.Labels))
+	}
+
+	header := []string{"CEF:0", "pscanner", "pscanner", version, eventClass(r.State), eventName(r), eventSeverity(r.State)}
+	for i := 1; i < len(header); i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(ext, " ")
+}
+
+// leefTimeFormat is the Go layout of the devTimeFormat sent with every event
+const (
+	leefTimeFormat    = "Jan 02 2006 15:04:05.000 MST"
+	leefDevTimeFormat = "MMM dd yyyy HH:mm:ss.SSS z"
+)
+
+// leefValueCleaner keeps attribute values from breaking the tab-delimited layout
+var leefValueCleaner = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+// FormatLEEF renders a result as a tab-delimited LEEF:2.0 event
+func FormatLEEF(r Result) string {
+	var attrs []string
+	add := func(key, value string) {
+		if value != "" {
+			attrs = append(attrs, key+"="+leefValueCleaner.Replace(value))
+		}
+	}
+	add("cat", eventClass(r.State))
+	add("devTime", r.Time.UTC().Format(leefTimeFormat))
+	add("devTimeFormat", leefDevTimeFormat)
+	add("dst", r.IP)
+	add("dstPort", strconv.Itoa(r.Port))
+	add("proto", strings.ToUpper(cmp.Or(r.Transport, "tcp")))
+	if r.Host != r.IP {
+		add("dstName", r.Host)
+	}
+	add("dstMAC", r.MAC)
+	add("org", r.Org)
+	add("country", r.Country)
+	if r.ASN != 0 {
+		add("asn", strconv.FormatUint(uint64(r.ASN), 10))
+	}
+	if len(r.Labels) > 0 {
+		add("labels", formatLabels(r.Labels))
+	}
+
+	// The delimiter field (x09, a tab) is optional but spelled out for
+	// parsers that do not default it
+	header := strings.Join([]string{"LEEF:2.0", "pscanner", "pscanner", version, eventClass(r.State), "x09"}, "|")
+	return header + "|" + strings.Join(attrs, "\t")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFormatCEF(t *testing.T) {
+	at := time.UnixMilli(1700000000123)
+	tests := []struct {
+		name     string
+		result   Result
+		expected string
+	}{
+		{
+			name:     "IP only",
+			result:   Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22, Time: at},
+			expected: "CEF:0|pscanner|pscanner|dev|open-port|Open TCP port|3|rt=1700000000123 dst=10.0.0.1 dpt=22 proto=TCP",
+		},
+		{
+			name:     "Hostname and enrichment",
+			result:   Result{Host: "example.com", IP: "93.184.216.34", Port: 443, Time: at, Org: "Edge=Cast\\Inc", Country: "US", ASN: 15133},
+			expected: `CEF:0|pscanner|pscanner|dev|open-port|Open TCP port|3|rt=1700000000123 dst=93.184.216.34 dpt=443 proto=TCP dhost=example.com cs1Label=Organization cs1=Edge\=Cast\\Inc cs2Label=Country cs2=US cn1Label=ASN cn1=15133`,
+		},
+		{
+			name:     "Labels",
+			result:   Result{Host: "10.0.0.5", IP: "10.0.0.5", Port: 22, Time: at, Labels: map[string]string{"team": "payments", "env": "prod"}},
+			expected: `CEF:0|pscanner|pscanner|dev|open-port|Open TCP port|3|rt=1700000000123 dst=10.0.0.5 dpt=22 proto=TCP cs3Label=Labels cs3=env\=prod,team\=payments`,
+		},
+		{
+			name:     "Filtered port",
+			result:   Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 25, Time: at, State: StateFiltered},
+			expected: "CEF:0|pscanner|pscanner|dev|filtered-port|Filtered TCP port|1|rt=1700000000123 dst=10.0.0.1 dpt=25 proto=TCP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatCEF(tt.result); got != tt.expected {
+				t.Errorf("FormatCEF() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatLEEF(t *testing.T) {
+	at := time.Date(2024, 3, 5, 14, 7, 9, 250e6, time.FixedZone("CET", 3600))
+	tests := []struct {
+		name     string
+		result   Result
+		expected string
+	}{
+		{
+			name:   "IP only",
+			result: Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22, Time: at},
+			expected: "LEEF:2.0|pscanner|pscanner|dev|open-port|x09|cat=open-port\tdevTime=Mar 05 2024 13:07:09.250 UTC\t" +
+				"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tdst=10.0.0.1\tdstPort=22\tproto=TCP",
+		},
+		{
+			name:   "Hostname and enrichment",
+			result: Result{Host: "example.com", IP: "93.184.216.34", Port: 443, Time: at, Org: "Edge\tCast", ASN: 15133},
+			expected: "LEEF:2.0|pscanner|pscanner|dev|open-port|x09|cat=open-port\tdevTime=Mar 05 2024 13:07:09.250 UTC\t" +
+				"devTimeFormat=MMM dd yyyy HH:mm:ss.SSS z\tdst=93.184.216.34\tdstPort=443\tproto=TCP\tdstName=example.com\torg=Edge Cast\tasn=15133",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatLEEF(tt.result); got != tt.expected {
+				t.Errorf("FormatLEEF() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewFormatter(t *testing.T) {
+	r := Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80}
+	for _, format := range []string{"", "text"} {
+		f, err := NewFormatter(format)
+		if err != nil {
+			t.Fatalf("NewFormatter(%q) error: %v", format, err)
+		}
+		if got := f(r); got != "10.0.0.1:80" {
+			t.Errorf("NewFormatter(%q) rendered %q", format, got)
+		}
+	}
+	if _, err := NewFormatter("xml"); err == nil {
+		t.Error("NewFormatter(\"xml\") expected an error")
+	}
+}
+
+func TestResultString(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   Result
+		expected string
+	}{
+		{name: "Address", result: Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22}, expected: "10.0.0.1:22"},
+		{name: "Hostname", result: Result{Host: "example.com", IP: "93.184.216.34", Port: 443}, expected: "example.com (93.184.216.34):443"},
+		{name: "Hostname closed", result: Result{Host: "example.com", IP: "93.184.216.34", Port: 25, State: StateClosed}, expected: "example.com (93.184.216.34):25 closed"},
+		{name: "No host", result: Result{IP: "10.0.0.1", Port: 80, State: StateFiltered}, expected: "10.0.0.1:80 filtered"},
+		{name: "Reprobed", result: Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Answered: 5, Attempts: 5}, expected: "10.0.0.1:80"},
+		{name: "Flapping", result: Result{Host: "lb.example.com", IP: "10.0.0.1", Port: 443, Answered: 3, Attempts: 5}, expected: "lb.example.com (10.0.0.1):443 (3/5)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.result.String()
+			if got != tt.expected {
+				t.Errorf("String() = %q, expected %q", got, tt.expected)
+			}
+			parsed, err := parseTextResult(got)
+			if err != nil || parsed.IP != tt.result.IP || parsed.Port != tt.result.Port || parsed.State != tt.result.State ||
+				parsed.Flapping() != tt.result.Flapping() {
+				t.Errorf("parseTextResult(%q) = %+v, %v", got, parsed, err)
+			}
+		})
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.txt")
+	read := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	out, err := OpenOutputFile(path, false, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString("10.0.0.1:22\n")
+	// The periodic flush writes the line without waiting for Close
+	deadline := time.Now().Add(2 * time.Second)
+	for read() != "10.0.0.1:22\n" {
+		if time.Now().After(deadline) {
+			t.Fatalf("output file = %q before Close, expected the line to be flushed", read())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	out.WriteString("10.0.0.1:80\n")
+	if err := out.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Errorf("second Close() = %v, expected nil", err)
+	}
+	out.WriteString("ignored\n")
+	if got := read(); got != "10.0.0.1:22\n10.0.0.1:80\n" {
+		t.Errorf("output file = %q", got)
+	}
+
+	// Appending keeps what a resumed scan found before
+	out, err = OpenOutputFile(path, true, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.WriteString("10.0.0.2:443\n")
+	out.Close()
+	if got := read(); got != "10.0.0.1:22\n10.0.0.1:80\n10.0.0.2:443\n" {
+		t.Errorf("appended output file = %q", got)
+	}
+
+	var none *OutputFile
+	none.WriteString("x")
+	if none.Flush() != nil || none.Close() != nil {
+		t.Error("a nil OutputFile should discard writes without errors")
+	}
+}
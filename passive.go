@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Passive enrichment asks Shodan or Censys what they have already seen on a
+// host, so the live scan can be compared with what the internet sees.
+
+var (
+	shodanBaseURL = "https://api.shodan.io"
+	censysBaseURL = "https://search.censys.io/api"
+)
+
+// KnownService is a service a passive data source has observed on a host
+type KnownService struct {
+	Source    string `json:"source"`
+	Port      int    `json:"port"`
+	Transport string `json:"transport,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Product   string `json:"product,omitempty"`
+}
+
+// hostInfo is what a passive source knows about one address
+type hostInfo struct {
+	tags     []string
+	services []KnownService
+}
+
+// PassiveSource attaches the services and tags a lookup function reports for
+// each host. Each address is looked up once, however many ports are open.
+type PassiveSource struct {
+	fetch func(ip string) (*hostInfo, error)
+
+	mu    sync.Mutex
+	hosts map[string]*hostResult
+}
+
+type hostResult struct {
+	once sync.Once
+	info *hostInfo
+}
+
+func newPassiveSource(fetch func(ip string) (*hostInfo, error)) *PassiveSource {
+	return &PassiveSource{fetch: fetch, hosts: make(map[string]*hostResult)}
+}
+
+// Enrich adds the host's known services and tags to a result
+func (p *PassiveSource) Enrich(r *Result, probe ProbeConfig) {
+	p.mu.Lock()
+	h := p.hosts[r.IP]
+	if h == nil {
+		h = &hostResult{}
+		p.hosts[r.IP] = h
+	}
+	p.mu.Unlock()
+
+	h.once.Do(func() {
+		info, err := p.fetch(r.IP)
+		if err != nil {
+			slog.Warn("enrichment lookup failed", "err", err)
+			return
+		}
+		h.info = info
+	})
+	if h.info == nil {
+		return
+	}
+	r.Known = append(r.Known, h.info.services...)
+	for _, tag := range h.info.tags {
+		if !containsString(r.Tags, tag) {
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+	sort.Strings(r.Tags)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var passiveClient = &http.Client{Timeout: 20 * time.Second}
+
+// getJSON fetches a URL and decodes the JSON response. A 404 means the
+// source has no data and yields found == false.
+func getJSON(req *http.Request, v any) (found bool, err error) {
+	resp, err := passiveClient.Do(req)
+	if err != nil {
+		// Drop the URL from the error; it can contain the API key
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return true, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// NewShodan returns a source backed by the Shodan host API
+func NewShodan(apiKey string) *PassiveSource {
+	return newPassiveSource(func(ip string) (*hostInfo, error) {
+		req, err := http.NewRequest(http.MethodGet, shodanBaseURL+"/shodan/host/"+ip+"?key="+url.QueryEscape(apiKey), nil)
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+			Data []struct {
+				Port      int    `json:"port"`
+				Transport string `json:"transport"`
+				Product   string `json:"product"`
+				Shodan    struct {
+					Module string `json:"module"`
+				} `json:"_shodan"`
+			} `json:"data"`
+		}
+		found, err := getJSON(req, &body)
+		if err != nil {
+			return nil, fmt.Errorf("shodan lookup for %s: %v", ip, err)
+		}
+		info := &hostInfo{}
+		if !found {
+			return info, nil
+		}
+		info.tags = body.Tags
+		for _, d := range body.Data {
+			info.services = append(info.services, KnownService{
+				Source: "shodan", Port: d.Port, Transport: d.Transport, Service: d.Shodan.Module, Product: d.Product,
+			})
+		}
+		return info, nil
+	})
+}
+
+// NewCensys returns a source backed by the Censys hosts API
+func NewCensys(apiID, apiSecret string) *PassiveSource {
+	return newPassiveSource(func(ip string) (*hostInfo, error) {
+		req, err := http.NewRequest(http.MethodGet, censysBaseURL+"/v2/hosts/"+ip, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(apiID, apiSecret)
+		var body struct {
+			Result struct {
+				Labels   []string `json:"labels"`
+				Services []struct {
+					Port              int    `json:"port"`
+					ServiceName       string `json:"service_name"`
+					TransportProtocol string `json:"transport_protocol"`
+					Software          []struct {
+						Product string `json:"product"`
+					} `json:"software"`
+				} `json:"services"`
+			} `json:"result"`
+		}
+		found, err := getJSON(req, &body)
+		if err != nil {
+			return nil, fmt.Errorf("censys lookup for %s: %v", ip, err)
+		}
+		info := &hostInfo{}
+		if !found {
+			return info, nil
+		}
+		info.tags = body.Result.Labels
+		for _, s := range body.Result.Services {
+			svc := KnownService{
+				Source: "censys", Port: s.Port, Transport: strings.ToLower(s.TransportProtocol), Service: strings.ToLower(s.ServiceName),
+			}
+			if len(s.Software) > 0 {
+				svc.Product = s.Software[0].Product
+			}
+			info.services = append(info.services, svc)
+		}
+		return info, nil
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShodanEnrich(t *testing.T) {
+	var queries atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		if r.URL.Query().Get("key") != "test-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/shodan/host/192.0.2.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"tags": ["cloud"], "data": [
+			{"port": 22, "transport": "tcp", "product": "OpenSSH", "_shodan": {"module": "ssh"}},
+			{"port": 443, "transport": "tcp", "_shodan": {"module": "https"}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	originalBase := shodanBaseURL
+	shodanBaseURL = ts.URL
+	defer func() { shodanBaseURL = originalBase }()
+
+	shodan := NewShodan("test-key")
+	for _, port := range []int{22, 8080} {
+		r := Result{IP: "192.0.2.1", Port: port}
+		shodan.Enrich(&r, ProbeConfig{})
+		if !reflect.DeepEqual(r.Tags, []string{"cloud"}) {
+			t.Errorf("Tags = %v, expected [cloud]", r.Tags)
+		}
+		expected := []KnownService{
+			{Source: "shodan", Port: 22, Transport: "tcp", Service: "ssh", Product: "OpenSSH"},
+			{Source: "shodan", Port: 443, Transport: "tcp", Service: "https"},
+		}
+		if !reflect.DeepEqual(r.Known, expected) {
+			t.Errorf("Known = %+v, expected %+v", r.Known, expected)
+		}
+	}
+
+	unknown := Result{IP: "198.51.100.1", Port: 80}
+	shodan.Enrich(&unknown, ProbeConfig{})
+	if unknown.Tags != nil || unknown.Known != nil {
+		t.Errorf("Enrich() of an unknown host = %+v, expected nothing added", unknown)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("made %d Shodan queries, expected 2 (one per host)", n)
+	}
+}
+
+func TestCensysEnrich(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"result": {"labels": ["remote-access"], "services": [
+			{"port": 3389, "service_name": "RDP", "transport_protocol": "TCP", "software": [{"product": "windows"}]}
+		]}}`))
+	}))
+	defer ts.Close()
+
+	originalBase := censysBaseURL
+	censysBaseURL = ts.URL
+	defer func() { censysBaseURL = originalBase }()
+
+	r := Result{IP: "192.0.2.1", Port: 3389}
+	NewCensys("id", "secret").Enrich(&r, ProbeConfig{})
+	expected := []KnownService{{Source: "censys", Port: 3389, Transport: "tcp", Service: "rdp", Product: "windows"}}
+	if !reflect.DeepEqual(r.Known, expected) || !reflect.DeepEqual(r.Tags, []string{"remote-access"}) {
+		t.Errorf("Enrich() = %+v", r)
+	}
+
+	failed := Result{IP: "192.0.2.1", Port: 3389}
+	NewCensys("id", "wrong").Enrich(&failed, ProbeConfig{})
+	if failed.Known != nil {
+		t.Errorf("Enrich() with bad credentials added %+v", failed.Known)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Pauser lets a running scan be paused and resumed. Workers call Wait
+// before each probe, so probes in flight finish but no new ones start.
+type Pauser struct {
+	mu      sync.Mutex
+	resumed chan struct{} // nil while running, closed on resume
+}
+
+// Toggle pauses a running scan or resumes a paused one and reports whether
+// it is now paused
+func (p *Pauser) Toggle() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		close(p.resumed)
+		p.resumed = nil
+		return false
+	}
+	p.resumed = make(chan struct{})
+	return true
+}
+
+// Paused reports whether the scan is paused
+func (p *Pauser) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// Wait blocks while the scan is paused or until ctx is cancelled
+func (p *Pauser) Wait(ctx context.Context) {
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
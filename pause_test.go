@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPauser(t *testing.T) {
+	var p Pauser
+	ctx := context.Background()
+
+	// Running: Wait returns at once
+	p.Wait(ctx)
+
+	if !p.Toggle() || !p.Paused() {
+		t.Fatal("Toggle() should pause a running scan")
+	}
+	waited := make(chan struct{})
+	go func() {
+		p.Wait(ctx)
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if p.Toggle() || p.Paused() {
+		t.Fatal("Toggle() should resume a paused scan")
+	}
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return after resuming")
+	}
+
+	// Cancelling the scan releases paused workers
+	p.Toggle()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	p.Wait(cancelled)
+}
+
+func TestRunJobsPaused(t *testing.T) {
+	pause := &Pauser{}
+	pause.Toggle()
+	stats := &Stats{startTime: time.Now()}
+	finished := make(chan struct{})
+	go func() {
+		RunScan(context.Background(), []string{"127.0.0.1"}, []int{1, 2}, ScanOptions{Workers: 1, Probe: quickProbe, Pause: pause}, stats, func(Result) {})
+		close(finished)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if scanned, _, _ := stats.GetStats(); scanned != 0 {
+		t.Fatalf("paused scan probed %d ports", scanned)
+	}
+	pause.Toggle()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scan did not finish after resuming")
+	}
+	if scanned, _, _ := stats.GetStats(); scanned != 2 {
+		t.Errorf("resumed scan probed %d ports, expected 2", scanned)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyPause does nothing: Windows has no SIGUSR1, so only the p key pauses
+func notifyPause(c chan<- os.Signal) {}
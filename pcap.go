@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// pcapLinkEthernet is the pcap link type for Ethernet frames
+const pcapLinkEthernet = 1
+
+// PcapWriter writes packets in the classic libpcap file format, readable by
+// tcpdump and Wireshark
+type PcapWriter struct {
+	w io.Writer
+}
+
+// NewPcapWriter writes the file header and returns a writer for packets
+func NewPcapWriter(w io.Writer, linkType uint32) (*PcapWriter, error) {
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4) // magic, microsecond timestamps
+	binary.LittleEndian.PutUint16(header[4:], 2)          // major version
+	binary.LittleEndian.PutUint16(header[6:], 4)          // minor version
+	binary.LittleEndian.PutUint32(header[16:], 65535)     // snapshot length
+	binary.LittleEndian.PutUint32(header[20:], linkType)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &PcapWriter{w: w}, nil
+}
+
+// WritePacket appends one captured frame
+func (p *PcapWriter) WritePacket(t time.Time, frame []byte) error {
+	record := make([]byte, 16, 16+len(frame))
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(record[12:], uint32(len(frame)))
+	_, err := p.w.Write(append(record, frame...))
+	return err
+}
+
+// frameAddresses returns the source and destination IP of an Ethernet frame
+// carrying IPv4 or IPv6, or nil if it carries anything else
+func frameAddresses(frame []byte) (src, dst net.IP) {
+	if len(frame) < 14 {
+		return nil, nil
+	}
+	payload := frame[14:]
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case 0x0800:
+		if len(payload) < 20 {
+			return nil, nil
+		}
+		return net.IP(payload[12:16]), net.IP(payload[16:20])
+	case 0x86DD:
+		if len(payload) < 40 {
+			return nil, nil
+		}
+		return net.IP(payload[8:24]), net.IP(payload[24:40])
+	}
+	return nil, nil
+}
+
+// resolveTargets returns the set of addresses the scan will talk to
+func resolveTargets(hosts []string) map[string]bool {
+	targets := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		if ip := parseHostIP(h); ip != nil {
+			targets[ip.String()] = true
+			continue
+		}
+		ips, err := net.LookupIP(h)
+		if err != nil {
+			continue
+		}
+		for _, ip := range ips {
+			targets[ip.String()] = true
+		}
+	}
+	return targets
+}
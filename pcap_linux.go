@@ -0,0 +1,180 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// arphrdRawIP is the link type of interfaces passing bare IP packets that
+// syscall has no name for, such as cellular modems
+const arphrdRawIP = 519
+
+// rawIPLinks are the link types whose packets start at the IP header: tun
+// devices such as WireGuard's, PPP and IP-in-IP tunnels
+var rawIPLinks = map[uint16]bool{
+	syscall.ARPHRD_NONE:    true,
+	syscall.ARPHRD_PPP:     true,
+	syscall.ARPHRD_TUNNEL:  true,
+	syscall.ARPHRD_TUNNEL6: true,
+	syscall.ARPHRD_SIT:     true,
+	arphrdRawIP:            true,
+}
+
+// ethHeaderLen is the size of the Ethernet header written for raw IP packets
+const ethHeaderLen = 14
+
+// Capture records the frames exchanged with scan targets on every interface
+// using an AF_PACKET socket. It needs root or CAP_NET_RAW. Packets on raw IP
+// links are given an Ethernet header so the file has a single link type.
+type Capture struct {
+	fd      int
+	file    *os.File
+	pcap    *PcapWriter
+	targets map[string]bool
+	loIndex map[int]bool
+	skipped map[int]bool // interfaces with a link type that can't be captured
+	stop    chan struct{}
+	done    sync.WaitGroup
+	packets int
+
+	Timestamps TimestampLog // TCP timestamps of the targets' SYN-ACKs
+}
+
+// StartCapture begins writing packets to or from the given hosts to filename
+func StartCapture(filename string, hosts []string) (*Capture, error) {
+	const ethPAll = 0x0003
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPAll)))
+	if err != nil {
+		return nil, fmt.Errorf("opening packet socket (root or CAP_NET_RAW required): %v", err)
+	}
+	// Wake up periodically so Stop is noticed when no traffic arrives
+	tv := syscall.NsecToTimeval((200 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	pcap, err := NewPcapWriter(f, pcapLinkEthernet)
+	if err != nil {
+		f.Close()
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	c := &Capture{fd: fd, file: f, pcap: pcap, targets: resolveTargets(hosts), loIndex: make(map[int]bool), skipped: make(map[int]bool), stop: make(chan struct{})}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			c.loIndex[iface.Index] = true
+		}
+	}
+	c.done.Add(1)
+	go c.run()
+	return c, nil
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+func (c *Capture) run() {
+	defer c.done.Done()
+	buf := make([]byte, 65536)
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		// Room is left for the Ethernet header a raw IP packet is given
+		n, from, err := syscall.Recvfrom(c.fd, buf[ethHeaderLen:], 0)
+		if err != nil {
+			continue // timeout or interrupted
+		}
+		ll, ok := from.(*syscall.SockaddrLinklayer)
+		if !ok {
+			continue
+		}
+		// Loopback traffic is seen both leaving and arriving; keep one copy
+		if ll.Pkttype == syscall.PACKET_OUTGOING && c.loIndex[ll.Ifindex] {
+			continue
+		}
+		var frame []byte
+		switch {
+		case ll.Hatype == syscall.ARPHRD_ETHER || ll.Hatype == syscall.ARPHRD_LOOPBACK:
+			frame = buf[ethHeaderLen : ethHeaderLen+n]
+		case rawIPLinks[ll.Hatype]:
+			frame = buf[:ethHeaderLen+n]
+			if !addEthernetHeader(frame) {
+				continue
+			}
+		default:
+			c.skip(ll)
+			continue
+		}
+		src, dst := frameAddresses(frame)
+		if src == nil || !(c.targets[src.String()] || c.targets[dst.String()]) {
+			continue
+		}
+		now := time.Now()
+		if c.targets[src.String()] {
+			c.Timestamps.Record(now, frame)
+		}
+		if err := c.pcap.WritePacket(now, frame); err == nil {
+			c.packets++
+		}
+	}
+}
+
+// skip warns, once per interface, that its packets are left out of the capture
+func (c *Capture) skip(ll *syscall.SockaddrLinklayer) {
+	if c.skipped[ll.Ifindex] {
+		return
+	}
+	c.skipped[ll.Ifindex] = true
+	name := fmt.Sprint(ll.Ifindex)
+	if iface, err := net.InterfaceByIndex(ll.Ifindex); err == nil {
+		name = iface.Name
+	}
+	slog.Warn("not capturing interface with an unsupported link type", "interface", name, "link_type", ll.Hatype)
+}
+
+// addEthernetHeader fills the first ethHeaderLen bytes of frame, which are
+// followed by an IP packet, with an Ethernet header with zero addresses. It
+// returns false when the packet is neither IPv4 nor IPv6.
+func addEthernetHeader(frame []byte) bool {
+	if len(frame) <= ethHeaderLen {
+		return false
+	}
+	clear(frame[:12])
+	switch frame[ethHeaderLen] >> 4 {
+	case 4:
+		binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	case 6:
+		binary.BigEndian.PutUint16(frame[12:], 0x86DD)
+	default:
+		return false
+	}
+	return true
+}
+
+// Stop ends the capture, closes the file and returns the number of packets written
+func (c *Capture) Stop() (int, error) {
+	close(c.stop)
+	c.done.Wait()
+	syscall.Close(c.fd)
+	return c.packets, c.file.Close()
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// Capture is only implemented on Linux
+type Capture struct {
+	Timestamps TimestampLog
+}
+
+// StartCapture reports that packet capture isn't available on this platform
+func StartCapture(filename string, hosts []string) (*Capture, error) {
+	return nil, errors.New("packet capture is only supported on Linux")
+}
+
+// Stop does nothing
+func (c *Capture) Stop() (int, error) {
+	return 0, nil
+}
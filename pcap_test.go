@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPcapWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewPcapWriter(&buf, pcapLinkEthernet)
+	if err != nil {
+		t.Fatalf("NewPcapWriter() error = %v", err)
+	}
+	frame := []byte{1, 2, 3, 4, 5}
+	ts := time.Unix(1700000000, 123456000)
+	if err := w.WritePacket(ts, frame); err != nil {
+		t.Fatalf("WritePacket() error = %v", err)
+	}
+
+	b := buf.Bytes()
+	if len(b) != 24+16+len(frame) {
+		t.Fatalf("file is %d bytes, expected %d", len(b), 24+16+len(frame))
+	}
+	if magic := binary.LittleEndian.Uint32(b); magic != 0xa1b2c3d4 {
+		t.Errorf("magic = %#x", magic)
+	}
+	if link := binary.LittleEndian.Uint32(b[20:]); link != pcapLinkEthernet {
+		t.Errorf("link type = %d", link)
+	}
+	record := b[24:]
+	if sec, usec := binary.LittleEndian.Uint32(record), binary.LittleEndian.Uint32(record[4:]); sec != 1700000000 || usec != 123456 {
+		t.Errorf("timestamp = %d.%06d", sec, usec)
+	}
+	if !bytes.Equal(record[16:], frame) {
+		t.Errorf("frame = %v, expected %v", record[16:], frame)
+	}
+}
+
+func TestFrameAddresses(t *testing.T) {
+	ipv4 := make([]byte, 14+20)
+	binary.BigEndian.PutUint16(ipv4[12:], 0x0800)
+	copy(ipv4[14+12:], net.ParseIP("10.0.0.1").To4())
+	copy(ipv4[14+16:], net.ParseIP("10.0.0.2").To4())
+
+	ipv6 := make([]byte, 14+40)
+	binary.BigEndian.PutUint16(ipv6[12:], 0x86DD)
+	copy(ipv6[14+8:], net.ParseIP("2001:db8::1"))
+	copy(ipv6[14+24:], net.ParseIP("2001:db8::2"))
+
+	arp := make([]byte, 14+28)
+	binary.BigEndian.PutUint16(arp[12:], 0x0806)
+
+	tests := []struct {
+		name     string
+		frame    []byte
+		src, dst string
+	}{
+		{name: "IPv4", frame: ipv4, src: "10.0.0.1", dst: "10.0.0.2"},
+		{name: "IPv6", frame: ipv6, src: "2001:db8::1", dst: "2001:db8::2"},
+		{name: "ARP", frame: arp},
+		{name: "Truncated", frame: ipv4[:20]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, dst := frameAddresses(tt.frame)
+			if tt.src == "" {
+				if src != nil || dst != nil {
+					t.Errorf("frameAddresses() = %v, %v, expected nil", src, dst)
+				}
+				return
+			}
+			if src.String() != tt.src || dst.String() != tt.dst {
+				t.Errorf("frameAddresses() = %v, %v, expected %s, %s", src, dst, tt.src, tt.dst)
+			}
+		})
+	}
+}
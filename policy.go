@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// policyFile is the -policy flag
+var policyFile string
+
+// errPolicy is the outcome of the probes the -policy file doesn't allow
+var errPolicy = errors.New("not probed: forbidden by the scan policy")
+
+// policyForbids are the kinds of scanning a policy rule can forbid; "all"
+// forbids scanning the network at all
+var policyForbids = []string{"all", "enrich", "ftp-bounce", "knock", "udp"}
+
+// Policy holds the constraints a scan policy file puts on networks. Each
+// target is governed by the rule of the most specific network containing
+// it; targets in none of them are unconstrained. Its methods do nothing on a
+// nil policy.
+type Policy struct {
+	Rules   []*PolicyRule // most specific network first
+	Network string        // address family target names are looked up in, as ProbeConfig.Network
+
+	mu      sync.Mutex
+	hosts   map[string]*PolicyRule
+	skipped atomic.Int64
+}
+
+// PolicyRule is the line of a policy file for one network
+type PolicyRule struct {
+	Network netip.Prefix
+	Line    string // file:line, for messages
+
+	Rate   int          // probes per second to the network's hosts, 0 for no limit
+	Ports  map[int]bool // the ports that may be probed, nil for any
+	Forbid []string     // kinds of scanning not allowed, from policyForbids
+
+	Days     [7]bool        // weekdays scanning is allowed on; all when none are set
+	Hours    []policyWindow // times of day scanning is allowed at; any when empty
+	Location *time.Location // time zone of Days and Hours
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next probe under Rate
+}
+
+// policyWindow is a time of day range in minutes after midnight; from > to
+// wraps past midnight
+type policyWindow struct {
+	from, to int
+}
+
+// LoadPolicy reads a policy file: one network per line, followed by its
+// constraints as key=value, as in
+//
+//	10.20.0.0/16  rate=50 ports=22,80,443 forbid=udp,enrich days=Mon-Fri hours=22:00-06:00
+func LoadPolicy(filename string) (*Policy, error) {
+	lines, err := ReadFileLines(filename)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{hosts: make(map[string]*PolicyRule)}
+	seen := make(map[netip.Prefix]string)
+	for _, line := range lines {
+		where := fmt.Sprintf("%s:%d", filepath.Base(filename), line.Number)
+		rule, err := parsePolicyRule(line.Text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+		if other, ok := seen[rule.Network]; ok {
+			return nil, fmt.Errorf("%s: %s already has a rule at %s", where, rule.Network, other)
+		}
+		rule.Line, seen[rule.Network] = where, where
+		p.Rules = append(p.Rules, rule)
+	}
+	slices.SortStableFunc(p.Rules, func(a, b *PolicyRule) int { return b.Network.Bits() - a.Network.Bits() })
+	return p, nil
+}
+
+// parsePolicyRule parses one line of a policy file
+func parsePolicyRule(text string) (*PolicyRule, error) {
+	target, options, err := parseTargetLine(text)
+	if err != nil {
+		return nil, err
+	}
+	network, err := netip.ParsePrefix(target)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(target)
+		if addrErr != nil {
+			return nil, fmt.Errorf("%q is not a network or address", target)
+		}
+		network = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	rule := &PolicyRule{Network: network.Masked(), Location: time.Local}
+	// The time zone applies to days and hours whatever their order
+	if tz, ok := options["tz"]; ok {
+		if rule.Location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("tz: %v", err)
+		}
+	}
+	for key, value := range options {
+		switch key {
+		case "tz":
+		case "rate":
+			if rule.Rate, err = strconv.Atoi(value); err != nil || rule.Rate < 1 {
+				return nil, fmt.Errorf("rate %q is not a number of probes per second", value)
+			}
+		case "ports":
+			portList, err := ParsePorts(value)
+			if err != nil {
+				return nil, fmt.Errorf("ports: %v", err)
+			}
+			rule.Ports = make(map[int]bool, len(portList))
+			for _, port := range portList {
+				rule.Ports[port] = true
+			}
+		case "forbid":
+			for _, kind := range strings.Split(value, ",") {
+				if !slices.Contains(policyForbids, kind) {
+					return nil, fmt.Errorf("forbid: unknown kind %q (use %s)", kind, strings.Join(policyForbids, ", "))
+				}
+				rule.Forbid = append(rule.Forbid, kind)
+			}
+		case "days":
+			if rule.Days, err = parsePolicyDays(value); err != nil {
+				return nil, err
+			}
+		case "hours":
+			if rule.Hours, err = parsePolicyHours(value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown constraint %q (use rate, ports, forbid, days, hours or tz)", key)
+		}
+	}
+	return rule, nil
+}
+
+// parsePolicyDays parses weekdays and ranges of them, such as "Mon-Fri,Sun"
+func parsePolicyDays(value string) (days [7]bool, err error) {
+	day := func(name string) (int, error) {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(name, d.String()[:3]) {
+				return int(d), nil
+			}
+		}
+		return 0, fmt.Errorf("days: %q is not a weekday such as Mon", name)
+	}
+	for _, part := range strings.Split(value, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := day(first)
+		if err != nil {
+			return days, err
+		}
+		to := from
+		if isRange {
+			if to, err = day(last); err != nil {
+				return days, err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parsePolicyHours parses time of day ranges, such as "22:00-06:00,12:00-13:00"
+func parsePolicyHours(value string) ([]policyWindow, error) {
+	minutes := func(clock string) (int, error) {
+		t, err := time.Parse("15:04", clock)
+		if err != nil {
+			return 0, fmt.Errorf("hours: %q is not a time such as 22:00", clock)
+		}
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	var windows []policyWindow
+	for _, part := range strings.Split(value, ",") {
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("hours: %q is not a range such as 22:00-06:00", part)
+		}
+		from, err := minutes(first)
+		if err != nil {
+			return nil, err
+		}
+		to, err := minutes(last)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, policyWindow{from: from, to: to})
+	}
+	return windows, nil
+}
+
+// Rule returns the rule governing host, or nil when there is none
+func (p *Policy) Rule(host string) *PolicyRule {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	rule, ok := p.hosts[host]
+	p.mu.Unlock()
+	if ok {
+		return rule
+	}
+	if ip, err := GetHostIP(host, p.Network); err == nil {
+		ip, _ = splitZone(ip)
+		if addr, err := netip.ParseAddr(ip); err == nil {
+			for _, r := range p.Rules {
+				if r.Network.Contains(addr.Unmap()) {
+					rule = r
+					break
+				}
+			}
+		}
+	}
+	p.mu.Lock()
+	p.hosts[host] = rule
+	p.mu.Unlock()
+	return rule
+}
+
+// Permits reports whether the policy allows a kind of scanning, from
+// policyForbids, of host
+func (p *Policy) Permits(host, kind string) bool {
+	rule := p.Rule(host)
+	return rule == nil || !slices.Contains(rule.Forbid, kind) && !slices.Contains(rule.Forbid, "all")
+}
+
+// Admit checks that the policy allows probing a port of host now, by the
+// kinds of scanning given, and waits for the rate of its network to allow
+// another probe. The error wraps errPolicy when the probe is not allowed,
+// and is the context's when it was cancelled while waiting.
+func (p *Policy) Admit(ctx context.Context, host string, port int, kinds ...string) error {
+	rule := p.Rule(host)
+	if rule == nil {
+		return nil
+	}
+	if reason := rule.refuse(port, kinds, time.Now()); reason != "" {
+		p.skipped.Add(1)
+		return fmt.Errorf("%w (%s: %s)", errPolicy, rule.Line, reason)
+	}
+	if rule.Rate == 0 {
+		return nil
+	}
+	rule.mu.Lock()
+	start := time.Now()
+	if rule.next.After(start) {
+		start = rule.next
+	}
+	rule.next = start.Add(time.Second / time.Duration(rule.Rate))
+	rule.mu.Unlock()
+	sleepContext(ctx, time.Until(start))
+	return ctx.Err()
+}
+
+// Skipped returns how many probes Admit refused
+func (p *Policy) Skipped() int {
+	if p == nil {
+		return 0
+	}
+	return int(p.skipped.Load())
+}
+
+// refuse returns why the rule doesn't allow probing port at now by the
+// given kinds of scanning, or "" when it does
+func (r *PolicyRule) refuse(port int, kinds []string, now time.Time) string {
+	if slices.Contains(r.Forbid, "all") {
+		return "scanning forbidden"
+	}
+	for _, kind := range kinds {
+		if slices.Contains(r.Forbid, kind) {
+			return kind + " forbidden"
+		}
+	}
+	if r.Ports != nil && !r.Ports[port] {
+		return "port not allowed"
+	}
+	now = now.In(r.Location)
+	if r.Days != [7]bool{} && !r.Days[now.Weekday()] {
+		return "not allowed on " + now.Weekday().String()
+	}
+	if len(r.Hours) == 0 {
+		return ""
+	}
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range r.Hours {
+		if w.from <= w.to && minute >= w.from && minute < w.to ||
+			w.from > w.to && (minute >= w.from || minute < w.to) {
+			return ""
+		}
+	}
+	return "outside the allowed hours"
+}
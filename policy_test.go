@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParsePolicyRule(t *testing.T) {
+	tests := []struct {
+		line    string
+		wantErr bool
+	}{
+		{line: "10.0.0.0/8 rate=500"},
+		{line: "10.20.0.0/16 rate=50 ports=22,80,8000-8100 forbid=udp,enrich days=Mon-Fri hours=22:00-06:00"},
+		{line: "10.0.0.5 forbid=all"},
+		{line: "2001:db8::/32 hours=09:00-17:00 tz=UTC"},
+		{line: "10.0.0.0/33 rate=1", wantErr: true},
+		{line: "scanme.example.com rate=1", wantErr: true},
+		{line: "10.0.0.0/8 rate=0", wantErr: true},
+		{line: "10.0.0.0/8 ports=0-5", wantErr: true},
+		{line: "10.0.0.0/8 forbid=syn", wantErr: true},
+		{line: "10.0.0.0/8 days=Mon-Fry", wantErr: true},
+		{line: "10.0.0.0/8 hours=22:00", wantErr: true},
+		{line: "10.0.0.0/8 hours=25:00-06:00", wantErr: true},
+		{line: "10.0.0.0/8 tz=Nowhere/Else", wantErr: true},
+		{line: "10.0.0.0/8 speed=fast", wantErr: true},
+		{line: "10.0.0.0/8 rate", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if _, err := parsePolicyRule(tt.line); (err != nil) != tt.wantErr {
+				t.Errorf("parsePolicyRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyRuleRefuse(t *testing.T) {
+	rule, err := parsePolicyRule("10.0.0.0/8 ports=22,80 forbid=udp days=Mon-Fri,Sun hours=22:00-06:00,12:00-13:00 tz=UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2026-01-05 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		port  int
+		kinds []string
+		now   time.Time
+		want  string
+	}{
+		{"Allowed at night", 22, nil, at(5, 23, 30), ""},
+		{"Allowed after midnight", 80, nil, at(6, 5, 59), ""},
+		{"Allowed at lunch", 80, nil, at(7, 12, 30), ""},
+		{"Sunday", 22, nil, at(4, 23, 0), ""},
+		{"Saturday", 22, nil, at(3, 23, 0), "not allowed on Saturday"},
+		{"Daytime", 22, nil, at(5, 9, 0), "outside the allowed hours"},
+		{"End of a window", 22, nil, at(5, 13, 0), "outside the allowed hours"},
+		{"Port", 443, nil, at(5, 23, 0), "port not allowed"},
+		{"Forbidden kind", 22, []string{"udp"}, at(5, 23, 0), "udp forbidden"},
+		{"Other kind", 22, []string{"knock"}, at(5, 23, 0), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rule.refuse(tt.port, tt.kinds, tt.now); got != tt.want {
+				t.Errorf("refuse() = %q, expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "scan.policy")
+	os.WriteFile(filename, []byte("# policy\n10.0.0.0/8 ports=22 rate=20\n10.20.0.0/16 forbid=enrich\n10.20.5.0/24 forbid=all\n"), 0o644)
+	p, err := LoadPolicy(filename)
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		host    string
+		line    string
+		admit   bool
+		enrich  bool
+		port    int
+		skipped int
+	}{
+		{host: "10.1.0.1", line: "scan.policy:2", port: 22, admit: true, enrich: true},
+		{host: "10.1.0.1", line: "scan.policy:2", port: 80, enrich: true, skipped: 1},
+		{host: "10.20.0.1", line: "scan.policy:3", port: 80, admit: true, skipped: 1},
+		{host: "10.20.5.1", line: "scan.policy:4", port: 22, skipped: 2},
+		{host: "192.168.1.1", port: 22, admit: true, enrich: true, skipped: 2},
+	}
+	for _, tt := range tests {
+		rule := p.Rule(tt.host)
+		if rule == nil && tt.line != "" || rule != nil && rule.Line != tt.line {
+			t.Errorf("Rule(%q) = %+v, expected the rule at %q", tt.host, rule, tt.line)
+		}
+		err := p.Admit(context.Background(), tt.host, tt.port)
+		if (err == nil) != tt.admit || err != nil && !errors.Is(err, errPolicy) {
+			t.Errorf("Admit(%q, %d) = %v, expected admitted %v", tt.host, tt.port, err, tt.admit)
+		}
+		if got := p.Permits(tt.host, "enrich"); got != tt.enrich {
+			t.Errorf("Permits(%q, enrich) = %v, expected %v", tt.host, got, tt.enrich)
+		}
+		if got := p.Skipped(); got != tt.skipped {
+			t.Errorf("Skipped() after %q = %d, expected %d", tt.host, got, tt.skipped)
+		}
+	}
+
+	// rate=20 spaces the network's probes 50ms apart
+	start := time.Now()
+	for range 3 {
+		p.Admit(context.Background(), "10.1.0.2", 22)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("3 more probes under rate=20 took %v, expected at least 100ms", elapsed)
+	}
+
+	os.WriteFile(filename, []byte("10.0.0.0/8 rate=1\n10.0.0.0/8 rate=2\n"), 0o644)
+	if _, err := LoadPolicy(filename); err == nil {
+		t.Error("LoadPolicy() of a file with two rules for a network returned no error")
+	}
+	if p := (*Policy)(nil); p.Admit(context.Background(), "10.0.0.1", 1) != nil || !p.Permits("10.0.0.1", "udp") {
+		t.Error("a nil Policy didn't allow everything")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// politeScan is the -polite flag
+var politeScan bool
+
+// The -polite preset, for fragile OT and embedded networks where a burst of
+// connections can crash a device
+const (
+	politeRate     = 10                     // ports started per second in total
+	politeJitter   = 250 * time.Millisecond // random delay added before each probe
+	politeCooldown = 2 * time.Second        // pause before moving on to the next host
+)
+
+// makePolite turns on the -polite limits in opts: a low rate, one probe at a
+// time per host, jitter and a cool-down between hosts. An explicit lower
+// rate is kept.
+func makePolite(opts *ScanOptions) {
+	if opts.Rate == 0 || opts.Rate > politeRate {
+		opts.Rate = politeRate
+	}
+	opts.HostLimit = 1
+	opts.Jitter = politeJitter
+	opts.Cooldown = politeCooldown
+}
+
+// hostLimiter caps the probes in flight to each host
+type hostLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{limit: limit, slots: make(map[string]chan struct{})}
+}
+
+// Acquire waits for a free slot on host, returning false if ctx ends first
+func (l *hostLimiter) Acquire(ctx context.Context, host string) bool {
+	l.mu.Lock()
+	slot, ok := l.slots[host]
+	if !ok {
+		slot = make(chan struct{}, l.limit)
+		l.slots[host] = slot
+	}
+	l.mu.Unlock()
+	select {
+	case slot <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Release frees a slot taken by Acquire
+func (l *hostLimiter) Release(host string) {
+	l.mu.Lock()
+	slot := l.slots[host]
+	l.mu.Unlock()
+	<-slot
+}
+
+// sleepContext waits for d or until ctx ends
+func sleepContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+// waitUntil polls done until it reports true or ctx ends
+func waitUntil(ctx context.Context, done func() bool) {
+	for !done() && ctx.Err() == nil {
+		sleepContext(ctx, 20*time.Millisecond)
+	}
+}
+
+// jitter returns a random duration below max
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMakePolite(t *testing.T) {
+	tests := []struct {
+		rate, expected int
+	}{{0, politeRate}, {100, politeRate}, {2, 2}}
+	for _, tt := range tests {
+		opts := ScanOptions{Workers: 100, Rate: tt.rate}
+		makePolite(&opts)
+		if opts.Rate != tt.expected || opts.HostLimit != 1 || opts.Jitter != politeJitter || opts.Cooldown != politeCooldown {
+			t.Errorf("makePolite(rate %d) = %+v", tt.rate, opts)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(2)
+	ctx := context.Background()
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Acquire(ctx, "10.0.0.1")
+			n := inFlight.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(5 * time.Millisecond)
+			inFlight.Add(-1)
+			limiter.Release("10.0.0.1")
+		}()
+	}
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("peak probes in flight = %d, expected 2", peak.Load())
+	}
+
+	// Another host has slots of its own
+	if !limiter.Acquire(ctx, "10.0.0.2") {
+		t.Error("Acquire() on another host failed")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	limiter.Acquire(ctx, "10.0.0.3")
+	limiter.Acquire(ctx, "10.0.0.3")
+	if limiter.Acquire(cancelled, "10.0.0.3") {
+		t.Error("Acquire() on a full host succeeded after cancellation")
+	}
+}
+
+func TestRunScanCooldown(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	var mu sync.Mutex
+	done := make(map[string]time.Time) // when each host's last probe finished
+	first := make(map[string]time.Time)
+	opts := ScanOptions{Workers: 4, Probe: quickProbe, HostLimit: 1, Cooldown: 200 * time.Millisecond}
+	opts.OnProbe = func(job ScanJob, state PortState, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, ok := first[job.Host]; !ok {
+			first[job.Host] = time.Now()
+		}
+		done[job.Host] = time.Now()
+	}
+	stats := &Stats{startTime: time.Now()}
+	RunScan(context.Background(), []string{"127.0.0.1", "127.0.0.2"}, []int{port, port + 1}, opts, stats, func(Result) {})
+
+	if gap := first["127.0.0.2"].Sub(done["127.0.0.1"]); gap < opts.Cooldown {
+		t.Errorf("second host started %v after the first finished, expected at least %v", gap, opts.Cooldown)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// portsFiles is the -ports-file flag: files each defining a named port list
+var portsFiles string
+
+// portListExt is the extension of port list files; a list is named after
+// its file, so web.ports defines @web
+const portListExt = ".ports"
+
+// portListDir is where @name lists not given with -ports-file are looked up
+func portListDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "pscanner", "ports")
+}
+
+// readPortList reads a port list file: ports, ranges and @references
+// separated by commas, spaces or newlines, with # starting a comment
+func readPortList(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	var parts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		parts = append(parts, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// portListName is the name a port list file defines
+func portListName(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// ExpandPortSpec replaces each @name in a port specification with the named
+// list, from lists or else from name.ports in dir. Lists may refer to
+// other lists.
+func ExpandPortSpec(spec string, lists map[string]string, dir string) (string, error) {
+	return expandPortSpec(spec, lists, dir, nil)
+}
+
+func expandPortSpec(spec string, lists map[string]string, dir string, seen []string) (string, error) {
+	if !strings.Contains(spec, "@") {
+		return spec, nil
+	}
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		name, ok := strings.CutPrefix(strings.TrimSpace(part), "@")
+		if !ok {
+			continue
+		}
+		for _, s := range seen {
+			if s == name {
+				return "", fmt.Errorf("port list @%s refers to itself", name)
+			}
+		}
+		list, ok := lists[name]
+		if !ok {
+			if dir == "" {
+				return "", fmt.Errorf("unknown port list @%s (define it with -ports-file)", name)
+			}
+			var err error
+			list, err = readPortList(filepath.Join(dir, name+portListExt))
+			if os.IsNotExist(err) {
+				return "", fmt.Errorf("unknown port list @%s (define it with -ports-file or in %s)", name, filepath.Join(dir, name+portListExt))
+			}
+			if err != nil {
+				return "", fmt.Errorf("port list @%s: %v", name, err)
+			}
+		}
+		expanded, err := expandPortSpec(list, lists, dir, append(seen, name))
+		if err != nil {
+			return "", err
+		}
+		parts[i] = expanded
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// resolvePorts expands the @name references in -p using the lists from
+// -ports-file. Without -p, the lists from -ports-file are scanned.
+func resolvePorts() error {
+	lists := make(map[string]string)
+	var names []string
+	for _, filename := range strings.Split(portsFiles, ",") {
+		if filename = strings.TrimSpace(filename); filename == "" {
+			continue
+		}
+		list, err := readPortList(filename)
+		if err != nil {
+			return fmt.Errorf("reading ports file: %v", err)
+		}
+		name := portListName(filename)
+		lists[name] = list
+		names = append(names, "@"+name)
+	}
+	if ports == "" {
+		ports = strings.Join(names, ",")
+	}
+	expanded, err := ExpandPortSpec(ports, lists, portListDir())
+	if err != nil {
+		return err
+	}
+	ports = expanded
+	if sweepPorts != "" {
+		if sweepPorts, err = ExpandPortSpec(sweepPorts, lists, portListDir()); err != nil {
+			return fmt.Errorf("-sweep: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadPortList(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "web.ports")
+	os.WriteFile(filename, []byte("# Web servers\n80, 443\n8000-8100 8443\t# proxies too\n\n@admin\n"), 0o644)
+
+	got, err := readPortList(filename)
+	if err != nil {
+		t.Fatalf("readPortList() error = %v", err)
+	}
+	if expected := "80,443,8000-8100,8443,@admin"; got != expected {
+		t.Errorf("readPortList() = %q, expected %q", got, expected)
+	}
+	if name := portListName(filename); name != "web" {
+		t.Errorf("portListName() = %q, expected web", name)
+	}
+}
+
+func TestExpandPortSpec(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "db.ports"), []byte("3306\n5432\n"), 0o644)
+	lists := map[string]string{
+		"web":   "80,443",
+		"all":   "@web,@db,22",
+		"loopA": "@loopB",
+		"loopB": "@loopA",
+	}
+
+	tests := []struct {
+		name     string
+		spec     string
+		expected string
+		wantErr  bool
+	}{
+		{name: "No lists", spec: "22,80-90", expected: "22,80-90"},
+		{name: "Named list", spec: "@web,8080", expected: "80,443,8080"},
+		{name: "From the directory", spec: "@db", expected: "3306,5432"},
+		{name: "Nested", spec: " @all", expected: "80,443,3306,5432,22"},
+		{name: "Unknown", spec: "@ftp", wantErr: true},
+		{name: "Cycle", spec: "@loopA", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpandPortSpec(tt.spec, lists, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExpandPortSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.expected {
+				t.Errorf("ExpandPortSpec() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolvePorts(t *testing.T) {
+	dir := t.TempDir()
+	web := filepath.Join(dir, "web.ports")
+	mail := filepath.Join(dir, "mail.ports")
+	os.WriteFile(web, []byte("80,443\n"), 0o644)
+	os.WriteFile(mail, []byte("25 587\n"), 0o644)
+	saved := [...]string{ports, portsFiles}
+	defer func() { ports, portsFiles = saved[0], saved[1] }()
+
+	tests := []struct {
+		name     string
+		ports    string
+		expected string
+	}{
+		{name: "Every list without -p", expected: "80,443,25,587"},
+		{name: "Referenced from -p", ports: "22,@mail", expected: "22,25,587"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ports, portsFiles = tt.ports, web+","+mail
+			if err := resolvePorts(); err != nil {
+				t.Fatalf("resolvePorts() error = %v", err)
+			}
+			if ports != tt.expected {
+				t.Errorf("ports = %q, expected %q", ports, tt.expected)
+			}
+		})
+	}
+}
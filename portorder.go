@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+)
+
+// portOrder is the -port-order flag
+var portOrder = "sequential"
+
+// portOrders are the values -port-order takes
+var portOrders = []string{"sequential", "frequency", "learned", "random"}
+
+// The networks -port-order learned ranks ports for: a port often open on some
+// hosts of a network is likely open on its other hosts too
+const (
+	learnedPrefix4 = 24
+	learnedPrefix6 = 64
+)
+
+// frequentPorts are the TCP ports most often found open on the internet,
+// most frequent first, after nmap's port frequency table
+var frequentPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080,
+	1723, 111, 995, 993, 5900, 1025, 587, 8888, 199, 1720, 465, 548, 113, 81,
+	6001, 10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554, 26, 1433,
+	49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000, 5631, 631, 49153,
+	8081, 2049, 88, 79, 5800, 106, 2121, 1110, 49155, 6000, 513, 990, 5357,
+	427, 49156, 543, 544, 5101, 144, 7, 389,
+}
+
+// OrderPorts reorders ascending ports in place for -port-order. "frequency"
+// moves the ports in frequentPorts to the front, most frequent first, and
+// keeps the rest ascending, which is also where "learned" starts from;
+// "random" shuffles them with r; anything else leaves them ascending.
+func OrderPorts(ports []int, order string, r *rand.Rand) {
+	switch order {
+	case "frequency", "learned":
+		rank := make(map[int]int, len(frequentPorts))
+		for i, p := range frequentPorts {
+			rank[p] = i + 1
+		}
+		slices.SortStableFunc(ports, func(a, b int) int {
+			ra, rb := rank[a], rank[b]
+			switch {
+			case ra == 0 && rb == 0:
+				return 0
+			case ra == 0:
+				return 1
+			case rb == 0:
+				return -1
+			}
+			return ra - rb
+		})
+	case "random":
+		r.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
+	}
+}
+
+// LearnedOrder orders each network's ports by how often the scans in a
+// history database found them open there, for -port-order learned. Ports
+// never seen open in a network follow in the order of those seen open
+// anywhere, then in the order given.
+type LearnedOrder struct {
+	networks map[netip.Prefix]map[int]int // open sightings of each port by network
+	overall  map[int]int                  // and in all networks
+	names    map[string]netip.Addr        // addresses the history recorded for host names
+	cache    map[netip.Prefix][]int
+}
+
+// LearnPortOrder counts the open TCP ports of each network in the recorded
+// scans
+func LearnPortOrder(records []*ScanRecord) *LearnedOrder {
+	o := &LearnedOrder{
+		networks: make(map[netip.Prefix]map[int]int),
+		overall:  make(map[int]int),
+		names:    make(map[string]netip.Addr),
+		cache:    make(map[netip.Prefix][]int),
+	}
+	for _, rec := range records {
+		for _, r := range rec.Results {
+			addr, err := netip.ParseAddr(r.IP)
+			if err != nil || r.Transport != "" {
+				continue
+			}
+			network := learnedNetwork(addr)
+			if o.networks[network] == nil {
+				o.networks[network] = make(map[int]int)
+			}
+			o.networks[network][r.Port]++
+			o.overall[r.Port]++
+			if r.Host != r.IP {
+				o.names[r.Host] = addr
+			}
+		}
+	}
+	return o
+}
+
+// Ports returns ports in the order learned for host's network, or ports
+// itself on a nil LearnedOrder. The order is worked out once per network, so
+// every call must pass the same ports.
+func (o *LearnedOrder) Ports(host string, ports []int) []int {
+	if o == nil {
+		return ports
+	}
+	var network netip.Prefix // the zero prefix stands for hosts of no known network
+	if ip := parseHostIP(host); ip != nil {
+		addr, _ := netip.AddrFromSlice(ip)
+		network = learnedNetwork(addr)
+	} else if addr, ok := o.names[host]; ok {
+		network = learnedNetwork(addr)
+	}
+	if ordered, ok := o.cache[network]; ok {
+		return ordered
+	}
+	counts := o.networks[network]
+	ordered := slices.Clone(ports)
+	slices.SortStableFunc(ordered, func(a, b int) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(o.overall[b], o.overall[a]))
+	})
+	o.cache[network] = ordered
+	return ordered
+}
+
+// learnedNetwork is the network an address is ranked with
+func learnedNetwork(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	bits := learnedPrefix6
+	if addr.Is4() {
+		bits = learnedPrefix4
+	}
+	network, _ := addr.Prefix(bits)
+	return network
+}
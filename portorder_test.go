@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestOrderPorts(t *testing.T) {
+	tests := []struct {
+		order    string
+		ports    []int
+		expected []int
+	}{
+		{"sequential", []int{21, 22, 80, 443, 9999}, []int{21, 22, 80, 443, 9999}},
+		{"frequency", []int{21, 22, 80, 443, 1234, 9999}, []int{80, 443, 21, 22, 1234, 9999}},
+		{"frequency", []int{5, 6, 7}, []int{7, 5, 6}},
+	}
+	for _, tt := range tests {
+		ports := slices.Clone(tt.ports)
+		OrderPorts(ports, tt.order, nil)
+		if !reflect.DeepEqual(ports, tt.expected) {
+			t.Errorf("OrderPorts(%v, %q) = %v, expected %v", tt.ports, tt.order, ports, tt.expected)
+		}
+	}
+
+	// Random orders are a permutation that repeats for the same seed
+	ports := []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	first, second := slices.Clone(ports), slices.Clone(ports)
+	OrderPorts(first, "random", newRand(42))
+	OrderPorts(second, "random", newRand(42))
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("OrderPorts() with seed 42 gave %v, then %v", first, second)
+	}
+	if sorted := slices.Sorted(slices.Values(first)); !reflect.DeepEqual(sorted, ports) {
+		t.Errorf("OrderPorts() random = %v, not a permutation of %v", first, ports)
+	}
+}
+
+func TestLearnedOrder(t *testing.T) {
+	r := func(host, ip string, port int) Result { return Result{Host: host, IP: ip, Port: port} }
+	records := []*ScanRecord{
+		{Results: []Result{r("10.0.0.1", "10.0.0.1", 8080), r("10.0.0.2", "10.0.0.2", 8080), r("10.0.0.2", "10.0.0.2", 22)}},
+		{Results: []Result{r("10.0.0.1", "10.0.0.1", 8080), r("10.0.1.5", "10.0.1.5", 3306), r("db.example.com", "10.0.1.6", 5432)}},
+		{Results: []Result{r("2001:db8::1", "2001:db8::1", 9000), {Host: "10.0.0.1", IP: "10.0.0.1", Port: 161, Transport: "udp"}}},
+	}
+	ports := []int{80, 443, 22, 161, 3306, 5432, 8080, 9000}
+	o := LearnPortOrder(records)
+
+	tests := []struct {
+		host     string
+		expected []int
+	}{
+		{"10.0.0.9", []int{8080, 22, 3306, 5432, 9000, 80, 443, 161}},
+		{"10.0.1.1", []int{3306, 5432, 8080, 22, 9000, 80, 443, 161}},
+		{"db.example.com", []int{3306, 5432, 8080, 22, 9000, 80, 443, 161}},
+		{"2001:db8::ff", []int{9000, 8080, 22, 3306, 5432, 80, 443, 161}},
+		{"192.168.1.1", []int{8080, 22, 3306, 5432, 9000, 80, 443, 161}},
+		{"unknown.example.com", []int{8080, 22, 3306, 5432, 9000, 80, 443, 161}},
+	}
+	for _, tt := range tests {
+		if got := o.Ports(tt.host, ports); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Ports(%q) = %v, expected %v", tt.host, got, tt.expected)
+		}
+	}
+	if got := (*LearnedOrder)(nil).Ports("10.0.0.9", ports); !reflect.DeepEqual(got, ports) {
+		t.Errorf("Ports() on a nil LearnedOrder = %v, expected %v", got, ports)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// runAs is the -run-as flag
+var runAs string
+
+// Privileges is the user a scan started as root switches to once the
+// sockets it needed root for are open
+type Privileges struct {
+	User   string
+	UID    int
+	GID    int
+	Groups []int // supplementary groups
+}
+
+// PrivilegeTarget works out whom a scan running as root switches to: the
+// user -run-as names, by name or as uid[:gid], or else the user who ran
+// pscanner through sudo, from the SUDO_UID and SUDO_GID variables getenv
+// reads. It returns nil when -run-as is root, and fails when there is no one
+// to switch to rather than leave the whole scan running as root.
+func PrivilegeTarget(name string, getenv func(string) string) (*Privileges, error) {
+	if name == "" {
+		uid, gid := getenv("SUDO_UID"), getenv("SUDO_GID")
+		if uid == "" || gid == "" {
+			return nil, errors.New("running as root without sudo, there is no user to switch to once the capture socket is open; name one with -run-as, or keep root with -run-as root")
+		}
+		name = uid + ":" + gid
+	}
+	var p *Privileges
+	if id, group, ok := strings.Cut(name, ":"); ok || isNumber(name) {
+		uid, err := strconv.Atoi(id)
+		if err != nil || uid < 0 {
+			return nil, fmt.Errorf("-run-as %q is not a user name or uid[:gid]", name)
+		}
+		p = &Privileges{User: id, UID: uid, GID: -1}
+		if ok {
+			if p.GID, err = strconv.Atoi(group); err != nil || p.GID < 0 {
+				return nil, fmt.Errorf("-run-as %q is not a user name or uid[:gid]", name)
+			}
+		}
+		// A uid needs no account, but the account gives the name and groups
+		if u, err := user.LookupId(id); err == nil {
+			p.User = u.Username
+			p.Groups = groupIDs(u)
+			if p.GID < 0 {
+				p.GID, _ = strconv.Atoi(u.Gid)
+			}
+		}
+		if p.GID < 0 {
+			p.GID = uid
+		}
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("-run-as: %v", err)
+		}
+		p = &Privileges{User: u.Username, Groups: groupIDs(u)}
+		p.UID, _ = strconv.Atoi(u.Uid)
+		p.GID, _ = strconv.Atoi(u.Gid)
+	}
+	if p.UID == 0 {
+		return nil, nil
+	}
+	if len(p.Groups) == 0 {
+		p.Groups = []int{p.GID}
+	}
+	return p, nil
+}
+
+// groupIDs returns the groups a user belongs to, or none when they can't be
+// looked up
+func groupIDs(u *user.User) []int {
+	names, err := u.GroupIds()
+	if err != nil {
+		return nil
+	}
+	var ids []int
+	for _, name := range names {
+		if id, err := strconv.Atoi(name); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// isNumber reports whether s is all decimal digits
+func isNumber(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// HeldFiles are the files a scan writes at its end, opened before root
+// privileges are dropped so that they can be written whatever the
+// permissions of their directories. Its methods write to the named file
+// instead on a nil HeldFiles, or when that file isn't held.
+type HeldFiles struct {
+	Audit, History, Resume *os.File
+
+	createdResume bool
+}
+
+// HoldFiles opens the audit log, history file and resume file, any of which
+// may be "", for writing after dropping to p. Files it creates are given to
+// p's user.
+func HoldFiles(p *Privileges, audit, history, resume string) (*HeldFiles, error) {
+	h := &HeldFiles{}
+	for _, f := range []struct {
+		name    string
+		flag    int
+		perm    os.FileMode
+		file    **os.File
+		created *bool
+	}{
+		{audit, os.O_RDWR | os.O_APPEND, 0o600, &h.Audit, nil},
+		{history, os.O_WRONLY | os.O_APPEND, 0o644, &h.History, nil},
+		{resume, os.O_RDWR, 0o644, &h.Resume, &h.createdResume},
+	} {
+		if f.name == "" {
+			continue
+		}
+		_, err := os.Stat(f.name)
+		created := errors.Is(err, os.ErrNotExist)
+		if *f.file, err = os.OpenFile(f.name, f.flag|os.O_CREATE, f.perm); err == nil && created {
+			err = (*f.file).Chown(p.UID, p.GID)
+		}
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		if f.created != nil {
+			*f.created = created
+		}
+	}
+	return h, nil
+}
+
+// AppendAudit adds an entry to the audit log
+func (h *HeldFiles) AppendAudit(filename string, e *AuditEntry, chain bool) error {
+	if h == nil || h.Audit == nil {
+		return AppendAudit(filename, e, chain)
+	}
+	return writeAudit(h.Audit, e, chain)
+}
+
+// AppendHistory records a scan in the history file
+func (h *HeldFiles) AppendHistory(filename string, rec ScanRecord) error {
+	if h == nil || h.History == nil {
+		return AppendHistory(filename, rec)
+	}
+	return writeHistory(h.History, rec)
+}
+
+// SaveResumeState saves the progress of an interrupted scan
+func (h *HeldFiles) SaveResumeState(filename string, s *ResumeState) error {
+	if h == nil || h.Resume == nil {
+		return SaveResumeState(filename, s)
+	}
+	return writeResumeState(h.Resume, s)
+}
+
+// DiscardResumeState removes the resume file of a resumed scan that
+// finished, or the one HoldFiles created for a scan that needed none. When
+// the directory doesn't allow that, the held file is emptied instead.
+func (h *HeldFiles) DiscardResumeState(filename string, resumed bool) {
+	created := h != nil && h.createdResume
+	if !resumed && !created {
+		return
+	}
+	if err := os.Remove(filename); err != nil && h != nil && h.Resume != nil {
+		h.Resume.Truncate(0)
+	}
+}
+
+// Close closes the files held
+func (h *HeldFiles) Close() {
+	if h == nil {
+		return
+	}
+	for _, f := range []*os.File{h.Audit, h.History, h.Resume} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
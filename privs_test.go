@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPrivilegeTarget(t *testing.T) {
+	sudo := map[string]string{"SUDO_UID": "43210", "SUDO_GID": "43211"}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    *Privileges
+		wantErr bool
+	}{
+		{"", nil, nil, true},
+		{"", sudo, &Privileges{User: "43210", UID: 43210, GID: 43211, Groups: []int{43211}}, false},
+		{"43220", sudo, &Privileges{User: "43220", UID: 43220, GID: 43220, Groups: []int{43220}}, false},
+		{"43220:43221", nil, &Privileges{User: "43220", UID: 43220, GID: 43221, Groups: []int{43221}}, false},
+		{"root", sudo, nil, false},
+		{"0", sudo, nil, false},
+		{"43220:staff", nil, nil, true},
+		{"-1", nil, nil, true},
+		{"no-such-user-here", nil, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := PrivilegeTarget(tt.name, func(key string) string { return tt.env[key] })
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PrivilegeTarget(%q) = %+v, %v, expected %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestDropPrivilegesKeepsOutputs(t *testing.T) {
+	// Dropping privileges can't be undone, so the scan runs in a copy of the
+	// test binary
+	if args := os.Getenv("PSCANNER_DROP_TEST"); args != "" {
+		os.Exit(runScan(strings.Split(args, "\n"), nil))
+	}
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("needs root for the -pcap capture the drop follows")
+	}
+
+	// Outputs in a directory only root can enter
+	dir := t.TempDir()
+	private := filepath.Join(dir, "private")
+	if err := os.Mkdir(private, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	audit, history := filepath.Join(private, "audit.log"), filepath.Join(private, "history.db")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	args := []string{"-h", "127.0.0.1", "-p", strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), "-yes",
+		"-pcap", filepath.Join(dir, "scan.pcap"), "-audit-log", audit, "-history", history,
+		"-resume-file", filepath.Join(private, "scan.resume"), "-run-as", "65534:65534"}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDropPrivilegesKeepsOutputs$")
+	cmd.Env = append(os.Environ(), "PSCANNER_DROP_TEST="+strings.Join(args, "\n"))
+	output, err := cmd.CombinedOutput()
+	if strings.Contains(string(output), "Error starting packet capture") {
+		t.Skipf("no packet capture here: %s", output)
+	}
+	if err != nil || !strings.Contains(string(output), "Running as nobody") {
+		t.Fatalf("scan failed: %v\n%s", err, output)
+	}
+
+	for _, filename := range []string{audit, history} {
+		if data, err := os.ReadFile(filename); err != nil || len(data) == 0 {
+			t.Errorf("%s not written after dropping privileges: %v\n%s", filepath.Base(filename), err, output)
+		}
+	}
+	if records, err := LoadHistory(history); err != nil || len(records) != 1 {
+		t.Errorf("LoadHistory() = %d record(s), %v", len(records), err)
+	}
+	// Removed, or emptied since nobody may not remove it from the directory
+	if _, err := LoadResumeState(filepath.Join(private, "scan.resume")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("resume state left behind by a finished scan: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// DropPrivileges switches the process to p's user and groups for good; Go
+// changes every thread, not only the calling one. Sockets and files already
+// open stay usable. It fails when root could be regained afterwards.
+func DropPrivileges(p *Privileges) error {
+	if err := syscall.Setgroups(p.Groups); err != nil {
+		return fmt.Errorf("setting groups: %v", err)
+	}
+	if err := syscall.Setgid(p.GID); err != nil {
+		return fmt.Errorf("setting group %d: %v", p.GID, err)
+	}
+	if err := syscall.Setuid(p.UID); err != nil {
+		return fmt.Errorf("setting user %d: %v", p.UID, err)
+	}
+	if syscall.Setuid(0) == nil {
+		return errors.New("root privileges can still be regained")
+	}
+	return nil
+}
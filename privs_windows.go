@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "errors"
+
+// DropPrivileges is not supported on Windows, where processes are never
+// root and -run-as has no effect
+func DropPrivileges(p *Privileges) error {
+	return errors.New("dropping privileges is not supported on Windows")
+}
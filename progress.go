@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxETA caps the remaining time shown; a scan that slow is better
+// described as "more than" than by an exact figure of months or years
+const maxETA = 99 * time.Hour
+
+// progressMath derives the completed fraction, rate in ports per second and
+// remaining time shown by the human progress formats. It stays finite when
+// there is nothing to scan, no time has passed yet or nothing has finished;
+// known is false while the rate, and so the remaining time, is unknown.
+func progressMath(scanned, total int, elapsed time.Duration) (fraction, rate float64, eta time.Duration, known bool) {
+	if total > 0 {
+		fraction = min(max(float64(scanned)/float64(total), 0), 1)
+	}
+	if elapsed <= 0 || scanned <= 0 {
+		return fraction, 0, 0, total <= 0 || scanned >= total
+	}
+	rate = float64(scanned) / elapsed.Seconds()
+	remaining := float64(max(total-scanned, 0)) / rate
+	if remaining >= maxETA.Seconds() {
+		return fraction, rate, maxETA, true
+	}
+	return fraction, rate, (time.Duration(remaining) * time.Second).Round(time.Second), true
+}
+
+// formatETA renders a remaining time from progressMath
+func formatETA(eta time.Duration, known bool) string {
+	switch {
+	case !known:
+		return "?"
+	case eta >= maxETA:
+		return ">" + strings.TrimSuffix(maxETA.String(), "0m0s")
+	}
+	return eta.String()
+}
+
+// progressLine is the periodic progress report printed when the output is
+// not a terminal
+func progressLine(scanned, total, open int, elapsed time.Duration) string {
+	fraction, rate, eta, known := progressMath(scanned, total, elapsed)
+	return fmt.Sprintf("[Progress] %.2f%% | Scanned: %d/%d | Open: %d | Rate: %.0f/s | ETA: %s",
+		fraction*100, scanned, total, open, rate, formatETA(eta, known))
+}
+
+// exhaustedWarning is printed the first time probes run out of file
+// descriptors
+const exhaustedWarning = "Warning: out of file descriptors; the affected probes wait and retry instead of counting as closed. Lower -c or raise the open file limit (ulimit -n)\n"
+
+// exhaustedNote is appended to the human progress line once probes have run
+// out of file descriptors
+func exhaustedNote(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" | FD limit hit: %d", n)
+}
+
+// progressJSON replaces the human progress report with JSON lines on stderr
+var progressJSON bool
+
+// ProgressEvent is one line of -progress-json output
+type ProgressEvent struct {
+	Time       time.Time `json:"time"`
+	Percent    float64   `json:"percent"`
+	Scanned    int       `json:"scanned"`
+	Total      int       `json:"total"`
+	Open       int       `json:"open"`
+	Rate       float64   `json:"rate"`        // ports per second
+	ETASeconds float64   `json:"eta_seconds"` // -1 until the rate is known
+	Errors     int64     `json:"errors"`
+	Exhausted  int       `json:"fd_exhausted,omitempty"` // attempts put off for lack of file descriptors
+	Done       bool      `json:"done,omitempty"`
+}
+
+// newProgressEvent computes the derived fields of a progress event. Unlike
+// the human formats it never yields NaN or Inf, which JSON cannot encode.
+func newProgressEvent(scanned, total, open int, errors int64, elapsed time.Duration) ProgressEvent {
+	e := ProgressEvent{Time: time.Now().UTC(), Scanned: scanned, Total: total, Open: open,
+		Errors: errors, ETASeconds: -1}
+	if total > 0 {
+		e.Percent = math.Round(float64(scanned)*10000/float64(total)) / 100
+	}
+	if elapsed > 0 {
+		e.Rate = math.Round(float64(scanned)*10/elapsed.Seconds()) / 10
+	}
+	if e.Rate > 0 {
+		e.ETASeconds = math.Round(min(float64(max(total-scanned, 0))/(float64(scanned)/elapsed.Seconds()), maxETA.Seconds()))
+	}
+	return e
+}
+
+// writeProgressEvent prints an event as a single JSON line
+func writeProgressEvent(w io.Writer, e ProgressEvent) error {
+	return json.NewEncoder(w).Encode(e)
+}
+
+// progressBarWidth is the number of cells in the bar itself
+const progressBarWidth = 30
+
+// renderProgressBar draws the single-line progress bar shown on terminals
+func renderProgressBar(scanned, total, open int, elapsed time.Duration) string {
+	fraction, rate, eta, known := progressMath(scanned, total, elapsed)
+	filled := int(fraction * progressBarWidth)
+	return fmt.Sprintf("[%s%s] %5.1f%% %d/%d | %.0f/s | ETA %s | Open: %d",
+		strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth-filled),
+		fraction*100, scanned, total, rate, formatETA(eta, known), open)
+}
+
+// ProgressBar keeps a status line at the bottom of a terminal. Output
+// written through its Writer is printed above the bar, which is redrawn
+// after each write.
+type ProgressBar struct {
+	mu    sync.Mutex
+	out   io.Writer
+	color bool
+	line  string
+}
+
+// NewProgressBar returns a bar drawn on out, dimmed when color is set
+func NewProgressBar(out io.Writer, color bool) *ProgressBar {
+	return &ProgressBar{out: out, color: color}
+}
+
+// Update replaces the status line
+func (p *ProgressBar) Update(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line = line
+	p.draw()
+}
+
+func (p *ProgressBar) draw() {
+	fmt.Fprint(p.out, "\r\x1b[K"+colorize(p.color, ansiDim, p.line))
+}
+
+// Finish leaves the final status line in place and moves below it
+func (p *ProgressBar) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		fmt.Fprint(p.out, "\n")
+	}
+	p.line = ""
+}
+
+// Writer returns a writer whose output appears above the bar
+func (p *ProgressBar) Writer(w io.Writer) io.Writer {
+	return barWriter{bar: p, w: w}
+}
+
+type barWriter struct {
+	bar *ProgressBar
+	w   io.Writer
+}
+
+func (b barWriter) Write(data []byte) (int, error) {
+	b.bar.mu.Lock()
+	defer b.bar.mu.Unlock()
+	if b.bar.line == "" {
+		return b.w.Write(data)
+	}
+	fmt.Fprint(b.bar.out, "\r\x1b[K")
+	n, err := b.w.Write(data)
+	b.bar.draw()
+	return n, err
+}
+
+// statusSnapshot is the detailed status printed when a key is pressed
+// during a scan
+func statusSnapshot(stats *Stats, total int, tracker *hostTracker) string {
+	scanned, open, elapsed := stats.GetStats()
+	var closed, filtered int
+	for _, h := range stats.HostStats() {
+		closed += h.States[StateClosed]
+		filtered += h.States[StateFiltered]
+	}
+	finished, active, hosts := tracker.Hosts()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- Status after %v ---\n", elapsed.Round(time.Second))
+	fmt.Fprintf(&b, "%s\n", progressLine(scanned, total, open, elapsed))
+	fmt.Fprintf(&b, "Open: %d | Closed: %d | Filtered: %d\n", open, closed, filtered)
+	fmt.Fprintf(&b, "Hosts: %d finished, %d in progress, %d total\n", finished, active, hosts)
+	return b.String()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenderProgressBar(t *testing.T) {
+	tests := []struct {
+		name     string
+		scanned  int
+		total    int
+		open     int
+		elapsed  time.Duration
+		expected string
+	}{
+		{
+			name: "Half way", scanned: 500, total: 1000, open: 3, elapsed: 5 * time.Second,
+			expected: "[###############...............]  50.0% 500/1000 | 100/s | ETA 5s | Open: 3",
+		},
+		{
+			name: "Done", scanned: 1000, total: 1000, open: 0, elapsed: 10 * time.Second,
+			expected: "[##############################] 100.0% 1000/1000 | 100/s | ETA 0s | Open: 0",
+		},
+		{
+			name: "No jobs", scanned: 0, total: 0, open: 0, elapsed: time.Second,
+			expected: "[..............................]   0.0% 0/0 | 0/s | ETA 0s | Open: 0",
+		},
+		{
+			name: "No time yet", scanned: 0, total: 1000, open: 0, elapsed: 0,
+			expected: "[..............................]   0.0% 0/1000 | 0/s | ETA ? | Open: 0",
+		},
+		{
+			name: "Nothing finished", scanned: 0, total: 1000, open: 0, elapsed: 5 * time.Second,
+			expected: "[..............................]   0.0% 0/1000 | 0/s | ETA ? | Open: 0",
+		},
+		{
+			name: "Crawling", scanned: 1, total: 10000000, open: 0, elapsed: time.Minute,
+			expected: "[..............................]   0.0% 1/10000000 | 0/s | ETA >99h | Open: 0",
+		},
+		{
+			name: "Overshoot", scanned: 1200, total: 1000, open: 0, elapsed: 10 * time.Second,
+			expected: "[##############################] 100.0% 1200/1000 | 120/s | ETA 0s | Open: 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderProgressBar(tt.scanned, tt.total, tt.open, tt.elapsed); got != tt.expected {
+				t.Errorf("renderProgressBar() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProgressLine(t *testing.T) {
+	tests := []struct {
+		scanned, total int
+		elapsed        time.Duration
+		expected       string
+	}{
+		{500, 1000, 5 * time.Second, "[Progress] 50.00% | Scanned: 500/1000 | Open: 0 | Rate: 100/s | ETA: 5s"},
+		{0, 0, 0, "[Progress] 0.00% | Scanned: 0/0 | Open: 0 | Rate: 0/s | ETA: 0s"},
+		{0, 1000, time.Second, "[Progress] 0.00% | Scanned: 0/1000 | Open: 0 | Rate: 0/s | ETA: ?"},
+		{1, 1 << 30, time.Hour, "[Progress] 0.00% | Scanned: 1/1073741824 | Open: 0 | Rate: 0/s | ETA: >99h"},
+	}
+	for _, tt := range tests {
+		got := progressLine(tt.scanned, tt.total, 0, tt.elapsed)
+		if got != tt.expected {
+			t.Errorf("progressLine(%d, %d, %v) = %q, expected %q", tt.scanned, tt.total, tt.elapsed, got, tt.expected)
+		}
+		if strings.Contains(got, "NaN") || strings.Contains(got, "Inf") {
+			t.Errorf("progressLine() = %q", got)
+		}
+	}
+}
+
+func TestProgressBarWriter(t *testing.T) {
+	var term strings.Builder
+	bar := NewProgressBar(&term, false)
+	out := bar.Writer(&term)
+
+	out.Write([]byte("before\n"))
+	bar.Update("[50%]")
+	out.Write([]byte("10.0.0.1:22\n"))
+	bar.Finish()
+	out.Write([]byte("after\n"))
+
+	expected := "before\n" +
+		"\r\x1b[K[50%]" +
+		"\r\x1b[K10.0.0.1:22\n\r\x1b[K[50%]" +
+		"\n" +
+		"after\n"
+	if term.String() != expected {
+		t.Errorf("terminal output = %q, expected %q", term.String(), expected)
+	}
+}
+
+func TestStatusSnapshot(t *testing.T) {
+	stats := &Stats{startTime: time.Now().Add(-10 * time.Second)}
+	var level atomic.Int32
+	tracker := newHostTracker(io.Discard, false, stats, map[string]int{"10.0.0.1": 2, "10.0.0.2": 2}, &level)
+
+	now := time.Now()
+	for _, p := range []struct {
+		port  int
+		state PortState
+	}{{22, StateOpen}, {23, StateClosed}} {
+		tracker.Queued("10.0.0.1")
+		stats.RecordProbe("10.0.0.1", p.state, nil, now, time.Millisecond)
+		stats.IncrementScanned()
+		tracker.Probed(ScanJob{Host: "10.0.0.1", Port: p.port}, p.state, nil)
+	}
+	stats.IncrementOpen()
+	tracker.Queued("10.0.0.2")
+	stats.RecordProbe("10.0.0.2", StateFiltered, nil, now, time.Millisecond)
+	stats.IncrementScanned()
+	tracker.Probed(ScanJob{Host: "10.0.0.2", Port: 22}, StateFiltered, nil)
+
+	got := statusSnapshot(stats, 4, tracker)
+	for _, want := range []string{
+		"--- Status after 10s ---\n",
+		"Scanned: 3/4",
+		"Open: 1 | Closed: 1 | Filtered: 1\n",
+		"Hosts: 1 finished, 1 in progress, 2 total\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("statusSnapshot() = %q, missing %q", got, want)
+		}
+	}
+}
+
+func TestNewProgressEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		scanned int
+		total   int
+		errors  int64
+		elapsed time.Duration
+		percent float64
+		rate    float64
+		eta     float64
+	}{
+		{name: "Half way", scanned: 500, total: 1000, errors: 2, elapsed: 5 * time.Second, percent: 50, rate: 100, eta: 5},
+		{name: "Fraction", scanned: 1, total: 3, elapsed: 3 * time.Second, percent: 33.33, rate: 0.3, eta: 6},
+		{name: "Nothing yet", scanned: 0, total: 1000, elapsed: 0, percent: 0, rate: 0, eta: -1},
+		{name: "No jobs", scanned: 0, total: 0, elapsed: time.Second, percent: 0, rate: 0, eta: -1},
+		{name: "Crawling", scanned: 1, total: 1 << 30, elapsed: time.Second, percent: 0, rate: 1, eta: maxETA.Seconds()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newProgressEvent(tt.scanned, tt.total, 1, tt.errors, tt.elapsed)
+			if e.Percent != tt.percent || e.Rate != tt.rate || e.ETASeconds != tt.eta {
+				t.Errorf("newProgressEvent() = %.2f%% %v/s eta %v, expected %.2f%% %v/s eta %v",
+					e.Percent, e.Rate, e.ETASeconds, tt.percent, tt.rate, tt.eta)
+			}
+			if e.Scanned != tt.scanned || e.Total != tt.total || e.Open != 1 || e.Errors != tt.errors {
+				t.Errorf("newProgressEvent() counts = %+v", e)
+			}
+
+			var buf strings.Builder
+			if err := writeProgressEvent(&buf, e); err != nil {
+				t.Fatalf("writeProgressEvent() error = %v", err)
+			}
+			if line := buf.String(); strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "}\n") {
+				t.Errorf("writeProgressEvent() = %q, expected one JSON line", line)
+			}
+		})
+	}
+}
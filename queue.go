@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// In worker mode pscanner takes batches of targets from a message queue and
+// publishes what it finds back to another queue, so it can sit behind
+// existing job infrastructure. Redis lists and NATS subjects are supported,
+// both spoken directly over TCP.
+
+// QueueBatch is a batch of targets read from the jobs queue
+type QueueBatch struct {
+	ID string `json:"id"`
+	ScanRequest
+}
+
+// QueueMessage is published to the results queue: one "result" message per
+// open port and a final "done" message per batch
+type QueueMessage struct {
+	Batch   string `json:"batch"`
+	Type    string `json:"type"`
+	*Result `json:",omitempty"`
+	Scanned int    `json:"scanned,omitempty"`
+	Open    int    `json:"open,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Queue is a source of batches and a sink for results
+type Queue interface {
+	// Receive blocks until a batch is available or ctx is done
+	Receive(ctx context.Context) ([]byte, error)
+	// Ack tells the queue the batch last received is done with, once its
+	// results are published
+	Ack() error
+	// Release hands the batch last received back to the queue, unfinished,
+	// for another worker to take
+	Release() error
+	Publish(data []byte) error
+	Close() error
+}
+
+// OpenQueue connects to a redis:// or nats:// URL. jobs and results name the
+// Redis lists or NATS subjects to consume from and publish to.
+func OpenQueue(rawURL, jobs, results string) (Queue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "redis":
+		return dialRedis(u, jobs, results)
+	case "nats":
+		return dialNATS(u, jobs, results)
+	}
+	return nil, fmt.Errorf("unsupported queue %q (use redis:// or nats://)", rawURL)
+}
+
+// redisQueue moves batches from one Redis list to a processing list while
+// they are scanned, and pushes results onto another list
+type redisQueue struct {
+	mu         sync.Mutex
+	conn       net.Conn
+	r          *bufio.Reader
+	jobs       string
+	processing string // <jobs>.processing, holding the batches being scanned
+	results    string
+	current    string // the batch last received, until acked or released
+}
+
+func dialRedis(u *url.URL, jobs, results string) (*redisQueue, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	q := &redisQueue{conn: conn, r: bufio.NewReader(conn), jobs: jobs, processing: jobs + ".processing", results: results}
+
+	if password, ok := u.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if name := u.User.Username(); name != "" {
+			args = []string{"AUTH", name, password}
+		}
+		if _, err := q.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := q.do("SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// do sends a command and reads its reply
+func (q *redisQueue) do(args ...string) (any, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.conn.Write(encodeRESP(args)); err != nil {
+		return nil, err
+	}
+	return readRESP(q.r)
+}
+
+func (q *redisQueue) Receive(ctx context.Context) ([]byte, error) {
+	for ctx.Err() == nil {
+		// Block for at most a second so cancellation is noticed
+		reply, err := q.do("BLMOVE", q.jobs, q.processing, "LEFT", "RIGHT", "1")
+		if err != nil {
+			return nil, err
+		}
+		if data, ok := reply.([]byte); ok {
+			q.current = string(data)
+			return data, nil
+		}
+	}
+	return nil, ctx.Err()
+}
+
+func (q *redisQueue) Publish(data []byte) error {
+	_, err := q.do("RPUSH", q.results, string(data))
+	return err
+}
+
+// Ack drops the batch last received from the processing list. A worker that
+// dies before then leaves it there, for requeueing by hand.
+func (q *redisQueue) Ack() error {
+	if q.current == "" {
+		return nil
+	}
+	_, err := q.do("LREM", q.processing, "1", q.current)
+	q.current = ""
+	return err
+}
+
+// Release puts the batch last received back at the head of the jobs list.
+// It is pushed before it leaves the processing list, so a failure in between
+// duplicates it rather than losing it.
+func (q *redisQueue) Release() error {
+	if q.current == "" {
+		return nil
+	}
+	if _, err := q.do("LPUSH", q.jobs, q.current); err != nil {
+		return err
+	}
+	return q.Ack()
+}
+
+func (q *redisQueue) Close() error {
+	return q.conn.Close()
+}
+
+// encodeRESP encodes a command as a RESP array of bulk strings
+func encodeRESP(args []string) []byte {
+	b := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		b = fmt.Appendf(b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b
+}
+
+// readRESP reads one RESP value: simple strings become string, integers
+// int64, bulk strings []byte, arrays []any and nulls nil. Error replies are
+// returned as errors.
+func readRESP(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty RESP reply")
+	}
+	body := line[1:]
+	switch line[0] {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, fmt.Errorf("redis: %s", body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected RESP reply %q", line)
+}
+
+// natsPrefetch is how many batches a worker asks the NATS server for at a
+// time. One means a worker holds no batch it isn't about to scan, which
+// others in the queue group could be scanning instead.
+const natsPrefetch = 1
+
+// natsMsg is a batch received from NATS and the subject to acknowledge it on,
+// which JetStream sets and plain subjects don't
+type natsMsg struct {
+	data  []byte
+	reply string
+}
+
+// natsQueue subscribes to the jobs subject in the "pscanner" queue group, so
+// each batch goes to exactly one worker, and publishes to the results subject.
+// Each subscription asks for only natsPrefetch batches, and a new one is made
+// once they have been received, so batches never pile up in the worker.
+type natsQueue struct {
+	mu      sync.Mutex // serializes writes to conn
+	conn    net.Conn
+	jobs    string
+	results string
+
+	pendingMu sync.Mutex
+	pending   []natsMsg
+	sid       int           // the latest subscription
+	owed      int           // batches it may still deliver
+	reply     string        // where to acknowledge the batch last received
+	err       error         // set once the connection is gone
+	ready     chan struct{} // signalled when pending or err changes
+}
+
+func dialNATS(u *url.URL, jobs, results string) (*natsQueue, error) {
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	info, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("not a NATS server: %q", strings.TrimSpace(info))
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "pscanner", "lang": "go"}
+	if password, ok := u.User.Password(); ok {
+		options["user"], options["pass"] = u.User.Username(), password
+	} else if u.User != nil {
+		options["auth_token"] = u.User.Username()
+	}
+	connect, _ := json.Marshal(options)
+	// The PING makes the server report an authentication failure right away
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(reply, "PONG") {
+		conn.Close()
+		return nil, fmt.Errorf("NATS connect failed: %s", strings.TrimSpace(reply))
+	}
+
+	q := &natsQueue{conn: conn, jobs: jobs, results: results, ready: make(chan struct{}, 1)}
+	go q.read(r)
+	return q, nil
+}
+
+// read handles incoming protocol messages. Batches are buffered rather than
+// handed over directly so server PINGs are answered while a batch is scanned.
+func (q *natsQueue) read(r *bufio.Reader) {
+	for {
+		msg, err := q.readMsg(r)
+		q.pendingMu.Lock()
+		if err != nil {
+			q.err = err
+		} else {
+			q.owed--
+			q.pending = append(q.pending, msg)
+		}
+		q.pendingMu.Unlock()
+		select {
+		case q.ready <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// readMsg returns the next MSG from the server
+func (q *natsQueue) readMsg(r *bufio.Reader) (natsMsg, error) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return natsMsg{}, err
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		switch {
+		case line == "PING":
+			q.write("PONG\r\n")
+		case strings.HasPrefix(line, "-ERR"):
+			slog.Error("NATS error", "message", strings.TrimPrefix(line, "-ERR "))
+		case strings.HasPrefix(line, "MSG "):
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			fields := strings.Fields(line)
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 || len(fields) < 4 {
+				return natsMsg{}, fmt.Errorf("malformed NATS message %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return natsMsg{}, err
+			}
+			msg := natsMsg{data: payload[:n]}
+			if len(fields) == 5 {
+				msg.reply = fields[3]
+			}
+			return msg, nil
+		}
+	}
+}
+
+func (q *natsQueue) write(s string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	_, err := io.WriteString(q.conn, s)
+	return err
+}
+
+func (q *natsQueue) Receive(ctx context.Context) ([]byte, error) {
+	for {
+		q.pendingMu.Lock()
+		if len(q.pending) > 0 {
+			msg := q.pending[0]
+			q.pending = q.pending[1:]
+			q.reply = msg.reply
+			q.pendingMu.Unlock()
+			return msg.data, nil
+		}
+		err := q.err
+		// Ask for more batches once the last subscription has delivered all
+		// it was going to; the server drops it by itself
+		subscribe := q.owed == 0
+		if subscribe {
+			q.sid++
+			q.owed = natsPrefetch
+		}
+		sid := q.sid
+		q.pendingMu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		if subscribe {
+			if err := q.write(fmt.Sprintf("SUB %s pscanner %d\r\nUNSUB %d %d\r\n", q.jobs, sid, sid, natsPrefetch)); err != nil {
+				return nil, err
+			}
+		}
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (q *natsQueue) Publish(data []byte) error {
+	return q.write(fmt.Sprintf("PUB %s %d\r\n%s\r\n", q.results, len(data), data))
+}
+
+// Ack acknowledges the batch last received to JetStream, which delivers it
+// again if that never happens. Batches published to a plain subject have
+// nothing to acknowledge.
+func (q *natsQueue) Ack() error {
+	q.pendingMu.Lock()
+	reply := q.reply
+	q.reply = ""
+	q.pendingMu.Unlock()
+	if reply == "" {
+		return nil
+	}
+	return q.write(fmt.Sprintf("PUB %s 4\r\n+ACK\r\n", reply))
+}
+
+// Release tells JetStream to deliver the batch last received again at once,
+// rather than after its acknowledgement times out. A batch published to a
+// plain subject cannot be handed back.
+func (q *natsQueue) Release() error {
+	q.pendingMu.Lock()
+	reply := q.reply
+	q.reply = ""
+	q.pendingMu.Unlock()
+	if reply == "" {
+		return nil
+	}
+	return q.write(fmt.Sprintf("PUB %s 4\r\n-NAK\r\n", reply))
+}
+
+func (q *natsQueue) Close() error {
+	return q.conn.Close()
+}
+
+// ProcessBatch scans one batch and publishes its results followed by a done message
+func ProcessBatch(ctx context.Context, q Queue, data []byte, probe ProbeConfig) error {
+	var batch QueueBatch
+	if err := json.Unmarshal(data, &batch); err != nil {
+		slog.Warn("invalid batch", "err", err)
+		return publishMessage(q, QueueMessage{Type: "done", Error: fmt.Sprintf("invalid batch: %v", err)})
+	}
+	done := QueueMessage{Batch: batch.ID, Type: "done"}
+	hosts, portList, err := prepareScan(batch.ScanRequest, defaultMaxHosts)
+	if err == nil {
+		err = checkRate(batch.Rate)
+	}
+	if err != nil {
+		slog.Warn("invalid batch", "batch", batch.ID, "err", err)
+		done.Error = err.Error()
+		return publishMessage(q, done)
+	}
+	slog.Debug("scanning batch", "batch", batch.ID, "hosts", len(hosts), "ports", len(portList))
+
+	workers := batch.Concurrency
+	if workers <= 0 {
+		workers = concurrency
+	}
+	workers = min(workers, defaultMaxWorkers)
+	var publishErr error
+	stats := &Stats{startTime: time.Now()}
+	RunScan(ctx, hosts, portList, ScanOptions{Workers: workers, Rate: batch.Rate, Probe: probe}, stats, func(r Result) {
+		err := publishMessage(q, QueueMessage{Batch: batch.ID, Type: "result", Result: &r})
+		publishErr = errors.Join(publishErr, err)
+	})
+	if publishErr != nil {
+		return publishErr
+	}
+	done.Scanned, done.Open, _ = stats.GetStats()
+	if ctx.Err() != nil {
+		done.Error = "worker stopped"
+	}
+	slog.Info("batch done", "batch", batch.ID, "scanned", done.Scanned, "open", done.Open)
+	return publishMessage(q, done)
+}
+
+func publishMessage(q Queue, msg QueueMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return q.Publish(data)
+}
+
+// runWorker implements the "worker" subcommand
+func runWorker(args []string) int {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	queueURL := flags.String("queue", "", "Queue to consume from (redis://host:6379/0 or nats://host:4222)")
+	jobs := flags.String("jobs", "pscanner.jobs", "Redis list or NATS subject to read batches from")
+	results := flags.String("results", "pscanner.results", "Redis list or NATS subject to publish results to")
+	flags.StringVar(&geoipFiles, "geoip", "", "MaxMind DB files for country/ASN lookups, comma-separated")
+	flags.StringVar(&enrich, "enrich", "", "Extra lookups for open ports, comma-separated (rdap, shodan, censys)")
+	addProbeFlags(flags)
+	addLogFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if !checkProbeFlags() {
+		return 2
+	}
+	if err := enableGeoIP(geoipFiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if err := enableEnrichers(enrich, probeConfig.Timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+
+	if *queueURL == "" {
+		fmt.Fprintf(os.Stderr, "Error: -queue is required\n")
+		return 2
+	}
+	q, err := OpenQueue(*queueURL, *jobs, *results)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to queue: %v\n", err)
+		return 1
+	}
+	defer q.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	slog.Info("waiting for batches", "queue", *jobs)
+	for {
+		data, err := q.Receive(ctx)
+		if err != nil && ctx.Err() != nil {
+			return 0
+		}
+		if err != nil {
+			slog.Error("reading from queue", "err", err)
+			return 1
+		}
+		if ctx.Err() == nil {
+			if err := ProcessBatch(ctx, q, data, probeConfig); err != nil {
+				slog.Error("publishing results", "err", err)
+				return 1
+			}
+		}
+		// A batch cut short goes back to the queue for another worker
+		if ctx.Err() != nil {
+			if err := q.Release(); err != nil {
+				slog.Error("returning batch to the queue", "err", err)
+				return 1
+			}
+			return 0
+		}
+		if err := q.Ack(); err != nil {
+			slog.Error("acknowledging batch", "err", err)
+			return 1
+		}
+	}
+}
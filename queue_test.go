@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadRESP(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected any
+		wantErr  bool
+	}{
+		{name: "Simple string", input: "+OK\r\n", expected: "OK"},
+		{name: "Integer", input: ":42\r\n", expected: int64(42)},
+		{name: "Bulk string", input: "$5\r\nhello\r\n", expected: []byte("hello")},
+		{name: "Null bulk string", input: "$-1\r\n", expected: nil},
+		{name: "Array", input: "*2\r\n$4\r\njobs\r\n:1\r\n", expected: []any{[]byte("jobs"), int64(1)}},
+		{name: "Null array", input: "*-1\r\n", expected: nil},
+		{name: "Error reply", input: "-ERR wrong type\r\n", wantErr: true},
+		{name: "Unknown type", input: "?\r\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRESP(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRESP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("readRESP() = %#v, expected %#v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// fakeRedis serves BLMOVE, LPUSH, RPUSH and LREM on in-memory lists
+type fakeRedis struct {
+	mu    sync.Mutex
+	lists map[string][]string
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		cmd, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range cmd.([]any) {
+			args = append(args, string(arg.([]byte)))
+		}
+		f.mu.Lock()
+		switch strings.ToUpper(args[0]) {
+		case "BLMOVE": // always LEFT RIGHT
+			if items := f.lists[args[1]]; len(items) > 0 {
+				f.lists[args[1]] = items[1:]
+				f.lists[args[2]] = append(f.lists[args[2]], items[0])
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(items[0]), items[0])
+			} else {
+				conn.Write([]byte("$-1\r\n"))
+			}
+		case "LPUSH":
+			f.lists[args[1]] = append([]string{args[2]}, f.lists[args[1]]...)
+			fmt.Fprintf(conn, ":%d\r\n", len(f.lists[args[1]]))
+		case "RPUSH":
+			f.lists[args[1]] = append(f.lists[args[1]], args[2])
+			fmt.Fprintf(conn, ":%d\r\n", len(f.lists[args[1]]))
+		case "LREM": // always count 1
+			items, removed := f.lists[args[1]], 0
+			for i, item := range items {
+				if item == args[3] {
+					f.lists[args[1]] = append(items[:i:i], items[i+1:]...)
+					removed = 1
+					break
+				}
+			}
+			fmt.Fprintf(conn, ":%d\r\n", removed)
+		default:
+			conn.Write([]byte("+OK\r\n"))
+		}
+		f.mu.Unlock()
+	}
+}
+
+func decodeQueueMessages(t *testing.T, raw []string) []QueueMessage {
+	t.Helper()
+	var msgs []QueueMessage
+	for _, data := range raw {
+		var msg QueueMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("invalid message %s: %v", data, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func TestRedisWorker(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer target.Close()
+	port := target.Addr().(*net.TCPAddr).Port
+
+	batch := fmt.Sprintf(`{"id": "b1", "hosts": ["127.0.0.1"], "ports": "%d"}`, port)
+	redis := &fakeRedis{lists: map[string][]string{"jobs": {batch, "not json", `{"id": "b2", "hosts": ["127.0.0.1"], "ports": "1", "rate": 2000000000}`}}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go redis.serve(conn)
+		}
+	}()
+
+	q, err := OpenQueue("redis://:secret@"+ln.Addr().String()+"/2", "jobs", "results")
+	if err != nil {
+		t.Fatalf("OpenQueue() error = %v", err)
+	}
+	defer q.Close()
+
+	for range 3 {
+		data, err := q.Receive(context.Background())
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if err := ProcessBatch(context.Background(), q, data, quickProbe); err != nil {
+			t.Fatalf("ProcessBatch() error = %v", err)
+		}
+		if err := q.Ack(); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+
+	redis.mu.Lock()
+	msgs := decodeQueueMessages(t, redis.lists["results"])
+	if processing := redis.lists["jobs.processing"]; len(processing) != 0 {
+		t.Errorf("processing list after acks = %q, expected it empty", processing)
+	}
+	redis.mu.Unlock()
+	if len(msgs) != 4 {
+		t.Fatalf("published %d messages, expected 4: %+v", len(msgs), msgs)
+	}
+	if msgs[0].Type != "result" || msgs[0].Batch != "b1" || msgs[0].Result == nil || msgs[0].Port != port {
+		t.Errorf("first message = %+v, expected result for port %d", msgs[0], port)
+	}
+	if msgs[1].Type != "done" || msgs[1].Scanned != 1 || msgs[1].Open != 1 || msgs[1].Error != "" {
+		t.Errorf("second message = %+v, expected done with 1 open port", msgs[1])
+	}
+	if msgs[2].Type != "done" || msgs[2].Error == "" {
+		t.Errorf("third message = %+v, expected done with an error", msgs[2])
+	}
+	if msgs[3].Type != "done" || msgs[3].Batch != "b2" || msgs[3].Scanned != 0 || msgs[3].Error == "" {
+		t.Errorf("fourth message = %+v, expected done with an error for the rate", msgs[3])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := q.Receive(ctx); err == nil {
+		t.Error("Receive() on an empty list returned no error after cancellation")
+	}
+}
+
+func TestRedisWorkerInterrupted(t *testing.T) {
+	batch := `{"id": "b1", "hosts": ["127.0.0.1"], "ports": "1-1024"}`
+	redis := &fakeRedis{lists: map[string][]string{"jobs": {batch, "next"}}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go redis.serve(conn)
+		}
+	}()
+	q, err := OpenQueue("redis://"+ln.Addr().String(), "jobs", "results")
+	if err != nil {
+		t.Fatalf("OpenQueue() error = %v", err)
+	}
+	defer q.Close()
+
+	data, err := q.Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	redis.mu.Lock()
+	if processing := redis.lists["jobs.processing"]; !reflect.DeepEqual(processing, []string{batch}) {
+		t.Errorf("processing list while scanning = %q, expected the batch", processing)
+	}
+	redis.mu.Unlock()
+
+	// The worker is stopped in the middle of the batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ProcessBatch(ctx, q, data, quickProbe); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if err := q.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	redis.mu.Lock()
+	defer redis.mu.Unlock()
+	if jobs := redis.lists["jobs"]; !reflect.DeepEqual(jobs, []string{batch, "next"}) {
+		t.Errorf("jobs list after release = %q, expected the batch back at its head", jobs)
+	}
+	if processing := redis.lists["jobs.processing"]; len(processing) != 0 {
+		t.Errorf("processing list after release = %q, expected it empty", processing)
+	}
+}
+
+func TestNATSQueue(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	published := make(chan string, 1)
+	acked := make(chan string, 1)
+	unsub := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "INFO {\"server_id\":\"test\"}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			switch {
+			case line == "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "SUB jobs pscanner "):
+				sid := strings.Fields(line)[3]
+				fmt.Fprintf(conn, "PING\r\nMSG jobs %s $JS.ACK.jobs.1 5\r\nhello\r\n", sid)
+			case strings.HasPrefix(line, "UNSUB "):
+				unsub <- line
+			case strings.HasPrefix(line, "PUB $JS.ACK.jobs.1 "):
+				payload := make([]byte, 6)
+				io.ReadFull(r, payload)
+				acked <- string(payload[:4])
+			case strings.HasPrefix(line, "PUB results "):
+				n, _ := strconv.Atoi(strings.Fields(line)[2])
+				payload := make([]byte, n+2)
+				io.ReadFull(r, payload)
+				published <- string(payload[:n])
+			}
+		}
+	}()
+
+	q, err := OpenQueue("nats://"+ln.Addr().String(), "jobs", "results")
+	if err != nil {
+		t.Fatalf("OpenQueue() error = %v", err)
+	}
+	defer q.Close()
+
+	data, err := q.Receive(context.Background())
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Receive() = %q, %v, expected \"hello\"", data, err)
+	}
+	if err := q.Publish([]byte(`{"type":"done"}`)); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	select {
+	case got := <-published:
+		if got != `{"type":"done"}` {
+			t.Errorf("server received %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never received the published message")
+	}
+	if got := <-unsub; got != "UNSUB 1 1" {
+		t.Errorf("subscription limited with %q, expected \"UNSUB 1 1\"", got)
+	}
+
+	if err := q.Ack(); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	select {
+	case got := <-acked:
+		if got != "+ACK" {
+			t.Errorf("server received ack %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server never received the ack")
+	}
+}
+
+func TestOpenQueueUnsupported(t *testing.T) {
+	if _, err := OpenQueue("amqp://localhost", "jobs", "results"); err == nil {
+		t.Error("OpenQueue() with amqp:// returned no error")
+	}
+}
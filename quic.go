@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// QUICInfo is what a QUIC endpoint answered
+type QUICInfo struct {
+	Versions []string `json:"versions"` // the QUIC versions it supports, e.g. "v1"
+}
+
+// quicReservedVersion is a version reserved to exercise version negotiation,
+// which no server supports and every server must answer by listing its own
+const quicReservedVersion = 0x1a2a3a4a
+
+// quicConnectionID identifies the probe in the reply
+var quicConnectionID = []byte("pscanner")
+
+// quicVersionProbe is a long header Initial packet in the reserved version,
+// padded to the 1200 bytes a server requires before it answers
+func quicVersionProbe() []byte {
+	packet := []byte{0xc0}
+	packet = binary.BigEndian.AppendUint32(packet, quicReservedVersion)
+	packet = append(packet, byte(len(quicConnectionID)))
+	packet = append(packet, quicConnectionID...)
+	packet = append(packet, byte(len(quicConnectionID)))
+	packet = append(packet, quicConnectionID...)
+	return append(packet, make([]byte, 1200-len(packet))...)
+}
+
+// quicVersionNames names the versions in use
+var quicVersionNames = map[uint32]string{
+	0x00000001: "v1",
+	0x6b3343cf: "v2",
+	0xff00001d: "draft-29",
+	0x51303530: "Q050",
+	0x54303530: "T050",
+	0x54303531: "T051",
+}
+
+// parseQUICReply is the Parse of the -udp quic probe, checking for a version
+// negotiation packet addressed to the probe
+func parseQUICReply(r *Result, request, reply []byte) bool {
+	if len(reply) < 7 || reply[0]&0x80 == 0 || binary.BigEndian.Uint32(reply[1:]) != 0 {
+		return false
+	}
+	rest := reply[5:]
+	for range 2 { // destination then source connection ID
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+			return false
+		}
+		rest = rest[1+rest[0]:]
+	}
+	info := &QUICInfo{}
+	for ; len(rest) >= 4; rest = rest[4:] {
+		v := binary.BigEndian.Uint32(rest)
+		if v&0x0f0f0f0f == 0x0a0a0a0a { // greased, reserved like ours
+			continue
+		}
+		name, ok := quicVersionNames[v]
+		if !ok {
+			name = fmt.Sprintf("0x%08x", v)
+		}
+		info.Versions = append(info.Versions, name)
+	}
+	if len(info.Versions) == 0 {
+		return false
+	}
+	r.QUIC, r.Service = info, "quic"
+	return true
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"math/rand/v2"
+)
+
+// The -randomize and -seed flags
+var (
+	randomize bool
+	seed      uint64
+)
+
+// newRand returns a generator that always yields the same sequence for the
+// same seed, so a randomized scan can be repeated exactly
+func newRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+}
+
+// shuffleTargets puts hosts and ports in random order. Jobs still go host by
+// host, but which host comes next and the order of its ports are unpredictable.
+func shuffleTargets(r *rand.Rand, hosts []string, ports []int) {
+	r.Shuffle(len(hosts), func(i, j int) { hosts[i], hosts[j] = hosts[j], hosts[i] })
+	r.Shuffle(len(ports), func(i, j int) { ports[i], ports[j] = ports[j], ports[i] })
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestShuffleTargets(t *testing.T) {
+	shuffled := func(seed uint64) ([]string, []int) {
+		hosts := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+		ports := []int{21, 22, 23, 25, 80, 443, 8080, 8443}
+		shuffleTargets(newRand(seed), hosts, ports)
+		return hosts, ports
+	}
+
+	hosts, ports := shuffled(42)
+	againHosts, againPorts := shuffled(42)
+	if !reflect.DeepEqual(hosts, againHosts) || !reflect.DeepEqual(ports, againPorts) {
+		t.Errorf("seed 42 gave %v %v, then %v %v", hosts, ports, againHosts, againPorts)
+	}
+
+	sortedPorts := slices.Clone(ports)
+	slices.Sort(sortedPorts)
+	if !reflect.DeepEqual(sortedPorts, []int{21, 22, 23, 25, 80, 443, 8080, 8443}) {
+		t.Errorf("shuffleTargets() lost or duplicated ports: %v", ports)
+	}
+
+	otherHosts, otherPorts := shuffled(43)
+	if reflect.DeepEqual(hosts, otherHosts) && reflect.DeepEqual(ports, otherPorts) {
+		t.Errorf("seeds 42 and 43 gave the same order %v %v", hosts, ports)
+	}
+}
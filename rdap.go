@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rdapBaseURL is the RDAP bootstrap service; it redirects each query to the
+// registry responsible for the address
+var rdapBaseURL = "https://rdap.org"
+
+// RDAP annotates results with the network that owns their address. Answers
+// cover whole ranges, so they are cached by range and most hosts in a large
+// scan need no query at all. Queries are serialized and spaced out to stay
+// within registry rate limits.
+type RDAP struct {
+	client   *http.Client
+	interval time.Duration
+
+	mu       sync.Mutex
+	last     time.Time
+	networks []*rdapNetwork
+	failed   map[string]bool
+}
+
+type rdapNetwork struct {
+	start, end net.IP
+	cidr       string
+	name       string
+	owner      string
+}
+
+// NewRDAP returns an RDAP enricher making at most one query per interval
+func NewRDAP(interval time.Duration) *RDAP {
+	return &RDAP{
+		client:   &http.Client{Timeout: 15 * time.Second},
+		interval: interval,
+		failed:   make(map[string]bool),
+	}
+}
+
+// Enrich fills in the network range, network name and owning organization
+func (e *RDAP) Enrich(r *Result, probe ProbeConfig) {
+	ip := net.ParseIP(r.IP)
+	if ip == nil {
+		return
+	}
+	n := e.lookup(ip)
+	if n == nil {
+		return
+	}
+	r.Network = n.cidr
+	r.NetName = n.name
+	r.Owner = n.owner
+}
+
+func (e *RDAP) lookup(ip net.IP) *rdapNetwork {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, n := range e.networks {
+		if ipInRange(ip, n.start, n.end) {
+			return n
+		}
+	}
+	if e.failed[ip.String()] {
+		return nil
+	}
+
+	if wait := e.interval - time.Since(e.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	e.last = time.Now()
+	n, err := e.query(ip)
+	if err != nil {
+		e.failed[ip.String()] = true
+		return nil
+	}
+	e.networks = append(e.networks, n)
+	return n
+}
+
+// rdapResponse holds the parts of an RDAP IP network object we use
+type rdapResponse struct {
+	StartAddress string `json:"startAddress"`
+	EndAddress   string `json:"endAddress"`
+	Name         string `json:"name"`
+	CIDRs        []struct {
+		V4Prefix string `json:"v4prefix"`
+		V6Prefix string `json:"v6prefix"`
+		Length   int    `json:"length"`
+	} `json:"cidr0_cidrs"`
+	Entities []struct {
+		Roles      []string `json:"roles"`
+		VCardArray []any    `json:"vcardArray"`
+	} `json:"entities"`
+}
+
+func (e *RDAP) query(ip net.IP) (*rdapNetwork, error) {
+	req, err := http.NewRequest(http.MethodGet, rdapBaseURL+"/ip/"+ip.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP lookup for %s returned %s", ip, resp.Status)
+	}
+	var body rdapResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return parseRDAPNetwork(ip, body), nil
+}
+
+func parseRDAPNetwork(ip net.IP, body rdapResponse) *rdapNetwork {
+	n := &rdapNetwork{
+		start: net.ParseIP(body.StartAddress),
+		end:   net.ParseIP(body.EndAddress),
+		name:  body.Name,
+	}
+	if n.start == nil || n.end == nil {
+		// Without a range the answer can only be reused for this address
+		n.start, n.end = ip, ip
+	}
+
+	var cidrs []string
+	for _, c := range body.CIDRs {
+		prefix := c.V4Prefix
+		if prefix == "" {
+			prefix = c.V6Prefix
+		}
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", prefix, c.Length))
+	}
+	n.cidr = strings.Join(cidrs, ",")
+	if n.cidr == "" && body.StartAddress != "" {
+		n.cidr = body.StartAddress + " - " + body.EndAddress
+	}
+
+	// Prefer the registrant; fall back to the first entity with a name
+	for _, entity := range body.Entities {
+		name := vcardName(entity.VCardArray)
+		if name == "" {
+			continue
+		}
+		registrant := false
+		for _, role := range entity.Roles {
+			registrant = registrant || role == "registrant"
+		}
+		if registrant || n.owner == "" {
+			n.owner = name
+		}
+		if registrant {
+			break
+		}
+	}
+	return n
+}
+
+// vcardName returns the "fn" property of a jCard: ["vcard", [[name, params, type, value], ...]]
+func vcardName(vcard []any) string {
+	if len(vcard) < 2 {
+		return ""
+	}
+	props, _ := vcard[1].([]any)
+	for _, p := range props {
+		prop, _ := p.([]any)
+		if len(prop) >= 4 && prop[0] == "fn" {
+			name, _ := prop[3].(string)
+			return name
+		}
+	}
+	return ""
+}
+
+// ipInRange reports whether ip lies between start and end inclusive
+func ipInRange(ip, start, end net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		start, end = start.To4(), end.To4()
+		if start == nil || end == nil {
+			return false
+		}
+	} else {
+		ip, start, end = ip.To16(), start.To16(), end.To16()
+	}
+	return bytes.Compare(ip, start) >= 0 && bytes.Compare(ip, end) <= 0
+}
+
+// enableEnrichers turns on the enrichment steps named in a comma-separated
+// list; wait is the connection timeout of those that talk to the port
+func enableEnrichers(list string, wait time.Duration) error {
+	for _, name := range strings.Split(list, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "rdap":
+			enrichers = append(enrichers, NewRDAP(time.Second))
+		case "banner":
+			enrichers = append(enrichers, BannerGrabber{Timeout: wait})
+		case "ftp-anon":
+			enrichers = append(enrichers, FTPAnonChecker{Timeout: wait})
+		case "smtp":
+			enrichers = append(enrichers, SMTPChecker{Timeout: wait})
+		case "smtp-relay":
+			enrichers = append(enrichers, SMTPChecker{Timeout: wait, Relay: true})
+		case "db":
+			enrichers = append(enrichers, DatabaseProber{Timeout: wait})
+		case "cache":
+			enrichers = append(enrichers, CacheProber{Timeout: wait})
+		case "smb":
+			enrichers = append(enrichers, SMBProber{Timeout: wait})
+		case "rdp":
+			enrichers = append(enrichers, RDPProber{Timeout: wait})
+		case "tls":
+			enrichers = append(enrichers, TLSProber{Timeout: wait})
+		case "jarm":
+			enrichers = append(enrichers, JARMProber{Timeout: wait})
+		case "favicon":
+			enrichers = append(enrichers, FaviconHasher{Timeout: wait})
+		case "websocket":
+			enrichers = append(enrichers, WebSocketProber{Timeout: wait})
+		case "mac":
+			resolver, err := NewMACResolver(ouiFile)
+			if err != nil {
+				return err
+			}
+			enrichers = append(enrichers, resolver)
+		case "dns":
+			enrichers = append(enrichers, DNSProber{Timeout: wait})
+		case "shodan":
+			key := getenv("PSCANNER_SHODAN_API_KEY", "SHODAN_API_KEY")
+			if key == "" {
+				return fmt.Errorf("shodan enrichment needs SHODAN_API_KEY or PSCANNER_SHODAN_API_KEY")
+			}
+			enrichers = append(enrichers, NewShodan(key))
+		case "censys":
+			id := getenv("PSCANNER_CENSYS_API_ID", "CENSYS_API_ID")
+			secret := getenv("PSCANNER_CENSYS_API_SECRET", "CENSYS_API_SECRET")
+			if id == "" || secret == "" {
+				return fmt.Errorf("censys enrichment needs CENSYS_API_ID and CENSYS_API_SECRET (or their PSCANNER_ forms)")
+			}
+			enrichers = append(enrichers, NewCensys(id, secret))
+		default:
+			return fmt.Errorf("unknown enrichment %q (supported: rdap, banner, ftp-anon, smtp, smtp-relay, db, cache, smb, rdp, tls, jarm, favicon, websocket, mac, dns, shodan, censys)", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const rdapFixture = `{
+  "objectClassName": "ip network",
+  "startAddress": "192.0.2.0",
+  "endAddress": "192.0.2.255",
+  "name": "EXAMPLE-NET",
+  "cidr0_cidrs": [{"v4prefix": "192.0.2.0", "length": 24}],
+  "entities": [
+    {"roles": ["technical"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example NOC"]]]},
+    {"roles": ["registrant"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example Corp"]]]}
+  ]
+}`
+
+func TestRDAPEnrich(t *testing.T) {
+	var queries atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		if r.URL.Path != "/ip/192.0.2.10" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rdap+json")
+		w.Write([]byte(rdapFixture))
+	}))
+	defer ts.Close()
+
+	originalBase := rdapBaseURL
+	rdapBaseURL = ts.URL
+	defer func() { rdapBaseURL = originalBase }()
+
+	e := NewRDAP(0)
+	tests := []struct {
+		name    string
+		ip      string
+		network string
+		owner   string
+	}{
+		{name: "Queried", ip: "192.0.2.10", network: "192.0.2.0/24", owner: "Example Corp"},
+		{name: "Cached range", ip: "192.0.2.200", network: "192.0.2.0/24", owner: "Example Corp"},
+		{name: "Unknown", ip: "198.51.100.1"},
+		{name: "Cached failure", ip: "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{IP: tt.ip, Port: 443}
+			e.Enrich(&r, ProbeConfig{})
+			if r.Network != tt.network || r.Owner != tt.owner {
+				t.Errorf("Enrich(%s) = network %q owner %q, expected %q %q", tt.ip, r.Network, r.Owner, tt.network, tt.owner)
+			}
+		})
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("made %d RDAP queries, expected 2", n)
+	}
+}
+
+func TestIPInRange(t *testing.T) {
+	tests := []struct {
+		ip, start, end string
+		expected       bool
+	}{
+		{"10.0.0.5", "10.0.0.0", "10.0.0.255", true},
+		{"10.0.1.0", "10.0.0.0", "10.0.0.255", false},
+		{"10.0.0.0", "10.0.0.0", "10.0.0.0", true},
+		{"2001:db8::1", "2001:db8::", "2001:db8::ffff", true},
+		{"2001:db9::", "2001:db8::", "2001:db8::ffff", false},
+		{"10.0.0.5", "2001:db8::", "2001:db8::ffff", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got := ipInRange(net.ParseIP(tt.ip), net.ParseIP(tt.start), net.ParseIP(tt.end))
+			if got != tt.expected {
+				t.Errorf("ipInRange(%s, %s, %s) = %v, expected %v", tt.ip, tt.start, tt.end, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEnableEnrichersUnknown(t *testing.T) {
+	if err := enableEnrichers("whois", time.Second); err == nil {
+		t.Error("enableEnrichers(\"whois\") returned no error")
+	}
+}
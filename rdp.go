@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RDPInfo is the security an RDP server negotiates
+type RDPInfo struct {
+	Security    string   `json:"security"`     // chosen when every protocol is offered, e.g. "NLA"
+	Protocols   []string `json:"protocols"`    // each accepted when offered alone: "RDP", "TLS", "NLA"
+	NLARequired bool     `json:"nla_required"` // connections must authenticate before a session starts
+}
+
+// Security protocols of an RDP negotiation request
+const (
+	rdpProtocolRDP     = 0 // standard RDP security
+	rdpProtocolSSL     = 1 // TLS
+	rdpProtocolHybrid  = 2 // CredSSP, that is network level authentication
+	rdpProtocolHybridX = 8 // CredSSP with early user authorization
+)
+
+// rdpPorts are the ports RDPProber tries when the service of a port isn't
+// known
+var rdpPorts = map[int]bool{3389: true}
+
+// RDPProber is an enricher that sends RDP connection requests offering each
+// security protocol and reports which the server accepts. Connections are
+// closed after the server's answer, before any login.
+type RDPProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records the security protocols of an RDP server
+func (p RDPProber) Enrich(r *Result, probe ProbeConfig) {
+	if r.Service != "rdp" && (r.Service != "" || !rdpPorts[r.Port]) {
+		return
+	}
+	info, err := probeRDP(r.Host, r.Port, probe, p.Timeout)
+	if err != nil {
+		return
+	}
+	r.RDP, r.Service = info, "rdp"
+}
+
+// probeRDP offers every protocol to learn what the server prefers, then
+// standard security and TLS alone to learn whether it allows sessions that
+// start before the user has authenticated
+func probeRDP(host string, port int, probe ProbeConfig, wait time.Duration) (*RDPInfo, error) {
+	selected, err := rdpNegotiate(host, port, probe, wait, rdpProtocolSSL|rdpProtocolHybrid|rdpProtocolHybridX)
+	var refused errRDPRefused
+	if errors.As(err, &refused) {
+		selected = rdpProtocolRDP // refusing all of them leaves standard security
+	} else if err != nil {
+		return nil, err
+	}
+	info := &RDPInfo{Security: rdpProtocolName(selected)}
+	for _, protocol := range []uint32{rdpProtocolRDP, rdpProtocolSSL} {
+		if s, err := rdpNegotiate(host, port, probe, wait, protocol); err == nil && s == protocol {
+			info.Protocols = append(info.Protocols, rdpProtocolName(protocol))
+		}
+	}
+	if selected == rdpProtocolHybrid || selected == rdpProtocolHybridX {
+		info.Protocols = append(info.Protocols, "NLA")
+		info.NLARequired = len(info.Protocols) == 1
+	}
+	return info, nil
+}
+
+// rdpProtocolName names a negotiated security protocol
+func rdpProtocolName(protocol uint32) string {
+	switch protocol {
+	case rdpProtocolRDP:
+		return "RDP"
+	case rdpProtocolSSL:
+		return "TLS"
+	case rdpProtocolHybrid, rdpProtocolHybridX:
+		return "NLA"
+	}
+	return fmt.Sprintf("protocol %d", protocol)
+}
+
+// errRDPRefused is a negotiation failure: the server refused the protocols
+// offered
+type errRDPRefused uint32
+
+func (e errRDPRefused) Error() string {
+	return fmt.Sprintf("RDP negotiation failed with code %d", uint32(e))
+}
+
+// rdpNegotiate sends an X.224 connection request offering protocols and
+// returns the protocol the server selected. Servers too old to negotiate
+// select standard RDP security.
+func rdpNegotiate(host string, port int, probe ProbeConfig, wait time.Duration, protocols uint32) (uint32, error) {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(wait))
+	if _, err := conn.Write(rdpConnectionRequest(protocols)); err != nil {
+		return 0, err
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return 0, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if header[0] != 3 || length < 11 || length > 512 {
+		return 0, fmt.Errorf("not a TPKT packet")
+	}
+	packet := make([]byte, length-4)
+	if _, err := io.ReadFull(conn, packet); err != nil {
+		return 0, err
+	}
+	return parseRDPConnectionConfirm(packet)
+}
+
+// rdpConnectionRequest is a TPKT packet carrying an X.224 connection request
+// with an RDP negotiation request
+func rdpConnectionRequest(protocols uint32) []byte {
+	packet := []byte{
+		3, 0, 0, 19, // TPKT version 3 and length
+		14, 0xe0, 0, 0, 0, 0, 0, // X.224 connection request
+		1, 0, 8, 0, // RDP negotiation request of 8 bytes
+	}
+	return binary.LittleEndian.AppendUint32(packet, protocols)
+}
+
+// parseRDPConnectionConfirm reads the protocol selected in an X.224
+// connection confirm, after its TPKT header
+func parseRDPConnectionConfirm(packet []byte) (uint32, error) {
+	if len(packet) < 7 || packet[1]&0xf0 != 0xd0 {
+		return 0, fmt.Errorf("not an X.224 connection confirm")
+	}
+	negotiation := packet[7:]
+	if len(negotiation) < 8 {
+		return rdpProtocolRDP, nil
+	}
+	value := binary.LittleEndian.Uint32(negotiation[4:])
+	switch negotiation[0] {
+	case 2:
+		return value, nil
+	case 3:
+		return 0, errRDPRefused(value)
+	}
+	return 0, fmt.Errorf("unknown RDP negotiation type %d", negotiation[0])
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// rdpServer answers connection requests like an RDP server that accepts the
+// protocols in accept, preferring the last
+func rdpServer(t *testing.T, accept []uint32, failure uint32) int {
+	return serveOnce(t, func(conn net.Conn) {
+		request := make([]byte, 19)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		offered := binary.LittleEndian.Uint32(request[15:])
+		reply := []byte{3, 0, 0, 19, 14, 0xd0, 0, 0, 0x12, 0x34, 0, 2, 0, 8, 0}
+		selected, ok := uint32(0), false
+		for _, p := range accept {
+			if p == rdpProtocolRDP && offered == 0 || p != rdpProtocolRDP && offered&p != 0 {
+				selected, ok = p, true
+			}
+		}
+		if !ok {
+			reply[11], selected = 3, failure
+		}
+		conn.Write(binary.LittleEndian.AppendUint32(reply, selected))
+	})
+}
+
+func TestRDPProber(t *testing.T) {
+	tests := []struct {
+		name    string
+		accept  []uint32
+		failure uint32
+		want    RDPInfo
+		flagged bool
+	}{
+		{
+			name:    "NLA required",
+			accept:  []uint32{rdpProtocolHybrid},
+			failure: 5,
+			want:    RDPInfo{Security: "NLA", Protocols: []string{"NLA"}, NLARequired: true},
+		},
+		{
+			name:    "TLS allowed",
+			accept:  []uint32{rdpProtocolSSL, rdpProtocolHybrid},
+			failure: 5,
+			want:    RDPInfo{Security: "NLA", Protocols: []string{"TLS", "NLA"}},
+			flagged: true,
+		},
+		{
+			name:    "Standard security only",
+			accept:  []uint32{rdpProtocolRDP},
+			failure: 2,
+			want:    RDPInfo{Security: "RDP", Protocols: []string{"RDP"}},
+			flagged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: rdpServer(t, tt.accept, tt.failure), Service: "rdp"}
+			RDPProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+			if r.RDP == nil || !reflect.DeepEqual(*r.RDP, tt.want) {
+				t.Fatalf("Enrich() rdp = %+v, expected %+v", r.RDP, tt.want)
+			}
+			if flagged := len(serviceFindings(r)) > 0; flagged != tt.flagged {
+				t.Errorf("serviceFindings() = %v, expected flagged %v", serviceFindings(r), tt.flagged)
+			}
+		})
+	}
+
+	t.Run("Not RDP", func(t *testing.T) {
+		r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: serveOnce(t, func(conn net.Conn) {
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n"))
+		}), Service: "rdp"}
+		RDPProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+		if r.RDP != nil {
+			t.Errorf("Enrich() rdp = %+v, expected nothing", r.RDP)
+		}
+	})
+}
+
+func TestParseRDPConnectionConfirm(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   uint32
+		ok     bool
+	}{
+		{"Selected TLS", []byte{14, 0xd0, 0, 0, 0x12, 0x34, 0, 2, 0, 8, 0, 1, 0, 0, 0}, rdpProtocolSSL, true},
+		{"No negotiation", []byte{6, 0xd0, 0, 0, 0x12, 0x34, 0}, rdpProtocolRDP, true},
+		{"Refused", []byte{14, 0xd0, 0, 0, 0x12, 0x34, 0, 3, 0, 8, 0, 5, 0, 0, 0}, 0, false},
+		{"Disconnect", []byte{6, 0x80, 0, 0, 0, 0, 0}, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRDPConnectionConfirm(tt.packet)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("%s: parseRDPConnectionConfirm() = %d, %v, expected %d", tt.name, got, err, tt.want)
+		}
+	}
+}
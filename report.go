@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// HostReport is the open ports found on one address
+type HostReport struct {
+	IP    string `json:"ip"`
+	Host  string `json:"host,omitempty"` // name the address was scanned as
+	Ports []int  `json:"ports"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BuildReport groups results by address, dropping duplicates such as those
+// left by a scan that was resumed
+func BuildReport(results []Result) []HostReport {
+	results = append([]Result(nil), results...)
+	sortResults(results)
+	var report []HostReport
+	for _, r := range results {
+		if n := len(report); n > 0 && report[n-1].IP == r.IP {
+			h := &report[n-1]
+			if h.Ports[len(h.Ports)-1] != r.Port {
+				h.Ports = append(h.Ports, r.Port)
+			}
+			continue
+		}
+		h := HostReport{IP: r.IP, Ports: []int{r.Port}, Labels: r.Labels}
+		if r.Host != r.IP {
+			h.Host = r.Host
+		}
+		report = append(report, h)
+	}
+	return report
+}
+
+// WriteReport prints a report for people, one line per address
+func WriteReport(w io.Writer, report []HostReport) {
+	if len(report) == 0 {
+		fmt.Fprintln(w, "No open ports")
+		return
+	}
+	total := 0
+	for _, h := range report {
+		ports := make([]string, len(h.Ports))
+		for i, p := range h.Ports {
+			ports[i] = strconv.Itoa(p)
+		}
+		name := h.IP
+		if h.Host != "" {
+			name = h.Host + " (" + h.IP + ")"
+		}
+		fmt.Fprintf(w, "%s: %d open: %s\n", name, len(h.Ports), strings.Join(ports, ", "))
+		total += len(h.Ports)
+	}
+	fmt.Fprintf(w, "\n%d open port(s) on %d host(s)\n", total, len(report))
+}
+
+// runReport implements the "report" subcommand, which summarizes saved
+// results in any of the formats diff reads
+func runReport(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	reportFormat := flags.String("format", "text", "Report format: text, json, cef or leef")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner report [-format text|json|cef|leef] results...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	var results []Result
+	for _, filename := range flags.Args() {
+		found, err := ReadResultsFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", filename, err)
+			return 1
+		}
+		results = append(results, found...)
+	}
+
+	switch *reportFormat {
+	case "text":
+		WriteReport(os.Stdout, BuildReport(results))
+	case "json":
+		return printJSON(os.Stdout, BuildReport(results))
+	default:
+		formatResult, err := NewFormatter(*reportFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return 2
+		}
+		sortResults(results)
+		for _, r := range results {
+			fmt.Println(formatResult(r))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildReport(t *testing.T) {
+	results := []Result{
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 443},
+		{Host: "web", IP: "10.0.0.1", Port: 80},
+		{Host: "10.0.0.2", IP: "10.0.0.2", Port: 22},
+		{Host: "web", IP: "10.0.0.1", Port: 80}, // repeated by a resumed scan
+	}
+	want := []HostReport{
+		{IP: "10.0.0.1", Host: "web", Ports: []int{80}},
+		{IP: "10.0.0.2", Ports: []int{22, 443}},
+	}
+	if got := BuildReport(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildReport() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	tests := []struct {
+		report []HostReport
+		want   string
+	}{
+		{nil, "No open ports\n"},
+		{
+			[]HostReport{{IP: "10.0.0.1", Host: "web", Ports: []int{80, 443}}, {IP: "10.0.0.2", Ports: []int{22}}},
+			"web (10.0.0.1): 2 open: 80, 443\n10.0.0.2: 1 open: 22\n\n3 open port(s) on 2 host(s)\n",
+		},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		WriteReport(&b, tt.report)
+		if b.String() != tt.want {
+			t.Errorf("WriteReport(%v) = %q, want %q", tt.report, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// rescanFile and rescanTop are the -rescan-open and -rescan-top flags
+var (
+	rescanFile string
+	rescanTop  int
+)
+
+// RescanJobs reads the results of an earlier scan, in any format diff
+// reads, and returns a job for each TCP port they report open, followed by
+// the top most frequently open ports of each address that were not. Ports
+// are probed by address; names maps each address to the name it was
+// reported under, when there was one.
+func RescanJobs(filename string, top int) (jobs []ScanJob, names map[string]string, err error) {
+	if top < 0 || top > len(frequentPorts) {
+		return nil, nil, fmt.Errorf("-rescan-top must be between 0 and %d, got %d", len(frequentPorts), top)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := parseResults(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	names = make(map[string]string)
+	seen := make(map[ScanJob]bool)
+	var addrs []string
+	for _, r := range results {
+		if r.Transport != "" {
+			continue
+		}
+		job := ScanJob{Host: r.IP, Port: r.Port}
+		if job.Host == "" {
+			job.Host = r.Host
+		}
+		if seen[job] {
+			continue
+		}
+		if _, ok := names[job.Host]; !ok {
+			addrs = append(addrs, job.Host)
+			names[job.Host] = ""
+			if r.Host != "" && r.Host != job.Host {
+				names[job.Host] = r.Host
+			}
+		}
+		seen[job] = true
+		jobs = append(jobs, job)
+	}
+	for _, addr := range addrs {
+		for _, port := range frequentPorts[:top] {
+			if job := (ScanJob{Host: addr, Port: port}); !seen[job] {
+				seen[job] = true
+				jobs = append(jobs, job)
+			}
+		}
+		if names[addr] == "" {
+			delete(names, addr)
+		}
+	}
+	return jobs, names, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRescanJobs(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		top       int
+		wantJobs  []ScanJob
+		wantNames map[string]string
+		wantErr   bool
+	}{
+		{name: "Open TCP ports only", input: "10.0.0.1:22\n10.0.0.1:23 closed\n10.0.0.2:161/udp\n10.0.0.2:443\n",
+			wantJobs: []ScanJob{{Host: "10.0.0.1", Port: 22}, {Host: "10.0.0.2", Port: 443}}, wantNames: map[string]string{}},
+		{name: "Names kept", input: "web.example.com (10.0.0.1):22\nweb.example.com (10.0.0.1):22\n",
+			wantJobs: []ScanJob{{Host: "10.0.0.1", Port: 22}}, wantNames: map[string]string{"10.0.0.1": "web.example.com"}},
+		{name: "Top ports", input: `[{"host":"10.0.0.1","ip":"10.0.0.1","port":80},{"host":"10.0.0.1","ip":"10.0.0.1","port":8443}]`, top: 3,
+			wantJobs:  []ScanJob{{Host: "10.0.0.1", Port: 80}, {Host: "10.0.0.1", Port: 8443}, {Host: "10.0.0.1", Port: 23}, {Host: "10.0.0.1", Port: 443}},
+			wantNames: map[string]string{}},
+		{name: "Empty", input: "\n", wantNames: map[string]string{}},
+		{name: "Bad top", input: "10.0.0.1:22\n", top: len(frequentPorts) + 1, wantErr: true},
+		{name: "Bad file", input: "10.0.0.1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "results")
+			if err := os.WriteFile(filename, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			jobs, names, err := RescanJobs(filename, tt.top)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RescanJobs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(jobs, tt.wantJobs) {
+				t.Errorf("RescanJobs() jobs = %v, expected %v", jobs, tt.wantJobs)
+			}
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("RescanJobs() names = %v, expected %v", names, tt.wantNames)
+			}
+		})
+	}
+}
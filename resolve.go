@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanUnresolved is the -scan-unresolved flag
+var scanUnresolved bool
+
+var (
+	dnsRetries   int    // -dns-retries
+	dnsResolvers string // -resolvers
+)
+
+// dnsBackoff is the wait before the first retry of a failed lookup; it
+// doubles with every further retry
+var dnsBackoff = 250 * time.Millisecond
+
+// SkippedTarget is a target left out of the scan: a name that did not
+// resolve or a CIDR range that did not expand
+type SkippedTarget struct {
+	Target string
+	Err    error
+}
+
+// lookupFunc resolves a name to its addresses
+type lookupFunc func(ctx context.Context, name string) ([]string, error)
+
+// lookupHost resolves a name with the system resolver; tests replace it
+var lookupHost lookupFunc = net.DefaultResolver.LookupHost
+
+// fallbackLookups are tried in order when lookupHost fails, set from
+// -resolvers
+var fallbackLookups []lookupFunc
+
+// ParseResolvers returns a lookup for each DNS server in a comma-separated
+// list of addresses, with port 53 unless one is given
+func ParseResolvers(spec string) ([]lookupFunc, error) {
+	var lookups []lookupFunc
+	for _, addr := range strings.Split(spec, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), "53")
+		}
+		host, _, _ := net.SplitHostPort(addr)
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("resolver %s is not an IP address", host)
+		}
+		r := &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		}
+		lookups = append(lookups, r.LookupHost)
+	}
+	return lookups, nil
+}
+
+// resolveName looks a name up with the system resolver and then each
+// fallback, retrying the whole round up to dnsRetries times with exponential
+// backoff while the failures may be transient. Only addresses that can be
+// reached on network count. A name no resolver has addresses for fails with
+// the system resolver's error.
+func resolveName(ctx context.Context, name, network string) ([]string, error) {
+	var firstErr error
+	for attempt := 0; ; attempt++ {
+		transient := false
+		for i, lookup := range append([]lookupFunc{lookupHost}, fallbackLookups...) {
+			found, err := lookup(ctx, name)
+			if err == nil && len(found) == 0 {
+				err = fmt.Errorf("no addresses for %s", name)
+			} else if err == nil && network != "tcp" {
+				if found = filterFamily(found, network); len(found) == 0 {
+					err = fmt.Errorf("no %s addresses for %s", familyName(network), name)
+				}
+			}
+			if err == nil {
+				return found, nil
+			}
+			if i == 0 && firstErr == nil {
+				firstErr = err
+			}
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && !dnsErr.IsNotFound {
+				transient = true
+			}
+		}
+		if !transient || attempt >= dnsRetries {
+			return nil, firstErr
+		}
+		select {
+		case <-ctx.Done():
+			return nil, firstErr
+		case <-time.After(dnsBackoff << attempt):
+		}
+	}
+}
+
+// ResolveHosts looks up every target that is not an IP address on network
+// with resolveName, up to workers lookups at a time. Targets that resolve to the
+// same addresses as an earlier one, or repeat it, are dropped and returned as
+// its aliases so that no address is probed twice. Names that don't resolve are split off
+// unless keepUnresolved is set.
+func ResolveHosts(ctx context.Context, hosts []string, workers int, network string, keepUnresolved bool) ([]string, map[string][]string, []SkippedTarget) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, h := range hosts {
+		if parseHostIP(h) == nil && !seen[h] {
+			seen[h] = true
+			names = append(names, h)
+		}
+	}
+
+	addrs := make(map[string]string) // name to its sorted addresses
+	failed := make(map[string]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < max(1, min(workers, len(names))); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				found, err := resolveName(ctx, name, network)
+				mu.Lock()
+				if err != nil {
+					failed[name] = err
+				} else {
+					slices.Sort(found)
+					addrs[name] = strings.Join(found, ",")
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+
+	resolved := make([]string, 0, len(hosts))
+	aliases := make(map[string][]string)
+	first := make(map[string]string) // addresses to the target kept for them
+	var unresolved []SkippedTarget
+	for _, h := range hosts {
+		if err, ok := failed[h]; ok && seen[h] {
+			unresolved = append(unresolved, SkippedTarget{Target: h, Err: err})
+			seen[h] = false
+			if keepUnresolved {
+				resolved = append(resolved, h)
+			}
+			continue
+		} else if ok {
+			continue
+		}
+		key, ok := addrs[h]
+		if !ok {
+			addr, zone := splitZone(h)
+			key = net.ParseIP(addr).String()
+			if zone != "" {
+				key += "%" + zone
+			}
+		}
+		kept, dup := first[key]
+		switch {
+		case !dup:
+			first[key] = h
+			resolved = append(resolved, h)
+		case kept != h && !slices.Contains(aliases[kept], h):
+			aliases[kept] = append(aliases[kept], h)
+		}
+	}
+	return resolved, aliases, unresolved
+}
+
+// WriteSkipped lists skipped targets with why, under a heading such as
+// "Unresolvable Hosts"
+func WriteSkipped(w io.Writer, heading string, skipped []SkippedTarget) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n=== %s ===\n", heading)
+	for _, s := range skipped {
+		fmt.Fprintf(w, "%s: %v\n", s.Target, s.Err)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolveHosts(t *testing.T) {
+	var lookups atomic.Int32
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		lookups.Add(1)
+		switch name {
+		case "web.example.com":
+			return []string{"10.0.0.1"}, nil
+		case "empty.example.com":
+			return nil, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	hosts := []string{"web.example.com", "gone.example.com", "10.0.0.2", "empty.example.com", "gone.example.com", "::1"}
+	resolved, _, unresolved := ResolveHosts(context.Background(), hosts, 4, "tcp", false)
+	if expected := []string{"web.example.com", "10.0.0.2", "::1"}; !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("resolved = %v, expected %v", resolved, expected)
+	}
+	var names []string
+	for _, u := range unresolved {
+		names = append(names, u.Target)
+	}
+	if expected := []string{"gone.example.com", "empty.example.com"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("unresolved = %v, expected %v", names, expected)
+	}
+	if n := lookups.Load(); n != 3 {
+		t.Errorf("%d lookups, expected one per distinct name (3)", n)
+	}
+
+	var out strings.Builder
+	WriteSkipped(&out, "Unresolvable Hosts", unresolved)
+	if !strings.Contains(out.String(), "gone.example.com: no such host\n") {
+		t.Errorf("WriteSkipped() = %q", out.String())
+	}
+
+	// Addresses need no lookups
+	lookups.Store(0)
+	if resolved, _, unresolved := ResolveHosts(context.Background(), []string{"10.0.0.1"}, 4, "tcp", false); len(resolved) != 1 || unresolved != nil || lookups.Load() != 0 {
+		t.Errorf("ResolveHosts() on addresses = %v, %v after %d lookups", resolved, unresolved, lookups.Load())
+	}
+}
+
+func TestResolveHostsAliases(t *testing.T) {
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		switch name {
+		case "www.example.com", "example.com":
+			return []string{"10.0.0.2", "10.0.0.1"}, nil
+		case "cdn.example.com":
+			return []string{"10.0.0.1", "10.0.0.2"}, nil
+		case "api.example.com":
+			return []string{"10.0.0.3"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		name     string
+		hosts    []string
+		keep     bool
+		resolved []string
+		aliases  map[string][]string
+	}{
+		{"Same addresses", []string{"www.example.com", "example.com", "cdn.example.com"}, false,
+			[]string{"www.example.com"}, map[string][]string{"www.example.com": {"example.com", "cdn.example.com"}}},
+		{"Address and name", []string{"10.0.0.3", "api.example.com"}, false,
+			[]string{"10.0.0.3"}, map[string][]string{"10.0.0.3": {"api.example.com"}}},
+		{"Repeated target", []string{"api.example.com", "api.example.com", "10.0.0.1", "10.0.0.1"}, false,
+			[]string{"api.example.com", "10.0.0.1"}, map[string][]string{}},
+		{"Partial overlap", []string{"10.0.0.1", "www.example.com"}, false,
+			[]string{"10.0.0.1", "www.example.com"}, map[string][]string{}},
+		{"Keep unresolved", []string{"gone.example.com", "api.example.com", "gone.example.com"}, true,
+			[]string{"gone.example.com", "api.example.com"}, map[string][]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, aliases, _ := ResolveHosts(context.Background(), tt.hosts, 2, "tcp", tt.keep)
+			if !reflect.DeepEqual(resolved, tt.resolved) {
+				t.Errorf("resolved = %v, expected %v", resolved, tt.resolved)
+			}
+			if !reflect.DeepEqual(aliases, tt.aliases) {
+				t.Errorf("aliases = %v, expected %v", aliases, tt.aliases)
+			}
+		})
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	savedLookup, savedBackoff, savedRetries := lookupHost, dnsBackoff, dnsRetries
+	defer func() {
+		lookupHost, dnsBackoff, dnsRetries, fallbackLookups = savedLookup, savedBackoff, savedRetries, nil
+	}()
+	dnsBackoff, dnsRetries = time.Millisecond, 2
+
+	servfail := &net.DNSError{Err: "server misbehaving", Name: "web.example.com", IsTemporary: true}
+	nxdomain := &net.DNSError{Err: "no such host", Name: "web.example.com", IsNotFound: true}
+	found := func(ctx context.Context, name string) ([]string, error) { return []string{"10.0.0.1"}, nil }
+
+	tests := []struct {
+		name      string
+		failures  int   // system lookups failing before one succeeds
+		err       error // of the failing system lookups
+		fallback  lookupFunc
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"Succeeds", 0, nil, nil, false, 1},
+		{"SERVFAIL then success", 2, servfail, nil, false, 3},
+		{"SERVFAIL past the retries", 5, servfail, nil, true, 3},
+		{"NXDOMAIN not retried", 5, nxdomain, nil, true, 1},
+		{"Fallback answers", 5, servfail, found, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			lookupHost = func(ctx context.Context, name string) ([]string, error) {
+				if calls.Add(1) <= int32(tt.failures) {
+					return nil, tt.err
+				}
+				return []string{"10.0.0.1"}, nil
+			}
+			fallbackLookups = nil
+			if tt.fallback != nil {
+				fallbackLookups = []lookupFunc{tt.fallback}
+			}
+			addrs, err := resolveName(context.Background(), "web.example.com", "tcp")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveName() = %v, %v, wantErr %v", addrs, err, tt.wantErr)
+			}
+			if tt.wantErr && err != tt.err {
+				t.Errorf("resolveName() error = %v, expected the system resolver's %v", err, tt.err)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("%d system lookups, expected %d", n, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestParseResolvers(t *testing.T) {
+	tests := []struct {
+		spec    string
+		count   int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1.1.1.1", 1, false},
+		{"1.1.1.1, 9.9.9.9:5353,[2606:4700::1111]:53,2606:4700::1001", 4, false},
+		{"dns.example.com", 0, true},
+	}
+
+	for _, tt := range tests {
+		lookups, err := ParseResolvers(tt.spec)
+		if (err != nil) != tt.wantErr || len(lookups) != tt.count {
+			t.Errorf("ParseResolvers(%q) = %d lookups, %v; expected %d, wantErr %v", tt.spec, len(lookups), err, tt.count, tt.wantErr)
+		}
+	}
+}
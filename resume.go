@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"iter"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultResumeFile is where an interrupted scan saves its progress
+const defaultResumeFile = "pscanner.resume"
+
+// ResumeState is what an interrupted scan leaves behind so that "pscanner
+// resume" can continue it. Jobs are numbered in the order they are queued;
+// Completed counts the jobs before the first one that did not finish.
+type ResumeState struct {
+	Args      []string  `json:"args"`
+	Targets   string    `json:"targets"` // fingerprint of the expanded targets
+	Completed int       `json:"completed"`
+	Total     int       `json:"total"`
+	Time      time.Time `json:"time"`
+}
+
+// SaveResumeState writes the state atomically
+func SaveResumeState(filename string, s *ResumeState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// writeResumeState replaces the state in a resume file already open for
+// writing; unlike SaveResumeState it needs no write access to the directory
+func writeResumeState(f *os.File, s *ResumeState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// LoadResumeState reads a state saved by an interrupted scan
+func LoadResumeState(filename string) (*ResumeState, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// A scan that dropped root privileges empties the file it held open
+	// when it can't remove it
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s is empty: %w", filename, os.ErrNotExist)
+	}
+	var s ResumeState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+	return &s, nil
+}
+
+// targetFingerprint identifies the expanded list of jobs, so a resumed scan
+// can tell whether its targets still line up with the interrupted one
+func targetFingerprint(hosts []string, portList []int, endpoints []ScanJob) string {
+	h := sha256.New()
+	for _, host := range hosts {
+		fmt.Fprintf(h, "h %s\n", host)
+	}
+	for _, port := range portList {
+		fmt.Fprintf(h, "p %d\n", port)
+	}
+	for _, job := range endpoints {
+		fmt.Fprintf(h, "e %s %d\n", job.Host, job.Port)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// scanJobs yields every host/port combination, with each host's ports in
+// the order learned for its network when learned isn't nil, followed by the
+// discovered endpoints, leaving out the first skip jobs
+func scanJobs(hosts []string, portList []int, learned *LearnedOrder, endpoints []ScanJob, skip int) iter.Seq[ScanJob] {
+	return func(yield func(ScanJob) bool) {
+		i := 0
+		if n := len(portList); n > 0 && skip > 0 {
+			i = min(skip/n, len(hosts))
+		}
+		for ; i < len(hosts); i++ {
+			for j, port := range learned.Ports(hosts[i], portList) {
+				if i*len(portList)+j < skip {
+					continue
+				}
+				if !yield(ScanJob{Host: hosts[i], Port: port}) {
+					return
+				}
+			}
+		}
+		for j, job := range endpoints {
+			if len(hosts)*len(portList)+j < skip {
+				continue
+			}
+			if !yield(job) {
+				return
+			}
+		}
+	}
+}
+
+// jobsPerHost counts the jobs scanJobs yields for each host that has any
+func jobsPerHost(hosts []string, portList []int, endpoints []ScanJob, skip int) map[string]int {
+	counts := make(map[string]int)
+	for i, h := range hosts {
+		if n := len(portList) - min(max(skip-i*len(portList), 0), len(portList)); n > 0 {
+			counts[h] += n
+		}
+	}
+	for j, job := range endpoints {
+		if len(hosts)*len(portList)+j >= skip {
+			counts[job.Host]++
+		}
+	}
+	return counts
+}
+
+// jobCursor follows jobs from being queued to finishing, to find how many
+// leading jobs are done when a scan is interrupted
+type jobCursor struct {
+	mu       sync.Mutex
+	next     int
+	inflight map[ScanJob]int
+}
+
+func newJobCursor(start int) *jobCursor {
+	return &jobCursor{next: start, inflight: make(map[ScanJob]int)}
+}
+
+// Queued numbers a job as it is handed to the workers
+func (c *jobCursor) Queued(job ScanJob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, dup := c.inflight[job]; !dup {
+		c.inflight[job] = c.next
+	}
+	c.next++
+}
+
+// Finished marks a job as done
+func (c *jobCursor) Finished(job ScanJob) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, job)
+}
+
+// Completed returns the number of jobs before the first unfinished one
+func (c *jobCursor) Completed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	completed := c.next
+	for _, i := range c.inflight {
+		completed = min(completed, i)
+	}
+	return completed
+}
+
+// runResume continues a scan interrupted with Ctrl+C from its state file
+func runResume(args []string) int {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: pscanner resume [state-file]\n\n"+
+			"Continues an interrupted scan with its original options (default state file: %s)\n", defaultResumeFile)
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return exitError
+	}
+	filename := defaultResumeFile
+	if flags.NArg() == 1 {
+		filename = flags.Arg(0)
+	}
+	state, err := LoadResumeState(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Error: no interrupted scan to resume (%s not found)\n", filename)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	// Keep saving progress to the same file if the scan is interrupted again
+	return runScan(append(slices.Clone(state.Args), "-resume-file", filename), state)
+}
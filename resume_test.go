@@ -0,0 +1,101 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScanJobsSkip(t *testing.T) {
+	hosts := []string{"a", "b"}
+	portList := []int{1, 2, 3}
+	endpoints := []ScanJob{{Host: "c", Port: 9}}
+	all := slices.Collect(scanJobs(hosts, portList, nil, endpoints, 0))
+	if len(all) != 7 {
+		t.Fatalf("scanJobs() yielded %d jobs, want 7", len(all))
+	}
+
+	for skip := 0; skip <= len(all); skip++ {
+		got := slices.Collect(scanJobs(hosts, portList, nil, endpoints, skip))
+		if want := all[skip:]; !reflect.DeepEqual(got, want) && len(want) > 0 {
+			t.Errorf("skip %d: got %v, want %v", skip, got, want)
+		}
+		counts := jobsPerHost(hosts, portList, endpoints, skip)
+		want := make(map[string]int)
+		for _, job := range all[skip:] {
+			want[job.Host]++
+		}
+		if !reflect.DeepEqual(counts, want) {
+			t.Errorf("skip %d: jobsPerHost() = %v, want %v", skip, counts, want)
+		}
+	}
+}
+
+func TestJobCursor(t *testing.T) {
+	c := newJobCursor(10)
+	jobs := []ScanJob{{Host: "a", Port: 1}, {Host: "a", Port: 2}, {Host: "a", Port: 3}}
+	for _, job := range jobs {
+		c.Queued(job)
+	}
+	if got := c.Completed(); got != 10 {
+		t.Errorf("Completed() = %d with nothing finished, want 10", got)
+	}
+	// Jobs finishing out of order only count once those before them finish
+	c.Finished(jobs[1])
+	if got := c.Completed(); got != 10 {
+		t.Errorf("Completed() = %d, want 10", got)
+	}
+	c.Finished(jobs[0])
+	if got := c.Completed(); got != 12 {
+		t.Errorf("Completed() = %d, want 12", got)
+	}
+	c.Finished(jobs[2])
+	if got := c.Completed(); got != 13 {
+		t.Errorf("Completed() = %d, want 13", got)
+	}
+}
+
+func TestResumeStateRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "scan.resume")
+	want := &ResumeState{
+		Args:      []string{"-h", "127.0.0.1", "-p", "1-1024"},
+		Targets:   targetFingerprint([]string{"127.0.0.1"}, []int{22, 80}, nil),
+		Completed: 1,
+		Total:     2,
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := SaveResumeState(filename, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadResumeState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadResumeState() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTargetFingerprint(t *testing.T) {
+	base := targetFingerprint([]string{"a", "b"}, []int{1, 2}, nil)
+	tests := []struct {
+		name      string
+		hosts     []string
+		portList  []int
+		endpoints []ScanJob
+	}{
+		{"host order", []string{"b", "a"}, []int{1, 2}, nil},
+		{"port order", []string{"a", "b"}, []int{2, 1}, nil},
+		{"extra endpoint", []string{"a", "b"}, []int{1, 2}, []ScanJob{{Host: "c", Port: 3}}},
+	}
+	for _, tt := range tests {
+		if targetFingerprint(tt.hosts, tt.portList, tt.endpoints) == base {
+			t.Errorf("%s: fingerprint unchanged", tt.name)
+		}
+	}
+	if targetFingerprint([]string{"a", "b"}, []int{1, 2}, nil) != base {
+		t.Error("fingerprint is not stable")
+	}
+}
@@ -0,0 +1,707 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Result is a port found during a scan: an open one unless closed or
+// filtered ports were asked for with ScanOptions.Report
+type Result struct {
+	Host string `json:"host"`
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+	// "udp" for services found with -udp; ports are TCP otherwise
+	Transport string    `json:"transport,omitempty"`
+	Time      time.Time `json:"time"`
+	State     PortState `json:"state,omitempty"` // left out for open ports
+
+	// Filled in by enrichers when configured
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	Network string `json:"network,omitempty"`
+	NetName string `json:"net_name,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+
+	// Hardware address of a host on the local network, and its vendor
+	MAC       string `json:"mac,omitempty"`
+	MACVendor string `json:"mac_vendor,omitempty"`
+
+	Banner  string `json:"banner,omitempty"`
+	Service string `json:"service,omitempty"`
+	Scheme  string `json:"scheme,omitempty"`  // "http" or "https" when the port speaks HTTP, with -output-targets
+	Product string `json:"product,omitempty"` // software named in the banner, e.g. "OpenSSH"
+	Version string `json:"version,omitempty"` // and its version, e.g. "8.9p1"
+	CPE     string `json:"cpe,omitempty"`     // CPE 2.3 name of the software, for vulnerability management tools
+	Hints   []Hint `json:"hints,omitempty"`   // unverified known vulnerabilities of the software, with -hints
+
+	SSH  *SSHInfo  `json:"ssh,omitempty"`
+	FTP  *FTPInfo  `json:"ftp,omitempty"`
+	SMTP *SMTPInfo `json:"smtp,omitempty"`
+
+	Database *DatabaseInfo `json:"database,omitempty"`
+	Cache    *CacheInfo    `json:"cache,omitempty"`
+	SMB      *SMBInfo      `json:"smb,omitempty"`
+	RDP      *RDPInfo      `json:"rdp,omitempty"`
+	SNMP     *SNMPInfo     `json:"snmp,omitempty"`
+	DNS      *DNSInfo      `json:"dns,omitempty"`
+	NTP      *NTPInfo      `json:"ntp,omitempty"`
+	TLS      *TLSInfo      `json:"tls,omitempty"`
+	QUIC     *QUICInfo     `json:"quic,omitempty"`
+	HTTP     *HTTPInfo     `json:"http,omitempty"`
+
+	Tags  []string       `json:"tags,omitempty"`
+	Known []KnownService `json:"known_services,omitempty"`
+
+	// Labels given to the target in the targets file
+	Labels map[string]string `json:"labels,omitempty"`
+	// Other targets that resolved to the same address and were not scanned
+	// separately
+	Aliases []string `json:"aliases,omitempty"`
+
+	// "honeypot" or "tarpit" when -honeypots labeled the host
+	Suspect string `json:"suspect,omitempty"`
+	// The host's uptime estimated from its TCP timestamps, with -uptime
+	Uptime *UptimeInfo `json:"uptime,omitempty"`
+
+	// Set when open ports are probed again with ProbeConfig.Reprobe: the
+	// port accepted Answered of Attempts connections
+	Answered int `json:"answered,omitempty"`
+	Attempts int `json:"attempts,omitempty"`
+
+	// Local address the port was probed from when -source-ip gave several
+	Source string `json:"source,omitempty"`
+}
+
+// String formats a result as ip:port, or as "host (ip):port" when the target
+// was a name, followed by the state of a port that is not open or the
+// attempts answered by a flapping one, e.g. "(3/5)"
+func (r Result) String() string {
+	addr := fmt.Sprintf("%s:%d", r.IP, r.Port)
+	if r.Host != "" && r.Host != r.IP {
+		addr = fmt.Sprintf("%s (%s):%d", r.Host, r.IP, r.Port)
+	}
+	if r.Transport != "" {
+		addr += "/" + r.Transport
+	}
+	if r.State != StateOpen {
+		return addr + " " + r.State.String()
+	}
+	if r.Flapping() {
+		return fmt.Sprintf("%s (%d/%d)", addr, r.Answered, r.Attempts)
+	}
+	return addr
+}
+
+// Key identifies the port a result is for: its address, port and transport.
+// Unlike String, it stays the same when the name of the host or the attempts
+// a flapping port answered change between scans.
+func (r Result) Key() string {
+	return r.IP + "|" + strconv.Itoa(r.Port) + "/" + r.Transport
+}
+
+// Flapping reports whether a reprobed port refused some of its attempts,
+// as load balancers and rate limiters do
+func (r Result) Flapping() bool {
+	return r.Answered < r.Attempts
+}
+
+// Enricher adds details to a result before it is reported
+type Enricher interface {
+	// Enrich looks up details of r, connecting to the host as probe does
+	Enrich(r *Result, probe ProbeConfig)
+}
+
+// enrichers are applied to every open port found
+var enrichers []Enricher
+
+type ScanJob struct {
+	Host string
+	Port int
+}
+
+type Stats struct {
+	mu        sync.Mutex
+	scanned   int
+	openPorts int
+	exhausted int // probe attempts put off for lack of file descriptors
+	panics    int // probes abandoned because they panicked
+	startTime time.Time
+	hosts     map[string]*HostStats
+}
+
+// HostStats aggregates probe outcomes for a single host
+type HostStats struct {
+	Start     time.Time
+	End       time.Time
+	Ports     int
+	States    [numPortStates]int
+	ProbeTime time.Duration
+	OpenTime  time.Duration // connecting to the open ports, one round trip each
+	OpenMin   time.Duration // the quickest of those connections
+	OpenMax   time.Duration // and the slowest
+	DNSTime   time.Duration // looking up the host's name, when it was dialed by name
+	Errors    ProbeErrors
+}
+
+// ProbeErrors counts a host's failed probes by the error of their last
+// attempt, as classified by classifyDialError. Exhausted counts attempts put
+// off for lack of file descriptors instead, since those are retried, and
+// Panic probes abandoned because of a bug.
+type ProbeErrors struct {
+	Refused     int
+	Timeout     int
+	Unreachable int
+	Exhausted   int
+	Panic       int
+	Other       int
+}
+
+// Add counts one error of a kind returned by classifyDialError
+func (e *ProbeErrors) Add(kind string) {
+	switch kind {
+	case "refused":
+		e.Refused++
+	case "timeout":
+		e.Timeout++
+	case "unreachable":
+		e.Unreachable++
+	case "exhausted":
+		e.Exhausted++
+	case "panic":
+		e.Panic++
+	default:
+		e.Other++
+	}
+}
+
+// String lists the non-zero counts, e.g. "timeout 1019, unreachable 2", or
+// "-" when there are none
+func (e ProbeErrors) String() string {
+	var parts []string
+	for _, c := range []struct {
+		kind string
+		n    int
+	}{{"refused", e.Refused}, {"timeout", e.Timeout}, {"unreachable", e.Unreachable}, {"fd limit", e.Exhausted}, {"panic", e.Panic}, {"other", e.Other}} {
+		if c.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", c.kind, c.n))
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AvgRTT estimates the round-trip time to the host from its open ports,
+// whose probes take a single connect; it is zero when none were open
+func (h HostStats) AvgRTT() time.Duration {
+	if h.States[StateOpen] == 0 {
+		return 0
+	}
+	return h.OpenTime / time.Duration(h.States[StateOpen])
+}
+
+// The thresholds of HostStats.Firewall
+const (
+	firewallLoss = 20                   // share of probes, 1 in this many, that may time out through packet loss alone
+	natSpread    = 2                    // slowest open port over the quickest for ports forwarded to other machines
+	natMinSpread = 5 * time.Millisecond // and by at least this much
+)
+
+// Firewall guesses from the outcome of a host's probes what stands in front
+// of it:
+//
+//   - "no filtering": closed ports refused connections, so probes reached it
+//   - "dropping": some ports answered and the others timed out, as behind a
+//     stateful firewall that drops what it doesn't allow
+//   - "rejecting": some ports answered and probes of the others failed with
+//     ICMP unreachable errors, as from a firewall that rejects instead
+//   - "NAT": some open ports take much longer to connect than others, as
+//     when a router forwards them to machines behind it
+//   - "no reply": nothing answered, so the host is down or everything is
+//     dropped
+//
+// It is a heuristic: few ports or a lossy link can mislead it.
+func (h HostStats) Firewall() string {
+	answered := h.States[StateOpen] + h.Errors.Refused
+	switch {
+	case h.Ports == 0:
+		return ""
+	case answered == 0:
+		return "no reply"
+	case h.Errors.Unreachable >= h.Errors.Timeout && h.Errors.Unreachable*firewallLoss > h.Ports:
+		return "rejecting"
+	case h.Errors.Timeout*firewallLoss > h.Ports:
+		return "dropping"
+	case h.States[StateOpen] >= 2 && h.OpenMax > natSpread*h.OpenMin && h.OpenMax-h.OpenMin >= natMinSpread:
+		return "NAT"
+	}
+	return "no filtering"
+}
+
+func (s *Stats) IncrementScanned() {
+	s.mu.Lock()
+	s.scanned++
+	s.mu.Unlock()
+}
+
+// RecordExhausted counts a probe attempt on host put off because the machine
+// ran out of file descriptors
+func (s *Stats) RecordExhausted(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.exhausted++
+	s.host(host).Errors.Exhausted++
+}
+
+// Exhausted returns how many probe attempts were put off for lack of file
+// descriptors
+func (s *Stats) Exhausted() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exhausted
+}
+
+// RecordPanic counts a probe of host that panicked
+func (s *Stats) RecordPanic(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.panics++
+	s.host(host).Errors.Add("panic")
+}
+
+// Panics returns how many probes panicked
+func (s *Stats) Panics() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.panics
+}
+
+// RecordResolve adds the time a probe of host spent looking up its name
+func (s *Stats) RecordResolve(host string, d time.Duration) {
+	if d == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(host).DNSTime += d
+}
+
+// DNSTime returns the time probes spent looking up target names, over all
+// hosts
+func (s *Stats) DNSTime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total time.Duration
+	for _, h := range s.hosts {
+		total += h.DNSTime
+	}
+	return total
+}
+
+func (s *Stats) IncrementOpen() {
+	s.mu.Lock()
+	s.openPorts++
+	s.mu.Unlock()
+}
+
+// RecordProbe adds the outcome of one port probe, and the error of its last
+// attempt if it failed, to the host's statistics
+func (s *Stats) RecordProbe(host string, state PortState, err error, start time.Time, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.host(host)
+	if h.Ports == 0 || start.Before(h.Start) {
+		h.Start = start
+	}
+	if err != nil {
+		_, kind := classifyDialError(err)
+		h.Errors.Add(kind)
+	}
+	if end := start.Add(d); end.After(h.End) {
+		h.End = end
+	}
+	h.Ports++
+	h.States[state]++
+	h.ProbeTime += d
+	if state == StateOpen {
+		if h.OpenTime == 0 || d < h.OpenMin {
+			h.OpenMin = d
+		}
+		h.OpenMax = max(h.OpenMax, d)
+		h.OpenTime += d
+	}
+}
+
+// host returns the statistics of a host, adding them if needed; s.mu must
+// be held
+func (s *Stats) host(host string) *HostStats {
+	if s.hosts == nil {
+		s.hosts = make(map[string]*HostStats)
+	}
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &HostStats{}
+		s.hosts[host] = h
+	}
+	return h
+}
+
+// Host returns the statistics of one host
+func (s *Stats) Host(host string) (HostStats, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.hosts[host]
+	if !ok {
+		return HostStats{}, false
+	}
+	return *h, true
+}
+
+// HostStats returns a snapshot of the per-host statistics
+func (s *Stats) HostStats() map[string]HostStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]HostStats, len(s.hosts))
+	for host, h := range s.hosts {
+		snapshot[host] = *h
+	}
+	return snapshot
+}
+
+func (s *Stats) GetStats() (int, int, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scanned, s.openPorts, time.Since(s.startTime)
+}
+
+func worker(ctx context.Context, jobs <-chan ScanJob, wg *sync.WaitGroup, stats *Stats, opts ScanOptions, limiter *hostLimiter, knocker *hostKnocker, onResult func(Result)) {
+	defer wg.Done()
+	for job := range jobs {
+		probed := false
+		func() {
+			// A bug in a probe or an enricher costs its job, not the scan
+			defer func() {
+				if v := recover(); v != nil {
+					slog.Error("probe panicked", "host", job.Host, "port", job.Port, "panic", v, "stack", string(debug.Stack()))
+					stats.RecordPanic(job.Host)
+					if !probed {
+						stats.IncrementScanned()
+						if opts.OnProbe != nil {
+							opts.OnProbe(job, StateFiltered, fmt.Errorf("panic: %v", v))
+						}
+					}
+				}
+			}()
+			state, err, ok := probeJob(ctx, job, stats, opts, limiter, knocker, onResult)
+			if !ok {
+				return
+			}
+			probed = true
+			stats.IncrementScanned()
+			if opts.OnProbe != nil {
+				opts.OnProbe(job, state, err)
+			}
+		}()
+	}
+}
+
+// probeJob probes one port and hands on its result. It reports false when
+// the scan was cancelled before the outcome was known.
+func probeJob(ctx context.Context, job ScanJob, stats *Stats, opts ScanOptions, limiter *hostLimiter, knocker *hostKnocker, onResult func(Result)) (state PortState, lastErr error, ok bool) {
+	if opts.Pause != nil {
+		opts.Pause.Wait(ctx)
+	}
+	var kinds []string
+	if opts.Probe.Bounce != nil {
+		kinds = append(kinds, "ftp-bounce")
+	}
+	if err := opts.Policy.Admit(ctx, job.Host, job.Port, kinds...); ctx.Err() != nil {
+		return 0, nil, false
+	} else if err != nil {
+		return StateFiltered, err, true
+	}
+	if knocker != nil && opts.Policy.Permits(job.Host, "knock") {
+		knocker.Knock(ctx, job.Host, opts.Probe)
+	}
+	release := func() {}
+	if limiter != nil {
+		if !limiter.Acquire(ctx, job.Host) {
+			return 0, nil, false
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { limiter.Release(job.Host) }) }
+		defer release() // in case a probe panics while holding it
+	}
+	sleepContext(ctx, jitter(opts.Jitter))
+	if ctx.Err() != nil {
+		return 0, nil, false // drain remaining jobs without probing
+	}
+	if opts.Honeypots.Skipping(job.Host) {
+		return StateFiltered, errHoneypot, true
+	}
+	start := time.Now()
+	// Every attempt at a port goes out from the same source address
+	probe := opts.Probe
+	probe.Source = probe.Source.Next(job.Host, probe.Network)
+	var resolving time.Duration
+	hooks := probeHooks{
+		Exhausted: func() { stats.RecordExhausted(job.Host) },
+		Resolved:  func(d time.Duration) { resolving += d },
+	}
+	state, lastErr = probePort(ctx, job.Host, job.Port, probe, hooks)
+	elapsed := time.Since(start)
+	// Looking up the target name is not part of connecting to the host
+	stats.RecordResolve(job.Host, resolving)
+	start, elapsed = start.Add(resolving), elapsed-resolving
+	// Reprobes count against the host's limit like the probe itself
+	var answered, attempts int
+	if state == StateOpen && probe.Reprobe > 0 {
+		answered, attempts = reprobeOpen(ctx, job.Host, job.Port, probe, hooks)
+	}
+	release()
+	if ctx.Err() != nil && state != StateOpen {
+		return 0, nil, false // interrupted mid-probe; the outcome is unknown
+	}
+	stats.RecordProbe(job.Host, state, lastErr, start, elapsed)
+	metrics.RecordState(state)
+	opts.Honeypots.Observe(ctx, job.Host, job.Port, state, probe)
+	if state == StateOpen || opts.Report.Has(state) {
+		ip, err := GetHostIP(job.Host, probe.Network)
+		if err != nil {
+			ip = job.Host
+		}
+		result := Result{Host: job.Host, IP: ip, Port: job.Port, Time: time.Now(), State: state,
+			Labels: opts.Labels[job.Host], Aliases: opts.Aliases[job.Host], Answered: answered, Attempts: attempts}
+		if name, ok := opts.Names[job.Host]; ok {
+			result.Host = name
+		}
+		result.Suspect = opts.Honeypots.Verdict(job.Host)
+		if opts.Probe.Source.Rotating() {
+			result.Source = probe.Source.IPs[0].String()
+		}
+		if state == StateOpen {
+			stats.IncrementOpen()
+			if opts.Policy.Permits(job.Host, "enrich") {
+				for _, e := range enrichers {
+					e.Enrich(&result, probe)
+				}
+			}
+			result.CPE = productCPE(result.Product, result.Version)
+			result.Hints = matchHints(result, hintRules)
+		}
+		onResult(result)
+	}
+	return state, lastErr, true
+}
+
+// ProbeConfig is how each port is probed
+type ProbeConfig struct {
+	Timeout time.Duration // connection timeout of each attempt
+	Retries int           // attempts per port
+	Sleep   time.Duration // pause after each failed attempt
+	Reprobe int           // further single attempts made to each open port
+	Source  SourceAddr    // local address and interface probes are sent from
+	Network string        // "tcp4" or "tcp6" to probe one address family only
+	Bounce  *FTPBounce    // FTP server probes are bounced through, with -ftp-bounce
+}
+
+// Dial connects to a port of host from the probe's source address and in
+// its address family, giving up after timeout
+func (p ProbeConfig) Dial(host string, port int, timeout time.Duration) (net.Conn, error) {
+	return p.Dialer(host, timeout).Dial(cmp.Or(p.Network, "tcp"), net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// Dialer returns a dialer for connections to host sent from the probe's
+// source address and in its address family, giving up after timeout
+func (p ProbeConfig) Dialer(host string, timeout time.Duration) *net.Dialer {
+	return p.Source.Dialer(host, p.Network, timeout)
+}
+
+// DefaultProbeConfig is the probing used without -t, -r and -s
+func DefaultProbeConfig() ProbeConfig {
+	return ProbeConfig{Timeout: 500 * time.Millisecond, Retries: 5, Sleep: 100 * time.Millisecond}
+}
+
+// probeConfig is set by -t, -r and -s; subcommands pass it on to the scans
+// they start
+var probeConfig = DefaultProbeConfig()
+
+// ScanOptions controls how RunScan schedules probes
+type ScanOptions struct {
+	Workers int         // number of concurrent workers
+	Rate    int         // maximum ports started per second, 0 for unlimited
+	Probe   ProbeConfig // how each port is probed
+
+	HostLimit int           // maximum probes in flight per host, 0 for unlimited
+	Jitter    time.Duration // random delay of up to this before each probe
+	Cooldown  time.Duration // pause before starting on the next host
+
+	// OnProbe, if set, is called after every probe with its outcome and the
+	// error of the last failed attempt. It may be called concurrently.
+	OnProbe func(job ScanJob, state PortState, err error)
+
+	// Pause, if set, holds back new probes while it is paused
+	Pause *Pauser
+
+	// Labels, if set, are attached to the results of each host
+	Labels map[string]map[string]string
+
+	// Aliases, if set, are the other names of each host, attached to its
+	// results
+	Aliases map[string][]string
+
+	// Names, if set, are the names that address targets were resolved from,
+	// reported as the host of their results
+	Names map[string]string
+
+	// Knock, if set, is sent to each host before its first probe
+	Knock *Knock
+
+	// Honeypots, if set, labels the results of hosts that look like
+	// honeypots or tarpits, and may skip the rest of their ports
+	Honeypots *HoneypotDetector
+
+	// Policy, if set, constrains how the hosts of each network it covers
+	// are probed
+	Policy *Policy
+
+	// Report adds closed or filtered ports to the results passed to
+	// onResult; open ports always are
+	Report StateSet
+}
+
+// maxRate is the highest rate a scan may ask for: the throttle ticks once per
+// port, and a second holds no more ticks than this
+const maxRate = int(time.Second)
+
+// checkRate refuses rates a submitted scan cannot be throttled to
+func checkRate(rate int) error {
+	if rate < 0 || rate > maxRate {
+		return fmt.Errorf("rate must be between 0 (unlimited) and %d ports per second, got %d", maxRate, rate)
+	}
+	return nil
+}
+
+// RunScan probes every host/port combination and calls onResult for each
+// open port. onResult is called from a single goroutine, one result at a
+// time, so it can write to shared output without locking. Job generation
+// stops early when ctx is cancelled.
+func RunScan(ctx context.Context, hosts []string, portList []int, opts ScanOptions, stats *Stats, onResult func(Result)) {
+	RunJobs(ctx, HostPorts(hosts, portList), opts, stats, onResult)
+}
+
+// HostPorts yields every combination of hosts and ports
+func HostPorts(hosts []string, portList []int) iter.Seq[ScanJob] {
+	return func(yield func(ScanJob) bool) {
+		for _, targetHost := range hosts {
+			for _, port := range portList {
+				if !yield(ScanJob{Host: targetHost, Port: port}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// RunJobs probes each host/port pair produced by jobs, like RunScan, for
+// targets that don't share one port list
+func RunJobs(ctx context.Context, jobs iter.Seq[ScanJob], opts ScanOptions, stats *Stats, onResult func(Result)) {
+	queue := make(chan ScanJob, opts.Workers*10)
+	var wg sync.WaitGroup
+
+	// A cool-down starts once every probe of the previous host is done
+	var dispatched int64
+	var finished atomic.Int64
+	if opts.Cooldown > 0 {
+		onProbe := opts.OnProbe
+		opts.OnProbe = func(job ScanJob, state PortState, err error) {
+			finished.Add(1)
+			if onProbe != nil {
+				onProbe(job, state, err)
+			}
+		}
+	}
+	var limiter *hostLimiter
+	if opts.HostLimit > 0 {
+		limiter = newHostLimiter(opts.HostLimit)
+	}
+	var knocker *hostKnocker
+	if opts.Knock != nil {
+		knocker = newHostKnocker(opts.Knock)
+	}
+	// Workers hand their results to one goroutine that calls onResult
+	results := make(chan Result, opts.Workers)
+	delivered := make(chan struct{})
+	go func() {
+		defer close(delivered)
+		for r := range results {
+			onResult(r)
+		}
+	}()
+	deliver := func(r Result) { results <- r }
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go worker(ctx, queue, &wg, stats, opts, limiter, knocker, deliver)
+	}
+
+	// A rate above maxRate has no interval to tick at, so is not throttled
+	var throttle <-chan time.Time
+	if opts.Rate > 0 && opts.Rate <= maxRate {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	lastHost := ""
+	for job := range jobs {
+		if opts.Cooldown > 0 && lastHost != "" && job.Host != lastHost {
+			waitUntil(ctx, func() bool { return finished.Load() == dispatched })
+			sleepContext(ctx, opts.Cooldown)
+		}
+		lastHost = job.Host
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case queue <- job:
+			dispatched++
+		case <-ctx.Done():
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+	close(results)
+	<-delivered
+}
+
+// PortsOrDefault parses a port specification, defaulting to all ports when empty
+func PortsOrDefault(portSpec string) ([]int, error) {
+	if portSpec != "" {
+		return ParsePorts(portSpec)
+	}
+	portList := make([]int, 0, 65535)
+	for p := 1; p <= 65535; p++ {
+		portList = append(portList, p)
+	}
+	return portList, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// screenshotDir is the -screenshots flag
+var screenshotDir string
+
+// screenshotWorkers is how many browsers run at once
+const screenshotWorkers = 4
+
+// screenshotTimeout limits how long one page may take to load and render
+var screenshotTimeout = 30 * time.Second
+
+// browserNames are the Chrome and Chromium executables looked for in PATH
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "msedge"}
+
+// browserPaths are where Chrome installs outside PATH
+var browserPaths = map[string][]string{
+	"darwin": {
+		"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+		"/Applications/Chromium.app/Contents/MacOS/Chromium",
+	},
+	"windows": {
+		`C:\Program Files\Google\Chrome\Application\chrome.exe`,
+		`C:\Program Files (x86)\Microsoft\Edge\Application\msedge.exe`,
+	},
+}
+
+// FindBrowser returns the headless browser used for screenshots: the one
+// named by PSCANNER_BROWSER, or the first Chrome or Chromium found
+func FindBrowser() (string, error) {
+	if browser := os.Getenv("PSCANNER_BROWSER"); browser != "" {
+		return exec.LookPath(browser)
+	}
+	for _, name := range browserNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	for _, path := range browserPaths[runtime.GOOS] {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no Chrome or Chromium found for -screenshots; install one or set PSCANNER_BROWSER")
+}
+
+// Screenshot is the picture of one web service, or why there is none
+type Screenshot struct {
+	URL  string
+	File string // name of the image in the screenshot directory
+	Err  error
+}
+
+// TakeScreenshots loads each web service among the open ports in the headless
+// browser and saves a picture of it to dir, with an index.html linking them
+// all. Ports are taken to serve the web when an enricher found a site or
+// named the service http or https, or when DetectHTTP says so. The file name
+// of each picture is recorded in the result's http.screenshot.
+func TakeScreenshots(ctx context.Context, browser, dir string, results []Result, probe ProbeConfig) ([]Screenshot, error) {
+	profile, err := os.MkdirTemp("", "pscanner-browser")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(profile)
+
+	var mu sync.Mutex
+	var shots []Screenshot
+	var wg sync.WaitGroup
+	queue := make(chan int)
+	for range screenshotWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				r := &results[i]
+				url := webURL(*r, probe, probe.Timeout)
+				if url == "" {
+					continue
+				}
+				shot := Screenshot{URL: url, File: screenshotFile(*r)}
+				shot.Err = screenshot(ctx, browser, profile, url, filepath.Join(dir, shot.File))
+				mu.Lock()
+				if shot.Err == nil {
+					if r.HTTP == nil {
+						r.HTTP = &HTTPInfo{URL: url}
+					}
+					r.HTTP.Screenshot = shot.File
+				}
+				shots = append(shots, shot)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, r := range results {
+		if r.State != StateOpen || r.Transport != "" || ctx.Err() != nil {
+			continue
+		}
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	slices.SortFunc(shots, func(a, b Screenshot) int { return strings.Compare(a.URL, b.URL) })
+	return shots, writeScreenshotIndex(filepath.Join(dir, "index.html"), shots)
+}
+
+// webURL is the URL of the site on an open port, or "" if it isn't one
+func webURL(r Result, probe ProbeConfig, wait time.Duration) string {
+	if r.HTTP != nil {
+		return r.HTTP.URL
+	}
+	scheme := r.Service
+	if scheme != "http" && scheme != "https" {
+		if r.Service != "" {
+			return ""
+		}
+		if scheme = DetectHTTP(r.Host, r.Port, probe, wait); scheme == "" {
+			return ""
+		}
+	}
+	return FormatTarget(r, scheme)
+}
+
+// screenshotFile names the picture of a port, e.g. "10.0.0.5_443.png"
+func screenshotFile(r Result) string {
+	return strings.NewReplacer(":", "-", "%", "-").Replace(r.IP) + "_" + strconv.Itoa(r.Port) + ".png"
+}
+
+// screenshot runs the browser headless to save a picture of one page. The
+// browser gets a profile of its own so that a running one is left alone, and
+// certificate errors are ignored since most internal sites have them.
+func screenshot(ctx context.Context, browser, profile, url, file string) error {
+	ctx, cancel := context.WithTimeout(ctx, screenshotTimeout)
+	defer cancel()
+	args := []string{"--headless", "--disable-gpu", "--hide-scrollbars", "--ignore-certificate-errors",
+		"--no-first-run", "--user-data-dir=" + profile, "--window-size=1280,800", "--screenshot=" + file}
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox") // Chrome refuses to run as root otherwise
+	}
+	out, err := exec.CommandContext(ctx, browser, append(args, url)...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil && output != "" {
+		return fmt.Errorf("%v: %s", err, output)
+	}
+	if _, statErr := os.Stat(file); err == nil && statErr != nil {
+		return fmt.Errorf("no screenshot saved: %s", output)
+	}
+	return err
+}
+
+// screenshotIndex is the page linking the screenshots
+var screenshotIndex = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>pscanner screenshots</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+figure { display: inline-block; margin: 0.5em; vertical-align: top; }
+img { width: 640px; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>Web services</h1>
+{{range .}}<figure>
+{{if .Err}}<figcaption><a href="{{.URL}}">{{.URL}}</a>: {{.Err}}</figcaption>
+{{else}}<a href="{{.File}}"><img src="{{.File}}" alt="{{.URL}}"></a>
+<figcaption><a href="{{.URL}}">{{.URL}}</a></figcaption>
+{{end}}</figure>
+{{end}}</body>
+</html>
+`))
+
+// writeScreenshotIndex writes the page linking the screenshots
+func writeScreenshotIndex(filename string, shots []Screenshot) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := screenshotIndex.Execute(f, shots); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBrowser writes a script that saves its URL argument to the file given
+// with --screenshot, or fails for URLs containing "broken"
+func fakeBrowser(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake browser is a shell script")
+	}
+	script := filepath.Join(t.TempDir(), "chromium")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+for arg; do
+	case $arg in
+	--screenshot=*) file=${arg#--screenshot=} ;;
+	*broken*) echo "net::ERR_CONNECTION_REFUSED" >&2; exit 1 ;;
+	http*) url=$arg ;;
+	esac
+done
+echo "$url" > "$file"
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestFindBrowser(t *testing.T) {
+	script := fakeBrowser(t)
+	t.Setenv("PSCANNER_BROWSER", script)
+	if got, err := FindBrowser(); err != nil || got != script {
+		t.Errorf("FindBrowser() = %q, %v, expected %q", got, err, script)
+	}
+	t.Setenv("PSCANNER_BROWSER", filepath.Join(t.TempDir(), "missing"))
+	if _, err := FindBrowser(); err == nil {
+		t.Errorf("FindBrowser() succeeded with a missing PSCANNER_BROWSER")
+	}
+}
+
+func TestTakeScreenshots(t *testing.T) {
+	browser := fakeBrowser(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+	results := []Result{
+		{Host: "127.0.0.1", IP: "127.0.0.1", Port: port, State: StateOpen, HTTP: &HTTPInfo{URL: srv.URL}},
+		{Host: "127.0.0.1", IP: "127.0.0.1", Port: 22, State: StateOpen, Service: "ssh"},
+		{Host: "broken.example", IP: "127.0.0.2", Port: 443, State: StateOpen, Service: "https"},
+		{Host: "127.0.0.1", IP: "127.0.0.1", Port: 161, State: StateOpen, Transport: "udp", Service: "snmp"},
+	}
+
+	dir := t.TempDir()
+	shots, err := TakeScreenshots(context.Background(), browser, dir, results, ProbeConfig{Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shots) != 2 || shots[0].URL != srv.URL || shots[0].Err != nil || shots[1].URL != "https://broken.example" || shots[1].Err == nil {
+		t.Fatalf("TakeScreenshots() = %+v, expected the broken site and the working one", shots)
+	}
+	file := "127.0.0.1_" + strconv.Itoa(port) + ".png"
+	if results[0].HTTP.Screenshot != file {
+		t.Errorf("screenshot = %q, expected %q", results[0].HTTP.Screenshot, file)
+	}
+	if results[2].HTTP != nil {
+		t.Errorf("the broken site got http %+v, expected none", results[2].HTTP)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, file)); err != nil || strings.TrimSpace(string(data)) != srv.URL {
+		t.Errorf("screenshot file = %q, %v, expected the browser's output", data, err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<img src="` + file + `"`, `<a href="https://broken.example">https://broken.example</a>: exit status 1: net::ERR_CONNECTION_REFUSED`} {
+		if !strings.Contains(string(index), want) {
+			t.Errorf("index.html does not contain %q:\n%s", want, index)
+		}
+	}
+}
@@ -0,0 +1,742 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// Job statuses reported by the API
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobCancelled = "cancelled"
+)
+
+// ScanRequest is the body accepted when submitting a scan
+type ScanRequest struct {
+	Hosts       []string `json:"hosts"`
+	CIDRs       []string `json:"cidrs"`
+	Ports       string   `json:"ports"`
+	Concurrency int      `json:"concurrency"`
+	Rate        int      `json:"rate"`
+}
+
+// Job is a scan submitted to the server. Its exported fields are what the
+// job store persists.
+type Job struct {
+	ID         string      `json:"id"`
+	Owner      string      `json:"owner,omitempty"`
+	Request    ScanRequest `json:"request"`
+	Status     string      `json:"status"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	Scanned    int         `json:"scanned"`
+	Open       int         `json:"open"`
+	Error      string      `json:"error,omitempty"` // why a restored scan was not started again
+
+	hosts   []string
+	names   map[string]string // names the addresses in hosts were resolved from
+	ports   []int
+	stats   *Stats
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	results []Result
+	changed chan struct{}
+}
+
+// JobStatus is a job along with its current progress
+type JobStatus struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Hosts      int        `json:"hosts"`
+	Total      int        `json:"total"`
+	Scanned    int        `json:"scanned"`
+	Open       int        `json:"open"`
+	Progress   float64    `json:"progress"`
+	Rate       float64    `json:"rate"`
+	Elapsed    string     `json:"elapsed"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Progress returns a snapshot of the job's progress
+func (j *Job) Progress() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	scanned, openPorts, elapsed := j.Scanned, j.Open, time.Duration(0)
+	if j.FinishedAt != nil {
+		if j.StartedAt != nil {
+			elapsed = j.FinishedAt.Sub(*j.StartedAt)
+		}
+	} else if j.stats != nil {
+		scanned, openPorts, elapsed = j.stats.GetStats()
+	}
+
+	total := len(j.hosts) * len(j.ports)
+	status := JobStatus{
+		ID:         j.ID,
+		Status:     j.Status,
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt,
+		Hosts:      len(j.hosts),
+		Total:      total,
+		Scanned:    scanned,
+		Open:       openPorts,
+		Elapsed:    elapsed.Round(time.Second).String(),
+		Error:      j.Error,
+	}
+	if total > 0 {
+		status.Progress = float64(scanned) * 100 / float64(total)
+	}
+	if elapsed > 0 {
+		status.Rate = float64(scanned) / elapsed.Seconds()
+	}
+	return status
+}
+
+// Results returns a copy of the open ports found so far
+func (j *Job) Results() []Result {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Result(nil), j.results...)
+}
+
+// Wait returns the results recorded after the first n, whether the job has
+// finished, and a channel that is closed the next time the job changes
+func (j *Job) Wait(n int) ([]Result, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.changed == nil {
+		j.changed = make(chan struct{})
+	}
+	var results []Result
+	if n < len(j.results) {
+		results = append(results, j.results[n:]...)
+	}
+	return results, j.FinishedAt != nil, j.changed
+}
+
+// notifyLocked wakes everyone waiting for the job to change; j.mu must be held
+func (j *Job) notifyLocked() {
+	if j.changed != nil {
+		close(j.changed)
+		j.changed = nil
+	}
+}
+
+// Limits on the scans a client can submit, which would otherwise let any
+// client exhaust the server's memory or sockets
+const (
+	defaultMaxHosts    = 65536          // hosts in one scan, a /16
+	defaultMaxWorkers  = 5000           // concurrent probes of one scan
+	defaultMaxJobs     = 4              // scans running at once
+	defaultMaxPending  = 16             // scans one client may have queued or running
+	defaultMaxFinished = 1000           // finished scans kept
+	defaultKeepFor     = 24 * time.Hour // how long finished scans are kept
+)
+
+// errTooManyScans is returned when a client already has as many scans queued
+// or running as the server allows
+var errTooManyScans = errors.New("too many scans queued or running")
+
+// Server runs scan jobs submitted over HTTP
+type Server struct {
+	mu         sync.Mutex
+	jobs       map[string]*Job
+	keys       []*APIKey     // when set, every API request must present one of these
+	store      *JobStore     // when set, jobs and results survive restarts
+	slots      chan struct{} // when set, limits how many scans run at once
+	probe      ProbeConfig   // how the scans probe each port
+	maxHosts   int           // largest number of hosts a scan may have
+	maxWorkers int           // highest concurrency a scan may ask for
+	maxPending int           // most scans one client may have queued or running (0 = unlimited)
+	keepFor    time.Duration // how long finished scans are kept (0 = forever)
+	maxKept    int           // most finished scans kept (0 = unlimited)
+	submitMu   sync.Mutex    // makes the pending count and the new job one step
+}
+
+// NewServer returns a server with no jobs whose scans probe ports as set by
+// probe
+func NewServer(probe ProbeConfig) *Server {
+	return &Server{
+		jobs:       make(map[string]*Job),
+		probe:      probe,
+		maxHosts:   defaultMaxHosts,
+		maxWorkers: defaultMaxWorkers,
+		maxPending: defaultMaxPending,
+		keepFor:    defaultKeepFor,
+		maxKept:    defaultMaxFinished,
+	}
+}
+
+// Handler returns the HTTP routes for the scanning API and web UI
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /api/scans", s.handleSubmit)
+	api.HandleFunc("GET /api/scans", s.handleList)
+	api.HandleFunc("GET /api/scans/{id}", s.handleStatus)
+	api.HandleFunc("GET /api/scans/{id}/results", s.handleResults)
+	api.HandleFunc("GET /api/scans/{id}/events", s.handleEvents)
+	api.HandleFunc("DELETE /api/scans/{id}", s.handleCancel)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", s.Authenticate(api))
+	ui, _ := fs.Sub(webFiles, "web")
+	mux.Handle("/", http.FileServerFS(ui))
+	return mux
+}
+
+// prepareScan expands a request's targets and ports, refusing more than
+// maxHosts hosts before expanding the ranges
+func prepareScan(req ScanRequest, maxHosts int) ([]string, []int, error) {
+	total := uint64(len(req.Hosts))
+	for _, cidr := range req.CIDRs {
+		size, err := CIDRSize(cidr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR %s: %v", cidr, err)
+		}
+		total += min(size, math.MaxUint32)
+	}
+	if total > uint64(maxHosts) {
+		return nil, nil, fmt.Errorf("too many hosts: at most %d may be scanned at once", maxHosts)
+	}
+	hosts := append([]string(nil), req.Hosts...)
+	for _, cidr := range req.CIDRs {
+		ips, err := ExpandCIDR(cidr, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CIDR %s: %v", cidr, err)
+		}
+		hosts = append(hosts, ips...)
+	}
+	if len(hosts) == 0 {
+		return nil, nil, fmt.Errorf("no hosts to scan")
+	}
+	portList, err := PortsOrDefault(req.Ports)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hosts, portList, nil
+}
+
+// Submit validates a scan request and queues it. When key is set, every
+// target must be within its scope and the rate is capped.
+func (s *Server) Submit(req ScanRequest, key *APIKey) (*Job, error) {
+	hosts, portList, err := prepareScan(req, s.maxHosts)
+	if err != nil {
+		return nil, err
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = concurrency
+	}
+	req.Concurrency = min(req.Concurrency, s.maxWorkers)
+	if err := checkRate(req.Rate); err != nil {
+		return nil, err
+	}
+	owner := ""
+	var names map[string]string
+	if key != nil {
+		if hosts, names, err = key.Resolve(context.Background(), hosts, s.probe.Network); err != nil {
+			return nil, err
+		}
+		if key.MaxRate > 0 && (req.Rate <= 0 || req.Rate > key.MaxRate) {
+			req.Rate = key.MaxRate
+		}
+		owner = key.Name
+	}
+
+	s.submitMu.Lock()
+	defer s.submitMu.Unlock()
+	s.prune(time.Now())
+	if s.maxPending > 0 && s.pending(owner) >= s.maxPending {
+		return nil, fmt.Errorf("%w: at most %d at once", errTooManyScans, s.maxPending)
+	}
+
+	job := &Job{
+		ID:        randomID(8),
+		Owner:     owner,
+		Request:   req,
+		Status:    JobQueued,
+		CreatedAt: time.Now(),
+		hosts:     hosts,
+		names:     names,
+		ports:     portList,
+	}
+	if err := s.store.Save(job); err != nil {
+		return nil, fmt.Errorf("saving scan: %v", err)
+	}
+	s.start(job)
+	return job, nil
+}
+
+// start runs a job in the background once a scan slot is free
+func (s *Server) start(job *Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job.cancel = cancel
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		if s.slots != nil {
+			select {
+			case s.slots <- struct{}{}:
+				defer func() { <-s.slots }()
+			case <-ctx.Done():
+				s.finish(job, JobCancelled)
+				return
+			}
+		}
+
+		now := time.Now()
+		stats := &Stats{startTime: now}
+		job.mu.Lock()
+		job.Status = JobRunning
+		job.StartedAt = &now
+		job.stats = stats
+		job.mu.Unlock()
+		s.persist(job)
+		slog.Info("scan started", "scan", job.ID, "hosts", len(job.hosts), "ports", len(job.ports))
+
+		opts := ScanOptions{Workers: job.Request.Concurrency, Rate: job.Request.Rate, Probe: s.probe, Names: job.names}
+		RunScan(ctx, job.hosts, job.ports, opts, stats, func(r Result) {
+			job.mu.Lock()
+			job.results = append(job.results, r)
+			job.notifyLocked()
+			job.mu.Unlock()
+			if err := s.store.AppendResult(job.ID, r); err != nil {
+				slog.Error("saving result", "scan", job.ID, "err", err)
+			}
+		})
+
+		if ctx.Err() != nil {
+			s.finish(job, JobCancelled)
+		} else {
+			s.finish(job, JobCompleted)
+		}
+	}()
+}
+
+// finish records the final status and counts of a job
+func (s *Server) finish(job *Job, status string) {
+	now := time.Now()
+	job.mu.Lock()
+	if job.stats != nil {
+		job.Scanned, job.Open, _ = job.stats.GetStats()
+	}
+	job.Status = status
+	job.FinishedAt = &now
+	job.notifyLocked()
+	scanned, open := job.Scanned, job.Open
+	job.mu.Unlock()
+	s.persist(job)
+	slog.Info("scan finished", "scan", job.ID, "status", status, "scanned", scanned, "open", open)
+}
+
+func (s *Server) persist(job *Job) {
+	if err := s.store.Save(job); err != nil {
+		slog.Error("saving scan", "scan", job.ID, "err", err)
+	}
+}
+
+// pending counts the scans an owner has queued or running
+func (s *Server) pending(owner string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, job := range s.jobs {
+		job.mu.Lock()
+		if job.Owner == owner && job.FinishedAt == nil {
+			n++
+		}
+		job.mu.Unlock()
+	}
+	return n
+}
+
+// prune forgets finished scans older than keepFor, and the oldest ones
+// beyond maxKept, removing them from the store too
+func (s *Server) prune(now time.Time) {
+	type finished struct {
+		id string
+		at time.Time
+	}
+	var done []finished
+	s.mu.Lock()
+	for id, job := range s.jobs {
+		job.mu.Lock()
+		if job.FinishedAt != nil {
+			done = append(done, finished{id, *job.FinishedAt})
+		}
+		job.mu.Unlock()
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].at.After(done[j].at) })
+	var expired []string
+	for i, f := range done {
+		if s.keepFor > 0 && now.Sub(f.at) > s.keepFor || s.maxKept > 0 && i >= s.maxKept {
+			delete(s.jobs, f.id)
+			expired = append(expired, f.id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range expired {
+		if err := s.store.Delete(id); err != nil {
+			slog.Error("removing expired scan", "scan", id, "err", err)
+		}
+	}
+}
+
+// keyNamed returns the API key with the given name, nil if there is none
+func (s *Server) keyNamed(name string) *APIKey {
+	for _, k := range s.keys {
+		if k.Name == name {
+			return k
+		}
+	}
+	return nil
+}
+
+// Restore loads the jobs kept in the store. Scans that were queued or running
+// when the server stopped are started again from the beginning, their names
+// resolved and checked against the scope of the key that submitted them once
+// more; those that are no longer valid, such as ones over a lowered
+// -max-hosts or that the key may no longer scan, are cancelled with the
+// reason.
+func (s *Server) Restore() (int, error) {
+	jobs, err := s.store.Load()
+	if err != nil {
+		return 0, err
+	}
+	for _, job := range jobs {
+		if job.FinishedAt != nil {
+			// Finished scans only need their size for the progress they report
+			job.hosts, job.ports, _ = prepareScan(job.Request, math.MaxInt)
+			job.cancel = func() {}
+			s.mu.Lock()
+			s.jobs[job.ID] = job
+			s.mu.Unlock()
+			continue
+		}
+		job.Status, job.StartedAt, job.results = JobQueued, nil, nil
+		if err := s.store.ResetResults(job.ID); err != nil {
+			return 0, err
+		}
+		job.hosts, job.ports, err = prepareScan(job.Request, s.maxHosts)
+		if err == nil && len(s.keys) > 0 {
+			key := s.keyNamed(job.Owner)
+			if key == nil {
+				err = fmt.Errorf("API key %q no longer exists", job.Owner)
+			} else {
+				job.hosts, job.names, err = key.Resolve(context.Background(), job.hosts, s.probe.Network)
+			}
+		}
+		if err != nil {
+			s.abandon(job, err)
+			continue
+		}
+		s.persist(job)
+		s.start(job)
+	}
+	s.prune(time.Now())
+	return len(jobs), nil
+}
+
+// abandon keeps a restored scan that cannot be started again as cancelled,
+// recording why
+func (s *Server) abandon(job *Job, err error) {
+	slog.Warn("not restarting scan", "scan", job.ID, "err", err)
+	job.cancel = func() {}
+	job.mu.Lock()
+	job.Error = err.Error()
+	job.mu.Unlock()
+	s.mu.Lock()
+	s.jobs[job.ID] = job
+	s.mu.Unlock()
+	s.finish(job, JobCancelled)
+}
+
+// Job looks up a job by ID. When key is set, only jobs it submitted are found.
+func (s *Server) Job(id string, key *APIKey) *Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job := s.jobs[id]
+	if job == nil || (key != nil && job.Owner != key.Name) {
+		return nil
+	}
+	return job
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func (s *Server) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: %v", err)
+		return
+	}
+	job, err := s.Submit(req, keyFromContext(r.Context()))
+	if errors.Is(err, errOutOfScope) {
+		writeError(w, http.StatusForbidden, "%v", err)
+		return
+	}
+	if errors.Is(err, errTooManyScans) {
+		writeError(w, http.StatusTooManyRequests, "%v", err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, job.Progress())
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	key := keyFromContext(r.Context())
+	s.mu.Lock()
+	list := make([]JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if key == nil || job.Owner == key.Name {
+			list = append(list, job.Progress())
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	job := s.Job(r.PathValue("id"), keyFromContext(r.Context()))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job.Progress())
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	job := s.Job(r.PathValue("id"), keyFromContext(r.Context()))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job.Results())
+}
+
+// writeEvent writes one Server-Sent Event with a JSON payload
+func writeEvent(w http.ResponseWriter, event string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// handleEvents streams "result" events for every open port (including those
+// found before the request), periodic "progress" events, and a final "done"
+// event once the scan finishes
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	job := s.Job(r.PathValue("id"), keyFromContext(r.Context()))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	writeEvent(w, "progress", job.Progress())
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	sent := 0
+	for {
+		results, done, changed := job.Wait(sent)
+		for _, res := range results {
+			writeEvent(w, "result", res)
+		}
+		sent += len(results)
+		if done {
+			writeEvent(w, "done", job.Progress())
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-ticker.C:
+			writeEvent(w, "progress", job.Progress())
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) handleCancel(w http.ResponseWriter, r *http.Request) {
+	job := s.Job(r.PathValue("id"), keyFromContext(r.Context()))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	job.cancel()
+	writeJSON(w, http.StatusAccepted, job.Progress())
+}
+
+// runServe implements the "serve" subcommand
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := flags.String("listen", ":8080", "Address to listen on; without -api-keys or -client-ca it must be a loopback address")
+	grpcListen := flags.String("grpc-listen", "", "Address to serve the gRPC API on (HTTP/2)")
+	keysFile := flags.String("api-keys", "", "JSON file of API keys; when set, every API request must present one")
+	certFile := flags.String("tls-cert", "", "TLS certificate file")
+	keyFile := flags.String("tls-key", "", "TLS private key file")
+	clientCA := flags.String("client-ca", "", "Require client certificates signed by this CA (mutual TLS)")
+	dataDir := flags.String("data-dir", "", "Directory to persist scans and results across restarts")
+	maxJobs := flags.Int("max-jobs", defaultMaxJobs, "Maximum number of scans to run at once; others wait in a queue (0 = unlimited)")
+	maxPending := flags.Int("max-pending", defaultMaxPending, "Maximum number of scans one API key may have queued or running; more are refused (0 = unlimited)")
+	keepFor := flags.Duration("keep-finished", defaultKeepFor, "How long to keep finished scans and their results (0 = forever)")
+	maxKept := flags.Int("max-finished", defaultMaxFinished, "Maximum number of finished scans to keep; the oldest are removed first (0 = unlimited)")
+	maxHosts := flags.Int("max-hosts", defaultMaxHosts, "Maximum number of hosts in one scan; larger requests are refused")
+	maxWorkers := flags.Int("max-concurrency", defaultMaxWorkers, "Maximum number of concurrent workers a scan may ask for")
+	flags.StringVar(&geoipFiles, "geoip", "", "MaxMind DB files for country/ASN lookups, comma-separated")
+	flags.StringVar(&enrich, "enrich", "", "Extra lookups for open ports, comma-separated (rdap, shodan, censys)")
+	addProbeFlags(flags)
+	flags.Lookup("c").Usage = "Default number of concurrent workers per scan"
+	addLogFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 2
+	}
+	if !checkProbeFlags() {
+		return 2
+	}
+	if err := enableGeoIP(geoipFiles); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if err := enableEnrichers(enrich, probeConfig.Timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+
+	if *maxHosts < 1 || *maxWorkers < 1 {
+		fmt.Fprintf(os.Stderr, "Error: -max-hosts and -max-concurrency must be at least 1\n")
+		return 2
+	}
+	if *maxJobs < 0 || *maxPending < 0 || *maxKept < 0 || *keepFor < 0 {
+		fmt.Fprintf(os.Stderr, "Error: -max-jobs, -max-pending, -max-finished and -keep-finished must not be negative\n")
+		return 2
+	}
+	if *keysFile == "" && *clientCA == "" && (!isLoopbackAddr(*listen) || *grpcListen != "" && !isLoopbackAddr(*grpcListen)) {
+		fmt.Fprintf(os.Stderr, "Error: -api-keys or -client-ca is required when -listen or -grpc-listen is not a loopback address\n")
+		return 2
+	}
+	server := NewServer(probeConfig)
+	server.maxHosts, server.maxWorkers = *maxHosts, *maxWorkers
+	server.maxPending, server.keepFor, server.maxKept = *maxPending, *keepFor, *maxKept
+	if *keysFile != "" {
+		keys, err := LoadAPIKeys(*keysFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading API keys: %v\n", err)
+			return 1
+		}
+		server.keys = keys
+		slog.Info("loaded API keys", "count", len(keys))
+	}
+
+	if *maxJobs > 0 {
+		server.slots = make(chan struct{}, *maxJobs)
+	}
+	if *dataDir != "" {
+		store, err := OpenJobStore(*dataDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening data directory: %v\n", err)
+			return 1
+		}
+		server.store = store
+		n, err := server.Restore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error restoring scans: %v\n", err)
+			return 1
+		}
+		slog.Info("restored scans", "count", n, "dir", *dataDir)
+	}
+
+	var tlsConfig *tls.Config
+	if *certFile != "" || *keyFile != "" {
+		var err error
+		tlsConfig, err = LoadServerTLS(*certFile, *keyFile, *clientCA)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading TLS configuration: %v\n", err)
+			return 1
+		}
+	} else if *clientCA != "" {
+		fmt.Fprintf(os.Stderr, "Error: -client-ca requires -tls-cert and -tls-key\n")
+		return 1
+	}
+
+	serve := func(srv *http.Server) error {
+		if tlsConfig != nil {
+			srv.TLSConfig = tlsConfig
+			return srv.ListenAndServeTLS("", "")
+		}
+		return srv.ListenAndServe()
+	}
+
+	if *grpcListen != "" {
+		var protocols http.Protocols
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		grpcServer := &http.Server{Addr: *grpcListen, Handler: server.GRPCHandler(), Protocols: &protocols}
+		go func() {
+			if err := serve(grpcServer); err != nil {
+				slog.Error("running gRPC server", "err", err)
+				os.Exit(1)
+			}
+		}()
+		slog.Info("gRPC listening", "addr", *grpcListen)
+	}
+
+	slog.Info("web UI and REST API listening", "addr", *listen)
+	if err := serve(&http.Server{Addr: *listen, Handler: server.Handler()}); err != nil {
+		slog.Error("running server", "err", err)
+		return 1
+	}
+	return 0
+}
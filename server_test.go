@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerScanLifecycle(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ts := httptest.NewServer(NewServer(quickProbe).Handler())
+	defer ts.Close()
+
+	body, _ := json.Marshal(ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: fmt.Sprint(port)})
+	resp, err := http.Post(ts.URL+"/api/scans", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /api/scans error = %v", err)
+	}
+	var status JobStatus
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || status.ID == "" {
+		t.Fatalf("POST /api/scans = %d %+v", resp.StatusCode, status)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for status.FinishedAt == nil && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+		resp, err := http.Get(ts.URL + "/api/scans/" + status.ID)
+		if err != nil {
+			t.Fatalf("GET status error = %v", err)
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+	}
+	if status.Status != JobCompleted || status.Scanned != 1 || status.Open != 1 {
+		t.Fatalf("scan status = %+v, expected completed with 1 open port", status)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/scans/" + status.ID + "/results")
+	if err != nil {
+		t.Fatalf("GET results error = %v", err)
+	}
+	var results []Result
+	json.NewDecoder(resp.Body).Decode(&results)
+	resp.Body.Close()
+	if len(results) != 1 || results[0].Port != port {
+		t.Errorf("results = %+v, expected port %d", results, port)
+	}
+}
+
+func TestServerSubmitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  ScanRequest
+	}{
+		{name: "No hosts", req: ScanRequest{Ports: "80"}},
+		{name: "Invalid CIDR", req: ScanRequest{CIDRs: []string{"10.0.0.0"}}},
+		{name: "Invalid ports", req: ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: "0"}},
+		{name: "IPv4 range too large", req: ScanRequest{CIDRs: []string{"10.0.0.0/8"}, Ports: "80"}},
+		{name: "IPv6 range too large", req: ScanRequest{CIDRs: []string{"2001:db8::/64"}, Ports: "80"}},
+		{name: "Too many hosts in all", req: ScanRequest{CIDRs: []string{"10.0.0.0/16", "10.1.0.0/24"}, Ports: "80"}},
+	}
+
+	s := NewServer(quickProbe)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Submit(tt.req, nil); err == nil {
+				t.Errorf("Submit() expected error for %+v", tt.req)
+			}
+		})
+	}
+}
+
+func TestServerUnknownScan(t *testing.T) {
+	ts := httptest.NewServer(NewServer(quickProbe).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/scans/missing")
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET unknown scan = %d, expected 404", resp.StatusCode)
+	}
+}
+
+func TestServerWebUI(t *testing.T) {
+	ts := httptest.NewServer(NewServer(quickProbe).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET / = %d %s, expected the embedded HTML page", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	server := NewServer(quickProbe)
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	job, err := server.Submit(ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: fmt.Sprint(port)}, nil)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/scans/" + job.ID + "/events")
+	if err != nil {
+		t.Fatalf("GET events error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Content-Type = %q, expected text/event-stream", resp.Header.Get("Content-Type"))
+	}
+	for _, want := range []string{"event: result\n", fmt.Sprintf(`"port":%d`, port), "event: done\n"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("event stream missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestServerSubmitLimits(t *testing.T) {
+	s := NewServer(quickProbe)
+	s.maxWorkers = 100
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		body        string
+		status      int
+		concurrency int
+	}{
+		{`{"hosts":["127.0.0.1"],"ports":"1","concurrency":-5}`, http.StatusCreated, concurrency},
+		{`{"hosts":["127.0.0.1"],"ports":"1","concurrency":1000000000}`, http.StatusCreated, 100},
+		{`{"hosts":["127.0.0.1"],"ports":"1","concurrency":7}`, http.StatusCreated, 7},
+		{`{"cidrs":["10.0.0.0/8"],"ports":"1"}`, http.StatusBadRequest, 0},
+		{`{"cidrs":["fe80::/64"],"ports":"1"}`, http.StatusBadRequest, 0},
+		{`{"hosts":["127.0.0.1"],"ports":"1","rate":2000000000}`, http.StatusBadRequest, 0},
+		{`{"hosts":["127.0.0.1"],"ports":"1","rate":-1}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		resp, err := http.Post(ts.URL+"/api/scans", "application/json", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("POST error = %v", err)
+		}
+		var status JobStatus
+		json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("POST %s = %d, expected %d", tt.body, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status != http.StatusCreated {
+			continue
+		}
+		if job := s.Job(status.ID, nil); job == nil || job.Request.Concurrency != tt.concurrency {
+			t.Errorf("POST %s: job %+v, expected concurrency %d", tt.body, job, tt.concurrency)
+		}
+	}
+}
+
+func TestRunServeRequiresAuthentication(t *testing.T) {
+	tests := [][]string{
+		{"-listen", ":0"},
+		{"-listen", "0.0.0.0:0"},
+		{"-listen", "127.0.0.1:0", "-grpc-listen", ":0"},
+	}
+	for _, args := range tests {
+		if code := runServe(args); code != 2 {
+			t.Errorf("runServe(%q) without authentication = %d, expected 2", args, code)
+		}
+	}
+}
+
+func TestServerPendingLimit(t *testing.T) {
+	s := NewServer(quickProbe)
+	s.maxPending = 2
+	s.slots = make(chan struct{}, 1)
+	s.slots <- struct{}{} // keeps every scan queued
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	body := `{"hosts":["127.0.0.1"],"ports":"1"}`
+	for i, expected := range []int{http.StatusCreated, http.StatusCreated, http.StatusTooManyRequests} {
+		resp, err := http.Post(ts.URL+"/api/scans", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("POST error = %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("POST #%d = %d, expected %d", i+1, resp.StatusCode, expected)
+		}
+	}
+
+	// A finished scan frees its place
+	s.mu.Lock()
+	var first *Job
+	for _, job := range s.jobs {
+		first = job
+		break
+	}
+	s.mu.Unlock()
+	first.cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for first.Progress().FinishedAt == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := s.Submit(ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: "1"}, nil); err != nil {
+		t.Errorf("Submit() after a scan finished error = %v", err)
+	}
+	for _, job := range s.jobs {
+		job.cancel()
+	}
+}
+
+func TestServerPrune(t *testing.T) {
+	store, err := OpenJobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(quickProbe)
+	s.store, s.keepFor, s.maxKept = store, time.Hour, 2
+	now := time.Now()
+	ages := map[string]time.Duration{"old": 2 * time.Hour, "a": 3 * time.Minute, "b": 2 * time.Minute, "c": time.Minute}
+	for id, age := range ages {
+		finished := now.Add(-age)
+		job := &Job{ID: id, Status: JobCompleted, FinishedAt: &finished}
+		store.Save(job)
+		s.jobs[id] = job
+	}
+	s.jobs["running"] = &Job{ID: "running", Status: JobRunning}
+
+	s.prune(now)
+	for _, id := range []string{"old", "a"} {
+		if s.jobs[id] != nil {
+			t.Errorf("scan %q kept, expected it pruned", id)
+		}
+	}
+	for _, id := range []string{"b", "c", "running"} {
+		if s.jobs[id] == nil {
+			t.Errorf("scan %q pruned, expected it kept", id)
+		}
+	}
+	jobs, err := store.Load()
+	if err != nil || len(jobs) != 2 {
+		t.Errorf("store.Load() after prune = %d jobs, %v; expected 2", len(jobs), err)
+	}
+}
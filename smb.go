@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// SMBInfo is what an SMB server tells an anonymous client while negotiating
+// a session: the protocol dialect, whether messages must be signed, and in
+// the NTLM challenge the names of the machine and its domain
+type SMBInfo struct {
+	Dialect         string `json:"dialect"`                // e.g. "3.1.1"
+	SigningRequired bool   `json:"signing_required"`       // unsigned sessions, and NTLM relaying, are refused
+	Computer        string `json:"computer,omitempty"`     // NetBIOS name of the server
+	Domain          string `json:"domain,omitempty"`       // NetBIOS name of its domain or workgroup
+	DNSComputer     string `json:"dns_computer,omitempty"` // fully qualified name of the server
+	DNSDomain       string `json:"dns_domain,omitempty"`
+	OSVersion       string `json:"os_version,omitempty"` // Windows version and build, e.g. "10.0.20348"
+}
+
+// smbPorts are the ports SMBProber tries when the service of a port isn't
+// known; 139 needs a NetBIOS session first
+var smbPorts = map[int]bool{139: true, 445: true}
+
+// SMBProber is an enricher that negotiates SMB 2 and 3 and starts, but never
+// completes, an NTLM login, which is enough for the server to describe
+// itself. No credentials are sent.
+type SMBProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records the SMB server behind a port
+func (p SMBProber) Enrich(r *Result, probe ProbeConfig) {
+	switch r.Service {
+	case "smb", "netbios-ssn", "microsoft-ds":
+	case "":
+		if !smbPorts[r.Port] {
+			return
+		}
+	default:
+		return
+	}
+	info, err := probeSMB(r.Host, r.Port, probe, p.Timeout)
+	if err != nil {
+		return
+	}
+	r.SMB = info
+	if r.Service == "" {
+		r.Service = "smb"
+	}
+	if r.Product == "" && info.OSVersion != "" {
+		r.Product, r.Version = "Windows", info.OSVersion
+	}
+}
+
+// probeSMB negotiates with an SMB server and reads its NTLM challenge
+func probeSMB(host string, port int, probe ProbeConfig, wait time.Duration) (*SMBInfo, error) {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(4 * wait))
+
+	if port == 139 {
+		if err := netbiosSession(conn); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeSMB(conn, smbNegotiateRequest()); err != nil {
+		return nil, err
+	}
+	reply, err := readSMB(conn)
+	if err != nil {
+		return nil, err
+	}
+	info, err := parseSMBNegotiate(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	// The names are a bonus: servers that won't start NTLM still negotiated
+	if writeSMB(conn, smbSessionSetupRequest()) != nil {
+		return info, nil
+	}
+	if reply, err = readSMB(conn); err == nil {
+		parseNTLMChallenge(reply, info)
+	}
+	return info, nil
+}
+
+// netbiosSession asks for a NetBIOS session with the generic *SMBSERVER name,
+// which SMB servers on port 139 answer to
+func netbiosSession(conn net.Conn) error {
+	body := append(netbiosName("*SMBSERVER"), netbiosName("PSCANNER")...)
+	request := append([]byte{0x81, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x82 {
+		return fmt.Errorf("NetBIOS session refused (%#x)", reply[0])
+	}
+	if n := int(reply[2])<<8 | int(reply[3]); n > 0 {
+		io.CopyN(io.Discard, conn, int64(n))
+	}
+	return nil
+}
+
+// netbiosName encodes a name for a NetBIOS session request: padded to 15
+// characters plus the file server suffix, each byte split into two letters
+func netbiosName(name string) []byte {
+	padded := fmt.Sprintf("%-15s\x20", name)
+	encoded := []byte{32}
+	for i := 0; i < len(padded); i++ {
+		encoded = append(encoded, 'A'+padded[i]>>4, 'A'+padded[i]&0x0f)
+	}
+	return append(encoded, 0)
+}
+
+// writeSMB sends an SMB message with its 4-byte length prefix
+func writeSMB(w io.Writer, msg []byte) error {
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+	return err
+}
+
+// readSMB reads one length-prefixed SMB message
+func readSMB(r io.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header) & 0xffffff
+	if length > 65536 {
+		return nil, fmt.Errorf("SMB message of %d bytes", length)
+	}
+	msg := make([]byte, length)
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
+
+const (
+	smb2Negotiate    = 0
+	smb2SessionSetup = 1
+)
+
+// smb2Header is the 64-byte header of a request
+func smb2Header(command uint16, messageID uint64) []byte {
+	h := make([]byte, 64)
+	copy(h, "\xfeSMB")
+	binary.LittleEndian.PutUint16(h[4:], 64)
+	binary.LittleEndian.PutUint16(h[12:], command)
+	binary.LittleEndian.PutUint16(h[14:], 1) // credits requested
+	binary.LittleEndian.PutUint64(h[24:], messageID)
+	return h
+}
+
+// smbDialects are the SMB 2 and 3 dialects offered, oldest first
+var smbDialects = []uint16{0x0202, 0x0210, 0x0300, 0x0302, 0x0311}
+
+// smbNegotiateRequest offers every SMB 2 and 3 dialect. Offering 3.1.1 takes
+// a pre-authentication integrity context.
+func smbNegotiateRequest() []byte {
+	msg := smb2Header(smb2Negotiate, 0)
+	body := make([]byte, 36)
+	binary.LittleEndian.PutUint16(body[0:], 36)
+	binary.LittleEndian.PutUint16(body[2:], uint16(len(smbDialects)))
+	binary.LittleEndian.PutUint16(body[4:], 1) // signing enabled
+	copy(body[12:28], "pscanner-client!")
+	for _, d := range smbDialects {
+		body = binary.LittleEndian.AppendUint16(body, d)
+	}
+	for (64+len(body))%8 != 0 {
+		body = append(body, 0)
+	}
+	binary.LittleEndian.PutUint32(body[28:], uint32(64+len(body)))
+	binary.LittleEndian.PutUint16(body[32:], 1)
+
+	preauth := []byte{1, 0, 38, 0, 0, 0, 0, 0}   // type, data length, reserved
+	preauth = append(preauth, 1, 0, 32, 0, 1, 0) // one hash, a 32-byte salt, SHA-512
+	preauth = append(preauth, bytes.Repeat([]byte{0x5a}, 32)...)
+	return append(msg, append(body, preauth...)...)
+}
+
+// smbSessionSetupRequest starts an NTLM login with a negotiate message
+func smbSessionSetupRequest() []byte {
+	msg := smb2Header(smb2SessionSetup, 1)
+	ntlm := []byte("NTLMSSP\x00")
+	ntlm = binary.LittleEndian.AppendUint32(ntlm, 1)
+	// Unicode, request target, NTLM, always sign, extended session security,
+	// target info, version, 128-bit and 56-bit keys
+	ntlm = binary.LittleEndian.AppendUint32(ntlm, 0xa2888205)
+	ntlm = append(ntlm, make([]byte, 16)...)            // no domain or workstation
+	ntlm = append(ntlm, 10, 0, 0x61, 0x4a, 0, 0, 0, 15) // client version 10.0.19041, NTLM revision 15
+	body := make([]byte, 24)
+	binary.LittleEndian.PutUint16(body[0:], 25)
+	body[3] = 1 // signing enabled
+	binary.LittleEndian.PutUint16(body[12:], uint16(64+len(body)))
+	binary.LittleEndian.PutUint16(body[14:], uint16(len(ntlm)))
+	return append(msg, append(body, ntlm...)...)
+}
+
+// parseSMBNegotiate reads the dialect and signing requirement from a
+// negotiate response
+func parseSMBNegotiate(msg []byte) (*SMBInfo, error) {
+	if len(msg) < 64+8 || !bytes.HasPrefix(msg, []byte("\xfeSMB")) {
+		return nil, fmt.Errorf("not an SMB 2 response")
+	}
+	if status := binary.LittleEndian.Uint32(msg[8:]); status != 0 {
+		return nil, fmt.Errorf("negotiate failed with status %#x", status)
+	}
+	body := msg[64:]
+	securityMode := binary.LittleEndian.Uint16(body[2:])
+	return &SMBInfo{
+		Dialect:         smbDialectName(binary.LittleEndian.Uint16(body[4:])),
+		SigningRequired: securityMode&0x02 != 0,
+	}, nil
+}
+
+// smbDialectName formats a dialect revision such as 0x0311 as "3.1.1"
+func smbDialectName(d uint16) string {
+	major, minor, patch := d>>8, d>>4&0x0f, d&0x0f
+	if patch == 0 {
+		return fmt.Sprintf("%d.%d", major, minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", major, minor, patch)
+}
+
+// parseNTLMChallenge finds the NTLM challenge in a session setup response,
+// wrapped in SPNEGO or not, and fills in the names and version it carries
+func parseNTLMChallenge(msg []byte, info *SMBInfo) {
+	start := bytes.Index(msg, []byte("NTLMSSP\x00\x02\x00\x00\x00"))
+	if start < 0 {
+		return
+	}
+	challenge := msg[start:]
+	if len(challenge) < 56 {
+		return
+	}
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	if flags&0x02000000 != 0 {
+		build := binary.LittleEndian.Uint16(challenge[50:])
+		info.OSVersion = fmt.Sprintf("%d.%d.%d", challenge[48], challenge[49], build)
+	}
+	length := int(binary.LittleEndian.Uint16(challenge[40:]))
+	offset := int(binary.LittleEndian.Uint32(challenge[44:]))
+	if offset+length > len(challenge) {
+		return
+	}
+	for pairs := challenge[offset : offset+length]; len(pairs) >= 4; {
+		id, n := binary.LittleEndian.Uint16(pairs), int(binary.LittleEndian.Uint16(pairs[2:]))
+		if id == 0 || 4+n > len(pairs) {
+			break
+		}
+		value := utf16String(pairs[4 : 4+n])
+		switch id {
+		case 1:
+			info.Computer = value
+		case 2:
+			info.Domain = value
+		case 3:
+			info.DNSComputer = value
+		case 4:
+			info.DNSDomain = value
+		}
+		pairs = pairs[4+n:]
+	}
+}
+
+// utf16String decodes little-endian UTF-16
+func utf16String(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return strings.TrimSpace(string(utf16.Decode(units)))
+}
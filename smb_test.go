@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestNetbiosName(t *testing.T) {
+	want := "\x20CKFDENECFDEFFCFGEFFCCACACACACACA\x00"
+	if got := string(netbiosName("*SMBSERVER")); got != want {
+		t.Errorf("netbiosName() = %q, expected %q", got, want)
+	}
+}
+
+func TestSMBDialectName(t *testing.T) {
+	for d, want := range map[uint16]string{0x0202: "2.0.2", 0x0210: "2.1", 0x0300: "3.0", 0x0302: "3.0.2", 0x0311: "3.1.1"} {
+		if got := smbDialectName(d); got != want {
+			t.Errorf("smbDialectName(%#x) = %q, expected %q", d, got, want)
+		}
+	}
+}
+
+// smbResponse builds an SMB 2 response to a command with a status
+func smbResponse(command uint16, status uint32, body []byte) []byte {
+	h := smb2Header(command, 0)
+	binary.LittleEndian.PutUint32(h[8:], status)
+	return append(h, body...)
+}
+
+// smbNegotiateResponse selects a dialect with a security mode
+func smbNegotiateResponse(dialect, securityMode uint16) []byte {
+	body := make([]byte, 65)
+	binary.LittleEndian.PutUint16(body[0:], 65)
+	binary.LittleEndian.PutUint16(body[2:], securityMode)
+	binary.LittleEndian.PutUint16(body[4:], dialect)
+	return smbResponse(smb2Negotiate, 0, body)
+}
+
+// ntlmChallenge builds a challenge message naming a server, as Windows
+// Server 2022 sends it
+func ntlmChallenge(names map[uint16]string) []byte {
+	var info []byte
+	for _, id := range []uint16{2, 1, 4, 3} {
+		value := utf16.Encode([]rune(names[id]))
+		info = binary.LittleEndian.AppendUint16(info, id)
+		info = binary.LittleEndian.AppendUint16(info, uint16(2*len(value)))
+		for _, u := range value {
+			info = binary.LittleEndian.AppendUint16(info, u)
+		}
+	}
+	info = append(info, 0, 0, 0, 0)
+
+	msg := []byte("NTLMSSP\x00\x02\x00\x00\x00")
+	msg = append(msg, 0, 0, 0, 0, 56, 0, 0, 0) // empty target name
+	msg = binary.LittleEndian.AppendUint32(msg, 0xa2898205)
+	msg = append(msg, make([]byte, 16)...) // challenge and reserved
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(info)))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(len(info)))
+	msg = binary.LittleEndian.AppendUint32(msg, 56)
+	msg = append(msg, 10, 0, 0x7c, 0x4f, 0, 0, 0, 15) // 10.0.20348
+	return append(msg, info...)
+}
+
+func TestParseNTLMChallenge(t *testing.T) {
+	names := map[uint16]string{1: "FS01", 2: "CORP", 3: "fs01.corp.example.com", 4: "corp.example.com"}
+	// Windows wraps the challenge in an SPNEGO token
+	msg := append([]byte{0xa1, 0x81, 0xc0, 0x30, 0x81, 0xbd}, ntlmChallenge(names)...)
+	var info SMBInfo
+	parseNTLMChallenge(msg, &info)
+	want := SMBInfo{Computer: "FS01", Domain: "CORP", DNSComputer: "fs01.corp.example.com", DNSDomain: "corp.example.com", OSVersion: "10.0.20348"}
+	if info != want {
+		t.Errorf("parseNTLMChallenge() = %+v, expected %+v", info, want)
+	}
+}
+
+func TestSMBProber(t *testing.T) {
+	names := map[uint16]string{1: "FS01", 2: "CORP", 3: "fs01.corp.example.com", 4: "corp.example.com"}
+	server := func(securityMode uint16) func(net.Conn) {
+		return func(conn net.Conn) {
+			negotiate, err := readSMB(conn)
+			if err != nil || !bytes.Equal(negotiate[:4], []byte("\xfeSMB")) || binary.LittleEndian.Uint16(negotiate[66:]) != uint16(len(smbDialects)) {
+				return
+			}
+			writeSMB(conn, smbNegotiateResponse(0x0311, securityMode))
+			setup, err := readSMB(conn)
+			if err != nil || !bytes.Contains(setup, []byte("NTLMSSP\x00\x01\x00\x00\x00")) {
+				return
+			}
+			body := []byte{9, 0, 0, 0, 72, 0, 0, 0}
+			challenge := ntlmChallenge(names)
+			binary.LittleEndian.PutUint16(body[6:], uint16(len(challenge)))
+			writeSMB(conn, smbResponse(smb2SessionSetup, 0xc0000016, append(body, challenge...)))
+		}
+	}
+	prober := SMBProber{Timeout: time.Second}
+
+	t.Run("Signing required", func(t *testing.T) {
+		r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: serveOnce(t, server(0x03)), Service: "smb"}
+		prober.Enrich(&r, ProbeConfig{})
+		want := SMBInfo{Dialect: "3.1.1", SigningRequired: true, Computer: "FS01", Domain: "CORP",
+			DNSComputer: "fs01.corp.example.com", DNSDomain: "corp.example.com", OSVersion: "10.0.20348"}
+		if r.SMB == nil || *r.SMB != want || r.Product != "Windows" || r.Version != "10.0.20348" {
+			t.Errorf("Enrich() smb = %+v, product %q %q, expected %+v", r.SMB, r.Product, r.Version, want)
+		}
+	})
+
+	t.Run("Signing not required", func(t *testing.T) {
+		r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: serveOnce(t, server(0x01)), Service: "smb"}
+		prober.Enrich(&r, ProbeConfig{})
+		if r.SMB == nil || r.SMB.SigningRequired || len(serviceFindings(r)) != 1 {
+			t.Errorf("Enrich() smb = %+v, expected signing not required and flagged", r.SMB)
+		}
+	})
+
+	t.Run("Not SMB", func(t *testing.T) {
+		r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: serveOnce(t, func(conn net.Conn) {
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+		}), Service: "smb"}
+		prober.Enrich(&r, ProbeConfig{})
+		if r.SMB != nil {
+			t.Errorf("Enrich() smb = %+v, expected nothing", r.SMB)
+		}
+	})
+}
+
+func TestNetbiosSession(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		defer server.Close()
+		request := make([]byte, 4+68)
+		server.Read(request)
+		if request[0] == 0x81 && bytes.Contains(request, netbiosName("*SMBSERVER")) {
+			server.Write([]byte{0x82, 0, 0, 0})
+		} else {
+			server.Write([]byte{0x83, 0, 0, 1, 0x80})
+		}
+	}()
+	if err := netbiosSession(client); err != nil {
+		t.Errorf("netbiosSession() = %v, expected a session", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SMTPInfo is what a mail server offered in answer to EHLO
+type SMTPInfo struct {
+	EHLO     string   `json:"ehlo"`               // first line of the EHLO reply, usually the server's name
+	StartTLS bool     `json:"starttls"`           // offers to upgrade to TLS
+	Auth     []string `json:"auth,omitempty"`     // SASL mechanisms offered
+	Relay    *bool    `json:"relay,omitempty"`    // accepted a recipient outside its domains, with -enrich smtp-relay
+	Features []string `json:"features,omitempty"` // the other extensions offered, e.g. "SIZE 10240000"
+}
+
+// smtpPorts are the ports checked by SMTPChecker when the service of a port
+// isn't known. 465 is left out: it speaks TLS from the start.
+var smtpPorts = map[int]bool{25: true, 587: true, 2525: true}
+
+// smtpProducts matches the mail servers that name themselves in their
+// greeting, with the version that sometimes follows
+var smtpProducts = regexp.MustCompile(`(?i)\b(Postfix|Exim|Sendmail|Microsoft ESMTP MAIL Service|OpenSMTPD|Haraka|qmail|MDaemon|Zimbra|hMailServer)(?:[ /]+(?:version )?([0-9][0-9A-Za-z.\-]*))?`)
+
+// smtpProduct picks the server software and version out of an SMTP greeting
+func smtpProduct(banner string) (product, version string) {
+	m := smtpProducts.FindStringSubmatch(banner)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], m[2]
+}
+
+// SMTPChecker is an enricher that greets mail servers with EHLO and records
+// what they offer. With Relay set it also asks to send mail between two
+// outside domains, without sending any.
+type SMTPChecker struct {
+	Timeout time.Duration
+	Relay   bool
+}
+
+// Enrich records the EHLO reply of a mail server
+func (c SMTPChecker) Enrich(r *Result, probe ProbeConfig) {
+	if r.Service != "smtp" && r.Service != "submission" && (r.Service != "" || !smtpPorts[r.Port]) {
+		return
+	}
+	banner, info, err := smtpHello(r.Host, r.Port, probe, c.Timeout, c.Relay)
+	if err != nil {
+		return
+	}
+	r.SMTP = info
+	if r.Service == "" {
+		r.Service = "smtp"
+	}
+	if r.Banner == "" {
+		r.Banner = banner
+	}
+	if r.Product == "" {
+		r.Product, r.Version = smtpProduct(banner)
+	}
+}
+
+// smtpHello connects to a mail server, sends EHLO and, with relay, tries a
+// sender and a recipient on domains reserved for examples. The transaction is
+// reset before any DATA, so no message is ever sent.
+func smtpHello(host string, port int, probe ProbeConfig, wait time.Duration, relay bool) (banner string, info *SMTPInfo, err error) {
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(6 * wait))
+	text := textproto.NewConn(conn)
+
+	code, greeting, err := text.ReadResponse(0)
+	if err != nil || code != 220 {
+		return "", nil, fmt.Errorf("not an SMTP greeting: %d %q: %v", code, greeting, err)
+	}
+	banner = fmt.Sprintf("%d %s", code, greeting)
+	code, reply, err := smtpCommand(text, "EHLO pscanner.invalid")
+	if err != nil || code != 250 {
+		return "", nil, fmt.Errorf("no EHLO reply: %d %q: %v", code, reply, err)
+	}
+	info = parseEHLO(reply)
+
+	if relay {
+		accepted := false
+		if code, _, err := smtpCommand(text, "MAIL FROM:<pscanner@example.com>"); err == nil && code == 250 {
+			code, _, err = smtpCommand(text, "RCPT TO:<pscanner@example.net>")
+			accepted = err == nil && (code == 250 || code == 251)
+		}
+		info.Relay = &accepted
+		smtpCommand(text, "RSET")
+	}
+	text.PrintfLine("QUIT")
+	return banner, info, nil
+}
+
+// smtpCommand sends a command and returns the code and text of the reply
+func smtpCommand(text *textproto.Conn, command string) (int, string, error) {
+	if err := text.PrintfLine("%s", command); err != nil {
+		return 0, "", err
+	}
+	code, reply, err := text.ReadResponse(0)
+	if _, ok := err.(*textproto.Error); ok {
+		err = nil // an unexpected code is still an answer
+	}
+	return code, reply, err
+}
+
+// parseEHLO splits the lines of an EHLO reply into the server's greeting
+// and the extensions it offers
+func parseEHLO(reply string) *SMTPInfo {
+	lines := strings.Split(reply, "\n")
+	info := &SMTPInfo{EHLO: strings.TrimSpace(lines[0])}
+	for _, line := range lines[1:] {
+		keyword, params, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(keyword) {
+		case "":
+		case "STARTTLS":
+			info.StartTLS = true
+		case "AUTH":
+			info.Auth = strings.Fields(params)
+		default:
+			info.Features = append(info.Features, strings.TrimSpace(line))
+		}
+	}
+	return info
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEHLO(t *testing.T) {
+	reply := "mail.example.com Hello [10.0.0.1]\nPIPELINING\nSIZE 10240000\nSTARTTLS\nAUTH PLAIN LOGIN\n8BITMIME"
+	want := &SMTPInfo{
+		EHLO:     "mail.example.com Hello [10.0.0.1]",
+		StartTLS: true,
+		Auth:     []string{"PLAIN", "LOGIN"},
+		Features: []string{"PIPELINING", "SIZE 10240000", "8BITMIME"},
+	}
+	if got := parseEHLO(reply); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseEHLO() = %+v, expected %+v", got, want)
+	}
+}
+
+func TestSMTPProduct(t *testing.T) {
+	tests := []struct {
+		banner, product, version string
+	}{
+		{"220 mail.example.com ESMTP Postfix (Ubuntu)", "Postfix", ""},
+		{"220 mx.example.com ESMTP Exim 4.96 Mon, 01 Jan 2024 10:00:00 +0000", "Exim", "4.96"},
+		{"220 host ESMTP Sendmail 8.15.2/8.15.2; Mon, 1 Jan 2024", "Sendmail", "8.15.2"},
+		{"220 EXCH01 Microsoft ESMTP MAIL Service ready", "Microsoft ESMTP MAIL Service", ""},
+		{"220 mail ready", "", ""},
+	}
+
+	for _, tt := range tests {
+		if product, version := smtpProduct(tt.banner); product != tt.product || version != tt.version {
+			t.Errorf("smtpProduct(%q) = %q, %q, expected %q, %q", tt.banner, product, version, tt.product, tt.version)
+		}
+	}
+}
+
+func TestSMTPChecker(t *testing.T) {
+	yes, no := true, false
+	ehlo := "250-mail.example.com\r\n250-STARTTLS\r\n250 SIZE 1000"
+	tests := []struct {
+		name     string
+		greeting string
+		replies  map[string]string
+		relay    bool
+		want     *SMTPInfo
+	}{
+		{
+			name:     "EHLO only",
+			greeting: "220 mail.example.com ESMTP Exim 4.96",
+			replies:  map[string]string{"EHLO": ehlo},
+			want:     &SMTPInfo{EHLO: "mail.example.com", StartTLS: true, Features: []string{"SIZE 1000"}},
+		},
+		{
+			name:     "Open relay",
+			greeting: "220 mail.example.com ESMTP Exim 4.96",
+			replies:  map[string]string{"EHLO": ehlo, "MAIL": "250 OK", "RCPT": "250 Accepted", "RSET": "250 Reset OK"},
+			relay:    true,
+			want:     &SMTPInfo{EHLO: "mail.example.com", StartTLS: true, Features: []string{"SIZE 1000"}, Relay: &yes},
+		},
+		{
+			name:     "Relay refused",
+			greeting: "220 mail.example.com ESMTP Exim 4.96",
+			replies:  map[string]string{"EHLO": ehlo, "MAIL": "250 OK", "RCPT": "550 relay not permitted", "RSET": "250 Reset OK"},
+			relay:    true,
+			want:     &SMTPInfo{EHLO: "mail.example.com", StartTLS: true, Features: []string{"SIZE 1000"}, Relay: &no},
+		},
+		{
+			name:     "Not SMTP",
+			greeting: "220 (vsFTPd 3.0.3)",
+			replies:  map[string]string{"EHLO": "500 Unknown command."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, commands := scriptedServer(t, tt.greeting, tt.replies)
+			r := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: port, Service: "smtp"}
+			SMTPChecker{Timeout: time.Second, Relay: tt.relay}.Enrich(&r, ProbeConfig{})
+			if !reflect.DeepEqual(r.SMTP, tt.want) {
+				t.Fatalf("Enrich() smtp = %+v, expected %+v", r.SMTP, tt.want)
+			}
+			if tt.want != nil && r.Product != "Exim" {
+				t.Errorf("Enrich() product = %q, expected Exim", r.Product)
+			}
+			for len(commands) > 0 {
+				if c := <-commands; strings.HasPrefix(c, "DATA") {
+					t.Errorf("sent %q, expected no message to be sent", c)
+				}
+			}
+		})
+	}
+}
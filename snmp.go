@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SNMPInfo is what an SNMP agent answered
+type SNMPInfo struct {
+	Community string `json:"community"`           // the community string it accepted
+	SysDescr  string `json:"sys_descr,omitempty"` // its system description, usually the device and firmware
+}
+
+// snmpCommunities is the -snmp-community flag
+var snmpCommunities = "public"
+
+// sysDescrOID is 1.3.6.1.2.1.1.1.0, the system description, BER encoded
+var sysDescrOID = []byte{0x2b, 6, 1, 2, 1, 1, 1, 0}
+
+// snmpRequests is an SNMPv1 GET of sysDescr for each -snmp-community
+func snmpRequests() [][]byte {
+	var requests [][]byte
+	for _, community := range strings.Split(snmpCommunities, ",") {
+		if community = strings.TrimSpace(community); community != "" {
+			requests = append(requests, snmpGetRequest(community, sysDescrOID))
+		}
+	}
+	return requests
+}
+
+// snmpGetRequest encodes an SNMPv1 GET of one object
+func snmpGetRequest(community string, oid []byte) []byte {
+	varbind := berTLV(0x30, berTLV(0x06, oid), berTLV(0x05))
+	pdu := berTLV(0xa0,
+		berTLV(0x02, []byte{0x70, 0x73}), // request ID
+		berTLV(0x02, []byte{0}),          // error status
+		berTLV(0x02, []byte{0}),          // error index
+		berTLV(0x30, varbind))
+	return berTLV(0x30, berTLV(0x02, []byte{0}), berTLV(0x04, []byte(community)), pdu)
+}
+
+// berTLV encodes a BER tag, length and content
+func berTLV(tag byte, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	out := []byte{tag}
+	switch n := len(body); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, body...)
+}
+
+// berRead splits the first BER element off data
+func berRead(data []byte) (tag byte, content, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, fmt.Errorf("truncated BER element")
+	}
+	tag, length, data := data[0], int(data[1]), data[2:]
+	if length&0x80 != 0 {
+		octets := length & 0x7f
+		if octets == 0 || octets > 2 || len(data) < octets {
+			return 0, nil, nil, fmt.Errorf("unsupported BER length")
+		}
+		length = 0
+		for _, b := range data[:octets] {
+			length = length<<8 | int(b)
+		}
+		data = data[octets:]
+	}
+	if length > len(data) {
+		return 0, nil, nil, fmt.Errorf("truncated BER element")
+	}
+	return tag, data[:length], data[length:], nil
+}
+
+// parseSNMPReply reads the response to a GET of sysDescr. An agent that
+// answers knows the community, even when it has no system description.
+func parseSNMPReply(r *Result, request, reply []byte) bool {
+	info, err := parseSNMPResponse(reply)
+	if err != nil {
+		return false
+	}
+	r.SNMP, r.Service = info, "snmp"
+	return true
+}
+
+// parseSNMPResponse decodes an SNMP GetResponse carrying one value
+func parseSNMPResponse(reply []byte) (*SNMPInfo, error) {
+	tag, message, _, err := berRead(reply)
+	if err != nil || tag != 0x30 {
+		return nil, fmt.Errorf("not an SNMP message")
+	}
+	var fields [3][]byte
+	var tags [3]byte
+	for i := range fields {
+		if tags[i], fields[i], message, err = berRead(message); err != nil {
+			return nil, err
+		}
+	}
+	if tags[0] != 0x02 || tags[1] != 0x04 || tags[2] != 0xa2 {
+		return nil, fmt.Errorf("not an SNMP response")
+	}
+	info := &SNMPInfo{Community: printable(fields[1])}
+
+	// Request ID, error status and index, then the variable bindings
+	pdu := fields[2]
+	var status []byte
+	for i := 0; i < 3; i++ {
+		var content []byte
+		if _, content, pdu, err = berRead(pdu); err != nil {
+			return nil, err
+		}
+		if i == 1 {
+			status = content
+		}
+	}
+	if len(status) != 1 || status[0] != 0 {
+		return info, nil // noSuchName and the like: still an agent that took the community
+	}
+	_, bindings, _, err := berRead(pdu)
+	if err != nil {
+		return info, nil
+	}
+	if _, binding, _, err := berRead(bindings); err == nil {
+		if _, _, value, err := berRead(binding); err == nil {
+			if tag, content, _, err := berRead(value); err == nil && tag == 0x04 {
+				info.SysDescr = strings.Join(strings.Fields(printable(content)), " ")
+			}
+		}
+	}
+	return info, nil
+}
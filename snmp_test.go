@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// snmpResponse encodes the GetResponse of an agent to a GET of sysDescr
+func snmpResponse(community string, status byte, descr string) []byte {
+	varbind := berTLV(0x30, berTLV(0x06, sysDescrOID), berTLV(0x04, []byte(descr)))
+	pdu := berTLV(0xa2, berTLV(0x02, []byte{0x70, 0x73}), berTLV(0x02, []byte{status}), berTLV(0x02, []byte{0}), berTLV(0x30, varbind))
+	return berTLV(0x30, berTLV(0x02, []byte{0}), berTLV(0x04, []byte(community)), pdu)
+}
+
+func TestSNMPGetRequest(t *testing.T) {
+	// As sent by snmpget -v1 -c public host 1.3.6.1.2.1.1.1.0, request ID aside
+	want := []byte{
+		0x30, 0x27, 0x02, 0x01, 0x00, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1a, 0x02, 0x02, 0x70, 0x73, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	}
+	if got := snmpGetRequest("public", sysDescrOID); !bytes.Equal(got, want) {
+		t.Errorf("snmpGetRequest() = % x, expected % x", got, want)
+	}
+}
+
+func TestBerTLVLongForm(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 300)
+	tag, content, rest, err := berRead(append(berTLV(0x04, long), 0xff))
+	if err != nil || tag != 0x04 || !bytes.Equal(content, long) || !bytes.Equal(rest, []byte{0xff}) {
+		t.Errorf("berRead(berTLV()) = %#x, %d bytes, %v, %v", tag, len(content), rest, err)
+	}
+}
+
+func TestParseSNMPResponse(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		want  *SNMPInfo
+	}{
+		{
+			name:  "System description",
+			reply: snmpResponse("public", 0, "Cisco IOS Software, C2960 Software\r\n  Version 15.0(2)SE"),
+			want:  &SNMPInfo{Community: "public", SysDescr: "Cisco IOS Software, C2960 Software Version 15.0(2)SE"},
+		},
+		{
+			name:  "No such name",
+			reply: snmpResponse("private", 2, ""),
+			want:  &SNMPInfo{Community: "private"},
+		},
+		{name: "Request", reply: snmpGetRequest("public", sysDescrOID)},
+		{name: "DNS", reply: []byte{0x12, 0x34, 0x81, 0x80, 0, 1, 0, 0}},
+		{name: "Truncated", reply: snmpResponse("public", 0, "x")[:20]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSNMPResponse(tt.reply)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("parseSNMPResponse() = %+v, expected an error", got)
+				}
+				return
+			}
+			if err != nil || *got != *tt.want {
+				t.Errorf("parseSNMPResponse() = %+v, %v, expected %+v", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// SourceAddr is where probes are sent from. The zero value leaves the choice
+// of address and interface to the routing table.
+type SourceAddr struct {
+	IPs       []net.IP // local addresses probes are bound to, taken in turn
+	Interface string   // network interface probes are sent out of
+
+	addrs []net.IP       // addresses of Interface, for platforms that can't bind to it
+	next  *atomic.Uint64 // rotates through IPs when there are several
+}
+
+// sourceIP and sourceIface are the -source-ip and -iface flags
+var sourceIP, sourceIface string
+
+// ParseSource checks the comma-separated addresses of -source-ip and -iface
+// against the interfaces of this machine, so that a typo fails the scan
+// instead of every probe
+func ParseSource(ips, iface string) (SourceAddr, error) {
+	var s SourceAddr
+	if ips != "" {
+		for _, spec := range strings.Split(ips, ",") {
+			spec = strings.TrimSpace(spec)
+			ip := net.ParseIP(spec)
+			if ip == nil {
+				return SourceAddr{}, fmt.Errorf("-source-ip %q is not an IP address", spec)
+			}
+			s.IPs = append(s.IPs, ip)
+		}
+		if len(s.IPs) > 1 {
+			s.next = new(atomic.Uint64)
+		}
+	}
+
+	var local []net.Addr
+	var err error
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			return SourceAddr{}, fmt.Errorf("-iface %s: no such interface (have %s)", iface, interfaceNames())
+		}
+		if ifi.Flags&net.FlagUp == 0 {
+			return SourceAddr{}, fmt.Errorf("-iface %s is down", iface)
+		}
+		if err := checkBindToDevice(iface); err != nil {
+			return SourceAddr{}, err
+		}
+		s.Interface = iface
+		if local, err = ifi.Addrs(); err != nil {
+			return SourceAddr{}, fmt.Errorf("-iface %s: %v", iface, err)
+		}
+		for _, a := range local {
+			if n, ok := a.(*net.IPNet); ok {
+				s.addrs = append(s.addrs, n.IP)
+			}
+		}
+	} else if len(s.IPs) > 0 {
+		if local, err = net.InterfaceAddrs(); err != nil {
+			return SourceAddr{}, err
+		}
+	}
+
+	for _, ip := range s.IPs {
+		if slices.ContainsFunc(local, func(a net.Addr) bool {
+			// Linux answers on the whole loopback network, not just 127.0.0.1
+			n, ok := a.(*net.IPNet)
+			return ok && (n.IP.Equal(ip) || n.IP.IsLoopback() && n.Contains(ip))
+		}) {
+			continue
+		}
+		if iface != "" {
+			return SourceAddr{}, fmt.Errorf("-source-ip %s is not an address of %s", ip, iface)
+		}
+		return SourceAddr{}, fmt.Errorf("-source-ip %s is not an address of this machine", ip)
+	}
+	return s, nil
+}
+
+// interfaceNames lists the interfaces of this machine for error messages
+func interfaceNames() string {
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		return "none"
+	}
+	names := make([]string, len(ifaces))
+	for i, ifi := range ifaces {
+		names[i] = ifi.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Rotating reports whether probes take turns between several addresses
+func (s SourceAddr) Rotating() bool {
+	return len(s.IPs) > 1
+}
+
+// Next returns the source to probe host from on network, with a single
+// address: the next in turn of those in the host's family, so that
+// consecutive probes spread across all of them
+func (s SourceAddr) Next(host, network string) SourceAddr {
+	if !s.Rotating() {
+		return s
+	}
+	candidates := familyOf(s.IPs, host, network)
+	if len(candidates) == 0 {
+		candidates = s.IPs
+	}
+	n := s.next.Add(1) - 1
+	s.IPs = []net.IP{candidates[n%uint64(len(candidates))]}
+	s.next = nil
+	return s
+}
+
+// Dialer returns a dialer for connections to host on network sent from the
+// source address, the next in turn when there are several. Where the
+// platform can't bind a socket to an interface, an address of the interface
+// in the host's family is used instead.
+func (s SourceAddr) Dialer(host, network string, timeout time.Duration) *net.Dialer {
+	s = s.Next(host, network)
+	d := &net.Dialer{Timeout: timeout}
+	var ip net.IP
+	if len(s.IPs) > 0 {
+		ip = s.IPs[0]
+	} else if s.Interface != "" && !canBindToDevice {
+		if found := familyOf(s.addrs, host, network); len(found) > 0 {
+			ip = found[0]
+		}
+	}
+	if ip != nil {
+		d.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if s.Interface != "" && canBindToDevice {
+		d.Control = bindToDevice(s.Interface)
+	}
+	return d
+}
+
+// familyOf returns the addresses that can reach host: those of its family
+// for an IP address, IPv4 ones for names unless network is "tcp6".
+// Link-local addresses are used for link-local targets only.
+func familyOf(addrs []net.IP, host, network string) []net.IP {
+	want4, linkLocal := network != "tcp6", false
+	if ip := parseHostIP(host); ip != nil {
+		want4, linkLocal = ip.To4() != nil, ip.IsLinkLocalUnicast()
+	}
+	var found []net.IP
+	for _, a := range addrs {
+		if (a.To4() != nil) == want4 && a.IsLinkLocalUnicast() == linkLocal {
+			found = append(found, a)
+		}
+	}
+	return found
+}
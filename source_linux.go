@@ -0,0 +1,45 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+)
+
+// canBindToDevice is set where sockets can be tied to an interface with
+// SO_BINDTODEVICE
+const canBindToDevice = true
+
+// bindToDevice returns a dialer Control function that sends the connection
+// out of iface whatever the routing table says
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+}
+
+// checkBindToDevice tries SO_BINDTODEVICE on a throwaway socket, since
+// kernels before 5.7 allow it only with CAP_NET_RAW
+func checkBindToDevice(iface string) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+	err = syscall.SetsockoptString(fd, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+	if errors.Is(err, syscall.EPERM) {
+		return fmt.Errorf("-iface needs root or CAP_NET_RAW on this kernel; -source-ip with an address of %s works without", iface)
+	}
+	if err != nil {
+		return fmt.Errorf("-iface %s: %v", iface, err)
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import "syscall"
+
+// canBindToDevice is false: probes leave through the interface's address
+// instead, which the routing table usually sends out of that interface
+const canBindToDevice = false
+
+// bindToDevice is not used on this platform
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// checkBindToDevice has nothing to check on this platform
+func checkBindToDevice(iface string) error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseSource(t *testing.T) {
+	loopback := "lo"
+	if runtime.GOOS != "linux" {
+		loopback = "lo0"
+	}
+	tests := []struct {
+		name    string
+		ip      string
+		iface   string
+		wantErr bool
+	}{
+		{name: "Neither"},
+		{name: "Local address", ip: "127.0.0.1"},
+		{name: "Interface", iface: loopback},
+		{name: "Address of the interface", ip: "127.0.0.1", iface: loopback},
+		{name: "Not an address", ip: "eth0", wantErr: true},
+		{name: "Several", ip: "127.0.0.1, ::1"},
+		{name: "Not a local address", ip: "192.0.2.77", wantErr: true},
+		{name: "One of several not local", ip: "127.0.0.1,192.0.2.77", wantErr: true},
+		{name: "No such interface", iface: "nosuch0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseSource(tt.ip, tt.iface)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSource(%q, %q) error = %v, wantErr %v", tt.ip, tt.iface, err, tt.wantErr)
+			}
+			if err == nil && s.Interface != tt.iface {
+				t.Errorf("ParseSource() interface = %q, expected %q", s.Interface, tt.iface)
+			}
+		})
+	}
+}
+
+func TestSourceAddrDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	s, err := ParseSource("127.0.0.1", "")
+	if err != nil {
+		t.Fatalf("ParseSource() error = %v", err)
+	}
+	conn, err := s.Dialer("127.0.0.1", "tcp", time.Second).Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if local := conn.LocalAddr().(*net.TCPAddr); !local.IP.Equal(s.IPs[0]) {
+		t.Errorf("connection sent from %v, expected %v", local.IP, s.IPs[0])
+	}
+
+	if d := (SourceAddr{}).Dialer("127.0.0.1", "tcp", time.Second); d.LocalAddr != nil || d.Control != nil {
+		t.Errorf("zero SourceAddr dialer = %+v, expected the system's choice", d)
+	}
+}
+
+func TestFamilyOf(t *testing.T) {
+	addrs := []net.IP{net.ParseIP("fe80::1"), net.ParseIP("2001:db8::1"), net.ParseIP("10.0.0.1")}
+	tests := []struct {
+		host     string
+		network  string
+		expected net.IP
+	}{
+		{"192.168.1.1", "tcp", net.ParseIP("10.0.0.1")},
+		{"2001:db8::2", "tcp", net.ParseIP("2001:db8::1")},
+		{"example.com", "tcp", net.ParseIP("10.0.0.1")},
+		{"example.com", "tcp6", net.ParseIP("2001:db8::1")},
+		{"192.168.1.1", "tcp6", net.ParseIP("10.0.0.1")},
+	}
+	for _, tt := range tests {
+		if got := familyOf(addrs, tt.host, tt.network); len(got) != 1 || !got[0].Equal(tt.expected) {
+			t.Errorf("familyOf(%q, %s) = %v, expected %v", tt.host, tt.network, got, tt.expected)
+		}
+	}
+}
+
+func TestSourceAddrNext(t *testing.T) {
+	s, err := ParseSource("127.0.0.1,127.0.0.2,::1", "")
+	if err != nil {
+		t.Skipf("ParseSource() error = %v", err)
+	}
+	var got []string
+	for range 4 {
+		got = append(got, s.Next("127.0.0.1", "tcp").IPs[0].String())
+	}
+	if expected := []string{"127.0.0.1", "127.0.0.2", "127.0.0.1", "127.0.0.2"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Next() for IPv4 = %v, expected %v", got, expected)
+	}
+	if ip := s.Next("::1", "tcp").IPs[0]; !ip.Equal(net.IPv6loopback) {
+		t.Errorf("Next() for IPv6 = %v, expected ::1", ip)
+	}
+	if single := (SourceAddr{IPs: []net.IP{net.ParseIP("127.0.0.1")}}); single.Rotating() || !single.Next("127.0.0.1", "tcp").IPs[0].Equal(single.IPs[0]) {
+		t.Error("a single source address should be used for every probe")
+	}
+}
+
+func TestRunScanRotatesSources(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln2, err := net.Listen("tcp", "127.0.0.2:"+strconv.Itoa(port))
+	if err != nil {
+		t.Skipf("127.0.0.2 not usable: %v", err)
+	}
+	defer ln2.Close()
+
+	source, err := ParseSource("127.0.0.1,127.0.0.2", "")
+	if err != nil {
+		t.Skipf("ParseSource() error = %v", err)
+	}
+	probe := quickProbe
+	probe.Source = source
+	var sources []string
+	RunScan(context.Background(), []string{"127.0.0.1", "127.0.0.2"}, []int{port},
+		ScanOptions{Workers: 1, Probe: probe}, &Stats{startTime: time.Now()}, func(r Result) {
+			sources = append(sources, r.Source)
+		})
+	if expected := []string{"127.0.0.1", "127.0.0.2"}; !reflect.DeepEqual(sources, expected) {
+		t.Errorf("results came from %v, expected %v", sources, expected)
+	}
+}
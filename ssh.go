@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SSHInfo is what an SSH server says about itself in its identification
+// string, "SSH-protoversion-softwareversion comments" (RFC 4253 section 4.2)
+type SSHInfo struct {
+	Protocol string `json:"protocol"`           // e.g. "2.0", or "1.99" for a server still speaking SSH 1
+	Software string `json:"software"`           // e.g. "OpenSSH_8.9p1"
+	Comments string `json:"comments,omitempty"` // e.g. "Ubuntu-3ubuntu0.1"
+}
+
+// parseSSHBanner finds the identification string in what an SSH server sent
+// first. Servers may send other lines before it. ok is false when there is
+// none.
+func parseSSHBanner(banner string) (info SSHInfo, ok bool) {
+	for _, line := range strings.Split(banner, "\n") {
+		rest, found := strings.CutPrefix(strings.TrimSpace(line), "SSH-")
+		if !found {
+			continue
+		}
+		protocol, software, found := strings.Cut(rest, "-")
+		if !found || protocol == "" || software == "" {
+			return SSHInfo{}, false
+		}
+		info = SSHInfo{Protocol: protocol, Software: software}
+		if software, comments, found := strings.Cut(software, " "); found {
+			info.Software, info.Comments = software, strings.TrimSpace(comments)
+		}
+		return info, true
+	}
+	return SSHInfo{}, false
+}
+
+// splitProduct splits a software string such as "OpenSSH_8.9p1" or
+// "dropbear_2022.83" into its product name and version, at the first "_" or
+// "-" followed by a digit. version is empty when there is no such split.
+func splitProduct(software string) (product, version string) {
+	for i := 0; i+1 < len(software); i++ {
+		if (software[i] == '_' || software[i] == '-') && unicode.IsDigit(rune(software[i+1])) {
+			return software[:i], software[i+1:]
+		}
+	}
+	return software, ""
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseSSHBanner(t *testing.T) {
+	tests := []struct {
+		banner string
+		want   SSHInfo
+		ok     bool
+	}{
+		{"SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.1", SSHInfo{Protocol: "2.0", Software: "OpenSSH_8.9p1", Comments: "Ubuntu-3ubuntu0.1"}, true},
+		{"SSH-2.0-dropbear_2022.83", SSHInfo{Protocol: "2.0", Software: "dropbear_2022.83"}, true},
+		{"SSH-1.99-Cisco-1.25", SSHInfo{Protocol: "1.99", Software: "Cisco-1.25"}, true},
+		{"Welcome to the jump host\r\nSSH-2.0-OpenSSH_9.6", SSHInfo{Protocol: "2.0", Software: "OpenSSH_9.6"}, true},
+		{"SSH-2.0-", SSHInfo{}, false},
+		{"HTTP/1.0 200 OK", SSHInfo{}, false},
+		{"", SSHInfo{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseSSHBanner(tt.banner)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseSSHBanner(%q) = %+v, %v, expected %+v, %v", tt.banner, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSplitProduct(t *testing.T) {
+	tests := []struct {
+		software, product, version string
+	}{
+		{"OpenSSH_8.9p1", "OpenSSH", "8.9p1"},
+		{"dropbear_2022.83", "dropbear", "2022.83"},
+		{"Cisco-1.25", "Cisco", "1.25"},
+		{"libssh-0.9.6", "libssh", "0.9.6"},
+		{"RomSShell_5.40", "RomSShell", "5.40"},
+		{"Go", "Go", ""},
+		{"paramiko_", "paramiko_", ""},
+	}
+
+	for _, tt := range tests {
+		if product, version := splitProduct(tt.software); product != tt.product || version != tt.version {
+			t.Errorf("splitProduct(%q) = %q, %q, expected %q, %q", tt.software, product, version, tt.product, tt.version)
+		}
+	}
+}
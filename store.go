@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JobStore persists server jobs in a directory: <id>.json holds the job and
+// <id>.results.jsonl holds its open ports, one JSON object per line. All
+// methods are no-ops on a nil store.
+type JobStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// OpenJobStore returns a store backed by dir, creating it if needed
+func OpenJobStore(dir string) (*JobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &JobStore{dir: dir}, nil
+}
+
+func (st *JobStore) jobPath(id string) string {
+	return filepath.Join(st.dir, id+".json")
+}
+
+func (st *JobStore) resultsPath(id string) string {
+	return filepath.Join(st.dir, id+".results.jsonl")
+}
+
+// Save writes the job's current state, replacing the previous version atomically
+func (st *JobStore) Save(job *Job) error {
+	if st == nil {
+		return nil
+	}
+	job.mu.Lock()
+	data, err := json.MarshalIndent(job, "", "  ")
+	job.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	tmp := st.jobPath(job.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.jobPath(job.ID))
+}
+
+// AppendResult adds one open port to the job's results file
+func (st *JobStore) AppendResult(id string, r Result) error {
+	if st == nil {
+		return nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	f, err := os.OpenFile(st.resultsPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ResetResults discards the results recorded for a job
+func (st *JobStore) ResetResults(id string) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := os.Remove(st.resultsPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Delete removes a job and its results
+func (st *JobStore) Delete(id string) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, path := range []string{st.jobPath(id), st.resultsPath(id)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads every stored job along with its results, oldest first
+func (st *JobStore) Load() ([]*Job, error) {
+	if st == nil {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(st.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []*Job
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, err
+		}
+		if job.ID == "" || st.jobPath(job.ID) != path {
+			continue
+		}
+		job.results, err = readResults(st.resultsPath(job.ID))
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// readResults reads a JSON-lines results file; a missing file has no results
+// and a truncated final line (from a crash mid-write) is ignored
+func readResults(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var results []Result
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var r Result
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			continue
+		}
+		results = append(results, r)
+	}
+	return results, scanner.Err()
+}
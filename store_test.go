@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobStoreRoundTrip(t *testing.T) {
+	store, err := OpenJobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenJobStore() error = %v", err)
+	}
+
+	finished := time.Now()
+	job := &Job{
+		ID:         "abc123",
+		Owner:      "ci",
+		Request:    ScanRequest{Hosts: []string{"10.0.0.1"}, Ports: "22,80"},
+		Status:     JobCompleted,
+		CreatedAt:  finished.Add(-time.Minute),
+		FinishedAt: &finished,
+		Scanned:    2,
+		Open:       1,
+	}
+	if err := store.Save(job); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := store.AppendResult(job.ID, Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22}); err != nil {
+		t.Fatalf("AppendResult() error = %v", err)
+	}
+
+	// A partial line left by a crash must not prevent loading
+	f, _ := os.OpenFile(store.resultsPath(job.ID), os.O_WRONLY|os.O_APPEND, 0o644)
+	f.WriteString(`{"host": "10.0.0.1", "po`)
+	f.Close()
+
+	jobs, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("Load() returned %d jobs, expected 1", len(jobs))
+	}
+	got := jobs[0]
+	if got.ID != job.ID || got.Owner != "ci" || got.Status != JobCompleted || got.Open != 1 {
+		t.Errorf("Load() = %+v, expected %+v", got, job)
+	}
+	if len(got.results) != 1 || got.results[0].Port != 22 {
+		t.Errorf("Load() results = %+v, expected port 22", got.results)
+	}
+}
+
+func TestServerRestoreRestartsInterruptedScans(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	store, err := OpenJobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenJobStore() error = %v", err)
+	}
+	started := time.Now()
+	interrupted := &Job{
+		ID:        "interrupted",
+		Request:   ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: fmt.Sprint(port), Concurrency: 1},
+		Status:    JobRunning,
+		CreatedAt: started,
+		StartedAt: &started,
+	}
+	store.Save(interrupted)
+	store.AppendResult(interrupted.ID, Result{IP: "127.0.0.1", Port: port})
+
+	server := NewServer(quickProbe)
+	server.store = store
+	if n, err := server.Restore(); err != nil || n != 1 {
+		t.Fatalf("Restore() = %d, %v, expected 1 scan", n, err)
+	}
+
+	job := server.Job("interrupted", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Progress().Status != JobCompleted && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := job.Progress(); status.Status != JobCompleted || status.Open != 1 {
+		t.Fatalf("restored scan = %+v, expected completed with 1 open port", status)
+	}
+
+	// The rescan replaces the results recorded before the restart
+	jobs, _ := store.Load()
+	if len(jobs) != 1 || len(jobs[0].results) != 1 || jobs[0].Status != JobCompleted {
+		t.Errorf("stored scan after restart = %+v with %d results", jobs[0], len(jobs[0].results))
+	}
+}
+
+func TestServerRestoreCancelsInvalidScans(t *testing.T) {
+	store, err := OpenJobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("OpenJobStore() error = %v", err)
+	}
+	now := time.Now()
+	// Submitted before -max-hosts was lowered
+	store.Save(&Job{ID: "large", Request: ScanRequest{CIDRs: []string{"10.0.0.0/24"}, Ports: "1"}, Status: JobQueued, CreatedAt: now})
+	store.Save(&Job{ID: "small", Request: ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: "1", Concurrency: 1}, Status: JobQueued, CreatedAt: now.Add(time.Second)})
+
+	server := NewServer(quickProbe)
+	server.store, server.maxHosts = store, 16
+	if n, err := server.Restore(); err != nil || n != 2 {
+		t.Fatalf("Restore() = %d, %v, expected 2 scans", n, err)
+	}
+
+	large := server.Job("large", nil).Progress()
+	if large.Status != JobCancelled || !strings.Contains(large.Error, "too many hosts") {
+		t.Errorf("restored large scan = %+v, expected cancelled for too many hosts", large)
+	}
+	small := server.Job("small", nil)
+	deadline := time.Now().Add(5 * time.Second)
+	for small.Progress().Status != JobCompleted && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if status := small.Progress().Status; status != JobCompleted {
+		t.Errorf("restored small scan status = %s, expected %s", status, JobCompleted)
+	}
+
+	// The reason is kept across another restart
+	jobs, _ := store.Load()
+	if len(jobs) != 2 || jobs[0].ID != "large" || jobs[0].Error == "" || jobs[0].Status != JobCancelled {
+		t.Errorf("stored scans = %+v, expected the large one cancelled with its reason", jobs)
+	}
+}
+
+func TestServerQueue(t *testing.T) {
+	server := NewServer(quickProbe)
+	server.slots = make(chan struct{}, 1)
+	server.slots <- struct{}{} // occupy the only slot
+
+	job, err := server.Submit(ScanRequest{Hosts: []string{"127.0.0.1"}, Ports: "1"}, nil)
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if status := job.Progress().Status; status != JobQueued {
+		t.Errorf("status while slots are full = %s, expected %s", status, JobQueued)
+	}
+
+	job.cancel()
+	deadline := time.Now().Add(time.Second)
+	for job.Progress().Status == JobQueued && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := job.Progress().Status; status != JobCancelled {
+		t.Errorf("status after cancelling a queued scan = %s, expected %s", status, JobCancelled)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"syscall"
+)
+
+// sweepPorts is the -sweep flag
+var sweepPorts string
+
+// Sweep probes every host once on a few ports and returns the hosts that
+// answered, in their order: with an open port, or by refusing a connection,
+// which only a host that is up does. The probes make a single attempt each
+// and report nothing else, so that a wide range is swept quickly before the
+// hosts found are scanned in depth.
+func Sweep(ctx context.Context, hosts []string, ports []int, opts ScanOptions) []string {
+	opts.Probe.Retries, opts.Probe.Reprobe = 1, 0
+	opts.Report, opts.Honeypots, opts.Knock = 0, nil, nil
+
+	var mu sync.Mutex
+	up := make(map[string]bool)
+	opts.OnProbe = func(job ScanJob, state PortState, err error) {
+		if state == StateOpen || errors.Is(err, syscall.ECONNREFUSED) {
+			mu.Lock()
+			up[job.Host] = true
+			mu.Unlock()
+		}
+	}
+	RunJobs(ctx, HostPorts(hosts, ports), opts, &Stats{}, func(Result) {})
+	return slices.DeleteFunc(slices.Clone(hosts), func(h string) bool { return !up[h] })
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestSweep(t *testing.T) {
+	saved := dialProbe
+	defer func() { dialProbe = saved }()
+
+	// 10.0.0.1 has the port open, 10.0.0.2 refuses it and nothing answers for
+	// 10.0.0.3
+	var mu sync.Mutex
+	dials := make(map[string]int)
+	dialProbe = func(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+		host, _, _ := net.SplitHostPort(address)
+		mu.Lock()
+		dials[host]++
+		mu.Unlock()
+		switch host {
+		case "10.0.0.1":
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		case "10.0.0.2":
+			return nil, &net.OpError{Op: "dial", Net: network, Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+		}
+		return nil, &net.OpError{Op: "dial", Net: network, Err: os.ErrDeadlineExceeded}
+	}
+
+	probe := DefaultProbeConfig()
+	probe.Retries = 3
+	hosts := []string{"10.0.0.3", "10.0.0.2", "10.0.0.1"}
+	got := Sweep(context.Background(), hosts, []int{22, 80}, ScanOptions{Workers: 4, Probe: probe})
+	if want := []string{"10.0.0.2", "10.0.0.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Sweep() = %v, expected %v", got, want)
+	}
+	if !reflect.DeepEqual(hosts, []string{"10.0.0.3", "10.0.0.2", "10.0.0.1"}) {
+		t.Errorf("Sweep() changed its hosts to %v", hosts)
+	}
+	if dials["10.0.0.3"] != 2 {
+		t.Errorf("Sweep() dialed the silent host %d times, expected once per port", dials["10.0.0.3"])
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileLine is a non-empty, non-comment line of a file with its 1-based number
+type FileLine struct {
+	Number int
+	Text   string
+}
+
+// ReadFileLines reads a file like ReadLines but keeps each line's number so
+// that problems can be reported where they are
+func ReadFileLines(filename string) ([]FileLine, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []FileLine
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, FileLine{Number: n, Text: line})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// skippedLines are the -hf and -cf lines the last CollectHosts skipped
+// because they were malformed or their range could not be expanded
+var skippedLines []SkippedTarget
+
+// skipLine warns about a target file line that will not be scanned and
+// records it for the summary
+func skipLine(filename string, line FileLine, err error) {
+	target := fmt.Sprintf("%s:%d: %s", filepath.Base(filename), line.Number, line.Text)
+	fmt.Fprintf(os.Stderr, "Warning: %s:%d: skipping %q: %v\n", filepath.Base(filename), line.Number, line.Text, err)
+	skippedLines = append(skippedLines, SkippedTarget{Target: target, Err: err})
+}
+
+// validateHost checks that a -hf entry is an IP address or a host name,
+// catching the usual copy-and-paste mistakes before they turn into a port
+// range's worth of failed probes
+func validateHost(h string) error {
+	if scheme, rest, ok := strings.Cut(h, "://"); ok {
+		return fmt.Errorf("%s:// is a URL scheme, not part of a host; did you mean %s?", scheme, strings.SplitN(rest, "/", 2)[0])
+	}
+	if strings.ContainsAny(h, ",;") {
+		return fmt.Errorf("stray separator; put one host per line")
+	}
+	if strings.Contains(h, "/") {
+		return fmt.Errorf("looks like a CIDR range or path; ranges go in the -cf file")
+	}
+	if _, err := netip.ParseAddr(h); err == nil {
+		return nil
+	}
+	if name, port, err := net.SplitHostPort(h); err == nil {
+		return fmt.Errorf("ports do not belong in the hosts file; use %s and -p %s", name, port)
+	}
+	if strings.Contains(h, ":") {
+		return fmt.Errorf("not a valid IP address")
+	}
+	return validateHostname(h)
+}
+
+// validateHostname checks the characters and lengths of a DNS name.
+// Underscores are allowed because plenty of internal names have them.
+func validateHostname(h string) error {
+	name := strings.TrimSuffix(h, ".")
+	if len(name) > 253 {
+		return fmt.Errorf("host name is longer than 253 characters")
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("host name has an empty label")
+		}
+		if len(label) > 63 {
+			return fmt.Errorf("host name label %q is longer than 63 characters", label)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("host name label %q starts or ends with a hyphen", label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("invalid character %q in host name", c)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCIDR checks that a -cf entry is a CIDR range, with a hint for a
+// lone address or a host that ended up in the wrong file
+func validateCIDR(cidr string) error {
+	cidr, _ = splitZone(cidr) // ExpandCIDR checks the zone
+	if _, _, err := net.ParseCIDR(cidr); err == nil {
+		return checkCIDRSize(cidr)
+	}
+	if strings.Contains(cidr, "://") || strings.ContainsAny(cidr, ",;") {
+		return validateHost(cidr)
+	}
+	if addr, err := netip.ParseAddr(cidr); err == nil {
+		return fmt.Errorf("missing prefix length; use %s/%d or put the address in the -hf file", cidr, addr.BitLen())
+	}
+	if !strings.Contains(cidr, "/") {
+		return fmt.Errorf("not a CIDR range; hosts go in the -hf file")
+	}
+	return fmt.Errorf("invalid CIDR range")
+}
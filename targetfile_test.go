@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadFileLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.txt")
+	os.WriteFile(path, []byte("# comment\n10.0.0.1\n\n  example.com  \n"), 0o644)
+
+	lines, err := ReadFileLines(path)
+	if err != nil {
+		t.Fatalf("ReadFileLines() error = %v", err)
+	}
+	expected := []FileLine{{Number: 2, Text: "10.0.0.1"}, {Number: 4, Text: "example.com"}}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("ReadFileLines() = %v, expected %v", lines, expected)
+	}
+}
+
+func TestValidateHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{"10.0.0.1", false},
+		{"::1", false},
+		{"fe80::1%eth0", false},
+		{"example.com", false},
+		{"example.com.", false},
+		{"db_1.internal", false},
+		{"http://example.com", true},
+		{"https://example.com/path", true},
+		{"example.com,", true},
+		{"10.0.0.1;", true},
+		{"10.0.0.0/24", true},
+		{"example.com:8080", true},
+		{"[::1]:22", true},
+		{"1:2:3", true},
+		{"exa mple.com", true},
+		{"example..com", true},
+		{"-example.com", true},
+		{"ex@mple.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			if err := validateHost(tt.host); (err != nil) != tt.wantErr {
+				t.Errorf("validateHost(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateCIDR(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		wantErr bool
+	}{
+		{"10.0.0.0/24", false},
+		{"2001:db8::/126", false},
+		{"10.0.0.0/33", true},
+		{"10.0.0.1", true},
+		{"10.0.0.0/24,", true},
+		{"http://10.0.0.0/24", true},
+		{"example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			if err := validateCIDR(tt.cidr); (err != nil) != tt.wantErr {
+				t.Errorf("validateCIDR(%q) error = %v, wantErr %v", tt.cidr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCollectHostsSkipsMalformedLines(t *testing.T) {
+	dir := t.TempDir()
+	hf := filepath.Join(dir, "hosts.txt")
+	os.WriteFile(hf, []byte("10.0.0.1\nhttp://example.com\n# comment\n10.0.0.2,\nexample.com\n"), 0o644)
+
+	saved := [...]string{host, hostsFile, cidrFile}
+	defer func() { host, hostsFile, cidrFile = saved[0], saved[1], saved[2] }()
+	host, hostsFile, cidrFile = "", hf, ""
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		t.Fatalf("CollectHosts() error = %v", err)
+	}
+	if expected := []string{"10.0.0.1", "example.com"}; !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("CollectHosts() = %v, expected %v", hosts, expected)
+	}
+	var skipped []string
+	for _, s := range skippedLines {
+		skipped = append(skipped, s.Target)
+	}
+	if expected := []string{"hosts.txt:2: http://example.com", "hosts.txt:4: 10.0.0.2,"}; !reflect.DeepEqual(skipped, expected) {
+		t.Errorf("skippedLines = %v, expected %v", skipped, expected)
+	}
+}
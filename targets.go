@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DetectHTTP reports whether an open port speaks HTTP, returning "http",
+// "https" or "" for anything else. TLS is tried first because many HTTPS
+// servers answer a plain request with an HTTP error page of their own. Each
+// connection, made as probe makes them, and exchange is limited to wait.
+func DetectHTTP(host string, port int, probe ProbeConfig, wait time.Duration) string {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	dialer := probe.Dialer(host, wait)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true, ServerName: host}
+	if tlsConn, err := tls.DialWithDialer(dialer, cmp.Or(probe.Network, "tcp"), addr, tlsConfig); err == nil {
+		ok := speaksHTTP(tlsConn, host, wait)
+		tlsConn.Close()
+		if ok {
+			return "https"
+		}
+	}
+
+	conn, err := probe.Dial(host, port, wait)
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	if speaksHTTP(conn, host, wait) {
+		return "http"
+	}
+	return ""
+}
+
+// HTTPDetector is an enricher that finds out whether a TCP port speaks HTTP
+// or HTTPS, for the URLs -output-targets prints. It runs in the scan's
+// workers, so slow ports don't hold up the results of others.
+type HTTPDetector struct {
+	Timeout time.Duration
+}
+
+// Enrich fills in the scheme of a result
+func (d HTTPDetector) Enrich(r *Result, probe ProbeConfig) {
+	if r.Transport == "" {
+		r.Scheme = DetectHTTP(r.Host, r.Port, probe, d.Timeout)
+	}
+}
+
+// speaksHTTP sends a HEAD request and checks for an HTTP status line
+func speaksHTTP(conn net.Conn, host string, wait time.Duration) bool {
+	conn.SetDeadline(time.Now().Add(wait))
+	if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", host); err != nil {
+		return false
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return false
+	}
+	return strings.HasPrefix(line, "HTTP/")
+}
+
+// FormatTarget renders a result for piping into other tools: host:port, or a
+// URL when the port was found to speak HTTP or was found over UDP. The
+// scanned name is kept rather than the address so virtual hosts keep working.
+func FormatTarget(r Result, scheme string) string {
+	hostPort := net.JoinHostPort(r.Host, strconv.Itoa(r.Port))
+	switch {
+	case r.Transport != "":
+		return r.Transport + "://" + hostPort
+	case scheme == "http" && r.Port == 80, scheme == "https" && r.Port == 443:
+		return scheme + "://" + formatURLHost(r.Host)
+	case scheme != "":
+		return scheme + "://" + hostPort
+	}
+	return hostPort
+}
+
+func formatURLHost(host string) string {
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFormatTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   Result
+		scheme   string
+		expected string
+	}{
+		{name: "Plain", result: Result{Host: "example.com", Port: 22}, expected: "example.com:22"},
+		{name: "IPv6", result: Result{Host: "2001:db8::1", Port: 22}, expected: "[2001:db8::1]:22"},
+		{name: "HTTP default port", result: Result{Host: "example.com", Port: 80}, scheme: "http", expected: "http://example.com"},
+		{name: "HTTPS default port", result: Result{Host: "example.com", Port: 443}, scheme: "https", expected: "https://example.com"},
+		{name: "HTTP other port", result: Result{Host: "10.0.0.1", Port: 8080}, scheme: "http", expected: "http://10.0.0.1:8080"},
+		{name: "HTTPS IPv6", result: Result{Host: "::1", Port: 443}, scheme: "https", expected: "https://[::1]"},
+		{name: "UDP", result: Result{Host: "10.0.0.1", Port: 53, Transport: "udp"}, expected: "udp://10.0.0.1:53"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatTarget(tt.result, tt.scheme); got != tt.expected {
+				t.Errorf("FormatTarget() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDetectHTTP(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+
+	banner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer banner.Close()
+	go func() {
+		for {
+			conn, err := banner.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("SSH-2.0-OpenSSH_9.6\r\n"))
+			conn.Close()
+		}
+	}()
+
+	port := func(addr net.Addr) int { return addr.(*net.TCPAddr).Port }
+	tests := []struct {
+		name     string
+		port     int
+		expected string
+	}{
+		{name: "HTTP", port: port(plain.Listener.Addr()), expected: "http"},
+		{name: "HTTPS", port: port(secure.Listener.Addr()), expected: "https"},
+		{name: "SSH", port: port(banner.Addr()), expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectHTTP("127.0.0.1", tt.port, ProbeConfig{}, 500*time.Millisecond); got != tt.expected {
+				t.Errorf("DetectHTTP(%s) = %q, expected %q", strconv.Itoa(tt.port), got, tt.expected)
+			}
+		})
+	}
+
+	// The probe's address family is kept: an IPv4 server isn't reached over IPv6
+	httpPort := port(plain.Listener.Addr())
+	if got := DetectHTTP("127.0.0.1", httpPort, ProbeConfig{Network: "tcp6"}, 500*time.Millisecond); got != "" {
+		t.Errorf("DetectHTTP() over tcp6 = %q, expected \"\"", got)
+	}
+
+	// HTTPDetector fills in TCP results only
+	tcp := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: httpPort}
+	udp := Result{Host: "127.0.0.1", IP: "127.0.0.1", Port: httpPort, Transport: "udp"}
+	detector := HTTPDetector{Timeout: 500 * time.Millisecond}
+	detector.Enrich(&tcp, ProbeConfig{})
+	detector.Enrich(&udp, ProbeConfig{})
+	if tcp.Scheme != "http" || udp.Scheme != "" {
+		t.Errorf("HTTPDetector gave TCP %q and UDP %q, expected \"http\" and \"\"", tcp.Scheme, udp.Scheme)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// enableCbreak is only implemented on Linux; elsewhere keys arrive after Enter
+func enableCbreak(fd int) (func(), error) {
+	return nil, errors.New("unbuffered terminal input is only supported on Linux")
+}
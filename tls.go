@@ -0,0 +1,78 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// TLSInfo is what a TLS handshake with a port negotiated
+type TLSInfo struct {
+	Version string    `json:"version"`         // e.g. "TLS 1.3"
+	Cipher  string    `json:"cipher"`          // cipher suite, e.g. "TLS_AES_128_GCM_SHA256"
+	ALPN    string    `json:"alpn,omitempty"`  // application protocol the server chose of those offered
+	HTTP2   bool      `json:"http2"`           // chose h2
+	JARM    string    `json:"jarm,omitempty"`  // with -enrich jarm
+	JA3S    string    `json:"ja3s,omitempty"`  // of the answer to the first JARM hello
+	Audit   *TLSAudit `json:"audit,omitempty"` // with -tls-audit
+}
+
+// tlsPorts are the ports where TLS is spoken from the start, tried when the
+// service is not known
+var tlsPorts = []int{443, 465, 636, 853, 993, 995, 8443}
+
+// tlsServices are the service names of TLS ports
+var tlsServices = []string{"https", "smtps", "ldaps", "imaps", "pop3s", "domain-s"}
+
+// tlsALPN are the application protocols offered, h2 first so that a server
+// that speaks HTTP/2 chooses it
+var tlsALPN = []string{"h2", "http/1.1"}
+
+// TLSProber is an enricher that completes a TLS handshake with TLS ports,
+// offering HTTP/2 and HTTP/1.1 over ALPN
+type TLSProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records the TLS version, cipher suite and application protocol a
+// port negotiates
+func (p TLSProber) Enrich(r *Result, probe ProbeConfig) {
+	if !isTLSPort(*r) {
+		return
+	}
+	dialer := probe.Dialer(r.Host, p.Timeout)
+	dialer.Deadline = time.Now().Add(2 * p.Timeout)
+	config := &tls.Config{InsecureSkipVerify: true, ServerName: tlsServerName(r.Host), NextProtos: tlsALPN}
+	conn, err := tls.DialWithDialer(dialer, cmp.Or(probe.Network, "tcp"), net.JoinHostPort(r.Host, strconv.Itoa(r.Port)), config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	state := conn.ConnectionState()
+	r.TLS = &TLSInfo{
+		Version: tls.VersionName(state.Version),
+		Cipher:  tls.CipherSuiteName(state.CipherSuite),
+		ALPN:    state.NegotiatedProtocol,
+		HTTP2:   state.NegotiatedProtocol == "h2",
+	}
+}
+
+// isTLSPort reports whether a port is known or likely to speak TLS
+func isTLSPort(r Result) bool {
+	if r.Service != "" {
+		return slices.Contains(tlsServices, r.Service)
+	}
+	return slices.Contains(tlsPorts, r.Port)
+}
+
+// tlsServerName is the SNI sent to host: the name scanned, but none for an
+// address, which servers would reject
+func tlsServerName(host string) string {
+	if parseHostIP(host) != nil {
+		return ""
+	}
+	return host
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTLSProber(t *testing.T) {
+	// Borrow the test server's certificate for listeners offering other protocols
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	tests := []struct {
+		name      string
+		protocols []string
+		want      string
+	}{
+		{"HTTP/2", []string{"h2", "http/1.1"}, "h2"},
+		{"HTTP/1.1 only", []string{"http/1.1"}, "http/1.1"},
+		{"No ALPN", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &tls.Config{Certificates: srv.TLS.Certificates, NextProtos: tt.protocols, MaxVersion: tls.VersionTLS12}
+			port := serveOnce(t, func(conn net.Conn) {
+				tls.Server(conn, config).Handshake()
+			})
+
+			r := Result{Host: "127.0.0.1", Port: port, Service: "https"}
+			TLSProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+			if r.TLS == nil {
+				t.Fatalf("Enrich() found no TLS")
+			}
+			if r.TLS.Version != "TLS 1.2" || r.TLS.Cipher == "" || r.TLS.ALPN != tt.want || r.TLS.HTTP2 != (tt.want == "h2") {
+				t.Errorf("Enrich() tls = %+v, expected TLS 1.2 with ALPN %q", r.TLS, tt.want)
+			}
+		})
+	}
+
+	plain := answerCommand(t, "HTTP/1.1 400 Bad Request\r\n\r\n")
+	for _, r := range []Result{
+		{Host: "127.0.0.1", Port: plain, Service: "https"},
+		{Host: "127.0.0.1", Port: plain, Service: "ssh"},
+	} {
+		TLSProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+		if r.TLS != nil {
+			t.Errorf("Enrich() of %s found TLS %+v, expected none", r.Service, r.TLS)
+		}
+	}
+}
+
+func TestParseQUICReply(t *testing.T) {
+	negotiation := []byte{0x80, 0, 0, 0, 0, 8}
+	negotiation = append(negotiation, quicConnectionID...)
+	negotiation = append(negotiation, 8)
+	negotiation = append(negotiation, quicConnectionID...)
+	negotiation = append(negotiation, 0, 0, 0, 1, 0x6b, 0x33, 0x43, 0xcf, 0x3a, 0x4a, 0x5a, 0x6a, 0xff, 0, 0, 0x1d, 0xff, 0, 0, 0x22)
+
+	var r Result
+	if !parseQUICReply(&r, quicVersionProbe(), negotiation) || r.Service != "quic" {
+		t.Fatalf("parseQUICReply() rejected a version negotiation packet")
+	}
+	if want := []string{"v1", "v2", "draft-29", "0xff000022"}; !reflect.DeepEqual(r.QUIC.Versions, want) {
+		t.Errorf("parseQUICReply() versions = %q, expected %q", r.QUIC.Versions, want)
+	}
+	for _, reply := range [][]byte{quicVersionProbe(), negotiation[:10], {0x80, 0, 0, 0, 0, 0, 0}} {
+		if parseQUICReply(&r, nil, reply) {
+			t.Errorf("parseQUICReply(% x) accepted it", reply[:min(len(reply), 8)])
+		}
+	}
+	if n := len(quicVersionProbe()); n != 1200 {
+		t.Errorf("quicVersionProbe() is %d bytes, expected 1200", n)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// TLSAudit is every TLS version and cipher suite a port accepts
+type TLSAudit struct {
+	Protocols  []TLSProtocol `json:"protocols"`
+	Deprecated []string      `json:"deprecated,omitempty"` // accepted versions deprecated by RFC 8996 or earlier
+	Weak       []string      `json:"weak,omitempty"`       // accepted cipher suites with known weaknesses, such as RC4 and 3DES
+}
+
+// TLSProtocol is a version a port accepts with its cipher suites, in the
+// server's order of preference. Only the suite chosen is known for SSL 3.0
+// and TLS 1.3.
+type TLSProtocol struct {
+	Version string   `json:"version"`
+	Ciphers []string `json:"ciphers"`
+}
+
+// tlsAudit is the -tls-audit flag
+var tlsAudit bool
+
+// deprecatedTLS are the versions flagged when accepted
+var deprecatedTLS = []string{"SSL 3.0", "TLS 1.0", "TLS 1.1"}
+
+// TLSAuditor is an enricher that enumerates the TLS versions and cipher
+// suites of TLS ports
+type TLSAuditor struct {
+	Timeout time.Duration
+}
+
+// Enrich probes each version in turn and, up to TLS 1.2, offers every cipher
+// suite crypto/tls knows, dropping the one chosen each time until the server
+// accepts none of those left
+func (a TLSAuditor) Enrich(r *Result, probe ProbeConfig) {
+	if r.TLS == nil {
+		TLSProber(a).Enrich(r, probe)
+	}
+	if r.TLS == nil {
+		return
+	}
+	audit := &TLSAudit{}
+	if suite, ok := a.sslv3(r.Host, r.Port, probe); ok {
+		audit.Protocols = append(audit.Protocols, TLSProtocol{"SSL 3.0", []string{tls.CipherSuiteName(suite)}})
+	}
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13} {
+		if ciphers := a.ciphers(r.Host, r.Port, probe, version); len(ciphers) > 0 {
+			audit.Protocols = append(audit.Protocols, TLSProtocol{tls.VersionName(version), ciphers})
+		}
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+	for _, p := range audit.Protocols {
+		if slices.Contains(deprecatedTLS, p.Version) {
+			audit.Deprecated = append(audit.Deprecated, p.Version)
+		}
+		for _, c := range p.Ciphers {
+			if insecure[c] && !slices.Contains(audit.Weak, c) {
+				audit.Weak = append(audit.Weak, c)
+			}
+		}
+	}
+	r.TLS.Audit = audit
+}
+
+// ciphers returns the cipher suites a port accepts with one version, or nil
+// when it doesn't accept the version
+func (a TLSAuditor) ciphers(host string, port int, probe ProbeConfig, version uint16) []string {
+	var offer []uint16
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(suite.SupportedVersions, version) && version != tls.VersionTLS13 {
+			offer = append(offer, suite.ID)
+		}
+	}
+	var accepted []string
+	for {
+		config := &tls.Config{InsecureSkipVerify: true, ServerName: tlsServerName(host),
+			MinVersion: version, MaxVersion: version, CipherSuites: offer}
+		state, err := a.handshake(host, port, probe, config)
+		if err != nil {
+			return accepted
+		}
+		accepted = append(accepted, tls.CipherSuiteName(state.CipherSuite))
+		// TLS 1.3 suites can't be chosen by the client
+		if version == tls.VersionTLS13 || !slices.Contains(offer, state.CipherSuite) {
+			return accepted
+		}
+		if offer = slices.DeleteFunc(offer, func(id uint16) bool { return id == state.CipherSuite }); len(offer) == 0 {
+			return accepted
+		}
+	}
+}
+
+// handshake completes one TLS handshake with a port
+func (a TLSAuditor) handshake(host string, port int, probe ProbeConfig, config *tls.Config) (tls.ConnectionState, error) {
+	dialer := probe.Dialer(host, a.Timeout)
+	dialer.Deadline = time.Now().Add(2 * a.Timeout)
+	conn, err := tls.DialWithDialer(dialer, cmp.Or(probe.Network, "tcp"), net.JoinHostPort(host, strconv.Itoa(port)), config)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+// sslv3Suites are the cipher suites offered in the SSL 3.0 hello, which
+// crypto/tls can't send
+var sslv3Suites = []uint16{0x0005, 0x0004, 0x000a, 0x0009, 0x002f, 0x0035, 0x0033, 0x0039, 0x0016}
+
+// sslv3Hello is an SSL 3.0 ClientHello offering sslv3Suites
+func sslv3Hello() []byte {
+	body := []byte{0x03, 0x00}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // no session ID
+	body = binary.BigEndian.AppendUint16(body, uint16(2*len(sslv3Suites)))
+	for _, suite := range sslv3Suites {
+		body = binary.BigEndian.AppendUint16(body, suite)
+	}
+	body = append(body, 1, 0) // null compression
+	handshake := append([]byte{1, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	record := []byte{0x16, 0x03, 0x00}
+	record = binary.BigEndian.AppendUint16(record, uint16(len(handshake)))
+	return append(record, handshake...)
+}
+
+// sslv3 sends an SSL 3.0 hello and reports the cipher suite of a ServerHello
+// that accepts the version
+func (a TLSAuditor) sslv3(host string, port int, probe ProbeConfig) (uint16, bool) {
+	conn, err := probe.Dial(host, port, a.Timeout)
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * a.Timeout))
+	if _, err := conn.Write(sslv3Hello()); err != nil {
+		return 0, false
+	}
+	return parseSSLv3Hello(conn)
+}
+
+// parseSSLv3Hello reads the server's first record and returns the cipher
+// suite of a ServerHello for SSL 3.0
+func parseSSLv3Hello(conn io.Reader) (uint16, bool) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != 0x16 {
+		return 0, false
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(conn, record); err != nil {
+		return 0, false
+	}
+	// type, length, version, random, session ID and then the suite
+	if len(record) < 39 || record[0] != 2 || record[4] != 3 || record[5] != 0 {
+		return 0, false
+	}
+	offset := 39 + int(record[38])
+	if len(record) < offset+2 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(record[offset:]), true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTLSAuditor(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	config := &tls.Config{Certificates: srv.TLS.Certificates, MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		}}
+	port := serveOnce(t, func(conn net.Conn) {
+		tls.Server(conn, config).Handshake()
+	})
+
+	r := Result{Host: "127.0.0.1", Port: port, Service: "https"}
+	TLSAuditor{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.TLS == nil || r.TLS.Audit == nil {
+		t.Fatalf("Enrich() tls = %+v, expected an audit", r.TLS)
+	}
+	audit := r.TLS.Audit
+	var versions []string
+	for _, p := range audit.Protocols {
+		versions = append(versions, p.Version)
+		slices.Sort(p.Ciphers)
+		want := []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA", "TLS_RSA_WITH_3DES_EDE_CBC_SHA"}
+		if p.Version == "TLS 1.2" {
+			want = append(want, "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+			slices.Sort(want)
+		}
+		if !reflect.DeepEqual(p.Ciphers, want) {
+			t.Errorf("%s ciphers = %q, expected %q", p.Version, p.Ciphers, want)
+		}
+	}
+	if want := []string{"TLS 1.0", "TLS 1.1", "TLS 1.2"}; !reflect.DeepEqual(versions, want) {
+		t.Errorf("Enrich() versions = %q, expected %q", versions, want)
+	}
+	if want := []string{"TLS 1.0", "TLS 1.1"}; !reflect.DeepEqual(audit.Deprecated, want) {
+		t.Errorf("Enrich() deprecated = %q, expected %q", audit.Deprecated, want)
+	}
+	if want := []string{"TLS_RSA_WITH_3DES_EDE_CBC_SHA"}; !reflect.DeepEqual(audit.Weak, want) {
+		t.Errorf("Enrich() weak = %q, expected %q", audit.Weak, want)
+	}
+	want := []string{"deprecated TLS 1.0, TLS 1.1", "1 weak cipher suite(s)"}
+	if got := serviceFindings(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceFindings() = %q, expected %q", got, want)
+	}
+}
+
+func TestParseSSLv3Hello(t *testing.T) {
+	hello := []byte{2, 0, 0, 42, 3, 0}
+	hello = append(hello, make([]byte, 32)...)
+	hello = append(hello, 4, 1, 2, 3, 4, 0x00, 0x0a, 0)
+	record := append([]byte{0x16, 3, 0, 0, byte(len(hello))}, hello...)
+	if suite, ok := parseSSLv3Hello(bytes.NewReader(record)); !ok || suite != 0x000a {
+		t.Errorf("parseSSLv3Hello() = %#04x, %v, expected 0x000a", suite, ok)
+	}
+
+	record[9] = 1 // TLS 1.0
+	if _, ok := parseSSLv3Hello(bytes.NewReader(record)); ok {
+		t.Errorf("parseSSLv3Hello() accepted a TLS 1.0 ServerHello")
+	}
+	alert := []byte{0x15, 3, 0, 0, 2, 2, 40}
+	if _, ok := parseSSLv3Hello(bytes.NewReader(alert)); ok {
+		t.Errorf("parseSSLv3Hello() accepted an alert")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UDPProbe asks a UDP service something it answers. An open UDP port says
+// nothing on its own, so a service is only found by speaking its protocol.
+type UDPProbe struct {
+	Port int
+	// Requests are sent in turn until one is answered
+	Requests func() [][]byte
+	// Parse fills in the result from the reply to a request, returning false
+	// when the reply is not from this service
+	Parse func(r *Result, request, reply []byte) bool
+	// Follow, if set, asks a service that answered further questions
+	Follow func(r *Result, exchange func(request []byte) ([]byte, error))
+}
+
+// udpProbes are the services -udp can look for, by name
+var udpProbes = map[string]UDPProbe{
+	"dns":  {Port: 53, Requests: func() [][]byte { return [][]byte{dnsProbeQuery} }, Parse: parseDNSUDPReply, Follow: followDNSUDP},
+	"ntp":  {Port: 123, Requests: func() [][]byte { return [][]byte{ntpClientRequest} }, Parse: parseNTPReply, Follow: followNTP},
+	"quic": {Port: 443, Requests: func() [][]byte { return [][]byte{quicVersionProbe()} }, Parse: parseQUICReply},
+	"snmp": {Port: 161, Requests: snmpRequests, Parse: parseSNMPReply},
+}
+
+// udpServices is the -udp flag
+var udpServices string
+
+// ParseUDPServices checks a comma-separated -udp list
+func ParseUDPServices(list string) ([]string, error) {
+	var services []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || slices.Contains(services, name) {
+			continue
+		}
+		if _, ok := udpProbes[name]; !ok {
+			return nil, fmt.Errorf("unknown UDP service %q (supported: %s)", name, strings.Join(udpServiceNames(), ", "))
+		}
+		services = append(services, name)
+	}
+	return services, nil
+}
+
+// udpPorts lists the ports probed for the given services, sorted
+func udpPorts(services []string) []int {
+	var ports []int
+	for _, name := range services {
+		if p := udpProbes[name].Port; !slices.Contains(ports, p) {
+			ports = append(ports, p)
+		}
+	}
+	slices.Sort(ports)
+	return ports
+}
+
+// udpServiceNames lists the services -udp knows, sorted
+func udpServiceNames() []string {
+	names := make([]string, 0, len(udpProbes))
+	for name := range udpProbes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// udpJob is one service to look for on one host
+type udpJob struct {
+	Host    string
+	Service string
+}
+
+// RunUDP looks for the given services on each host over UDP, reporting those
+// that answer as open results. It uses the workers, probing and labels of
+// opts, and stops early when ctx is cancelled.
+func RunUDP(ctx context.Context, hosts, services []string, opts ScanOptions, stats *Stats, onResult func(Result)) {
+	jobs := make(chan udpJob)
+	var mu sync.Mutex // onResult is called by one goroutine at a time, as in RunJobs
+	var wg sync.WaitGroup
+	for i := 0; i < max(1, min(opts.Workers, len(hosts)*len(services))); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if opts.Pause != nil {
+					opts.Pause.Wait(ctx)
+				}
+				if ctx.Err() != nil {
+					continue
+				}
+				if opts.Policy.Admit(ctx, job.Host, udpProbes[job.Service].Port, "udp") != nil {
+					continue
+				}
+				r, ok := probeUDP(ctx, job.Host, udpProbes[job.Service], opts.Probe)
+				if !ok {
+					continue
+				}
+				r.Labels, r.Aliases = opts.Labels[job.Host], opts.Aliases[job.Host]
+				if name, ok := opts.Names[job.Host]; ok {
+					r.Host = name
+				}
+				stats.IncrementOpen()
+				mu.Lock()
+				onResult(r)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, host := range hosts {
+		for _, service := range services {
+			select {
+			case jobs <- udpJob{Host: host, Service: service}:
+			case <-ctx.Done():
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// probeUDP sends a service's requests to a host, each up to probe.Retries
+// times, until one is answered. A port reported unreachable is not tried
+// further.
+func probeUDP(ctx context.Context, host string, probe UDPProbe, config ProbeConfig) (Result, bool) {
+	ip, err := GetHostIP(host, config.Network)
+	if err != nil {
+		ip = host
+	}
+	r := Result{Host: host, IP: ip, Port: probe.Port, Transport: "udp"}
+	for _, request := range probe.Requests() {
+		for i := 0; i < max(1, config.Retries) && ctx.Err() == nil; i++ {
+			reply, err := exchangeUDP(ctx, host, probe.Port, request, config)
+			if err != nil {
+				if _, kind := classifyDialError(err); kind == "refused" {
+					return Result{}, false
+				}
+				continue
+			}
+			if probe.Parse(&r, request, reply) {
+				if probe.Follow != nil {
+					probe.Follow(&r, func(request []byte) ([]byte, error) {
+						return exchangeUDP(ctx, host, probe.Port, request, config)
+					})
+				}
+				r.CPE = productCPE(r.Product, r.Version)
+				r.Hints = matchHints(r, hintRules)
+				r.Time = time.Now()
+				return r, true
+			}
+			break // answered, but not by this service
+		}
+	}
+	return Result{}, false
+}
+
+// exchangeUDP sends one datagram to a port and waits up to the probe timeout
+// for the reply
+func exchangeUDP(ctx context.Context, host string, port int, request []byte, config ProbeConfig) ([]byte, error) {
+	dialer := config.Dialer(host, config.Timeout)
+	if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok {
+		dialer.LocalAddr = &net.UDPAddr{IP: local.IP}
+	}
+	network := "udp" + strings.TrimPrefix(config.Network, "tcp")
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(config.Timeout))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 65535)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return nil, err
+	}
+	return reply[:n], nil
+}
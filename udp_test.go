@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// udpAgent answers datagrams on a new local port with reply, if it returns
+// one
+func udpAgent(t *testing.T, reply func(request []byte) []byte) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 2048)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if answer := reply(buf[:n]); answer != nil {
+				conn.WriteTo(answer, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestParseUDPServices(t *testing.T) {
+	if got, err := ParseUDPServices(" SNMP, snmp,"); err != nil || len(got) != 1 || got[0] != "snmp" {
+		t.Errorf("ParseUDPServices() = %v, %v, expected [snmp]", got, err)
+	}
+	if _, err := ParseUDPServices("snmp,gopher"); err == nil {
+		t.Errorf("ParseUDPServices() with an unknown service succeeded, expected an error")
+	}
+}
+
+func TestRunUDP(t *testing.T) {
+	// The agent only knows the second community
+	port := udpAgent(t, func(request []byte) []byte {
+		if bytes.Equal(request, snmpGetRequest("private", sysDescrOID)) {
+			return snmpResponse("private", 0, "Linux printer 5.10")
+		}
+		return nil
+	})
+	savedProbes, savedCommunities := udpProbes, snmpCommunities
+	defer func() { udpProbes, snmpCommunities = savedProbes, savedCommunities }()
+	probe := udpProbes["snmp"]
+	probe.Port = port
+	udpProbes = map[string]UDPProbe{"snmp": probe}
+	snmpCommunities = "public,private"
+
+	var found []Result
+	stats := &Stats{startTime: time.Now()}
+	opts := ScanOptions{Workers: 4, Probe: ProbeConfig{Timeout: 100 * time.Millisecond, Retries: 1},
+		Labels: map[string]map[string]string{"127.0.0.1": {"site": "lab"}}}
+	RunUDP(context.Background(), []string{"127.0.0.1"}, []string{"snmp"}, opts, stats, func(r Result) {
+		found = append(found, r)
+	})
+	if len(found) != 1 {
+		t.Fatalf("RunUDP() found %v, expected the agent", found)
+	}
+	r := found[0]
+	if r.Port != port || r.Transport != "udp" || r.Service != "snmp" || r.Labels["site"] != "lab" {
+		t.Errorf("RunUDP() result = %+v, expected labelled snmp over UDP", r)
+	}
+	if r.SNMP == nil || r.SNMP.Community != "private" || r.SNMP.SysDescr != "Linux printer 5.10" {
+		t.Errorf("RunUDP() snmp = %+v, expected the private community and description", r.SNMP)
+	}
+	if _, open, _ := stats.GetStats(); open != 1 {
+		t.Errorf("open ports = %d, expected 1", open)
+	}
+	if got := r.String(); got != "127.0.0.1:"+strconv.Itoa(port)+"/udp" {
+		t.Errorf("String() = %q, expected the port marked /udp", got)
+	}
+}
+
+func TestProbeUDPClosed(t *testing.T) {
+	// Reserve a port and free it, so that the kernel reports it unreachable
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	start := time.Now()
+	probe := UDPProbe{Port: port, Requests: func() [][]byte { return [][]byte{{1}, {2}} }, Parse: parseSNMPReply}
+	if _, ok := probeUDP(context.Background(), "127.0.0.1", probe, ProbeConfig{Timeout: time.Second, Retries: 3}); ok {
+		t.Errorf("probeUDP() found a service on a closed port")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("probeUDP() took %v, expected to give up on the unreachable port at once", elapsed)
+	}
+}
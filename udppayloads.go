@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// UDPPayload is a request a UDP service answers, from the payload library
+type UDPPayload struct {
+	Service       string `json:"service"`                  // name given to -udp and reported as the service
+	Port          int    `json:"port"`                     // port the service listens on
+	Payload       string `json:"payload"`                  // request, in hex
+	ReplyPrefix   string `json:"reply_prefix,omitempty"`   // start of a reply from the service, in hex
+	ReplyContains string `json:"reply_contains,omitempty"` // text a reply from the service contains
+
+	request, prefix []byte
+}
+
+//go:embed udp-payloads.json
+var bundledUDPPayloads []byte
+
+// udpPayloadsFile is the -udp-payloads flag
+var udpPayloadsFile string
+
+func init() {
+	payloads, err := ParseUDPPayloads(bundledUDPPayloads)
+	if err != nil {
+		panic("udp-payloads.json: " + err.Error())
+	}
+	for _, p := range payloads {
+		if _, ok := udpProbes[p.Service]; !ok {
+			udpProbes[p.Service] = p.Probe()
+		}
+	}
+}
+
+// LoadUDPPayloads adds the services of a payloads file to those -udp knows,
+// replacing any of the same name
+func LoadUDPPayloads(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	payloads, err := ParseUDPPayloads(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for _, p := range payloads {
+		udpProbes[p.Service] = p.Probe()
+	}
+	return nil
+}
+
+// ParseUDPPayloads decodes and checks a JSON array of payloads
+func ParseUDPPayloads(data []byte) ([]UDPPayload, error) {
+	var payloads []UDPPayload
+	if err := json.Unmarshal(data, &payloads); err != nil {
+		return nil, err
+	}
+	for i := range payloads {
+		p := &payloads[i]
+		p.Service = strings.ToLower(strings.TrimSpace(p.Service))
+		if p.Service == "" || strings.ContainsAny(p.Service, ", ") {
+			return nil, fmt.Errorf("payload %d: service must be a name without commas or spaces", i+1)
+		}
+		if p.Port < 1 || p.Port > 65535 {
+			return nil, fmt.Errorf("%s: port %d out of range", p.Service, p.Port)
+		}
+		var err error
+		if p.request, err = hex.DecodeString(p.Payload); err != nil || len(p.request) == 0 {
+			return nil, fmt.Errorf("%s: payload must be non-empty hex", p.Service)
+		}
+		if p.prefix, err = hex.DecodeString(p.ReplyPrefix); err != nil {
+			return nil, fmt.Errorf("%s: reply_prefix must be hex", p.Service)
+		}
+	}
+	return payloads, nil
+}
+
+// Probe is the UDP probe that sends the payload. Any reply that starts with
+// ReplyPrefix and contains ReplyContains is taken to come from the service,
+// and kept as the banner when it is text.
+func (p UDPPayload) Probe() UDPProbe {
+	return UDPProbe{
+		Port:     p.Port,
+		Requests: func() [][]byte { return [][]byte{p.request} },
+		Parse: func(r *Result, request, reply []byte) bool {
+			if len(reply) == 0 || !bytes.HasPrefix(reply, p.prefix) || !bytes.Contains(reply, []byte(p.ReplyContains)) {
+				return false
+			}
+			r.Service, r.Banner = p.Service, textBanner(reply)
+			return true
+		},
+	}
+}
+
+// textBanner is the start of a reply made of printable text, or "" for a
+// binary one
+func textBanner(reply []byte) string {
+	reply = reply[:min(len(reply), maxBanner)]
+	text := string(reply)
+	for _, c := range text {
+		if c == unicode.ReplacementChar || !unicode.IsPrint(c) && !unicode.IsSpace(c) {
+			return ""
+		}
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBundledUDPPayloads(t *testing.T) {
+	payloads, err := ParseUDPPayloads(bundledUDPPayloads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range payloads {
+		if _, ok := udpProbes[p.Service]; !ok {
+			t.Errorf("bundled service %s is not known to -udp", p.Service)
+		}
+	}
+	// The built-in probes keep their names
+	if probe := udpProbes["dns"]; probe.Follow == nil {
+		t.Errorf("the payload library replaced the built-in dns probe")
+	}
+}
+
+func TestParseUDPPayloads(t *testing.T) {
+	bad := []string{
+		`{}`,
+		`[{"service": "", "port": 1, "payload": "00"}]`,
+		`[{"service": "a,b", "port": 1, "payload": "00"}]`,
+		`[{"service": "x", "port": 0, "payload": "00"}]`,
+		`[{"service": "x", "port": 1, "payload": ""}]`,
+		`[{"service": "x", "port": 1, "payload": "zz"}]`,
+		`[{"service": "x", "port": 1, "payload": "00", "reply_prefix": "0"}]`,
+	}
+	for _, data := range bad {
+		if _, err := ParseUDPPayloads([]byte(data)); err == nil {
+			t.Errorf("ParseUDPPayloads(%s) succeeded, expected an error", data)
+		}
+	}
+}
+
+func TestLoadUDPPayloads(t *testing.T) {
+	port := udpAgent(t, func(request []byte) []byte {
+		switch string(request) {
+		case "PING\n":
+			return []byte("PONG from gopherd 1.2\n")
+		case "\x01\x02":
+			return []byte{0xca, 0xfe, 0x00, 0xff}
+		}
+		return nil
+	})
+	saved := udpProbes
+	defer func() { udpProbes = saved }()
+	udpProbes = make(map[string]UDPProbe)
+	for name, probe := range saved {
+		udpProbes[name] = probe
+	}
+
+	file := filepath.Join(t.TempDir(), "payloads.json")
+	os.WriteFile(file, []byte(`[
+		{"service": "Gopher", "port": `+strconv.Itoa(port)+`, "payload": "50494e470a", "reply_contains": "PONG"},
+		{"service": "binary", "port": `+strconv.Itoa(port)+`, "payload": "0102", "reply_prefix": "cafe"},
+		{"service": "picky", "port": `+strconv.Itoa(port)+`, "payload": "0102", "reply_prefix": "beef"}
+	]`), 0o644)
+	if err := LoadUDPPayloads(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseUDPServices("gopher,binary"); err != nil {
+		t.Errorf("ParseUDPServices() = %v, expected the loaded services", err)
+	}
+
+	config := ProbeConfig{Timeout: 200 * time.Millisecond, Retries: 1}
+	r, ok := probeUDP(context.Background(), "127.0.0.1", udpProbes["gopher"], config)
+	if !ok || r.Service != "gopher" || r.Banner != "PONG from gopherd 1.2" {
+		t.Errorf("probeUDP(gopher) = %+v, %v, expected the text banner", r, ok)
+	}
+	r, ok = probeUDP(context.Background(), "127.0.0.1", udpProbes["binary"], config)
+	if !ok || r.Service != "binary" || r.Banner != "" {
+		t.Errorf("probeUDP(binary) = %+v, %v, expected no banner for a binary reply", r, ok)
+	}
+	if _, ok := probeUDP(context.Background(), "127.0.0.1", udpProbes["picky"], config); ok {
+		t.Errorf("probeUDP(picky) accepted a reply without its prefix")
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// releasesURL is the GitHub API endpoint for the latest release
+var releasesURL = "https://api.github.com/repos/rudSarkar/pscanner/releases/latest"
+
+// updateKey is the base64 Ed25519 public key release checksums are signed
+// with, set by release builds with -ldflags "-X main.updateKey=...". When it
+// is set, updates must carry a valid checksums.txt.sig.
+var updateKey = ""
+
+// maxDownload caps the size of anything fetched while updating
+const maxDownload = 200 << 20
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Release is a published GitHub release
+type Release struct {
+	Tag    string         `json:"tag_name"`
+	Assets []ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file attached to a release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Asset returns the download URL of the named file, or "" without one
+func (r *Release) Asset(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// assetName is the release file holding the binary for a platform
+func assetName(goos, goarch string) string {
+	name := "pscanner_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// download fetches a URL in full
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "pscanner/"+version)
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err == nil && len(data) > maxDownload {
+		err = fmt.Errorf("%s is larger than %d MiB", url, maxDownload>>20)
+	}
+	return data, err
+}
+
+// LatestRelease looks up the newest release on GitHub
+func LatestRelease() (*Release, error) {
+	data, err := download(releasesURL)
+	if err != nil {
+		return nil, err
+	}
+	var r Release
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing release: %v", err)
+	}
+	if r.Tag == "" {
+		return nil, errors.New("release has no tag")
+	}
+	return &r, nil
+}
+
+// parseVersion splits a release version such as v1.2.3 or 1.2.3-rc.1 into
+// its numbers and pre-release suffix
+func parseVersion(v string) (nums [3]int, pre string, ok bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return nums, "", false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nums, "", false
+		}
+		nums[i] = n
+	}
+	return nums, pre, true
+}
+
+// isRelease reports whether v names a published release rather than a
+// development build or a Go pseudo-version
+func isRelease(v string) bool {
+	_, pre, ok := parseVersion(v)
+	return ok && !isPseudoVersion(pre) && !strings.HasSuffix(v, "+dirty")
+}
+
+// isPseudoVersion reports whether a pre-release suffix is that of a Go
+// pseudo-version such as v0.0.0-20240501100000-0123456789ab, which names a
+// commit rather than a release
+func isPseudoVersion(pre string) bool {
+	i := strings.LastIndexByte(pre, '-')
+	if i < 14 || len(pre)-i-1 != 12 {
+		return false
+	}
+	if _, err := hex.DecodeString(pre[i+1:]); err != nil {
+		return false
+	}
+	_, err := strconv.ParseUint(pre[i-14:i], 10, 64)
+	return err == nil
+}
+
+// compareVersions orders two release versions like semver: -1 when a is
+// older than b, 0 when equal and 1 when newer
+func compareVersions(a, b string) int {
+	an, apre, _ := parseVersion(a)
+	bn, bpre, _ := parseVersion(b)
+	for i := range an {
+		if an[i] != bn[i] {
+			if an[i] < bn[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "": // a release is newer than its pre-releases
+		return 1
+	case bpre == "":
+		return -1
+	}
+	return comparePrerelease(apre, bpre)
+}
+
+// comparePrerelease orders two pre-release suffixes by semver precedence:
+// dot-separated identifiers left to right, numeric ones as numbers and below
+// alphanumeric ones, so rc.9 comes before rc.10 and a longer list after its
+// prefix
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.ParseUint(as[i], 10, 64)
+		bn, berr := strconv.ParseUint(bs[i], 10, 64)
+		switch {
+		case aerr == nil && berr == nil:
+			if an != bn {
+				return cmp.Compare(an, bn)
+			}
+		case aerr == nil:
+			return -1
+		case berr == nil:
+			return 1
+		case as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return cmp.Compare(len(as), len(bs))
+}
+
+// checksumFor finds a file's SHA-256 in a sha256sum-style checksums file
+func checksumFor(checksums []byte, name string) ([]byte, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			sum, err := hex.DecodeString(fields[0])
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("malformed checksum for %s", name)
+			}
+			return sum, nil
+		}
+	}
+	return nil, fmt.Errorf("no checksum for %s", name)
+}
+
+// checksumsVersion returns the release named by a "version: v1.2.3" line of
+// a checksums file, or "" without one
+func checksumsVersion(checksums []byte) string {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "version:"); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// verifySignature checks a base64 or raw Ed25519 signature of the checksums
+// file against a base64 public key
+func verifySignature(key string, checksums, sig []byte) error {
+	pub, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errors.New("malformed update key")
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+		sig = decoded
+	}
+	if !ed25519.Verify(pub, checksums, sig) {
+		return errors.New("checksums signature does not verify")
+	}
+	return nil
+}
+
+// FetchUpdate downloads the binary for this platform from a release and
+// verifies it against the release checksums, and their signature and
+// version line when updateKey is set
+func FetchUpdate(r *Release) ([]byte, error) {
+	name := assetName(runtime.GOOS, runtime.GOARCH)
+	binURL := r.Asset(name)
+	if binURL == "" {
+		return nil, fmt.Errorf("release %s has no build for %s/%s", r.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL := r.Asset("checksums.txt")
+	if sumsURL == "" {
+		return nil, fmt.Errorf("release %s has no checksums.txt", r.Tag)
+	}
+	checksums, err := download(sumsURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading checksums: %v", err)
+	}
+	if updateKey != "" {
+		sigURL := r.Asset("checksums.txt.sig")
+		if sigURL == "" {
+			return nil, fmt.Errorf("release %s has no checksums.txt.sig", r.Tag)
+		}
+		sig, err := download(sigURL)
+		if err != nil {
+			return nil, fmt.Errorf("downloading signature: %v", err)
+		}
+		if err := verifySignature(updateKey, checksums, sig); err != nil {
+			return nil, err
+		}
+		// The signature covers the version line too, so the checksums of an
+		// older release can't be passed off as a newer one
+		v := checksumsVersion(checksums)
+		if v == "" {
+			return nil, fmt.Errorf("release %s: checksums.txt has no version line", r.Tag)
+		}
+		if strings.TrimPrefix(v, "v") != strings.TrimPrefix(r.Tag, "v") {
+			return nil, fmt.Errorf("release %s: checksums.txt is signed for version %s", r.Tag, v)
+		}
+	}
+	want, err := checksumFor(checksums, name)
+	if err != nil {
+		return nil, err
+	}
+
+	binary, err := download(binURL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %v", name, err)
+	}
+	if got := sha256.Sum256(binary); !bytes.Equal(got[:], want) {
+		return nil, fmt.Errorf("checksum mismatch for %s", name)
+	}
+	return binary, nil
+}
+
+// replaceExecutable swaps the file at path for data. The new file is written
+// next to it and renamed into place, so a failure leaves the old one intact.
+// Windows cannot overwrite a running program, so the old one is moved aside
+// to path.old first.
+func replaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0o111); err != nil {
+		return err
+	}
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runUpdate implements the "update" subcommand
+func runUpdate(args []string) int {
+	flags := flag.NewFlagSet("update", flag.ExitOnError)
+	check := flags.Bool("check", false, "Only report whether a newer release is available")
+	force := flags.Bool("force", false, "Install the latest release even if it is not newer, or over a development build")
+	insecure := flags.Bool("insecure", false, "Install a release this build has no key to verify the signature of, trusting its checksums alone")
+	flags.Parse(args)
+
+	current := currentBuild().Version
+	r, err := LatestRelease()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking for updates: %v\n", err)
+		return 1
+	}
+	release := isRelease(current)
+	newer := !release || compareVersions(r.Tag, current) > 0
+	switch {
+	case *check && release && newer:
+		fmt.Printf("pscanner %s is available (running %s); run 'pscanner update' to install it\n", r.Tag, current)
+		return 0
+	case *check && !release:
+		fmt.Printf("Latest release is %s (running development build %s)\n", r.Tag, current)
+		return 0
+	case *check || !newer && !*force:
+		fmt.Printf("pscanner %s is up to date\n", current)
+		return 0
+	case !release && !*force:
+		fmt.Fprintf(os.Stderr, "Error: this is a development build (%s); use -force to replace it with %s\n", current, r.Tag)
+		return 1
+	}
+
+	if updateKey == "" && !*insecure {
+		fmt.Fprintf(os.Stderr, "Error: this build has no key to verify the release signature; use -insecure to trust the checksums alone\n")
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locating the running binary: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Downloading pscanner %s...\n", r.Tag)
+	binary, err := FetchUpdate(r)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return 1
+	}
+	if updateKey == "" {
+		fmt.Fprintf(os.Stderr, "Warning: checksum verified, but the release signature was not checked (-insecure)\n")
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		fmt.Fprintf(os.Stderr, "Error replacing %s: %v\n", exe, err)
+		return 1
+	}
+	fmt.Printf("Updated %s from %s to %s\n", exe, current, r.Tag)
+	return 0
+}
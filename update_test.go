@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "v1.10.0", -1},
+		{"v2.0.0", "v1.99.99", 1},
+		{"v1.3", "v1.2.9", 1},
+		{"v1.2.3-rc.1", "v1.2.3", -1},
+		{"v1.2.3", "v1.2.3-rc.1", 1},
+		{"v1.2.3-rc.1", "v1.2.3-rc.2", -1},
+		{"v1.2.3-rc.9", "v1.2.3-rc.10", -1},
+		{"v1.2.3-rc.10", "v1.2.3-rc.9", 1},
+		{"v1.2.3-rc.1", "v1.2.3-rc.1.1", -1},
+		{"v1.2.3-1", "v1.2.3-alpha", -1},
+		{"v1.2.3-alpha", "v1.2.3-beta", -1},
+		{"v1.2.3-beta.2", "v1.2.3-beta.11", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestIsRelease(t *testing.T) {
+	tests := []struct {
+		v    string
+		want bool
+	}{
+		{"v1.2.3", true},
+		{"v1.2.3-rc.1", true},
+		{"dev", false},
+		{"v0.0.0-20240501100000-0123456789ab", false},
+		{"v1.2.4-0.20240501100000-0123456789ab", false},
+		{"v1.2.3+dirty", false},
+	}
+	for _, tt := range tests {
+		if got := isRelease(tt.v); got != tt.want {
+			t.Errorf("isRelease(%q) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+// releaseServer serves a release of binary with its checksums, signed with
+// priv when it is not nil
+func releaseServer(t *testing.T, binary []byte, sums string, priv ed25519.PrivateKey) *httptest.Server {
+	name := assetName(runtime.GOOS, runtime.GOARCH)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			assets := []ReleaseAsset{{name, srv.URL + "/bin"}, {"checksums.txt", srv.URL + "/sums"}}
+			if priv != nil {
+				assets = append(assets, ReleaseAsset{"checksums.txt.sig", srv.URL + "/sig"})
+			}
+			json.NewEncoder(w).Encode(Release{Tag: "v9.9.9", Assets: assets})
+		case "/bin":
+			w.Write(binary)
+		case "/sums":
+			w.Write([]byte(sums))
+		case "/sig":
+			w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(sums)))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchUpdate(t *testing.T) {
+	binary := []byte("new pscanner")
+	sum := sha256.Sum256(binary)
+	line := hex.EncodeToString(sum[:]) + "  " + assetName(runtime.GOOS, runtime.GOARCH) + "\n"
+	sums := "version: v9.9.9\n" + line
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, otherPriv, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name    string
+		binary  []byte
+		sums    string
+		priv    ed25519.PrivateKey
+		key     string
+		wantErr string
+	}{
+		{"checksum only", binary, line, nil, "", ""},
+		{"signed", binary, sums, priv, base64.StdEncoding.EncodeToString(pub), ""},
+		{"tampered binary", []byte("evil pscanner"), sums, nil, "", "checksum mismatch"},
+		{"wrong signer", binary, sums, otherPriv, base64.StdEncoding.EncodeToString(pub), "does not verify"},
+		{"signature required", binary, sums, nil, base64.StdEncoding.EncodeToString(pub), "no checksums.txt.sig"},
+		{"replayed older release", binary, "version: v1.0.0\n" + line, priv, base64.StdEncoding.EncodeToString(pub), "signed for version v1.0.0"},
+		{"signed without version", binary, line, priv, base64.StdEncoding.EncodeToString(pub), "no version line"},
+	}
+	defer func(url, key string) { releasesURL, updateKey = url, key }(releasesURL, updateKey)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := releaseServer(t, tt.binary, tt.sums, tt.priv)
+			releasesURL, updateKey = srv.URL+"/latest", tt.key
+			r, err := LatestRelease()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FetchUpdate(r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("FetchUpdate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(got) != string(binary) {
+				t.Fatalf("FetchUpdate() = %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pscanner")
+	if err := os.WriteFile(path, []byte("old"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Fatalf("after replace: %q, %v", data, err)
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0 {
+		t.Errorf("replaced binary is not executable: %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if runtime.GOOS != "windows" && len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// uptimeEnabled is the -uptime flag
+var uptimeEnabled bool
+
+// uptimeMinSpan is how far apart the first and last timestamps of a host
+// must be taken for its clock rate to be measured
+const uptimeMinSpan = time.Second
+
+// uptimeMaxSkew is the coarsest clock skew resolution, in parts per million,
+// worth reporting; the resolution improves with the time between samples
+const uptimeMaxSkew = 100
+
+// ipProtoTCP is the IP protocol number of TCP
+const ipProtoTCP = 6
+
+// timestampRates are the clock rates TCP stacks run their timestamps at:
+// kernel ticks on older systems, milliseconds on most current ones
+var timestampRates = []int{1, 2, 10, 100, 200, 250, 300, 1000}
+
+// UptimeInfo is a host's uptime estimated from the TCP timestamps (RFC 7323)
+// in its SYN-ACKs. Hosts that start their timestamp clock at boot give it
+// away; current Linux kernels add a random offset per connection, and the clock
+// wraps after 2^32 ticks (49.7 days at 1000 Hz).
+type UptimeInfo struct {
+	Seconds int64     `json:"seconds"`            // uptime when last sampled
+	Boot    time.Time `json:"boot"`               // when the clock started
+	Hz      int       `json:"hz"`                 // timestamp clock rate
+	SkewPPM int       `json:"skew_ppm,omitempty"` // left out when too close to measure
+}
+
+// TimestampSample is the TSval of a SYN-ACK and when it arrived
+type TimestampSample struct {
+	Time  time.Time
+	TSval uint32
+}
+
+// TimestampLog keeps the first and last TCP timestamp seen from each
+// address. The zero value is ready to use.
+type TimestampLog struct {
+	mu    sync.Mutex
+	hosts map[string]*[2]TimestampSample
+}
+
+// Record adds the timestamp of a frame if it is a SYN-ACK carrying one
+func (l *TimestampLog) Record(t time.Time, frame []byte) {
+	src, tsval, ok := synAckTimestamp(frame)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.hosts == nil {
+		l.hosts = make(map[string]*[2]TimestampSample)
+	}
+	sample := TimestampSample{Time: t, TSval: tsval}
+	if s := l.hosts[src.String()]; s != nil {
+		s[1] = sample
+	} else {
+		l.hosts[src.String()] = &[2]TimestampSample{sample, sample}
+	}
+}
+
+// Estimates returns the uptime of each address whose timestamps were
+// sampled far enough apart and advanced at a known clock rate
+func (l *TimestampLog) Estimates() map[string]*UptimeInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	estimates := make(map[string]*UptimeInfo)
+	for ip, s := range l.hosts {
+		if u := EstimateUptime(s[0], s[1]); u != nil {
+			estimates[ip] = u
+		}
+	}
+	return estimates
+}
+
+// Resample connects once more to an open port of each host that sent a
+// timestamp, late enough for its clock rate to be measured; the capture
+// records the SYN-ACKs
+func (l *TimestampLog) Resample(ctx context.Context, results []Result, probe ProbeConfig) {
+	l.mu.Lock()
+	var latest time.Time
+	targets := make(map[string]int)
+	for _, r := range results {
+		if s := l.hosts[r.IP]; s != nil && r.State == StateOpen && r.Transport == "" {
+			if _, ok := targets[r.IP]; !ok {
+				targets[r.IP] = r.Port
+				if s[0].Time.After(latest) {
+					latest = s[0].Time
+				}
+			}
+		}
+	}
+	l.mu.Unlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	sleepContext(ctx, time.Until(latest.Add(uptimeMinSpan)))
+	slots := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for ip, port := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			conn, err := probe.Dialer(ip, probe.Timeout).DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+			if err == nil {
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// EstimateUptime works out the clock rate of two timestamps from how far
+// they advanced, and from it the host's uptime. It returns nil when the
+// samples are too close together or the rate isn't one TCP stacks use, as
+// when the host randomizes its timestamps per connection.
+func EstimateUptime(first, last TimestampSample) *UptimeInfo {
+	span := last.Time.Sub(first.Time)
+	if span < uptimeMinSpan {
+		return nil
+	}
+	rate := float64(last.TSval-first.TSval) / span.Seconds()
+	for _, hz := range timestampRates {
+		ratio := rate / float64(hz)
+		if math.Abs(ratio-1) > 0.1 {
+			continue
+		}
+		uptime := time.Duration(float64(last.TSval) / float64(hz) * float64(time.Second))
+		u := &UptimeInfo{Seconds: int64(uptime / time.Second), Boot: last.Time.Add(-uptime).Round(time.Second), Hz: hz}
+		if 1e6/(float64(hz)*span.Seconds()) <= uptimeMaxSkew {
+			u.SkewPPM = int(math.Round((ratio - 1) * 1e6))
+		}
+		return u
+	}
+	return nil
+}
+
+// synAckTimestamp returns the source address and TSval of an Ethernet frame
+// carrying a TCP SYN-ACK with the timestamps option
+func synAckTimestamp(frame []byte) (src net.IP, tsval uint32, ok bool) {
+	if len(frame) < 14 {
+		return nil, 0, false
+	}
+	payload := frame[14:]
+	var tcp []byte
+	switch binary.BigEndian.Uint16(frame[12:14]) {
+	case 0x0800:
+		if len(payload) < 20 || payload[9] != ipProtoTCP {
+			return nil, 0, false
+		}
+		src, tcp = net.IP(payload[12:16]), payload[int(payload[0]&0x0f)*4:]
+	case 0x86DD:
+		if len(payload) < 40 || payload[6] != ipProtoTCP {
+			return nil, 0, false
+		}
+		src, tcp = net.IP(payload[8:24]), payload[40:]
+	default:
+		return nil, 0, false
+	}
+	if len(tcp) < 20 || tcp[13]&0x12 != 0x12 {
+		return nil, 0, false
+	}
+	end := int(tcp[12]>>4) * 4
+	if end < 20 || end > len(tcp) {
+		return nil, 0, false
+	}
+	for options := tcp[20:end]; len(options) > 0; {
+		switch kind := options[0]; {
+		case kind == 0:
+			return nil, 0, false
+		case kind == 1:
+			options = options[1:]
+		case len(options) < 2 || int(options[1]) < 2 || int(options[1]) > len(options):
+			return nil, 0, false
+		case kind == 8 && options[1] == 10:
+			return src, binary.BigEndian.Uint32(options[2:6]), true
+		default:
+			options = options[options[1]:]
+		}
+	}
+	return nil, 0, false
+}
+
+// WriteUptimes lists the hosts whose uptime was estimated, with their last
+// boot and timestamp clock
+func WriteUptimes(w io.Writer, results []Result) {
+	seen := make(map[string]bool)
+	var hosts []Result
+	for _, r := range results {
+		if r.Uptime != nil && !seen[r.IP] {
+			seen[r.IP] = true
+			hosts = append(hosts, r)
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+	sortResults(hosts)
+	fmt.Fprintf(w, "\n=== Host Uptime ===\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "HOST\tUPTIME\tBOOTED\tCLOCK\tSKEW\n")
+	for _, r := range hosts {
+		host := r.IP
+		if r.Host != r.IP {
+			host = fmt.Sprintf("%s (%s)", r.Host, r.IP)
+		}
+		skew := "-"
+		if r.Uptime.SkewPPM != 0 {
+			skew = fmt.Sprintf("%+d ppm", r.Uptime.SkewPPM)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d Hz\t%s\n", host, formatDuration(time.Duration(r.Uptime.Seconds)*time.Second),
+			r.Uptime.Boot.Local().Format("2006-01-02 15:04"), r.Uptime.Hz, skew)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// synAckFrame builds an Ethernet frame carrying a TCP segment from src with
+// the given flags and options
+func synAckFrame(src string, flags byte, options []byte) []byte {
+	tcp := make([]byte, 20, 20+len(options))
+	tcp = append(tcp, options...)
+	tcp[12] = byte(len(tcp)/4) << 4
+	tcp[13] = flags
+	ip := net.ParseIP(src)
+	var frame []byte
+	if v4 := ip.To4(); v4 != nil {
+		frame = make([]byte, 14+20)
+		binary.BigEndian.PutUint16(frame[12:], 0x0800)
+		frame[14] = 0x45
+		frame[14+9] = ipProtoTCP
+		copy(frame[14+12:], v4)
+	} else {
+		frame = make([]byte, 14+40)
+		binary.BigEndian.PutUint16(frame[12:], 0x86DD)
+		frame[14+6] = ipProtoTCP
+		copy(frame[14+8:], ip)
+	}
+	return append(frame, tcp...)
+}
+
+func TestSynAckTimestamp(t *testing.T) {
+	// MSS, SACK permitted, timestamps and window scale, as Linux sends them
+	options := []byte{2, 4, 0x05, 0xb4, 4, 2, 8, 10, 0x12, 0x34, 0x56, 0x78, 0, 0, 0, 0, 1, 3, 3, 7}
+	tests := []struct {
+		name  string
+		frame []byte
+		src   string
+		tsval uint32
+		ok    bool
+	}{
+		{"IPv4 SYN-ACK", synAckFrame("10.0.0.1", 0x12, options), "10.0.0.1", 0x12345678, true},
+		{"IPv6 SYN-ACK", synAckFrame("2001:db8::1", 0x12, options), "2001:db8::1", 0x12345678, true},
+		{"SYN", synAckFrame("10.0.0.1", 0x02, options), "", 0, false},
+		{"No timestamps", synAckFrame("10.0.0.1", 0x12, []byte{2, 4, 0x05, 0xb4}), "", 0, false},
+		{"Bad option length", synAckFrame("10.0.0.1", 0x12, []byte{1, 1, 2, 9, 0, 0}), "", 0, false},
+		{"Truncated", synAckFrame("10.0.0.1", 0x12, options)[:40], "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, tsval, ok := synAckTimestamp(tt.frame)
+			if ok != tt.ok || tsval != tt.tsval || ok && !src.Equal(net.ParseIP(tt.src)) {
+				t.Errorf("synAckTimestamp() = %v, %d, %v; expected %s, %d, %v", src, tsval, ok, tt.src, tt.tsval, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEstimateUptime(t *testing.T) {
+	start := time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)
+	sample := func(after time.Duration, tsval uint32) TimestampSample {
+		return TimestampSample{Time: start.Add(after), TSval: tsval}
+	}
+	tests := []struct {
+		name        string
+		first, last TimestampSample
+		want        *UptimeInfo
+	}{
+		{"1000 Hz", sample(0, 3_600_000), sample(2*time.Second, 3_602_000),
+			&UptimeInfo{Seconds: 3602, Boot: start.Add(-time.Hour), Hz: 1000}},
+		{"100 Hz with skew", sample(0, 0), sample(10*time.Minute, 60_030),
+			&UptimeInfo{Seconds: 600, Boot: start, Hz: 100, SkewPPM: 500}},
+		{"Skew too fine to tell", sample(0, 0), sample(time.Minute, 6_003),
+			&UptimeInfo{Seconds: 60, Boot: start, Hz: 100}},
+		{"Wrapped", sample(0, 0xffffff00), sample(time.Second, 744),
+			&UptimeInfo{Seconds: 0, Boot: start, Hz: 1000}},
+		{"Too close", sample(0, 1000), sample(500*time.Millisecond, 1500), nil},
+		{"Randomized", sample(0, 3_624_085_894), sample(2*time.Second, 470_692_065), nil},
+		{"Stopped", sample(0, 1000), sample(2*time.Second, 1000), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateUptime(tt.first, tt.last)
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("EstimateUptime() = %+v, expected %+v", got, tt.want)
+			}
+		})
+	}
+}
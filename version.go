@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Build metadata, set by release builds with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds without them fall back to what the Go toolchain records, such as the
+// module version of "go install ...@v1.2.0" or the VCS revision of a checkout.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Modified  bool   `json:"modified,omitempty"` // built from a checkout with local changes
+}
+
+// currentBuild combines the ldflags with the toolchain's build information
+func currentBuild() BuildInfo {
+	b := BuildInfo{Version: version, Commit: commit, Date: date,
+		GoVersion: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fillBuild(&b, info)
+	}
+	return b
+}
+
+// fillBuild fills in whatever the ldflags left unset from info
+func fillBuild(b *BuildInfo, info *debug.BuildInfo) {
+	if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.time":
+			if b.Date == "" {
+				b.Date = s.Value
+			}
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+}
+
+// WriteVersion prints the build information for -version
+func WriteVersion(w io.Writer, b BuildInfo) {
+	fmt.Fprintf(w, "pscanner %s\n", b.Version)
+	if b.Commit != "" {
+		c := b.Commit
+		if b.Modified {
+			c += " (modified)"
+		}
+		fmt.Fprintf(w, "  commit:   %s\n", c)
+	}
+	if b.Date != "" {
+		if t, err := time.Parse(time.RFC3339, b.Date); err == nil {
+			b.Date = t.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "  built:    %s\n", b.Date)
+	}
+	fmt.Fprintf(w, "  go:       %s\n", b.GoVersion)
+	fmt.Fprintf(w, "  platform: %s\n", b.Platform)
+}
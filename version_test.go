@@ -0,0 +1,67 @@
+package main
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestFillBuild(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.4.0"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: "0123abcd"},
+			{Key: "vcs.time", Value: "2024-05-01T10:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	tests := []struct {
+		name string
+		b    BuildInfo
+		want BuildInfo
+	}{
+		{
+			"toolchain only",
+			BuildInfo{Version: "dev"},
+			BuildInfo{Version: "v1.4.0", Commit: "0123abcd", Date: "2024-05-01T10:00:00Z", Modified: true},
+		},
+		{
+			"ldflags win",
+			BuildInfo{Version: "v2.0.0", Commit: "ffff", Date: "2024-06-01T00:00:00Z"},
+			BuildInfo{Version: "v2.0.0", Commit: "ffff", Date: "2024-06-01T00:00:00Z", Modified: true},
+		},
+	}
+	for _, tt := range tests {
+		fillBuild(&tt.b, info)
+		if tt.b != tt.want {
+			t.Errorf("%s: fillBuild() = %+v, want %+v", tt.name, tt.b, tt.want)
+		}
+	}
+
+	// A plain "go build" in a checkout reports (devel)
+	b := BuildInfo{Version: "dev"}
+	fillBuild(&b, &debug.BuildInfo{Main: debug.Module{Version: "(devel)"}})
+	if b.Version != "dev" {
+		t.Errorf("fillBuild() with (devel) set version %q", b.Version)
+	}
+}
+
+func TestWriteVersion(t *testing.T) {
+	var out strings.Builder
+	WriteVersion(&out, BuildInfo{Version: "v1.4.0", Commit: "0123abcd", Date: "2024-05-01T12:00:00+02:00",
+		GoVersion: "go1.24.3", Platform: "linux/amd64"})
+	want := "pscanner v1.4.0\n" +
+		"  commit:   0123abcd\n" +
+		"  built:    2024-05-01T10:00:00Z\n" +
+		"  go:       go1.24.3\n" +
+		"  platform: linux/amd64\n"
+	if out.String() != want {
+		t.Errorf("WriteVersion() = %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	WriteVersion(&out, BuildInfo{Version: "dev", GoVersion: "go1.24.3", Platform: "linux/amd64"})
+	if strings.Contains(out.String(), "commit") || strings.Contains(out.String(), "built") {
+		t.Errorf("WriteVersion() printed unknown fields: %q", out.String())
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Baseline is the set of open ports recorded by the last watch cycle
+type Baseline struct {
+	Time    time.Time `json:"time"`
+	Results []Result  `json:"results"`
+}
+
+// LoadBaseline reads a baseline file; a missing file yields a nil baseline
+func LoadBaseline(filename string) (*Baseline, error) {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &Baseline{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %v", filename, err)
+	}
+	return b, nil
+}
+
+// SaveBaseline replaces the baseline file atomically
+func SaveBaseline(filename string, b *Baseline) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// diffResults compares two scans and returns the ports that are open only in
+// current (opened) and only in previous (closed), ordered by address
+func diffResults(previous, current []Result) (opened, closed []Result) {
+	before := make(map[string]bool, len(previous))
+	for _, r := range previous {
+		if r.State == StateOpen {
+			before[r.Key()] = true
+		}
+	}
+	after := make(map[string]bool, len(current))
+	for _, r := range current {
+		if r.State != StateOpen {
+			continue
+		}
+		after[r.Key()] = true
+		if !before[r.Key()] {
+			opened = append(opened, r)
+		}
+	}
+	for _, r := range previous {
+		if r.State == StateOpen && !after[r.Key()] {
+			closed = append(closed, r)
+		}
+	}
+	sortResults(opened)
+	sortResults(closed)
+	return opened, closed
+}
+
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].IP != results[j].IP {
+			return results[i].IP < results[j].IP
+		}
+		return results[i].Port < results[j].Port
+	})
+}
+
+// ChangeAlert describes the ports that changed between two watch cycles
+type ChangeAlert struct {
+	Time   time.Time `json:"time"`
+	Opened []Result  `json:"opened"`
+	Closed []Result  `json:"closed"`
+}
+
+// Summary renders the alert as plain text
+func (a ChangeAlert) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pscanner: %d port(s) opened, %d port(s) closed", len(a.Opened), len(a.Closed))
+	for _, r := range a.Opened {
+		fmt.Fprintf(&b, "\n+ %s", r)
+	}
+	for _, r := range a.Closed {
+		fmt.Fprintf(&b, "\n- %s", r)
+	}
+	return b.String()
+}
+
+// postJSON sends v as a JSON request body and fails on a non-2xx response
+func postJSON(url string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// Alert is a notification SendAlert can deliver
+type Alert interface {
+	Summary() string
+}
+
+// SendAlert delivers an alert to a generic webhook (the alert as JSON) and/or
+// a Slack incoming webhook (the text summary)
+func SendAlert(alert Alert, webhookURL, slackURL string) error {
+	if webhookURL != "" {
+		if err := postJSON(webhookURL, alert); err != nil {
+			return fmt.Errorf("webhook: %v", err)
+		}
+	}
+	if slackURL != "" {
+		if err := postJSON(slackURL, map[string]string{"text": alert.Summary()}); err != nil {
+			return fmt.Errorf("slack: %v", err)
+		}
+	}
+	return nil
+}
+
+// scanOpenPorts runs a full scan and returns the open ports found
+func scanOpenPorts(ctx context.Context, hosts []string, portList []int, probe ProbeConfig) []Result {
+	var results []Result
+	stats := &Stats{startTime: time.Now()}
+	RunScan(ctx, hosts, portList, ScanOptions{Workers: concurrency, Probe: probe, Labels: hostLabels}, stats, func(r Result) {
+		results = append(results, r)
+	})
+	sortResults(results)
+	return results
+}
+
+// runWatch implements the "watch" subcommand
+func runWatch(args []string) int {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	interval := flags.Duration("interval", 6*time.Hour, "Time between scans")
+	baselineFile := flags.String("baseline", "pscanner-baseline.json", "File holding the open ports from the last scan")
+	webhookURL := flags.String("webhook", "", "URL to POST a JSON alert to when ports change")
+	slackURL := flags.String("slack", "", "Slack incoming webhook URL to notify when ports change")
+	once := flags.Bool("once", false, "Scan once, compare with the baseline and exit with status 5 on changes")
+	addTargetFlags(flags)
+	addProbeFlags(flags)
+	addLogFlags(flags)
+	addConfigFlags(flags)
+	flags.Parse(args)
+	if err := loadSettings(flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	if err := setupLogging(os.Stderr, logLevel, logJSON); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	if !checkProbeFlags() {
+		return exitError
+	}
+
+	hosts, err := CollectHosts()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no targets given (use -h, -hf or -cf)\n")
+		return exitError
+	}
+	if err := resolvePorts(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error %v\n", err)
+		return exitError
+	}
+	portList, err := PortsOrDefault(ports)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing ports: %v\n", err)
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		baseline, err := LoadBaseline(*baselineFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			return exitError
+		}
+
+		slog.Info("scanning", "hosts", len(hosts), "ports", len(portList))
+		results := scanOpenPorts(ctx, hosts, portList, probeConfig)
+		if ctx.Err() != nil {
+			if *once {
+				return exitPartial
+			}
+			return 0
+		}
+
+		// The baseline only moves on once the change has been reported, so an
+		// alert that could not be delivered is raised again by the next scan
+		now := time.Now()
+		changed := false
+		if baseline == nil {
+			slog.Info("recorded baseline", "open", len(results), "file", *baselineFile)
+		} else {
+			opened, closed := diffResults(baseline.Results, results)
+			changed = len(opened) > 0 || len(closed) > 0
+			if changed {
+				alert := ChangeAlert{Time: now, Opened: opened, Closed: closed}
+				fmt.Println(alert.Summary())
+				if err := SendAlert(alert, *webhookURL, *slackURL); err != nil {
+					slog.Error("sending alert; keeping the old baseline", "err", err)
+					if *once {
+						return exitError
+					}
+					if !waitInterval(ctx, *interval) {
+						return 0
+					}
+					continue
+				}
+			} else {
+				slog.Info("no changes", "open", len(results))
+			}
+		}
+		if err := SaveBaseline(*baselineFile, &Baseline{Time: now, Results: results}); err != nil {
+			slog.Error("saving baseline", "file", *baselineFile, "err", err)
+			return exitError
+		}
+
+		if *once {
+			if changed {
+				return exitChanged
+			}
+			return 0
+		}
+		if !waitInterval(ctx, *interval) {
+			return 0
+		}
+	}
+}
+
+// waitInterval sleeps until the next scan is due, reporting false if the
+// watch was stopped first
+func waitInterval(ctx context.Context, interval time.Duration) bool {
+	select {
+	case <-time.After(interval):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffResults(t *testing.T) {
+	r := func(ip string, port int) Result { return Result{Host: ip, IP: ip, Port: port} }
+	flapping := func(answered int) Result {
+		return Result{Host: "10.0.0.1", IP: "10.0.0.1", Port: 80, Answered: answered, Attempts: 5}
+	}
+	named := func(host string) Result { return Result{Host: host, IP: "10.0.0.1", Port: 22} }
+	tests := []struct {
+		name           string
+		previous       []Result
+		current        []Result
+		expectedOpened []Result
+		expectedClosed []Result
+	}{
+		{name: "No changes", previous: []Result{r("10.0.0.1", 22)}, current: []Result{r("10.0.0.1", 22)}},
+		{name: "Port opened", previous: []Result{r("10.0.0.1", 22)}, current: []Result{r("10.0.0.1", 22), r("10.0.0.1", 80)}, expectedOpened: []Result{r("10.0.0.1", 80)}},
+		{name: "Port closed", previous: []Result{r("10.0.0.1", 22), r("10.0.0.2", 443)}, current: []Result{r("10.0.0.1", 22)}, expectedClosed: []Result{r("10.0.0.2", 443)}},
+		{name: "Both, sorted", previous: []Result{r("10.0.0.2", 80), r("10.0.0.1", 80)}, current: []Result{r("10.0.0.3", 25), r("10.0.0.3", 22)}, expectedOpened: []Result{r("10.0.0.3", 22), r("10.0.0.3", 25)}, expectedClosed: []Result{r("10.0.0.1", 80), r("10.0.0.2", 80)}},
+		{name: "First scan", current: []Result{r("10.0.0.1", 22)}, expectedOpened: []Result{r("10.0.0.1", 22)}},
+		{name: "Flapping port answering more often", previous: []Result{flapping(3)}, current: []Result{flapping(4)}},
+		{name: "Host name changed", previous: []Result{named("old.example.com")}, current: []Result{named("new.example.com")}},
+		{name: "Closed ports ignored", previous: []Result{{IP: "10.0.0.1", Port: 23, State: StateClosed}}, current: []Result{r("10.0.0.1", 22)}, expectedOpened: []Result{r("10.0.0.1", 22)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opened, closed := diffResults(tt.previous, tt.current)
+			if !reflect.DeepEqual(opened, tt.expectedOpened) {
+				t.Errorf("diffResults() opened = %v, expected %v", opened, tt.expectedOpened)
+			}
+			if !reflect.DeepEqual(closed, tt.expectedClosed) {
+				t.Errorf("diffResults() closed = %v, expected %v", closed, tt.expectedClosed)
+			}
+		})
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "baseline.json")
+	if b, err := LoadBaseline(filename); b != nil || err != nil {
+		t.Fatalf("LoadBaseline() of a missing file = %v, %v, expected nil, nil", b, err)
+	}
+
+	saved := &Baseline{Time: time.Now().UTC().Truncate(time.Second), Results: []Result{{Host: "example.com", IP: "10.0.0.1", Port: 443}}}
+	if err := SaveBaseline(filename, saved); err != nil {
+		t.Fatalf("SaveBaseline() error = %v", err)
+	}
+	loaded, err := LoadBaseline(filename)
+	if err != nil {
+		t.Fatalf("LoadBaseline() error = %v", err)
+	}
+	if !loaded.Time.Equal(saved.Time) || !reflect.DeepEqual(loaded.Results, saved.Results) {
+		t.Errorf("LoadBaseline() = %+v, expected %+v", loaded, saved)
+	}
+}
+
+func TestSendAlert(t *testing.T) {
+	var webhook ChangeAlert
+	var slack map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/webhook":
+			json.NewDecoder(r.Body).Decode(&webhook)
+		case "/slack":
+			json.NewDecoder(r.Body).Decode(&slack)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	alert := ChangeAlert{
+		Opened: []Result{{Host: "db.example.com", IP: "10.0.0.5", Port: 5432}},
+		Closed: []Result{{Host: "10.0.0.1", IP: "10.0.0.1", Port: 22}},
+	}
+	if err := SendAlert(alert, ts.URL+"/webhook", ts.URL+"/slack"); err != nil {
+		t.Fatalf("SendAlert() error = %v", err)
+	}
+	if len(webhook.Opened) != 1 || webhook.Opened[0].Port != 5432 || len(webhook.Closed) != 1 {
+		t.Errorf("webhook received %+v", webhook)
+	}
+	for _, want := range []string{"1 port(s) opened", "+ db.example.com (10.0.0.5):5432", "- 10.0.0.1:22"} {
+		if !strings.Contains(slack["text"], want) {
+			t.Errorf("slack text %q missing %q", slack["text"], want)
+		}
+	}
+
+	if err := SendAlert(alert, ts.URL+"/missing", ""); err == nil {
+		t.Error("SendAlert() to a failing webhook returned no error")
+	}
+}
+
+func TestRunWatchOnce(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	status := http.StatusInternalServerError
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer hook.Close()
+
+	baselineFile := filepath.Join(t.TempDir(), "baseline.json")
+	if err := SaveBaseline(baselineFile, &Baseline{Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-once", "-baseline", baselineFile, "-webhook", hook.URL, "-h", "127.0.0.1", "-p", port, "-r", "1", "-s", "0", "-log-level", "error"}
+
+	// An undelivered alert leaves the baseline where it was
+	if code := runWatch(args); code != exitError {
+		t.Errorf("runWatch() with failing webhook = %d, expected %d", code, exitError)
+	}
+	if b, _ := LoadBaseline(baselineFile); b == nil || len(b.Results) != 0 {
+		t.Errorf("baseline advanced despite the failed alert: %+v", b)
+	}
+
+	status = http.StatusOK
+	if code := runWatch(args); code != exitChanged {
+		t.Errorf("runWatch() with new port = %d, expected %d", code, exitChanged)
+	}
+	if b, _ := LoadBaseline(baselineFile); b == nil || len(b.Results) != 1 {
+		t.Errorf("baseline not advanced after the alert: %+v", b)
+	}
+	if code := runWatch(args); code != 0 {
+		t.Errorf("runWatch() without changes = %d, expected 0", code)
+	}
+}
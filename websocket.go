@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// webSocketPaths are where WebSocket endpoints are usually found: the site
+// root, the common names, and the paths of Socket.IO, GraphQL subscriptions
+// and Rails Action Cable
+var webSocketPaths = []string{"/", "/ws", "/websocket", "/socket.io/?EIO=4&transport=websocket", "/graphql", "/cable"}
+
+// webSocketGUID is appended to the key of an upgrade request to make the
+// accept value of the reply (RFC 6455)
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocketProber is an enricher that asks HTTP ports for a WebSocket
+// upgrade on the common paths. It closes each connection as soon as it is
+// upgraded, without sending a message.
+type WebSocketProber struct {
+	Timeout time.Duration
+}
+
+// Enrich records the paths of a site that accept a WebSocket upgrade
+func (p WebSocketProber) Enrich(r *Result, probe ProbeConfig) {
+	base := webURL(*r, probe, p.Timeout)
+	u, err := url.Parse(base)
+	if base == "" || err != nil {
+		return
+	}
+	if r.Service == "" {
+		r.Service = u.Scheme
+	}
+	if r.HTTP == nil {
+		r.HTTP = &HTTPInfo{URL: base}
+	}
+	for _, path := range webSocketPaths {
+		if p.upgrade(r.Host, r.Port, probe, u, path) {
+			r.HTTP.WebSockets = append(r.HTTP.WebSockets, path)
+		}
+	}
+}
+
+// upgrade reports whether a path of the site at u switches to the WebSocket
+// protocol, with the accept value that proves it understood the request
+func (p WebSocketProber) upgrade(host string, port int, probe ProbeConfig, u *url.URL, path string) bool {
+	conn, err := probe.Dial(host, port, p.Timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * p.Timeout))
+	if u.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: tlsServerName(host)})
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", path, u.Host, key)
+	if err != nil {
+		return false
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusSwitchingProtocols && resp.Header.Get("Sec-WebSocket-Accept") == webSocketAccept(key)
+}
+
+// webSocketAccept is the Sec-WebSocket-Accept value answering a key
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
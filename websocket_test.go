@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// The example of RFC 6455 section 1.3
+	if got, want := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("webSocketAccept() = %q, expected %q", got, want)
+	}
+}
+
+func TestWebSocketProber(t *testing.T) {
+	upgrade := func(accept func(key string) string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") != "websocket" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+				http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Upgrade", "websocket")
+			w.Header().Set("Connection", "Upgrade")
+			w.Header().Set("Sec-WebSocket-Accept", accept(r.Header.Get("Sec-WebSocket-Key")))
+			w.WriteHeader(http.StatusSwitchingProtocols)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", http.NotFound)
+	mux.Handle("/ws", upgrade(webSocketAccept))
+	mux.Handle("/cable", upgrade(webSocketAccept))
+	// Switches protocols without having understood the key
+	mux.Handle("/websocket", upgrade(func(string) string { return "bogus" }))
+
+	port := func(srv *httptest.Server) int {
+		u, _ := url.Parse(srv.URL)
+		p, _ := strconv.Atoi(u.Port())
+		return p
+	}
+	for _, srv := range []*httptest.Server{httptest.NewServer(mux), httptest.NewTLSServer(mux)} {
+		defer srv.Close()
+		r := Result{Host: "127.0.0.1", Port: port(srv)}
+		WebSocketProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+		if r.HTTP == nil || !slices.Equal(r.HTTP.WebSockets, []string{"/ws", "/cable"}) {
+			t.Errorf("Enrich(%s) http = %+v, expected WebSockets on /ws and /cable", srv.URL, r.HTTP)
+		}
+	}
+
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+	r := Result{Host: "127.0.0.1", Port: port(plain), Service: "http"}
+	WebSocketProber{Timeout: time.Second}.Enrich(&r, ProbeConfig{})
+	if r.HTTP == nil || r.HTTP.WebSockets != nil {
+		t.Errorf("Enrich() http = %+v, expected a site without WebSockets", r.HTTP)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// linkZone is the -zone flag
+var linkZone string
+
+// splitZone splits an address such as "fe80::1%eth0" into the address and
+// its zone, which is empty when there is none
+func splitZone(host string) (addr, zone string) {
+	addr, zone, _ = strings.Cut(host, "%")
+	return addr, zone
+}
+
+// parseHostIP parses a target that is an IP address, with or without a
+// zone, returning nil for names
+func parseHostIP(host string) net.IP {
+	addr, _ := splitZone(host)
+	return net.ParseIP(addr)
+}
+
+// needsZone reports whether host is an IPv6 link-local address without a
+// zone, which can't be dialed: every interface has the same fe80::/10
+func needsZone(host string) bool {
+	ip := parseHostIP(host)
+	_, zone := splitZone(host)
+	return ip != nil && ip.To4() == nil && ip.IsLinkLocalUnicast() && zone == ""
+}
+
+// checkZone verifies that a zone names an interface of this machine, by
+// name or by index
+func checkZone(zone string) error {
+	if index, err := strconv.Atoi(zone); err == nil {
+		if _, err := net.InterfaceByIndex(index); err != nil {
+			return fmt.Errorf("zone %s: no interface with that index", zone)
+		}
+		return nil
+	}
+	if _, err := net.InterfaceByName(zone); err != nil {
+		return fmt.Errorf("zone %s: no such interface (have %s)", zone, interfaceNames())
+	}
+	return nil
+}
+
+// ApplyZone gives the IPv6 link-local targets without a zone the zone given
+// with -zone, carrying their labels over. Without one they can't be probed
+// and are returned as skipped, as are targets whose zone is not an interface
+// of this machine.
+func ApplyZone(hosts []string, zone string) (kept []string, skipped []SkippedTarget) {
+	kept = hosts[:0:0]
+	zoneErrs := make(map[string]error)
+	for _, h := range hosts {
+		if _, given := splitZone(h); given != "" && parseHostIP(h) != nil {
+			err, checked := zoneErrs[given]
+			if !checked {
+				err = checkZone(given)
+				zoneErrs[given] = err
+			}
+			if err != nil {
+				skipped = append(skipped, SkippedTarget{Target: h, Err: err})
+				continue
+			}
+		}
+		if !needsZone(h) {
+			kept = append(kept, h)
+			continue
+		}
+		if zone == "" {
+			skipped = append(skipped, SkippedTarget{Target: h,
+				Err: fmt.Errorf("link-local address needs a zone, such as %s%%eth0, or -zone", h)})
+			continue
+		}
+		zoned := h + "%" + zone
+		addLabels(hostLabels, zoned, hostLabels[h])
+		kept = append(kept, zoned)
+	}
+	return kept, skipped
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestNeedsZone(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"fe80::1", true},
+		{"fe80::1%eth0", false},
+		{"2001:db8::1", false},
+		{"169.254.1.1", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := needsZone(tt.host); got != tt.expected {
+			t.Errorf("needsZone(%q) = %v, expected %v", tt.host, got, tt.expected)
+		}
+	}
+}
+
+func TestApplyZone(t *testing.T) {
+	loopback := "lo"
+	if runtime.GOOS != "linux" {
+		loopback = "lo0"
+	}
+	saved := hostLabels
+	defer func() { hostLabels = saved }()
+	hostLabels = map[string]map[string]string{"fe80::1": {"segment": "lab"}}
+
+	hosts := []string{"fe80::1", "10.0.0.1", "fe80::2%" + loopback, "fe80::3%nosuch0"}
+	kept, skipped := ApplyZone(hosts, "")
+	if expected := []string{"10.0.0.1", "fe80::2%" + loopback}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("ApplyZone() without -zone = %v, expected %v", kept, expected)
+	}
+	if len(skipped) != 2 || skipped[0].Target != "fe80::1" || skipped[1].Target != "fe80::3%nosuch0" {
+		t.Errorf("ApplyZone() skipped %v, expected the unzoned address and the unknown zone", skipped)
+	}
+
+	kept, _ = ApplyZone(hosts, loopback)
+	if expected := []string{"fe80::1%" + loopback, "10.0.0.1", "fe80::2%" + loopback}; !reflect.DeepEqual(kept, expected) {
+		t.Errorf("ApplyZone() with -zone = %v, expected %v", kept, expected)
+	}
+	if hostLabels["fe80::1%"+loopback]["segment"] != "lab" {
+		t.Errorf("labels = %v, expected those of the address carried over", hostLabels)
+	}
+}
+
+func TestExpandCIDRZone(t *testing.T) {
+	ips, err := ExpandCIDR("fe80::/126%eth0", false)
+	if expected := []string{"fe80::%eth0", "fe80::1%eth0", "fe80::2%eth0", "fe80::3%eth0"}; err != nil || !reflect.DeepEqual(ips, expected) {
+		t.Errorf("ExpandCIDR() = %v, %v; expected %v", ips, err, expected)
+	}
+	if _, err := ExpandCIDR("10.0.0.0/30%eth0", false); err == nil {
+		t.Error("ExpandCIDR() accepted a zone on an IPv4 range")
+	}
+	if err := validateCIDR("fe80::/120%eth0"); err != nil {
+		t.Errorf("validateCIDR() error = %v", err)
+	}
+	// A /64 has 2^64 addresses and would never finish expanding
+	if err := validateCIDR("fe80::/64%eth0"); err == nil {
+		t.Error("validateCIDR() accepted a /64")
+	}
+	if _, err := ExpandCIDR("fe80::/64%lo", false); err == nil {
+		t.Error("ExpandCIDR() accepted a /64")
+	}
+}
+
+func TestResolveHostsZone(t *testing.T) {
+	saved := lookupHost
+	defer func() { lookupHost = saved }()
+	lookupHost = func(ctx context.Context, name string) ([]string, error) {
+		return nil, errors.New("unexpected lookup of " + name)
+	}
+	hosts, _, unresolved := ResolveHosts(context.Background(), []string{"fe80::1%eth0", "fe80::1%eth1", "fe80::1%eth0"}, 1, "tcp", false)
+	if expected := []string{"fe80::1%eth0", "fe80::1%eth1"}; !reflect.DeepEqual(hosts, expected) || len(unresolved) > 0 {
+		t.Errorf("ResolveHosts() = %v, %v; expected the zoned addresses kept apart", hosts, unresolved)
+	}
+}